@@ -0,0 +1,4250 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/csv"
+	"encoding/hex"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"os/exec"
+	"os/signal"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+	"unicode/utf8"
+
+	"golang.org/x/crypto/pbkdf2"
+	"golang.org/x/crypto/scrypt"
+)
+
+// Структура заметки
+type Note struct {
+	ID        int        `json:"id"`
+	Title     string     `json:"title,omitempty"` // Заголовок; без него используется первая строка
+	Content   string     `json:"content"`
+	CreatedAt time.Time  `json:"created_at"`
+	UpdatedAt time.Time  `json:"updated_at"`
+	Tags      []string   `json:"tags,omitempty"`       // Теги в нижнем регистре, без "#"
+	Due       *time.Time `json:"due,omitempty"`        // Срок (полночь дня по местному времени)
+	DeletedAt *time.Time `json:"deleted_at,omitempty"` // Время перемещения в корзину
+	Pinned    bool       `json:"pinned,omitempty"`     // Закреплена: выводится в начале списка
+	Done      bool       `json:"done,omitempty"`       // Выполнена
+	Notified  bool       `json:"notified,omitempty"`   // Напоминание о сроке уже отправлено (daylist remind)
+	Snoozed   int        `json:"snoozed,omitempty"`    // Сколько раз срок откладывался (daylist snooze)
+	RemoteID  int        `json:"remote_id,omitempty"`  // ID задачи на сервере (daylist sync)
+	SyncHash  string     `json:"sync_hash,omitempty"`  // Отпечаток заметки при последней синхронизации
+	SyncedAt  *time.Time `json:"synced_at,omitempty"`  // Время последней синхронизации
+
+	Attachments []attachment `json:"attachments,omitempty"` // Прикреплённые файлы
+	Links       []int        `json:"links,omitempty"`       // ID связанных заметок (связь двусторонняя)
+
+	Repeat     *repeatRule `json:"repeat,omitempty"`      // Правило повторения (только у шаблонов)
+	TemplateID int         `json:"template_id,omitempty"` // Шаблон, по которому создана заметка
+}
+
+// Отметка выполненной заметки
+const doneMark = "✓"
+
+// Отметка закреплённой заметки
+const pinMark = "📌"
+
+// Содержимое файла заметок. Старые файлы — просто массив заметок без корзины
+// и счётчика ID.
+type notesData struct {
+	Version int    `json:"version"`
+	NextID  int    `json:"next_id"` // ID следующей заметки; ID никогда не используются повторно
+	Notes   []Note `json:"notes"`
+	Trash   []Note `json:"trash,omitempty"`
+	Repeats []Note `json:"repeats,omitempty"` // Шаблоны повторяющихся заметок
+}
+
+// Версия формата файла заметок
+const notesVersion = 1
+
+// stringList — повторяемый строковый флаг (--tag=a --tag=b)
+type stringList []string
+
+func (l *stringList) String() string { return strings.Join(*l, ",") }
+
+func (l *stringList) Set(value string) error {
+	*l = append(*l, value)
+	return nil
+}
+
+var notes []Note
+
+// ID следующей новой заметки
+var nextNoteID = 1
+
+// Заметки в корзине
+var trash []Note
+
+// Шаблоны повторяющихся заметок
+var repeats []Note
+
+// Код выхода после сохранения заметок (remind сообщает им о найденных сроках)
+var exitCode int
+
+// Вывод в JSON вместо текста (глобальный флаг --json)
+var jsonOutput bool
+
+// Функция вывода ошибки и завершения с кодом 1; с --json ошибка
+// выводится в stderr объектом {"error": "..."}
+func fail(format string, args ...interface{}) {
+	msg := fmt.Sprintf(format, args...)
+	if jsonOutput {
+		data, _ := json.Marshal(map[string]string{"error": msg})
+		fmt.Fprintln(os.Stderr, string(data))
+	} else {
+		fmt.Println(msg)
+	}
+	exit(1)
+}
+
+// Функция вывода заметок массивом JSON в stdout
+func printJSON(list []Note) {
+	if list == nil {
+		list = []Note{}
+	}
+	data, err := json.MarshalIndent(list, "", "  ")
+	if err != nil {
+		fail("Ошибка формирования JSON: %v", err)
+	}
+	fmt.Println(string(data))
+}
+
+// Значение глобального флага --color
+var colorMode string
+
+// Функция извлечения глобальных флагов --json и --color=... из аргументов
+func extractGlobalFlags(args []string) []string {
+	var rest []string
+	for _, arg := range args {
+		if arg == "--json" || arg == "-json" {
+			jsonOutput = true
+			continue
+		}
+		if value, ok := strings.CutPrefix(arg, "--color="); ok {
+			colorMode = value
+			continue
+		}
+		rest = append(rest, arg)
+	}
+	return rest
+}
+
+// Основной файл хранения заметок
+const notesFile = "notes.json"
+
+// Файл блокировки заметок. Блокируется он, а не notes.json: тот при
+// сохранении заменяется новым файлом, и блокировка осталась бы на старом
+const lockFile = notesFile + ".lock"
+
+// Сколько ждать, пока другой процесс daylist освободит заметки
+const lockWait = 5 * time.Second
+
+// Команды, которые только читают заметки: им хватает общей блокировки,
+// и изменения при загрузке (очистка корзины, повторения) они не сохраняют
+var readOnlyCommands = map[string]bool{
+	"list": true, "days": true, "show": true, "search": true, "agenda": true,
+	"tags": true, "export": true, "stats": true, "_ids": true,
+}
+
+// Функция снятия блокировки; заменяется при её получении
+var unlock = func() {}
+
+// Функция выхода с кодом code со снятием блокировки
+func exit(code int) {
+	unlock()
+	os.Exit(code)
+}
+
+// Ошибка: заметки заняты другим процессом
+var errLocked = fmt.Errorf("заметки заняты другим процессом daylist (%s), повторите позже", lockFile)
+
+// Функция проверки перед сохранением, что блокировка всё ещё у этого процесса;
+// заменяется при получении блокировки файлом-меткой
+var checkLock = func() error { return nil }
+
+// Функция блокировки файлом-меткой: он создаётся только если его нет (O_EXCL).
+// В метке — PID процесса и время её создания, так что две метки одного PID
+// различаются. Метку завершившегося процесса нельзя просто удалить: два процесса
+// могут одновременно прочитать одну устаревшую метку, и второй удалил бы свежую
+// метку первого. Поэтому она забирается takeOverMarker. Блокировка заметок
+// (lockNotes) — в lock_unix.go и lock_other.go.
+func lockWithMarker(deadline time.Time) error {
+	marker := lockFile + ".pid"
+	own := fmt.Sprintf("%d %d", os.Getpid(), time.Now().UnixNano())
+	for {
+		f, err := os.OpenFile(marker, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0644)
+		if err == nil {
+			_, err = f.WriteString(own)
+			if closeErr := f.Close(); err == nil {
+				err = closeErr
+			}
+			if err != nil {
+				os.Remove(marker)
+				return err
+			}
+			unlock = func() {
+				if ownsMarker(marker, own) {
+					os.Remove(marker)
+				}
+			}
+			checkLock = func() error {
+				if !ownsMarker(marker, own) {
+					return fmt.Errorf("блокировку заметок (%s) перехватил другой процесс daylist, изменения не сохранены", marker)
+				}
+				return nil
+			}
+			return nil
+		}
+		if !os.IsExist(err) {
+			return err
+		}
+		if _, ok := staleMarker(marker); ok && takeOverMarker(marker) {
+			continue
+		}
+		if time.Now().After(deadline) {
+			return errLocked
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+}
+
+// Функция чтения метки: её содержимое и признак того, что процесс, создавший её,
+// уже завершился. Пустая метка (процесс ещё не записал PID) не считается устаревшей
+func staleMarker(marker string) (string, bool) {
+	data, err := ioutil.ReadFile(marker)
+	if err != nil {
+		return "", false
+	}
+	fields := strings.Fields(string(data))
+	if len(fields) == 0 {
+		return "", false
+	}
+	pid, err := strconv.Atoi(fields[0])
+	return string(data), err == nil && !processExists(pid)
+}
+
+// Функция проверки, что метка по-прежнему та, что создал этот процесс
+func ownsMarker(marker, own string) bool {
+	data, err := ioutil.ReadFile(marker)
+	return err == nil && string(data) == own
+}
+
+// Файл-метка, поставленная дольше этого срока назад, считается брошенной
+// упавшим процессом; сам захват длится мгновения
+const takeoverGuardAge = 10 * time.Second
+
+// Функция захвата устаревшей метки. Захватом занимается один процесс за раз: он
+// держит вспомогательную метку .takeover (O_EXCL), поэтому живую метку, созданную
+// между чтением и переименованием, никто не заберёт. Под ней устаревшая метка
+// перечитывается, атомарно переименовывается в файл этого процесса, и PID в ней
+// проверяется ещё раз; если метка оказалась живой, она возвращается на место
+// (O_EXCL, чтобы не затереть чужую). Возвращает false, если захватом занят другой
+// процесс
+func takeOverMarker(marker string) bool {
+	guard := marker + ".takeover"
+	g, err := os.OpenFile(guard, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0644)
+	if err != nil {
+		if info, statErr := os.Stat(guard); statErr == nil && time.Since(info.ModTime()) > takeoverGuardAge {
+			os.Remove(guard)
+		}
+		return false
+	}
+	g.Close()
+	defer os.Remove(guard)
+	stale, ok := staleMarker(marker)
+	if !ok {
+		return true
+	}
+	claimed := fmt.Sprintf("%s.%d", marker, os.Getpid())
+	if os.Rename(marker, claimed) != nil {
+		return true
+	}
+	defer os.Remove(claimed)
+	data, err := ioutil.ReadFile(claimed)
+	if err != nil || string(data) == stale {
+		return true
+	}
+	if f, err := os.OpenFile(marker, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0644); err == nil {
+		f.Write(data)
+		f.Close()
+	}
+	return true
+}
+
+// Предыдущая версия файла заметок, обновляется при каждом сохранении
+const backupFile = notesFile + ".bak"
+
+// Заметки изменены командой и должны быть сохранены
+var changed bool
+
+// Функция загрузки файла
+func loadNotes() error {
+	data, err := ioutil.ReadFile(notesFile)
+	if err != nil {
+		if os.IsNotExist(err) {
+			notes = []Note{}
+			return nil
+		}
+		return err
+	}
+	data, err = decodeNotesFile(data)
+	if err != nil {
+		return err
+	}
+	parsed, err := parseNotes(data)
+	if err != nil {
+		return fmt.Errorf("файл %s повреждён (%v); предыдущая версия сохранена в %s, "+
+			"восстановить её: daylist restore", notesFile, err, backupFile)
+	}
+	if parsed.Version > notesVersion {
+		return fmt.Errorf("файл %s создан более новой версией DayList (формат %d)", notesFile, parsed.Version)
+	}
+	notes, trash, repeats = parsed.Notes, parsed.Trash, parsed.Repeats
+	if notes == nil {
+		notes = []Note{}
+	}
+	// В старых файлах счётчика нет: продолжаем после наибольшего известного ID
+	nextNoteID = parsed.NextID
+	for _, list := range [][]Note{notes, trash, repeats} {
+		for i, note := range list {
+			if note.ID >= nextNoteID {
+				nextNoteID = note.ID + 1
+			}
+			// В старых файлах времени изменения нет
+			if note.UpdatedAt.IsZero() {
+				list[i].UpdatedAt = note.CreatedAt
+			}
+		}
+	}
+	return nil
+}
+
+// Функция разбора файла заметок в новом (объект) или старом (массив) формате
+func parseNotes(data []byte) (notesData, error) {
+	var parsed notesData
+	if trimmed := bytes.TrimSpace(data); len(trimmed) > 0 && trimmed[0] == '[' {
+		err := json.Unmarshal(data, &parsed.Notes)
+		return parsed, err
+	}
+	err := json.Unmarshal(data, &parsed)
+	return parsed, err
+}
+
+// Функция атомарной записи файла: данные пишутся во временный файл рядом
+// и переименовываются, поэтому прерванная запись не портит файл
+func writeFileAtomic(path string, data []byte) error {
+	tmp, err := ioutil.TempFile(filepath.Dir(path), filepath.Base(path)+".tmp*")
+	if err != nil {
+		return err
+	}
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := os.Chmod(tmp.Name(), 0644); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	return nil
+}
+
+// Функция сохранения файла; прежнее содержимое остаётся в notes.json.bak
+func saveNotes() error {
+	if err := checkLock(); err != nil {
+		return err
+	}
+	data, err := json.MarshalIndent(notesData{Version: notesVersion, NextID: nextNoteID, Notes: notes, Trash: trash, Repeats: repeats}, "", "  ")
+	if err != nil {
+		return err
+	}
+	if encryption != nil {
+		if data, err = encryption.seal(data); err != nil {
+			return fmt.Errorf("ошибка шифрования: %v", err)
+		}
+	}
+	if old, err := ioutil.ReadFile(notesFile); err == nil {
+		if err := writeFileAtomic(backupFile, old); err != nil {
+			return fmt.Errorf("ошибка записи резервной копии: %v", err)
+		}
+	}
+	return writeFileAtomic(notesFile, data)
+}
+
+// Функция восстановления заметок из notes.json.bak. Текущий файл
+// (например, повреждённый) сохраняется как notes.json.broken.
+func restoreBackup() error {
+	data, err := ioutil.ReadFile(backupFile)
+	if err != nil {
+		return fmt.Errorf("резервная копия недоступна: %v", err)
+	}
+	plain, err := decodeNotesFile(data)
+	if err != nil {
+		return err
+	}
+	restored, err := parseNotes(plain)
+	if err != nil {
+		return fmt.Errorf("резервная копия %s тоже повреждена: %v", backupFile, err)
+	}
+	if current, err := ioutil.ReadFile(notesFile); err == nil {
+		if err := writeFileAtomic(notesFile+".broken", current); err != nil {
+			return err
+		}
+	}
+	if err := writeFileAtomic(notesFile, data); err != nil {
+		return err
+	}
+	fmt.Printf("Восстановлено заметок: %d из %s\n", len(restored.Notes), backupFile)
+	return nil
+}
+
+// Признак зашифрованного файла заметок
+const encryptedFormat = "daylist-encrypted"
+
+// Параметры scrypt при шифровании: 32 МБ памяти, около 0,1 с на телефоне
+const (
+	scryptN = 1 << 15
+	scryptR = 8
+	scryptP = 1
+)
+
+// Зашифрованный файл заметок: заголовок с версией и параметрами ключа
+// и шифротекст AES-256-GCM (все двоичные поля в base64). Версия 2 — ключ
+// scrypt (n, r, p); версия 1 — PBKDF2-SHA256 (iterations), такие файлы
+// читаются и сохраняются в своей версии до нового encrypt.
+type encryptedFile struct {
+	Format     string `json:"format"`
+	Version    int    `json:"version"`
+	KDF        string `json:"kdf"`
+	N          int    `json:"n,omitempty"`
+	R          int    `json:"r,omitempty"`
+	P          int    `json:"p,omitempty"`
+	Iterations int    `json:"iterations,omitempty"`
+	Salt       []byte `json:"salt"`
+	Nonce      []byte `json:"nonce"`
+	Ciphertext []byte `json:"ciphertext"`
+}
+
+// Ключ шифрования открытого файла; nil — файл хранится открытым текстом
+type encryptionKey struct {
+	key    []byte
+	header encryptedFile // Версия, KDF, параметры и соль без nonce и шифротекста
+}
+
+var encryption *encryptionKey
+
+// Функция проверки, зашифрован ли файл заметок
+func isEncrypted(data []byte) (encryptedFile, bool) {
+	var env encryptedFile
+	if json.Unmarshal(data, &env) != nil || env.Format != encryptedFormat {
+		return env, false
+	}
+	return env, true
+}
+
+// Функция получения ключа из парольной фразы по KDF и параметрам заголовка.
+// Параметры ограничены, чтобы чужой файл не занял всю память.
+func deriveKey(passphrase string, header encryptedFile) (*encryptionKey, error) {
+	header.Nonce, header.Ciphertext = nil, nil
+	var key []byte
+	switch {
+	case header.Version == 2 && header.KDF == "scrypt":
+		if header.N > 1<<20 || header.R > 32 || header.P > 16 {
+			return nil, fmt.Errorf("слишком большие параметры scrypt: n=%d r=%d p=%d", header.N, header.R, header.P)
+		}
+		var err error
+		if key, err = scrypt.Key([]byte(passphrase), header.Salt, header.N, header.R, header.P, 32); err != nil {
+			return nil, err
+		}
+	case header.Version == 1 && header.KDF == "pbkdf2-sha256":
+		if header.Iterations < 1 || header.Iterations > 10000000 {
+			return nil, fmt.Errorf("неверное число итераций PBKDF2: %d", header.Iterations)
+		}
+		key = pbkdf2.Key([]byte(passphrase), header.Salt, header.Iterations, 32, sha256.New)
+	default:
+		return nil, fmt.Errorf("неподдерживаемая версия шифрования: %d (%s)", header.Version, header.KDF)
+	}
+	return &encryptionKey{key: key, header: header}, nil
+}
+
+// Функция создания ключа scrypt со случайной солью
+func newEncryptionKey(passphrase string) (*encryptionKey, error) {
+	salt := make([]byte, 16)
+	if _, err := rand.Read(salt); err != nil {
+		return nil, err
+	}
+	return deriveKey(passphrase, encryptedFile{
+		Format: encryptedFormat, Version: 2, KDF: "scrypt",
+		N: scryptN, R: scryptR, P: scryptP, Salt: salt,
+	})
+}
+
+// Функция проверки, что файл зашифрован этим же ключом (та же соль и параметры)
+func (k *encryptionKey) matches(env encryptedFile) bool {
+	h := k.header
+	return bytes.Equal(env.Salt, h.Salt) && env.Version == h.Version && env.KDF == h.KDF &&
+		env.N == h.N && env.R == h.R && env.P == h.P && env.Iterations == h.Iterations
+}
+
+// Функция шифрования содержимого файла заметок (новый nonce при каждом сохранении)
+func (k *encryptionKey) seal(plain []byte) ([]byte, error) {
+	gcm, err := newGCM(k.key)
+	if err != nil {
+		return nil, err
+	}
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+	env := k.header
+	env.Format, env.Nonce = encryptedFormat, nonce
+	env.Ciphertext = gcm.Seal(nil, nonce, plain, []byte(encryptedFormat))
+	return json.MarshalIndent(env, "", "  ")
+}
+
+// Функция расшифровки файла заметок; неверная фраза даёт ошибку, файл не меняется
+func openEncrypted(env encryptedFile, passphrase string) ([]byte, *encryptionKey, error) {
+	key, err := deriveKey(passphrase, env)
+	if err != nil {
+		return nil, nil, err
+	}
+	plain, err := key.open(env)
+	if err != nil {
+		return nil, nil, err
+	}
+	return plain, key, nil
+}
+
+// Функция расшифровки содержимого уже полученным ключом
+func (k *encryptionKey) open(env encryptedFile) ([]byte, error) {
+	gcm, err := newGCM(k.key)
+	if err != nil {
+		return nil, err
+	}
+	if len(env.Nonce) != gcm.NonceSize() {
+		return nil, fmt.Errorf("повреждён заголовок шифрования")
+	}
+	plain, err := gcm.Open(nil, env.Nonce, env.Ciphertext, []byte(encryptedFormat))
+	if err != nil {
+		return nil, fmt.Errorf("неверная парольная фраза или файл повреждён")
+	}
+	return plain, nil
+}
+
+// Функция создания шифра AES-GCM
+func newGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// Общий буферизованный stdin: отдельные bufio.Reader на каждый запрос забирали бы
+// в свой буфер следующие строки перенаправленного ввода (printf 'pw\npw\n' | ...)
+var stdin = bufio.NewReader(os.Stdin)
+
+// Функция чтения парольной фразы: из DAYLIST_PASSPHRASE или с терминала без эха
+func readPassphrase(prompt string) (string, error) {
+	if env, ok := os.LookupEnv("DAYLIST_PASSPHRASE"); ok {
+		return env, nil
+	}
+	fmt.Fprint(os.Stderr, prompt)
+	// stty есть и в Termux; если его нет, фраза просто будет видна при вводе
+	echoOff := exec.Command("stty", "-echo")
+	echoOff.Stdin = os.Stdin
+	if echoOff.Run() == nil {
+		defer func() {
+			echoOn := exec.Command("stty", "echo")
+			echoOn.Stdin = os.Stdin
+			echoOn.Run()
+			fmt.Fprintln(os.Stderr)
+		}()
+	}
+	line, err := stdin.ReadString('\n')
+	if err != nil && line == "" {
+		return "", fmt.Errorf("парольная фраза не введена")
+	}
+	return strings.TrimRight(line, "\r\n"), nil
+}
+
+// Функция расшифровки файла заметок, если он зашифрован; запоминает ключ
+// для повторного шифрования при сохранении
+func decodeNotesFile(data []byte) ([]byte, error) {
+	env, ok := isEncrypted(data)
+	if !ok {
+		return data, nil
+	}
+	// Архивы шифруются ключом notes.json, и фраза повторно не спрашивается
+	if encryption != nil && encryption.matches(env) {
+		return encryption.open(env)
+	}
+	passphrase, err := readPassphrase("Парольная фраза: ")
+	if err != nil {
+		return nil, err
+	}
+	plain, key, err := openEncrypted(env, passphrase)
+	if err != nil {
+		return nil, err
+	}
+	encryption = key
+	return plain, nil
+}
+
+// Каталог архивов по месяцам рядом с notes.json
+const archiveDir = "archive"
+
+// Функция пути к архиву месяца вида archive/notes-2023-12.json
+func archivePath(month string) string {
+	return filepath.Join(archiveDir, "notes-"+month+".json")
+}
+
+// Функция чтения архива месяца; отсутствующий архив — пустой список
+func readArchive(path string) ([]Note, error) {
+	data, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	plain, err := decodeNotesFile(data)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", path, err)
+	}
+	var list []Note
+	if err := json.Unmarshal(plain, &list); err != nil {
+		return nil, fmt.Errorf("архив %s повреждён: %v", path, err)
+	}
+	return list, nil
+}
+
+// Функция записи архива месяца; при включённом шифровании он шифруется
+// тем же ключом, что и notes.json
+func writeArchive(path string, list []Note) error {
+	sort.Slice(list, func(i, j int) bool { return list[i].ID < list[j].ID })
+	data, err := json.MarshalIndent(list, "", "  ")
+	if err != nil {
+		return err
+	}
+	if encryption != nil {
+		if data, err = encryption.seal(data); err != nil {
+			return fmt.Errorf("ошибка шифрования: %v", err)
+		}
+	}
+	if err := os.MkdirAll(archiveDir, 0755); err != nil {
+		return err
+	}
+	return writeFileAtomic(path, data)
+}
+
+// Функция чтения архивных заметок: за месяц month (2023-12) или за все месяцы
+func loadArchives(month string) ([]Note, error) {
+	if month != "" {
+		if _, err := time.Parse("2006-01", month); err != nil {
+			return nil, fmt.Errorf("--month: ожидается месяц вида 2023-12, получено %q", month)
+		}
+		return readArchive(archivePath(month))
+	}
+	paths, err := filepath.Glob(archivePath("*"))
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(paths)
+	var all []Note
+	for _, path := range paths {
+		list, err := readArchive(path)
+		if err != nil {
+			return nil, err
+		}
+		all = append(all, list...)
+	}
+	return all, nil
+}
+
+// Функция переноса заметок, созданных до before, в архивы по месяцам создания.
+// Архивы записываются сразу, а notes.json — после команды, как обычно.
+func archiveNotes(before time.Time) {
+	byMonth := make(map[string][]Note)
+	var kept []Note
+	for _, note := range notes {
+		if note.CreatedAt.Before(before) {
+			month := note.CreatedAt.Local().Format("2006-01")
+			byMonth[month] = append(byMonth[month], note)
+		} else {
+			kept = append(kept, note)
+		}
+	}
+	if len(byMonth) == 0 {
+		fmt.Println("Заметок для архивации нет.")
+		return
+	}
+	months := make([]string, 0, len(byMonth))
+	for month := range byMonth {
+		months = append(months, month)
+	}
+	sort.Strings(months)
+	for _, month := range months {
+		path := archivePath(month)
+		list, err := readArchive(path)
+		if err != nil {
+			fail("Ошибка чтения архива: %v", err)
+		}
+		if err := writeArchive(path, append(list, byMonth[month]...)); err != nil {
+			fail("Ошибка записи архива %s: %v", path, err)
+		}
+		fmt.Printf("%s: заметок %d\n", path, len(byMonth[month]))
+	}
+	fmt.Printf("В архив перенесено заметок: %d\n", len(notes)-len(kept))
+	notes = kept
+	if notes == nil {
+		notes = []Note{}
+	}
+	changed = true
+}
+
+// Функция возврата заметок из архива в notes.json под прежними ID. Если ID
+// уже занят, заметка остаётся в архиве, а конфликт сообщается. notes.json
+// сохраняется раньше архивов: при сбое заметка окажется в обоих местах, но не пропадёт.
+func unarchiveNotes(ids []int) {
+	wanted := make(map[int]bool)
+	for _, id := range ids {
+		wanted[id] = true
+	}
+	paths, err := filepath.Glob(archivePath("*"))
+	if err != nil {
+		fail("%v", err)
+	}
+	sort.Strings(paths)
+	conflicts := 0
+	rewrite := make(map[string][]Note)
+	for _, path := range paths {
+		list, err := readArchive(path)
+		if err != nil {
+			fail("Ошибка чтения архива: %v", err)
+		}
+		var kept []Note
+		moved := false
+		for _, note := range list {
+			if !wanted[note.ID] {
+				kept = append(kept, note)
+				continue
+			}
+			delete(wanted, note.ID)
+			if idTaken(note.ID) {
+				fmt.Printf("ID %d уже занят другой заметкой, заметка оставлена в %s.\n", note.ID, path)
+				conflicts++
+				kept = append(kept, note)
+				continue
+			}
+			notes = append(notes, note)
+			moved = true
+			changed = true
+			fmt.Printf("Заметка с ID %d возвращена из архива.\n", note.ID)
+		}
+		if moved {
+			rewrite[path] = kept
+		}
+	}
+	if len(rewrite) > 0 {
+		if err := saveNotes(); err != nil {
+			fail("Ошибка сохранения заметок: %v", err)
+		}
+	}
+	for path, kept := range rewrite {
+		if len(kept) == 0 {
+			err = os.Remove(path)
+		} else {
+			err = writeArchive(path, kept)
+		}
+		if err != nil {
+			fail("Ошибка записи архива %s: %v", path, err)
+		}
+	}
+	for _, id := range ids {
+		if wanted[id] {
+			fmt.Printf("Заметки с ID %d в архиве нет.\n", id)
+			conflicts++
+		}
+	}
+	if conflicts > 0 {
+		exitCode = 1
+	}
+}
+
+// Функция проверки, занят ли ID заметкой, корзиной или шаблоном
+func idTaken(id int) bool {
+	for _, list := range [][]Note{notes, trash, repeats} {
+		for _, note := range list {
+			if note.ID == id {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// Функция включения шифрования файла заметок
+func encryptNotes() {
+	if encryption != nil {
+		fail("Файл %s уже зашифрован.", notesFile)
+	}
+	first, err := readPassphrase("Новая парольная фраза: ")
+	if err != nil {
+		fail("%v", err)
+	}
+	if _, fromEnv := os.LookupEnv("DAYLIST_PASSPHRASE"); !fromEnv {
+		second, err := readPassphrase("Повторите парольную фразу: ")
+		if err != nil {
+			fail("%v", err)
+		}
+		if first != second {
+			fail("Парольные фразы не совпадают.")
+		}
+	}
+	if first == "" {
+		fail("Парольная фраза не может быть пустой.")
+	}
+	key, err := newEncryptionKey(first)
+	if err != nil {
+		fail("Ошибка создания ключа: %v", err)
+	}
+	encryption = key
+	changed = true
+	fmt.Printf("Файл %s будет зашифрован.\n", notesFile)
+}
+
+// Функция шифрования архивов и резервных копий очистки (notes.json.*.bak),
+// оставшихся открытым текстом, ключом notes.json. Вызывается после сохранения
+// зашифрованного notes.json; возвращает пути зашифрованных файлов.
+func sealPlainFiles() ([]string, error) {
+	archives, err := filepath.Glob(archivePath("*"))
+	if err != nil {
+		return nil, err
+	}
+	backups, err := filepath.Glob(notesFile + ".*.bak")
+	if err != nil {
+		return nil, err
+	}
+	var sealed []string
+	for _, path := range append(archives, backups...) {
+		data, err := ioutil.ReadFile(path)
+		if err != nil {
+			return sealed, err
+		}
+		if _, ok := isEncrypted(data); ok {
+			continue
+		}
+		if data, err = encryption.seal(data); err != nil {
+			return sealed, fmt.Errorf("ошибка шифрования %s: %v", path, err)
+		}
+		if err := writeFileAtomic(path, data); err != nil {
+			return sealed, err
+		}
+		sealed = append(sealed, path)
+	}
+	return sealed, nil
+}
+
+// Функция отключения шифрования файла заметок
+func decryptNotes() {
+	if encryption == nil {
+		fail("Файл %s не зашифрован.", notesFile)
+	}
+	encryption = nil
+	changed = true
+	fmt.Printf("Файл %s будет сохранён открытым текстом.\n", notesFile)
+}
+
+// Функция выделения хэштегов (#work, #дом) из текста заметки
+func extractTags(content string) []string {
+	var tags []string
+	for _, word := range strings.Fields(content) {
+		if !strings.HasPrefix(word, "#") {
+			continue
+		}
+		// Знаки препинания в конце слова ("#work,") в тег не входят
+		tag := strings.TrimRightFunc(word[1:], func(r rune) bool {
+			return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+		})
+		if tag != "" && !strings.ContainsRune(tag, '#') {
+			tags = append(tags, tag)
+		}
+	}
+	return normalizeTags(tags)
+}
+
+// Функция приведения тегов к нижнему регистру без "#" и повторов
+func normalizeTags(tags []string) []string {
+	var result []string
+	seen := make(map[string]bool)
+	for _, tag := range tags {
+		tag = strings.ToLower(strings.TrimPrefix(strings.TrimSpace(tag), "#"))
+		if tag == "" || seen[tag] {
+			continue
+		}
+		seen[tag] = true
+		result = append(result, tag)
+	}
+	return result
+}
+
+// Функция проверки наличия тега у заметки (без учёта регистра)
+func hasTag(note Note, tag string) bool {
+	tag = strings.ToLower(strings.TrimPrefix(tag, "#"))
+	for _, t := range note.Tags {
+		if t == tag {
+			return true
+		}
+	}
+	return false
+}
+
+// Формат даты срока
+const dateLayout = "2006-01-02"
+
+// Дни недели для --due=friday
+var weekdays = map[string]time.Weekday{
+	"sunday": time.Sunday, "monday": time.Monday, "tuesday": time.Tuesday, "wednesday": time.Wednesday,
+	"thursday": time.Thursday, "friday": time.Friday, "saturday": time.Saturday,
+	"sun": time.Sunday, "mon": time.Monday, "tue": time.Tuesday, "wed": time.Wednesday,
+	"thu": time.Thursday, "fri": time.Friday, "sat": time.Saturday,
+}
+
+// Функция получения начала дня по местному времени
+func startOfDay(t time.Time) time.Time {
+	t = t.Local()
+	return localDay(t.Year(), t.Month(), t.Day())
+}
+
+// Функция получения начала дня year-month-day по местному времени. Если часы
+// переводятся ровно в полночь, полуночи в этот день нет и time.Date возвращает время
+// предыдущего дня; тогда день начинается с момента перевода.
+func localDay(year int, month time.Month, day int) time.Time {
+	t := time.Date(year, month, day, 0, 0, 0, 0, time.Local)
+	if noon := time.Date(year, month, day, 12, 0, 0, 0, time.Local); t.Day() != noon.Day() {
+		_, t = t.ZoneBounds()
+	}
+	return t
+}
+
+// Функция получения начала дня, отстоящего от дня t на days дней; в отличие
+// от AddDate не сдвигается после дня без полуночи
+func addDays(t time.Time, days int) time.Time {
+	t = t.Local()
+	return localDay(t.Year(), t.Month(), t.Day()+days)
+}
+
+// Функция разбора дня в формате 2006-01-02 как начала дня по местному времени
+func parseDay(s string) (time.Time, error) {
+	t, err := time.Parse(dateLayout, s)
+	if err != nil {
+		return time.Time{}, err
+	}
+	return localDay(t.Year(), t.Month(), t.Day()), nil
+}
+
+// Функция разбора срока: 2024-05-12, today, tomorrow, день недели (friday — ближайшая
+// пятница после сегодняшнего дня) или +3d / +2w относительно сегодняшнего дня
+func parseDue(expr string, now time.Time) (time.Time, error) {
+	today := startOfDay(now)
+	expr = strings.ToLower(strings.TrimSpace(expr))
+	switch expr {
+	case "today":
+		return today, nil
+	case "tomorrow":
+		return today.AddDate(0, 0, 1), nil
+	}
+	if day, ok := weekdays[expr]; ok {
+		delta := (int(day) - int(today.Weekday()) + 7) % 7
+		if delta == 0 {
+			delta = 7
+		}
+		return today.AddDate(0, 0, delta), nil
+	}
+	if strings.HasPrefix(expr, "+") && len(expr) > 2 {
+		n, err := strconv.Atoi(expr[1 : len(expr)-1])
+		if err == nil && n >= 0 {
+			switch expr[len(expr)-1] {
+			case 'd':
+				return today.AddDate(0, 0, n), nil
+			case 'w':
+				return today.AddDate(0, 0, 7*n), nil
+			}
+		}
+	}
+	if t, err := time.ParseInLocation(dateLayout, expr, time.Local); err == nil {
+		return t, nil
+	}
+	return time.Time{}, fmt.Errorf("неверный срок %q; допустимые форматы: 2024-05-12, today, tomorrow, "+
+		"день недели (monday..sunday или mon..sun), +3d (через 3 дня), +2w (через 2 недели)", expr)
+}
+
+// Функция переноса срока заметки вперёд: на 1d, 2w и т. п. от текущего срока
+// (от сегодня, если он уже прошёл) или на день в формате parseDue. Заметке
+// без срока он назначается только с set. Напоминание сбрасывается.
+func snoozeNote(id int, expr string, set bool, now time.Time) {
+	i := noteIndex(id)
+	if i < 0 {
+		for _, note := range trash {
+			if note.ID == id {
+				fail("Заметка с ID %d в корзине, отложить её нельзя.", id)
+			}
+		}
+		fail("Заметка с ID %d не найдена.", id)
+	}
+	note := &notes[i]
+	if note.Done {
+		fail("Заметка с ID %d уже выполнена, откладывать нечего.", id)
+	}
+	if note.Due == nil && !set {
+		fail("У заметки %d нет срока; чтобы назначить его, добавьте --set.", id)
+	}
+	base := startOfDay(now)
+	if note.Due != nil && note.Due.After(base) {
+		base = *note.Due
+	}
+	var due time.Time
+	var err error
+	if n := strings.TrimRight(expr, "dw"); len(n) == len(expr)-1 && n != "" && strings.Trim(n, "0123456789") == "" {
+		due, err = parseDue("+"+expr, base)
+	} else {
+		due, err = parseDue(expr, now)
+	}
+	if err != nil {
+		fail("%v", err)
+	}
+	if note.Due != nil && !due.After(*note.Due) {
+		fail("Новый срок %s не позже текущего %s.", due.Format(dateLayout), note.Due.Format(dateLayout))
+	}
+	note.Due = &due
+	note.Notified = false
+	note.Snoozed++
+	note.UpdatedAt = now
+	changed = true
+	fmt.Printf("Срок заметки %d перенесён на %s.\n", id, due.Format(dateLayout))
+}
+
+// Функция пометки отложенной заметки для agenda: " (отложена ×2)"
+func snoozeMark(note Note) string {
+	if note.Snoozed == 0 {
+		return ""
+	}
+	return fmt.Sprintf(" (отложена ×%d)", note.Snoozed)
+}
+
+// Функция проверки просроченности заметки относительно now
+func isOverdue(note Note, now time.Time) bool {
+	return note.Due != nil && note.Due.Before(startOfDay(now))
+}
+
+// Функция выделения ID для новой заметки; ID только растут, поэтому
+// ID удалённой заметки не достанется новой
+func nextID() int {
+	id := nextNoteID
+	nextNoteID++
+	return id
+}
+
+// Функция добавления заметки
+func addNote(title, content string, tags []string, due *time.Time) {
+	now := time.Now()
+	note := Note{
+		ID:        nextID(),
+		Title:     title,
+		Content:   content,
+		CreatedAt: now,
+		UpdatedAt: now,
+		Tags:      normalizeTags(append(extractTags(content), tags...)),
+		Due:       due,
+	}
+	notes = append(notes, note)
+	changed = true
+	fmt.Printf("Заметка добавлена с ID %d\n", note.ID)
+}
+
+// Функция создания копии заметки: тот же заголовок, текст, теги и вложения,
+// но новый ID, время создания и срок due; отметка выполнения не копируется
+func copyNote(id int, due *time.Time) {
+	i := noteIndex(id)
+	if i < 0 {
+		for _, note := range trash {
+			if note.ID == id {
+				fail("Заметка с ID %d в корзине; сначала восстановите её: daylist restore %d", id, id)
+			}
+		}
+		fail("Заметка с ID %d не найдена.", id)
+	}
+	src := notes[i]
+	now := time.Now()
+	note := Note{
+		ID:        nextID(),
+		Title:     src.Title,
+		Content:   src.Content,
+		CreatedAt: now,
+		UpdatedAt: now,
+		Tags:      append([]string(nil), src.Tags...),
+		Due:       due,
+	}
+	// Скопированные файлы дублируются, чтобы удаление одной заметки не затронуло другую
+	for _, att := range src.Attachments {
+		if att.Copied {
+			path, err := copyAttachment(note.ID, att.Path)
+			if err != nil {
+				fail("Ошибка копирования вложения %s: %v", att.Path, err)
+			}
+			att.Path = path
+		}
+		note.Attachments = append(note.Attachments, att)
+	}
+	notes = append(notes, note)
+	changed = true
+	fmt.Printf("Заметка %d скопирована с ID %d\n", id, note.ID)
+}
+
+// Функция изменения текста заметки. Хэштеги извлекаются заново,
+// а теги, заданные через --tag (их нет в старом тексте), сохраняются.
+func editNote(id int, title *string, content string, tags []string) {
+	for i := range notes {
+		if notes[i].ID != id {
+			continue
+		}
+		inline := make(map[string]bool)
+		for _, tag := range extractTags(notes[i].Content) {
+			inline[tag] = true
+		}
+		newTags := extractTags(content)
+		for _, tag := range notes[i].Tags {
+			if !inline[tag] {
+				newTags = append(newTags, tag)
+			}
+		}
+		notes[i].Content = content
+		if title != nil {
+			notes[i].Title = *title
+		}
+		notes[i].Tags = normalizeTags(append(newTags, tags...))
+		notes[i].UpdatedAt = time.Now()
+		changed = true
+		fmt.Printf("Заметка с ID %d изменена.\n", id)
+		return
+	}
+	fmt.Printf("Заметка с ID %d не найдена.\n", id)
+}
+
+// Фильтр списка заметок; нулевое значение пропускает все заметки
+type noteFilter struct {
+	tag      string    // Только заметки с этим тегом
+	overdue  bool      // Только просроченные
+	pinned   bool      // Только закреплённые
+	from     time.Time // Созданные не раньше (включительно)
+	to       time.Time // Созданные раньше этого момента
+	last     int       // Только N последних по дате создания (0 — все)
+	minWords int       // Только заметки не короче N слов
+}
+
+// Функция проверки заметки по фильтру (кроме last)
+func (f noteFilter) match(note Note, now time.Time) bool {
+	if f.tag != "" && !hasTag(note, f.tag) {
+		return false
+	}
+	if f.overdue && !isOverdue(note, now) {
+		return false
+	}
+	if f.pinned && !note.Pinned {
+		return false
+	}
+	if !f.from.IsZero() && note.CreatedAt.Before(f.from) {
+		return false
+	}
+	if !f.to.IsZero() && !note.CreatedAt.Before(f.to) {
+		return false
+	}
+	if f.minWords > 0 && noteWords(note) < f.minWords {
+		return false
+	}
+	return true
+}
+
+// Функция отбора заметок по фильтру; порядок заметок сохраняется
+func filterNotes(source []Note, f noteFilter, now time.Time) []Note {
+	var result []Note
+	for _, note := range source {
+		if f.match(note, now) {
+			result = append(result, note)
+		}
+	}
+	if f.last > 0 && len(result) > f.last {
+		recent := make([]Note, len(result))
+		copy(recent, result)
+		sort.SliceStable(recent, func(i, j int) bool { return recent[i].CreatedAt.After(recent[j].CreatedAt) })
+		keep := make(map[int]bool)
+		for _, note := range recent[:f.last] {
+			keep[note.ID] = true
+		}
+		var trimmed []Note
+		for _, note := range result {
+			if keep[note.ID] {
+				trimmed = append(trimmed, note)
+			}
+		}
+		result = trimmed
+	}
+	return result
+}
+
+// Функция сортировки заметок по ключу created, due или id. При равенстве
+// ключей заметки упорядочиваются по ID; без срока при --sort=due всегда в конце.
+// Сортируется переданный срез, поэтому порядок в файле не меняется, если передать копию.
+func sortNotes(list []Note, key string, reverse bool) error {
+	var cmp func(a, b Note) int
+	switch key {
+	case "", "created":
+		cmp = func(a, b Note) int { return a.CreatedAt.Compare(b.CreatedAt) }
+	case "updated":
+		cmp = func(a, b Note) int { return a.UpdatedAt.Compare(b.UpdatedAt) }
+	case "id":
+		cmp = func(a, b Note) int { return 0 }
+	case "due":
+		cmp = func(a, b Note) int {
+			if a.Due == nil || b.Due == nil {
+				return 0
+			}
+			return a.Due.Compare(*b.Due)
+		}
+	default:
+		return fmt.Errorf("--sort: ожидается created, updated, due или id, получено %q", key)
+	}
+	sort.SliceStable(list, func(i, j int) bool {
+		a, b := list[i], list[j]
+		if key == "due" && (a.Due == nil) != (b.Due == nil) {
+			return b.Due == nil
+		}
+		c := cmp(a, b)
+		if reverse {
+			c = -c
+		}
+		if c != 0 {
+			return c < 0
+		}
+		if key == "id" && reverse {
+			return a.ID > b.ID
+		}
+		return a.ID < b.ID
+	})
+	return nil
+}
+
+// Функция заполнения диапазона дат фильтра из флагов list. Границы дней —
+// полночь по местному времени; --to включает указанный день целиком.
+func dateRange(f *noteFilter, today, yesterday bool, date, from, to string, now time.Time) error {
+	day := func(s, name string) (time.Time, error) {
+		t, err := parseDay(s)
+		if err != nil {
+			return time.Time{}, fmt.Errorf("%s: ожидается дата в формате 2024-05-01, получено %q", name, s)
+		}
+		return t, nil
+	}
+	set := 0
+	for _, on := range []bool{today, yesterday, date != "", from != "" || to != ""} {
+		if on {
+			set++
+		}
+	}
+	if set > 1 {
+		return fmt.Errorf("--today, --yesterday, --date и --from/--to нельзя использовать вместе")
+	}
+	switch {
+	case today:
+		f.from = startOfDay(now)
+		f.to = addDays(f.from, 1)
+	case yesterday:
+		f.to = startOfDay(now)
+		f.from = addDays(f.to, -1)
+	case date != "":
+		t, err := day(date, "--date")
+		if err != nil {
+			return err
+		}
+		f.from, f.to = t, addDays(t, 1)
+	default:
+		if from != "" {
+			t, err := day(from, "--from")
+			if err != nil {
+				return err
+			}
+			f.from = t
+		}
+		if to != "" {
+			t, err := day(to, "--to")
+			if err != nil {
+				return err
+			}
+			f.to = addDays(t, 1)
+		}
+	}
+	return nil
+}
+
+// Функция просмотра заметок, подходящих под фильтр, в порядке sortKey;
+// при groupBy == "day" заметки выводятся по дням создания
+func listNotes(source []Note, f noteFilter, sortKey string, reverse bool, groupBy string) {
+	found := false
+	list := filterNotes(source, f, time.Now())
+	if err := sortNotes(list, sortKey, reverse); err != nil {
+		fail("%v", err)
+	}
+	switch groupBy {
+	case "", "none":
+	case "day":
+		if !jsonOutput {
+			printByDay(list)
+			return
+		}
+	default:
+		fail("Неизвестная группировка %q; допустимо: day", groupBy)
+	}
+	if jsonOutput {
+		printJSON(list)
+		return
+	}
+	// Закреплённые заметки выводятся отдельным разделом в начале при любой сортировке
+	var pinned, rest []Note
+	for _, note := range list {
+		if note.Pinned {
+			pinned = append(pinned, note)
+		} else {
+			rest = append(rest, note)
+		}
+	}
+	if len(pinned) > 0 && len(rest) > 0 {
+		fmt.Printf("%s Закреплённые:\n\n", pinMark)
+	}
+	for _, note := range pinned {
+		found = true
+		printRow(note, "")
+	}
+	if len(pinned) > 0 && len(rest) > 0 {
+		fmt.Printf("\nОстальные:\n\n")
+	}
+	for _, note := range rest {
+		found = true
+		printRow(note, "")
+	}
+	if !found {
+		fmt.Println("Заметок не найдено.")
+	}
+}
+
+// Функция вывода заметок по дням создания, начиная с последнего дня.
+// Внутри дня сохраняется порядок list; дни без заметок не выводятся.
+func printByDay(list []Note) {
+	if len(list) == 0 {
+		fmt.Println("Заметок не найдено.")
+		return
+	}
+	byDay := make(map[string][]Note)
+	var days []string
+	for _, note := range list {
+		day := note.CreatedAt.Local().Format(dateLayout)
+		if _, ok := byDay[day]; !ok {
+			days = append(days, day)
+		}
+		byDay[day] = append(byDay[day], note)
+	}
+	// Формат 2006-01-02 сортируется как строка
+	sort.Sort(sort.Reverse(sort.StringSlice(days)))
+	for i, day := range days {
+		if i > 0 {
+			fmt.Println()
+		}
+		t, _ := time.ParseInLocation(dateLayout, day, time.Local)
+		fmt.Printf("=== %s (%s) === заметок: %d\n", day, t.Weekday(), len(byDay[day]))
+		for _, note := range byDay[day] {
+			printRow(note, "  ")
+		}
+	}
+}
+
+// Ширина строки списка (--width); 0 — ширина терминала
+var rowWidth int
+
+// Вывод списка прежним многострочным форматом (--full)
+var fullRows bool
+
+// Функция получения заголовка заметки: явный заголовок или первая строка текста
+func noteTitle(note Note) string {
+	if note.Title != "" {
+		return note.Title
+	}
+	if i := strings.IndexByte(note.Content, '\n'); i >= 0 {
+		return note.Content[:i]
+	}
+	return note.Content
+}
+
+// Функция ширины символа в терминале: эмодзи и иероглифы занимают две колонки
+func runeWidth(r rune) int {
+	switch {
+	case r == 0x200D || r >= 0xFE00 && r <= 0xFE0F || r >= 0x0300 && r <= 0x036F:
+		return 0 // Соединители, селекторы вариантов и диакритика
+	case r >= 0x1100 && r <= 0x115F, r >= 0x2E80 && r <= 0xA4CF, r >= 0xAC00 && r <= 0xD7A3,
+		r >= 0xF900 && r <= 0xFAFF, r >= 0xFF00 && r <= 0xFF60, r >= 0x1F300 && r <= 0x1FAFF:
+		return 2
+	}
+	return 1
+}
+
+// Функция ширины строки в колонках терминала
+func textWidth(s string) int {
+	w := 0
+	for _, r := range s {
+		w += runeWidth(r)
+	}
+	return w
+}
+
+// Функция обрезки строки до n колонок с многоточием. Режет только по
+// границам символов, поэтому кириллица и эмодзи не ломаются.
+func truncate(s string, n int) string {
+	if textWidth(s) <= n {
+		return s
+	}
+	var b strings.Builder
+	w := 0
+	for _, r := range s {
+		if w+runeWidth(r) > n-1 {
+			break
+		}
+		b.WriteRune(r)
+		w += runeWidth(r)
+	}
+	return b.String() + "…"
+}
+
+// Функция краткой даты для строки списка: "today 14:32" для сегодняшних
+// заметок, "May 01" для этого года и 2006-01-02 для прошлых лет
+func shortDate(t, now time.Time) string {
+	t, now = t.Local(), now.Local()
+	switch {
+	case startOfDay(t).Equal(startOfDay(now)):
+		return t.Format("today 15:04")
+	case t.Year() == now.Year():
+		return t.Format("Jan 02")
+	}
+	return t.Format(dateLayout)
+}
+
+// Стили оформления вывода
+const (
+	styleOverdue = "overdue" // Просроченный срок
+	styleToday   = "today"   // Срок сегодня
+	styleDone    = "done"    // Выполненная заметка
+	styleTag     = "tag"     // Теги
+	stylePinned  = "pinned"  // Отметка закреплённой заметки
+)
+
+// Оформление текста стилем; без цвета (в файл, в конвейер) — как есть
+type painter interface {
+	paint(style, s string) string
+}
+
+// Оформление без цвета
+type plainPainter struct{}
+
+func (plainPainter) paint(style, s string) string { return s }
+
+// Оформление цветом ANSI
+type ansiPainter struct{}
+
+// Коды ANSI для стилей
+var ansiCodes = map[string]string{
+	styleOverdue: "31", // красный
+	styleToday:   "33", // жёлтый
+	styleDone:    "2",  // тусклый
+	styleTag:     "36", // голубой
+	stylePinned:  "1",  // жирный
+}
+
+func (ansiPainter) paint(style, s string) string {
+	if s == "" {
+		return s
+	}
+	return "\x1b[" + ansiCodes[style] + "m" + s + "\x1b[0m"
+}
+
+// Текущее оформление вывода, выбирается по --color в начале main
+var output painter = plainPainter{}
+
+// Функция выбора оформления по --color=always|never|auto: auto — цвет, только
+// если вывод в терминал и не задана переменная NO_COLOR
+func choosePainter(mode string) (painter, error) {
+	switch mode {
+	case "always":
+		return ansiPainter{}, nil
+	case "never":
+		return plainPainter{}, nil
+	case "", "auto":
+		if _, noColor := os.LookupEnv("NO_COLOR"); noColor || jsonOutput {
+			return plainPainter{}, nil
+		}
+		if info, err := os.Stdout.Stat(); err == nil && info.Mode()&os.ModeCharDevice != 0 {
+			return ansiPainter{}, nil
+		}
+		return plainPainter{}, nil
+	}
+	return nil, fmt.Errorf("--color: ожидается always, never или auto, получено %q", mode)
+}
+
+// Функция стиля срока заметки: просрочен, сегодня или без выделения ("")
+func dueStyle(note Note, now time.Time) string {
+	switch {
+	case note.Due == nil || note.Done:
+		return ""
+	case isOverdue(note, now):
+		return styleOverdue
+	case note.Due.Equal(startOfDay(now)):
+		return styleToday
+	}
+	return ""
+}
+
+// Часть строки списка со стилем ("" — без оформления)
+type segment struct {
+	text, style string
+}
+
+// Функция сборки строки из частей не шире width колонок: обрезается
+// текст, а оформление добавляется уже к обрезанным частям
+func fitSegments(segments []segment, width int) string {
+	var b strings.Builder
+	for _, seg := range segments {
+		text := seg.text
+		w := textWidth(text)
+		cut := w > width
+		if cut {
+			text = truncate(text, width)
+		}
+		if seg.style != "" {
+			text = output.paint(seg.style, text)
+		}
+		b.WriteString(text)
+		width -= w
+		if cut || width <= 0 {
+			break
+		}
+	}
+	return b.String()
+}
+
+// Функция вывода заметки одной строкой по ширине терминала: ID, дата,
+// отметки (выполнена, закреплена), затем заголовок, теги и срок с обрезкой.
+// indent — отступ строки; с --full заметка выводится многострочным блоком.
+func printRow(note Note, indent string) {
+	if fullRows {
+		printNote(note, true)
+		return
+	}
+	width := rowWidth
+	if width <= 0 {
+		width = terminalWidth()
+	}
+	// ID выравниваются по самому длинному из выданных
+	idWidth := len(strconv.Itoa(max(nextNoteID-1, note.ID)))
+	now := time.Now()
+	flags := "  "
+	if note.Done {
+		flags = doneMark + " "
+	}
+	pin := "  "
+	if note.Pinned {
+		pin = output.paint(stylePinned, pinMark)
+	}
+	prefix := fmt.Sprintf("%s[%*d] %-11s %s", indent, idWidth, note.ID, shortDate(note.CreatedAt, now), flags)
+	title := noteTitle(note)
+	if note.Title == "" && strings.Contains(note.Content, "\n") {
+		title += " …"
+	}
+	segments := []segment{{text: title}, {text: tagSuffix(note), style: styleTag}}
+	if note.Due != nil {
+		segments = append(segments, segment{" (срок: " + note.Due.Format(dateLayout) + ")", dueStyle(note, now)})
+	}
+	if note.UpdatedAt.After(note.CreatedAt) {
+		segments = append(segments, segment{text: " (изм. " + shortDate(note.UpdatedAt, now) + ")"})
+	}
+	width = max(width-textWidth(prefix)-textWidth(pinMark)-1, 10)
+	if note.Done {
+		// Выполненная заметка тускнеет целиком, без цветов внутри
+		for i := range segments {
+			segments[i].style = ""
+		}
+		fmt.Println(output.paint(styleDone, prefix+pin+" "+fitSegments(segments, width)))
+		return
+	}
+	fmt.Println(prefix + pin + " " + fitSegments(segments, width))
+}
+
+// Функция отметки заметки выполненной (done = true) или невыполненной
+func setDone(id int, done bool) {
+	for i := range notes {
+		if notes[i].ID != id {
+			continue
+		}
+		switch {
+		case notes[i].Done == done && done:
+			fmt.Printf("Заметка с ID %d уже выполнена.\n", id)
+		case notes[i].Done == done:
+			fmt.Printf("Заметка с ID %d и так не выполнена.\n", id)
+		default:
+			notes[i].Done = done
+			notes[i].UpdatedAt = time.Now()
+			changed = true
+			if done {
+				fmt.Printf("Заметка с ID %d выполнена.\n", id)
+			} else {
+				fmt.Printf("Заметка с ID %d снова не выполнена.\n", id)
+			}
+		}
+		return
+	}
+	fmt.Printf("Заметка с ID %d не найдена.\n", id)
+}
+
+// Число заметок на одной странице интерактивного режима
+const uiPageSize = 15
+
+// Функция получения ширины терминала: COLUMNS, затем stty size для
+// терминала; если вывод не в терминал — 80
+func terminalWidth() int {
+	if n, err := strconv.Atoi(os.Getenv("COLUMNS")); err == nil && n > 0 {
+		return n
+	}
+	if info, err := os.Stdout.Stat(); err == nil && info.Mode()&os.ModeCharDevice != 0 {
+		if tty, err := os.Open("/dev/tty"); err == nil {
+			defer tty.Close()
+			size := exec.Command("stty", "size")
+			size.Stdin = tty
+			if out, err := size.Output(); err == nil {
+				var rows, cols int
+				if _, err := fmt.Sscan(string(out), &rows, &cols); err == nil && cols > 0 {
+					return cols
+				}
+			}
+		}
+	}
+	return 80
+}
+
+// Функция интерактивного режима: список заметок и команды из одной буквы.
+// Заметки сохраняются после каждого изменения, поэтому выход по Ctrl+C
+// в любой момент не теряет уже сделанного; Ctrl+C во время ввода лишь отменяет строку.
+func runUI(in io.Reader) {
+	interrupts := make(chan os.Signal, 1)
+	signal.Notify(interrupts, os.Interrupt)
+	defer signal.Stop(interrupts)
+	go func() {
+		for range interrupts {
+			fmt.Println("\n(ввод отменён; q — выход)")
+		}
+	}()
+
+	scanner := bufio.NewScanner(in)
+	read := func(prompt string) (string, bool) {
+		fmt.Print(prompt)
+		if !scanner.Scan() {
+			return "", false
+		}
+		return strings.TrimSpace(scanner.Text()), true
+	}
+	save := func() {
+		if !changed {
+			return
+		}
+		if err := saveNotes(); err != nil {
+			fmt.Printf("Ошибка сохранения заметок: %v\n", err)
+			return
+		}
+		changed = false
+	}
+
+	filter := ""
+	page := 0
+	for {
+		list := notes
+		if filter != "" {
+			list = searchNotes(notes, filter, false)
+		}
+		pages := (len(list) + uiPageSize - 1) / uiPageSize
+		if page >= pages {
+			page = max(pages-1, 0)
+		}
+		width := max(terminalWidth(), 20)
+		fmt.Println()
+		if filter != "" {
+			fmt.Printf("Фильтр: %q\n", filter)
+		}
+		if len(list) == 0 {
+			fmt.Println("Заметок не найдено.")
+		}
+		for _, note := range list[min(page*uiPageSize, len(list)):min((page+1)*uiPageSize, len(list))] {
+			mark := " "
+			if note.Done {
+				mark = doneMark
+			}
+			prefix := fmt.Sprintf("%3d %s ", note.ID, mark)
+			fmt.Println(prefix + truncate(noteTitle(note), max(width-len([]rune(prefix)), 5)))
+		}
+		if pages > 1 {
+			fmt.Printf("Страница %d из %d (n/p — листать)\n", page+1, pages)
+		}
+		line, ok := read("a — добавить, d ID — удалить, x ID — выполнено, / текст — фильтр, q — выход\n> ")
+		if !ok {
+			fmt.Println()
+			return
+		}
+		cmd, arg, _ := strings.Cut(line, " ")
+		arg = strings.TrimSpace(arg)
+		switch cmd {
+		case "q", "quit":
+			return
+		case "n":
+			if page+1 < pages {
+				page++
+			}
+		case "p":
+			if page > 0 {
+				page--
+			}
+		case "a":
+			content := arg
+			if content == "" {
+				if content, ok = read("Текст заметки (пустая строка — отмена): "); !ok {
+					return
+				}
+			}
+			if content != "" {
+				addNote("", content, nil, nil)
+				save()
+			}
+		case "d", "x":
+			id, err := strconv.Atoi(arg)
+			if err != nil {
+				fmt.Println("Укажите ID заметки, например: d 12")
+				continue
+			}
+			if cmd == "d" {
+				deleteNotes([]int{id}, true, false)
+			} else {
+				for _, note := range notes {
+					if note.ID == id {
+						setDone(id, !note.Done)
+						break
+					}
+				}
+			}
+			save()
+		case "/":
+			filter, page = arg, 0
+		case "":
+		default:
+			if strings.HasPrefix(cmd, "/") {
+				filter, page = strings.TrimSpace(strings.TrimPrefix(line, "/")), 0
+				continue
+			}
+			fmt.Println("Неизвестная команда:", cmd)
+		}
+	}
+}
+
+// Функция поиска заметок по подстроке в заголовке и тексте (без учёта регистра);
+// с titleOnly — только в заголовке
+func searchNotes(source []Note, query string, titleOnly bool) []Note {
+	query = strings.ToLower(query)
+	var result []Note
+	for _, note := range source {
+		text := noteTitle(note)
+		if !titleOnly {
+			text += "\n" + note.Content
+		}
+		if strings.Contains(strings.ToLower(text), query) {
+			result = append(result, note)
+		}
+	}
+	return result
+}
+
+// Функция расстояния Левенштейна между строками (по символам, не байтам)
+func levenshtein(a, b []rune) int {
+	prev := make([]int, len(b)+1)
+	cur := make([]int, len(b)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(a); i++ {
+		cur[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			cur[j] = min(prev[j]+1, cur[j-1]+1, prev[j-1]+cost)
+		}
+		prev, cur = cur, prev
+	}
+	return prev[len(b)]
+}
+
+// Функция приведения текста для нечёткого поиска: нижний регистр, ё как е
+func fuzzyFold(s string) string {
+	return strings.ReplaceAll(strings.ToLower(s), "ё", "е")
+}
+
+// Функция разбиения текста на слова в нижнем регистре (буквы и цифры любого алфавита)
+func fuzzyWords(s string) [][]rune {
+	var words [][]rune
+	for _, w := range strings.FieldsFunc(fuzzyFold(s), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	}) {
+		words = append(words, []rune(w))
+	}
+	return words
+}
+
+// Функция нечёткой оценки совпадения запроса с текстом; 0 — не совпадает,
+// чем больше, тем лучше. По убыванию оценки: точное вхождение, слова
+// запроса с опечатками (до одной на три буквы, допускается начало слова),
+// буквы запроса по порядку на коротком отрезке текста. Внутри каждого
+// вида совпадение ближе к началу текста оценивается выше, а при равном
+// числе опечаток целое слово выше начала слова.
+func fuzzyScore(query, text string) int {
+	q := []rune(fuzzyFold(strings.TrimSpace(query)))
+	t := []rune(fuzzyFold(text))
+	if len(q) == 0 {
+		return 0
+	}
+	if i := strings.Index(string(t), string(q)); i >= 0 {
+		return 1000 - min(utf8.RuneCountInString(string(t)[:i]), 300)
+	}
+
+	words := fuzzyWords(text)
+	queryWords := fuzzyWords(query)
+	if len(queryWords) > 0 && len(words) > 0 {
+		typos, prefixes, first := 0, 0, -1
+		for _, qw := range queryWords {
+			best, bestPos, bestPrefix := len(qw)+1, -1, false
+			for pos, w := range words {
+				d, prefix := levenshtein(qw, w), false
+				if len(w) > len(qw) {
+					if p := levenshtein(qw, w[:len(qw)]); p < d {
+						d, prefix = p, true
+					}
+				}
+				if d < best || d == best && bestPrefix && !prefix {
+					best, bestPos, bestPrefix = d, pos, prefix
+				}
+			}
+			if best > max(len(qw)/3, 1) || len(qw) < 3 && best > 0 {
+				typos = -1
+				break
+			}
+			typos += best
+			if bestPrefix {
+				prefixes++
+			}
+			if first < 0 || bestPos < first {
+				first = bestPos
+			}
+		}
+		if typos >= 0 {
+			return 600 - 50*typos - 5*prefixes - min(first*10, 200)
+		}
+	}
+
+	// Буквы запроса по порядку: отрезок не длиннее трёх длин запроса
+	letters := []rune(strings.Join(strings.Fields(string(q)), ""))
+	for start := range t {
+		if t[start] != letters[0] {
+			continue
+		}
+		k, end := 1, start
+		for i := start + 1; i < len(t) && k < len(letters) && i-start < 3*len(letters); i++ {
+			if t[i] == letters[k] {
+				k++
+				end = i
+			}
+		}
+		if k == len(letters) {
+			return 300 - (end - start + 1 - len(letters)) - min(start, 100)
+		}
+	}
+	return 0
+}
+
+// Результат нечёткого поиска
+type scoredNote struct {
+	note  Note
+	score int
+}
+
+// Функция нечёткого поиска: не больше limit лучших заметок по убыванию
+// оценки. Совпадение в заголовке ценится выше, короткие заметки — чуть
+// выше длинных; при равной оценке порядок по ID.
+func fuzzySearch(source []Note, query string, limit int, titleOnly bool) []scoredNote {
+	var result []scoredNote
+	for _, note := range source {
+		score := fuzzyScore(query, noteTitle(note))
+		if score > 0 {
+			score += 500
+		}
+		if !titleOnly {
+			score = max(score, fuzzyScore(query, note.Content))
+		}
+		if score <= 0 {
+			continue
+		}
+		score = max(score-min(utf8.RuneCountInString(note.Content)/20, 100), 1)
+		result = append(result, scoredNote{note, score})
+	}
+	sort.Slice(result, func(i, j int) bool {
+		if result[i].score != result[j].score {
+			return result[i].score > result[j].score
+		}
+		return result[i].note.ID < result[j].note.ID
+	})
+	if limit > 0 && len(result) > limit {
+		result = result[:limit]
+	}
+	return result
+}
+
+// Функция закрепления (pin = true) или открепления заметки
+func pinNote(id int, pin bool) {
+	for i := range notes {
+		if notes[i].ID != id {
+			continue
+		}
+		switch {
+		case notes[i].Pinned == pin && pin:
+			fmt.Printf("Заметка с ID %d уже закреплена.\n", id)
+		case notes[i].Pinned == pin:
+			fmt.Printf("Заметка с ID %d не закреплена.\n", id)
+		case pin:
+			notes[i].Pinned = true
+			notes[i].UpdatedAt = time.Now()
+			changed = true
+			fmt.Printf("Заметка с ID %d закреплена.\n", id)
+		default:
+			notes[i].Pinned = false
+			notes[i].UpdatedAt = time.Now()
+			changed = true
+			fmt.Printf("Заметка с ID %d откреплена.\n", id)
+		}
+		return
+	}
+	fail("Заметка с ID %d не найдена.", id)
+}
+
+// Функция получения первой строки заметки; у многострочных в конце ставится "…"
+func firstLine(content string) string {
+	if i := strings.IndexByte(content, '\n'); i >= 0 {
+		return content[:i] + " …"
+	}
+	return content
+}
+
+// Функция вывода заметки блоком полей; без full у многострочной заметки
+// выводится только первая строка
+func printNote(note Note, full bool) {
+	content := firstLine(note.Content)
+	if full {
+		content = note.Content
+	}
+	mark := ""
+	if note.Pinned {
+		mark = " " + pinMark
+	}
+	fmt.Printf("ID: %d%s\n", note.ID, mark)
+	if note.Title != "" {
+		fmt.Printf("Заголовок: %s\n", note.Title)
+	}
+	fmt.Printf("Содержание: %s\nДата создания: %s\n", content, note.CreatedAt.Format(time.RFC1123))
+	if full {
+		fmt.Printf("Слов: %d, символов: %d\n", noteWords(note), utf8.RuneCountInString(note.Content))
+	}
+	if full || note.UpdatedAt.After(note.CreatedAt) {
+		fmt.Printf("Изменена: %s\n", note.UpdatedAt.Format(time.RFC1123))
+	}
+	if len(note.Tags) > 0 {
+		fmt.Printf("Теги: %s\n", strings.Join(note.Tags, ", "))
+	}
+	if note.Due != nil {
+		fmt.Printf("Срок: %s\n", note.Due.Format(dateLayout))
+	}
+	yesNo := map[bool]string{true: "да", false: "нет"}
+	if full {
+		fmt.Printf("Выполнена: %s\nЗакреплена: %s\n", yesNo[note.Done], yesNo[note.Pinned])
+	} else if note.Done {
+		fmt.Println("Выполнена: да")
+	}
+	if len(note.Links) > 0 {
+		refs := make([]string, len(note.Links))
+		for i, id := range note.Links {
+			refs[i] = "#" + strconv.Itoa(id)
+		}
+		fmt.Printf("Связана с: %s\n", strings.Join(refs, ", "))
+	}
+	if len(note.Attachments) > 0 {
+		fmt.Println("Вложения:")
+		for i, att := range note.Attachments {
+			fmt.Printf("  %d. %s%s\n", i+1, att.Path, attachmentStatus(att))
+		}
+	}
+	fmt.Println()
+}
+
+// Файл, прикреплённый к заметке
+type attachment struct {
+	Path   string `json:"path"`             // Абсолютный путь к файлу или его копии
+	SHA256 string `json:"sha256,omitempty"` // Хеш файла в момент прикрепления
+	Copied bool   `json:"copied,omitempty"` // Файл скопирован в attachmentsDir
+}
+
+// Каталог для копий прикреплённых файлов (--copy), рядом с notes.json
+const attachmentsDir = "attachments"
+
+// Функция вычисления SHA-256 файла
+func fileSHA256(path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// Функция копирования файла в attachmentsDir под свободным именем "<ID>-<имя>"
+func copyAttachment(id int, src string) (string, error) {
+	if err := os.MkdirAll(attachmentsDir, 0755); err != nil {
+		return "", err
+	}
+	base := filepath.Base(src)
+	dst := filepath.Join(attachmentsDir, fmt.Sprintf("%d-%s", id, base))
+	for n := 2; ; n++ {
+		if _, err := os.Stat(dst); os.IsNotExist(err) {
+			break
+		}
+		dst = filepath.Join(attachmentsDir, fmt.Sprintf("%d-%d-%s", id, n, base))
+	}
+	data, err := ioutil.ReadFile(src)
+	if err != nil {
+		return "", err
+	}
+	if err := ioutil.WriteFile(dst, data, 0644); err != nil {
+		return "", err
+	}
+	return filepath.Abs(dst)
+}
+
+// Функция поиска заметки по ID; -1, если её нет
+func noteIndex(id int) int {
+	for i, note := range notes {
+		if note.ID == id {
+			return i
+		}
+	}
+	return -1
+}
+
+// Функция прикрепления файла к заметке; с copyFile файл копируется в attachmentsDir
+func attachFile(id int, path string, copyFile bool) {
+	i := noteIndex(id)
+	if i < 0 {
+		fail("Заметка с ID %d не найдена.", id)
+	}
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		fail("Ошибка пути %s: %v", path, err)
+	}
+	info, err := os.Stat(abs)
+	if err != nil {
+		fail("Файл недоступен: %v", err)
+	}
+	if info.IsDir() {
+		fail("%s — каталог, прикрепить можно только файл.", abs)
+	}
+	sum, err := fileSHA256(abs)
+	if err != nil {
+		fail("Ошибка чтения %s: %v", abs, err)
+	}
+	att := attachment{Path: abs, SHA256: sum}
+	if copyFile {
+		if att.Path, err = copyAttachment(id, abs); err != nil {
+			fail("Ошибка копирования %s: %v", abs, err)
+		}
+		att.Copied = true
+	}
+	notes[i].Attachments = append(notes[i].Attachments, att)
+	notes[i].UpdatedAt = time.Now()
+	changed = true
+	fmt.Printf("Файл прикреплён к заметке %d под номером %d: %s\n", id, len(notes[i].Attachments), att.Path)
+}
+
+// Функция открепления файла по номеру (с 1); копия файла удаляется
+func detachFile(id, index int) {
+	i := noteIndex(id)
+	if i < 0 {
+		fail("Заметка с ID %d не найдена.", id)
+	}
+	list := notes[i].Attachments
+	if index < 1 || index > len(list) {
+		fail("У заметки %d нет вложения с номером %d.", id, index)
+	}
+	att := list[index-1]
+	notes[i].Attachments = append(list[:index-1:index-1], list[index:]...)
+	removeAttachmentCopies(Note{Attachments: []attachment{att}})
+	notes[i].UpdatedAt = time.Now()
+	changed = true
+	fmt.Printf("Файл откреплён от заметки %d: %s\n", id, att.Path)
+}
+
+// Функция удаления копий вложений заметки при её окончательном удалении
+func removeAttachmentCopies(note Note) {
+	for _, att := range note.Attachments {
+		if !att.Copied {
+			continue
+		}
+		if err := os.Remove(att.Path); err != nil && !os.IsNotExist(err) {
+			fmt.Fprintf(os.Stderr, "Не удалось удалить копию вложения %s: %v\n", att.Path, err)
+		}
+	}
+}
+
+// Функция состояния вложения: пометка, если файл пропал или изменился
+func attachmentStatus(att attachment) string {
+	if _, err := os.Stat(att.Path); err != nil {
+		return " [файл не найден]"
+	}
+	if att.SHA256 == "" {
+		return ""
+	}
+	if sum, err := fileSHA256(att.Path); err != nil || sum != att.SHA256 {
+		return " [файл изменён]"
+	}
+	return ""
+}
+
+// Функция подсчёта слов: слово — буквы и цифры любого алфавита, дефис и
+// апостроф внутри слова его не разрывают ("кто-то", "don't" — одно слово),
+// знаки препинания и тире словами не считаются
+func countWords(s string) int {
+	n := 0
+	for _, field := range strings.FieldsFunc(s, func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r) && r != '-' && r != '\'' && r != '’'
+	}) {
+		if strings.IndexFunc(field, func(r rune) bool { return unicode.IsLetter(r) || unicode.IsDigit(r) }) >= 0 {
+			n++
+		}
+	}
+	return n
+}
+
+// Функция числа слов заметки вместе с заголовком
+func noteWords(note Note) int {
+	return countWords(note.Title + "\n" + note.Content)
+}
+
+// Функция вывода общей статистики заметок
+func showStats() {
+	now := time.Now()
+	done, overdue, words, runes := 0, 0, 0, 0
+	for _, note := range notes {
+		if note.Done {
+			done++
+		}
+		if isOverdue(note, now) {
+			overdue++
+		}
+		words += noteWords(note)
+		runes += utf8.RuneCountInString(note.Content)
+	}
+	fmt.Printf("Заметок: %d (выполнено: %d, просрочено: %d, в корзине: %d)\n", len(notes), done, overdue, len(trash))
+	fmt.Printf("Слов: %d, символов: %d\n", words, runes)
+}
+
+// Функция вывода журнала: слов, написанных за каждый день создания заметок
+// в диапазоне f (по умолчанию от первой заметки до сегодня), итог и среднее
+// за день периода, включая дни без заметок
+func showJournal(f noteFilter, now time.Time) {
+	list := filterNotes(notes, f, now)
+	if len(list) == 0 {
+		fmt.Println("Заметок за период нет.")
+		return
+	}
+	byDay := make(map[string]int)
+	first := startOfDay(now)
+	for _, note := range list {
+		byDay[note.CreatedAt.Local().Format(dateLayout)] += noteWords(note)
+		if day := startOfDay(note.CreatedAt.Local()); day.Before(first) {
+			first = day
+		}
+	}
+	from, to := first, startOfDay(now)
+	if !f.from.IsZero() {
+		from = f.from
+	}
+	if !f.to.IsZero() {
+		to = f.to.AddDate(0, 0, -1)
+	}
+	total, days := 0, 0
+	for day := from; !day.After(to); day = day.AddDate(0, 0, 1) {
+		days++
+		if words, ok := byDay[day.Format(dateLayout)]; ok {
+			fmt.Printf("%s (%s)  слов: %d\n", day.Format(dateLayout), day.Weekday(), words)
+			total += words
+		}
+	}
+	fmt.Printf("Итого: %d слов за %d дн., в среднем %.1f в день\n", total, days, float64(total)/float64(max(days, 1)))
+}
+
+// Функция вывода заметки notes[i] целиком; с withLinks выводятся и первые
+// строки связанных заметок
+func showNote(i int, withLinks bool) {
+	printNote(notes[i], true)
+	if !withLinks || len(notes[i].Links) == 0 {
+		return
+	}
+	fmt.Println("Связанные заметки:")
+	for _, linked := range notes[i].Links {
+		if j := noteIndex(linked); j >= 0 {
+			fmt.Printf("  #%d %s\n", linked, noteTitle(notes[j]))
+		} else {
+			fmt.Printf("  #%d (в корзине)\n", linked)
+		}
+	}
+}
+
+// Функция поиска заметки по ID или по началу текста (без учёта регистра);
+// начало должно подходить ровно к одной заметке
+func resolveNote(arg string) (int, error) {
+	if id, err := strconv.Atoi(arg); err == nil {
+		if i := noteIndex(id); i >= 0 {
+			return i, nil
+		}
+		return -1, fmt.Errorf("заметка с ID %d не найдена", id)
+	}
+	prefix := strings.ToLower(arg)
+	var found []int
+	for i, note := range notes {
+		if strings.HasPrefix(strings.ToLower(note.Content), prefix) || strings.HasPrefix(strings.ToLower(note.Title), prefix) {
+			found = append(found, i)
+		}
+	}
+	switch len(found) {
+	case 0:
+		return -1, fmt.Errorf("заметок, начинающихся с %q, нет", arg)
+	case 1:
+		return found[0], nil
+	}
+	ids := make([]string, len(found))
+	for k, i := range found {
+		ids[k] = strconv.Itoa(notes[i].ID)
+	}
+	return -1, fmt.Errorf("с %q начинаются несколько заметок (%s), укажите ID", arg, strings.Join(ids, ", "))
+}
+
+// Функция вывода заметок по ID или началу текста в порядке аргументов.
+// Ненайденные сообщаются, а код выхода становится 1. С --json одна
+// заметка выводится объектом, несколько — массивом.
+func showNotes(args []string, withLinks bool) {
+	var found []Note
+	for _, arg := range args {
+		i, err := resolveNote(arg)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Ошибка: %v\n", err)
+			exitCode = 1
+			continue
+		}
+		if jsonOutput {
+			found = append(found, notes[i])
+			continue
+		}
+		showNote(i, withLinks)
+	}
+	if !jsonOutput {
+		return
+	}
+	if len(args) == 1 && len(found) == 1 {
+		data, err := json.MarshalIndent(found[0], "", "  ")
+		if err != nil {
+			fail("Ошибка формирования JSON: %v", err)
+		}
+		fmt.Println(string(data))
+		return
+	}
+	printJSON(found)
+}
+
+// Функция удаления id из списка; возвращает nil вместо пустого списка
+func removeID(ids []int, id int) []int {
+	var kept []int
+	for _, other := range ids {
+		if other != id {
+			kept = append(kept, other)
+		}
+	}
+	return kept
+}
+
+// Функция двусторонней связи двух заметок
+func linkNotes(a, b int) {
+	if a == b {
+		fail("Нельзя связать заметку саму с собой.")
+	}
+	i, j := noteIndex(a), noteIndex(b)
+	if i < 0 {
+		fail("Заметка с ID %d не найдена.", a)
+	}
+	if j < 0 {
+		fail("Заметка с ID %d не найдена.", b)
+	}
+	for _, linked := range notes[i].Links {
+		if linked == b {
+			fmt.Printf("Заметки %d и %d уже связаны.\n", a, b)
+			return
+		}
+	}
+	notes[i].Links = append(notes[i].Links, b)
+	notes[j].Links = append(notes[j].Links, a)
+	notes[i].UpdatedAt, notes[j].UpdatedAt = time.Now(), time.Now()
+	changed = true
+	fmt.Printf("Заметки %d и %d связаны.\n", a, b)
+}
+
+// Функция чтения текста новой заметки из stdin целиком; переводы строк
+// сохраняются, кроме завершающих
+func readContent(r io.Reader) (string, error) {
+	data, err := ioutil.ReadAll(r)
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimRight(string(data), "\r\n"), nil
+}
+
+// Функция набора текста заметки в редакторе $EDITOR (по умолчанию vi)
+func editContent() (string, error) {
+	editor := strings.Fields(os.Getenv("EDITOR"))
+	if len(editor) == 0 {
+		editor = []string{"vi"}
+	}
+	tmp, err := ioutil.TempFile("", "daylist-*.txt")
+	if err != nil {
+		return "", err
+	}
+	tmp.Close()
+	defer os.Remove(tmp.Name())
+	cmd := exec.Command(editor[0], append(editor[1:], tmp.Name())...)
+	cmd.Stdin, cmd.Stdout, cmd.Stderr = os.Stdin, os.Stdout, os.Stderr
+	if err := cmd.Run(); err != nil {
+		return "", fmt.Errorf("редактор %s завершился с ошибкой: %v", editor[0], err)
+	}
+	f, err := os.Open(tmp.Name())
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	return readContent(f)
+}
+
+// Функция проверки, что stdin перенаправлен (не терминал)
+func stdinPiped() bool {
+	info, err := os.Stdin.Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice == 0
+}
+
+// Функция вывода заметок со сроком: сначала просроченные, затем предстоящие по дням
+func showAgenda() {
+	now := time.Now()
+	var overdue, upcoming []Note
+	for _, note := range notes {
+		switch {
+		case note.Due == nil:
+		case isOverdue(note, now):
+			overdue = append(overdue, note)
+		default:
+			upcoming = append(upcoming, note)
+		}
+	}
+	if len(overdue) == 0 && len(upcoming) == 0 && !jsonOutput {
+		fmt.Println("Заметок со сроком не найдено.")
+		return
+	}
+	byDue := func(list []Note) {
+		sort.SliceStable(list, func(i, j int) bool { return list[i].Due.Before(*list[j].Due) })
+	}
+	byDue(overdue)
+	byDue(upcoming)
+	if jsonOutput {
+		printJSON(append(overdue, upcoming...))
+		return
+	}
+	if len(overdue) > 0 {
+		fmt.Println(output.paint(styleOverdue, fmt.Sprintf("!!! Просрочено (%d) !!!", len(overdue))))
+		for _, note := range overdue {
+			fmt.Printf("  [%d] %s %s%s\n", note.ID, firstLine(note.Content), output.paint(styleOverdue, "(срок: "+note.Due.Format(dateLayout)+")"), snoozeMark(note))
+		}
+		fmt.Println()
+	}
+	today := startOfDay(now)
+	for i, note := range upcoming {
+		if i == 0 || !note.Due.Equal(*upcoming[i-1].Due) {
+			if i > 0 {
+				fmt.Println()
+			}
+			label := note.Due.Format("2006-01-02 (Monday)")
+			switch {
+			case note.Due.Equal(today):
+				label = output.paint(styleToday, label+" — сегодня")
+			case note.Due.Equal(today.AddDate(0, 0, 1)):
+				label += " — завтра"
+			}
+			fmt.Println(label)
+		}
+		fmt.Printf("  [%d] %s%s\n", note.ID, firstLine(note.Content), snoozeMark(note))
+	}
+}
+
+// Функция вывода всех тегов с количеством заметок
+func listTags() {
+	counts := make(map[string]int)
+	for _, note := range notes {
+		for _, tag := range note.Tags {
+			counts[tag]++
+		}
+	}
+	if len(counts) == 0 {
+		fmt.Println("Тегов не найдено.")
+		return
+	}
+	tags := make([]string, 0, len(counts))
+	for tag := range counts {
+		tags = append(tags, tag)
+	}
+	// Сначала самые частые теги, при равенстве — по алфавиту
+	sort.Slice(tags, func(i, j int) bool {
+		if counts[tags[i]] != counts[tags[j]] {
+			return counts[tags[i]] > counts[tags[j]]
+		}
+		return tags[i] < tags[j]
+	})
+	for _, tag := range tags {
+		fmt.Printf("#%s: %d\n", tag, counts[tag])
+	}
+}
+
+// Команды и их аргументы для help, completion и сообщений об ошибках;
+// флаги каждой команды выводит help <команда>
+var commands = []struct{ name, usage string }{
+	{"add", `add "текст" | add - | add --edit [флаги]`},
+	{"list", "list [флаги]"},
+	{"days", "days [флаги list]"},
+	{"show", `show <ID>|"начало текста"... [--with-links]`},
+	{"link", "link <ID1> <ID2>"},
+	{"search", "search <текст> [флаги]"},
+	{"agenda", "agenda"},
+	{"edit", `edit <ID> "текст" [флаги]`},
+	{"copy", "copy <ID> [--due=срок]"},
+	{"snooze", "snooze <ID> 1d|2w|tomorrow|2024-05-01 [--set]"},
+	{"attach", "attach <ID> <путь> [--copy]"},
+	{"detach", "detach <ID> <номер_вложения>"},
+	{"done", "done <ID>"},
+	{"undone", "undone <ID>"},
+	{"pin", "pin <ID>"},
+	{"unpin", "unpin <ID>"},
+	{"delete", "delete <ID>... (например, 3 5 7-12) [флаги]"},
+	{"clear", "clear [флаги]"},
+	{"trash", "trash [--empty [--older-than=30d]]"},
+	{"archive", "archive [--before=2024-01-01]"},
+	{"unarchive", "unarchive <ID>..."},
+	{"restore", "restore [<ID>...]"},
+	{"tags", "tags"},
+	{"stats", "stats [--journal [--from=2024-05-01] [--to=2024-05-31]]"},
+	{"export", "export [флаги]"},
+	{"import", "import <файл> [флаги]"},
+	{"remind", "remind [флаги]"},
+	{"repeat", "repeat list | repeat delete <ID>"},
+	{"tick", "tick"},
+	{"sync", "sync [флаги]"},
+	{"encrypt", "encrypt"},
+	{"decrypt", "decrypt"},
+	{"ui", "ui"},
+	{"help", "help [команда]"},
+	{"completion", "completion bash|zsh"},
+}
+
+// Команды, для которых completion предлагает ID заметок
+var idCommands = []string{"show", "edit", "delete", "done", "undone", "pin", "unpin", "copy", "snooze", "link", "attach", "detach"}
+
+// Справка запрошена командой help: флаги выводятся в stdout, заметки не загружаются
+var helpMode bool
+
+// Функция получения строки использования команды; "" для неизвестной
+func commandUsage(name string) string {
+	for _, c := range commands {
+		if c.name == name {
+			return c.usage
+		}
+	}
+	return ""
+}
+
+// Функция получения имён всех команд
+func commandNames() []string {
+	names := make([]string, len(commands))
+	for i, c := range commands {
+		names[i] = c.name
+	}
+	return names
+}
+
+// Функция создания набора флагов команды; -h и help <команда> выводят
+// её использование и флаги
+func newFlagSet(name string) *flag.FlagSet {
+	fs := flag.NewFlagSet(name, flag.ContinueOnError)
+	if helpMode {
+		fs.SetOutput(os.Stdout)
+	}
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Использование: daylist %s\n", commandUsage(name))
+		fs.PrintDefaults()
+	}
+	return fs
+}
+
+// Функция вывода общей справки
+func printHelp() {
+	fmt.Println("Использование: daylist <команда> [аргументы...] [--json]")
+	fmt.Println("\nКоманды:")
+	for _, c := range commands {
+		fmt.Printf("  %s\n", c.usage)
+	}
+	fmt.Println("\nФлаги команды: daylist help <команда>")
+}
+
+// Функция вывода скрипта автодополнения для bash или zsh. Скрипт рассчитан
+// на собранную программу daylist (go build -o daylist .) и берёт
+// ID заметок из скрытой команды _ids.
+func printCompletion(shell string) error {
+	names := strings.Join(commandNames(), " ")
+	ids := strings.Join(idCommands, "|")
+	switch shell {
+	case "bash":
+		fmt.Printf(`_daylist() {
+	local cur=${COMP_WORDS[COMP_CWORD]}
+	if [ "$COMP_CWORD" -eq 1 ]; then
+		COMPREPLY=($(compgen -W "%s" -- "$cur"))
+		return
+	fi
+	case ${COMP_WORDS[1]} in
+	%s)
+		COMPREPLY=($(compgen -W "$(daylist _ids 2>/dev/null)" -- "$cur")) ;;
+	help)
+		COMPREPLY=($(compgen -W "%s" -- "$cur")) ;;
+	esac
+}
+complete -F _daylist daylist
+`, names, ids, names)
+	case "zsh":
+		fmt.Printf(`#compdef daylist
+_daylist() {
+	if (( CURRENT == 2 )); then
+		compadd -- %s
+		return
+	fi
+	case $words[2] in
+	%s)
+		compadd -- ${(f)"$(daylist _ids 2>/dev/null)"} ;;
+	help)
+		compadd -- %s ;;
+	esac
+}
+compdef _daylist daylist
+`, names, ids, names)
+	default:
+		return fmt.Errorf("completion: ожидается bash или zsh, получено %q", shell)
+	}
+	return nil
+}
+
+// Функция удаления лишнего аргумента при go run в Termux: там os.Args[1]
+// бывает абсолютным путём к программе, а команда идёт следом
+func stripTermuxPath(args []string) []string {
+	if len(args) > 2 && filepath.IsAbs(args[1]) {
+		return append([]string{args[0]}, args[2:]...)
+	}
+	return args
+}
+
+// Функция разбора флагов команды; флаги можно указывать и после аргументов
+func parseArgs(fs *flag.FlagSet, args []string) []string {
+	var positional []string
+	if jsonOutput {
+		fs.SetOutput(ioutil.Discard)
+	}
+	for {
+		if err := fs.Parse(args); err == flag.ErrHelp {
+			exit(0)
+		} else if err != nil && jsonOutput {
+			fail("%v", err)
+		} else if err != nil {
+			exit(1)
+		}
+		args = fs.Args()
+		if len(args) == 0 {
+			return positional
+		}
+		positional = append(positional, args[0])
+		args = args[1:]
+	}
+}
+
+// Функция разбора списка ID: "3 5 7-12" -> 3, 5, 7, 8, ..., 12 (без повторов)
+func parseIDs(args []string) ([]int, error) {
+	var ids []int
+	seen := make(map[int]bool)
+	for _, arg := range args {
+		low, high := arg, arg
+		if i := strings.Index(arg, "-"); i > 0 {
+			low, high = arg[:i], arg[i+1:]
+		}
+		a, errA := strconv.Atoi(low)
+		b, errB := strconv.Atoi(high)
+		if errA != nil || errB != nil {
+			return nil, fmt.Errorf("ID заметки должно быть числом или диапазоном (7-12), получено %q", arg)
+		}
+		if a > b {
+			return nil, fmt.Errorf("неверный диапазон %q: начало больше конца", arg)
+		}
+		for id := a; id <= b; id++ {
+			if !seen[id] {
+				seen[id] = true
+				ids = append(ids, id)
+			}
+		}
+	}
+	return ids, nil
+}
+
+// Порог, начиная с которого удаление требует подтверждения
+const confirmDeleteOver = 3
+
+// Функция удаления заметок по списку ID. Сначала проверяются все ID, затем
+// найденные заметки за один раз перемещаются в корзину (с force — удаляются
+// насовсем); больше confirmDeleteOver заметок — только после подтверждения (или с yes).
+func deleteNotes(ids []int, yes, force bool) {
+	wanted := make(map[int]bool)
+	for _, id := range ids {
+		wanted[id] = true
+	}
+	var found []Note
+	for _, note := range notes {
+		if wanted[note.ID] {
+			found = append(found, note)
+			delete(wanted, note.ID)
+		}
+	}
+	if len(wanted) > 0 {
+		var missing []string
+		for _, id := range ids {
+			if wanted[id] {
+				missing = append(missing, strconv.Itoa(id))
+			}
+		}
+		if len(ids) == 1 {
+			fmt.Printf("Заметка с ID %s не найдена.\n", missing[0])
+		} else {
+			fmt.Printf("Заметки не найдены: %s\n", strings.Join(missing, ", "))
+		}
+	}
+	if len(found) == 0 {
+		return
+	}
+	if len(found) > confirmDeleteOver && !yes {
+		if force {
+			fmt.Printf("Будут удалены насовсем заметки (%d):\n", len(found))
+		} else {
+			fmt.Printf("Будут перемещены в корзину заметки (%d):\n", len(found))
+		}
+		for _, note := range found {
+			fmt.Printf("  [%d] %s\n", note.ID, firstLine(note.Content))
+		}
+		fmt.Print("Удалить? (yes/no): ")
+		answer, _ := stdin.ReadString('\n')
+		if strings.TrimSpace(strings.ToLower(answer)) != "yes" {
+			fmt.Println("Отменено, ничего не удалено.")
+			return
+		}
+	}
+	remove := make(map[int]bool)
+	for _, note := range found {
+		remove[note.ID] = true
+	}
+	kept := notes[:0]
+	for _, note := range notes {
+		if !remove[note.ID] {
+			kept = append(kept, note)
+		}
+	}
+	notes = kept
+	changed = true
+	action := "перемещена в корзину"
+	if force {
+		action = "удалена"
+		for _, note := range found {
+			forgetNote(note)
+		}
+	} else {
+		now := time.Now()
+		for _, note := range found {
+			note.DeletedAt = &now
+			trash = append(trash, note)
+		}
+	}
+	if len(found) == 1 {
+		fmt.Printf("Заметка с ID %d %s: %s\n", found[0].ID, action, firstLine(found[0].Content))
+		return
+	}
+	if force {
+		fmt.Printf("Удалено заметок: %d\n", len(found))
+	} else {
+		fmt.Printf("Перемещено в корзину заметок: %d\n", len(found))
+	}
+	for _, note := range found {
+		fmt.Printf("  [%d] %s\n", note.ID, firstLine(note.Content))
+	}
+}
+
+// Функция очистки заметок: всех или созданных до дня before и/или с тегом tag.
+// Всегда спрашивает подтверждение (кроме --yes) и перед изменением сохраняет
+// копию notes.json с меткой времени; заметки уходят в корзину, если не force.
+func clearNotes(before time.Time, tag string, yes, force bool) {
+	var ids []int
+	for _, note := range notes {
+		if (before.IsZero() || note.CreatedAt.Before(before)) && (tag == "" || hasTag(note, tag)) {
+			ids = append(ids, note.ID)
+		}
+	}
+	if len(ids) == 0 {
+		fmt.Println("Подходящих заметок нет, ничего не удалено.")
+		return
+	}
+	if !yes {
+		action := "перемещены в корзину"
+		if force {
+			action = "удалены насовсем"
+		}
+		fmt.Printf("Будут %s заметки: %d. Для подтверждения введите yes: ", action, len(ids))
+		answer, _ := stdin.ReadString('\n')
+		if strings.TrimSpace(strings.ToLower(answer)) != "yes" {
+			fmt.Println("Отменено, ничего не удалено.")
+			return
+		}
+	}
+	if data, err := ioutil.ReadFile(notesFile); err == nil {
+		stamp := time.Now().Format("20060102-150405")
+		backup := fmt.Sprintf("%s.%s.bak", notesFile, stamp)
+		// Две очистки за одну секунду не должны затирать копию первой
+		for n := 2; ; n++ {
+			if _, err := os.Stat(backup); os.IsNotExist(err) {
+				break
+			}
+			backup = fmt.Sprintf("%s.%s-%d.bak", notesFile, stamp, n)
+		}
+		if err := writeFileAtomic(backup, data); err != nil {
+			fail("Ошибка записи резервной копии %s: %v", backup, err)
+		}
+		fmt.Printf("Резервная копия: %s\n", backup)
+	}
+	deleteNotes(ids, true, force)
+}
+
+// Срок хранения заметок в корзине по умолчанию, дней
+const defaultTrashDays = 30
+
+// Функция разбора возраста: 30d, 2w или длительность Go (12h)
+func parseAge(s string) (time.Duration, error) {
+	if n, err := strconv.Atoi(strings.TrimSuffix(s, "d")); err == nil && strings.HasSuffix(s, "d") && n >= 0 {
+		return time.Duration(n) * 24 * time.Hour, nil
+	}
+	if n, err := strconv.Atoi(strings.TrimSuffix(s, "w")); err == nil && strings.HasSuffix(s, "w") && n >= 0 {
+		return time.Duration(n) * 7 * 24 * time.Hour, nil
+	}
+	d, err := time.ParseDuration(s)
+	if err != nil || d < 0 {
+		return 0, fmt.Errorf("неверный возраст %q; допустимые форматы: 30d, 2w, 12h", s)
+	}
+	return d, nil
+}
+
+// Подстановки --exec команды remind в порядке позиционных параметров sh: {id} — ${1}, {title} — ${2} и т. д.
+var remindPlaceholders = []string{"{id}", "{title}", "{content}", "{due}"}
+
+// Функция сборки скрипта для sh -c из шаблона --exec: каждая подстановка из names
+// заменяется ссылкой на позиционный параметр, а сами значения передаются отдельными
+// аргументами и оболочкой не разбираются. Поэтому $(...), кавычки и переводы строк в
+// тексте заметки не исполняются ни вне кавычек, ни внутри двойных. Вне кавычек ссылка
+// берётся в двойные кавычки; внутри одинарных подставить нельзя — это ошибка
+func compileExec(tmpl string, names []string) (string, error) {
+	var b strings.Builder
+	var quote byte // Открытая кавычка: 0, '\'' или '"'
+	for i := 0; i < len(tmpl); {
+		if tmpl[i] == '{' {
+			if n := slices.IndexFunc(names, func(name string) bool { return strings.HasPrefix(tmpl[i:], name) }); n >= 0 {
+				ref := fmt.Sprintf("${%d}", n+1)
+				switch quote {
+				case '\'':
+					return "", fmt.Errorf("подстановка %s внутри одинарных кавычек не сработает, уберите кавычки или замените их двойными", names[n])
+				case 0:
+					ref = `"` + ref + `"`
+				}
+				b.WriteString(ref)
+				i += len(names[n])
+				continue
+			}
+		}
+		switch c := tmpl[i]; {
+		case c == '\\' && quote != '\'' && i+1 < len(tmpl):
+			// Экранированный символ переносится как есть вместе с обратной косой чертой
+			b.WriteString(tmpl[i : i+2])
+			i += 2
+			continue
+		case (c == '\'' || c == '"') && quote == 0:
+			quote = c
+		case c == quote:
+			quote = 0
+		}
+		b.WriteByte(tmpl[i])
+		i++
+	}
+	return b.String(), nil
+}
+
+// Функция напоминания о заметках со сроком не позже now+within, ещё не
+// выполненных и без напоминания (с again — и с ним). Со script (шаблон --exec,
+// собранный compileExec) для каждой заметки запускается sh -c, а ID, заголовок,
+// текст и срок передаются ему позиционными параметрами; напоминание запоминается,
+// только если команда завершилась успешно.
+// Без script заметки выводятся, и при наличии таких код выхода — 1.
+func remind(now time.Time, within time.Duration, script string, again bool) {
+	limit := now.Add(within)
+	var due []int
+	for i, note := range notes {
+		if note.Due != nil && !note.Done && (again || !note.Notified) && !note.Due.After(limit) {
+			due = append(due, i)
+		}
+	}
+	if script == "" {
+		if len(due) == 0 {
+			fmt.Println("Напоминать не о чем.")
+			return
+		}
+		for _, i := range due {
+			printRow(notes[i], "")
+			notes[i].Notified = true
+		}
+		changed = true
+		exitCode = 1
+		return
+	}
+	sent := 0
+	for _, i := range due {
+		note := notes[i]
+		// Первый аргумент после скрипта становится $0, значения — ${1}…${4} по remindPlaceholders
+		run := exec.Command("sh", "-c", script, "daylist", strconv.Itoa(note.ID), noteTitle(note), note.Content, note.Due.Format(dateLayout))
+		run.Stdout, run.Stderr = os.Stdout, os.Stderr
+		if err := run.Run(); err != nil {
+			fmt.Fprintf(os.Stderr, "Напоминание о заметке %d не отправлено: %v\n", note.ID, err)
+			exitCode = 1
+			continue
+		}
+		notes[i].Notified = true
+		changed = true
+		sent++
+	}
+	fmt.Printf("Отправлено напоминаний: %d из %d\n", sent, len(due))
+}
+
+// Функция удаления из корзины заметок, удалённых раньше before; возвращает их число
+func purgeTrash(before time.Time) int {
+	kept := trash[:0]
+	var purged []Note
+	for _, note := range trash {
+		if note.DeletedAt != nil && note.DeletedAt.Before(before) {
+			purged = append(purged, note)
+			continue
+		}
+		kept = append(kept, note)
+	}
+	trash = kept
+	for _, note := range purged {
+		forgetNote(note)
+	}
+	if len(purged) > 0 {
+		changed = true
+	}
+	return len(purged)
+}
+
+// Функция уборки за окончательно удалённой заметкой: копии её вложений
+// и ссылки на неё из других заметок (в том числе в корзине)
+func forgetNote(note Note) {
+	removeAttachmentCopies(note)
+	for _, list := range [][]Note{notes, trash} {
+		for i := range list {
+			list[i].Links = removeID(list[i].Links, note.ID)
+		}
+	}
+}
+
+// Функция автоматической очистки корзины при загрузке. Срок хранения в днях
+// задаётся переменной DAYLIST_TRASH_DAYS (0 — хранить бессрочно).
+func autoPurgeTrash(now time.Time) {
+	days := defaultTrashDays
+	if env := os.Getenv("DAYLIST_TRASH_DAYS"); env != "" {
+		n, err := strconv.Atoi(env)
+		if err != nil || n < 0 {
+			fail("DAYLIST_TRASH_DAYS: ожидается число дней, получено %q", env)
+		}
+		days = n
+	}
+	if days > 0 {
+		purgeTrash(now.AddDate(0, 0, -days))
+	}
+}
+
+// Функция вывода содержимого корзины
+func listTrash() {
+	if jsonOutput {
+		printJSON(trash)
+		return
+	}
+	if len(trash) == 0 {
+		fmt.Println("Корзина пуста.")
+		return
+	}
+	for _, note := range trash {
+		fmt.Printf("  [%d] %s (удалена %s)\n", note.ID, firstLine(note.Content), note.DeletedAt.Local().Format("2006-01-02 15:04"))
+	}
+}
+
+// Функция вставки заметки в список с сохранением порядка по ID
+func insertNote(note Note) {
+	i := sort.Search(len(notes), func(i int) bool { return notes[i].ID > note.ID })
+	notes = append(notes, Note{})
+	copy(notes[i+1:], notes[i:])
+	notes[i] = note
+}
+
+// Функция возврата заметок из корзины. Заметка сохраняет свой ID,
+// если он не занят, иначе получает новый.
+func restoreNotes(ids []int) {
+	for _, id := range ids {
+		index := -1
+		for i, note := range trash {
+			if note.ID == id {
+				index = i
+				break
+			}
+		}
+		if index == -1 {
+			fmt.Printf("Заметки с ID %d нет в корзине.\n", id)
+			continue
+		}
+		note := trash[index]
+		trash = append(trash[:index], trash[index+1:]...)
+		note.DeletedAt = nil
+		taken := false
+		for _, n := range notes {
+			if n.ID == note.ID {
+				taken = true
+				break
+			}
+		}
+		if taken {
+			note.ID = nextID()
+			notes = append(notes, note)
+			fmt.Printf("Заметка %d восстановлена с новым ID %d (прежний ID занят).\n", id, note.ID)
+		} else {
+			insertNote(note)
+			fmt.Printf("Заметка с ID %d восстановлена.\n", id)
+		}
+		changed = true
+	}
+}
+
+// Задача сервера RESTful_API.go (только поля, участвующие в синхронизации)
+type remoteTask struct {
+	ID          int        `json:"id"`
+	Title       string     `json:"title"`
+	Description string     `json:"description"`
+	Completed   bool       `json:"completed"`
+	DueAt       *time.Time `json:"due_at,omitempty"`
+}
+
+// Функция представления заметки задачей: заголовок — явный заголовок или первая
+// строка, описание — остальной текст
+func noteToTask(note Note) remoteTask {
+	task := remoteTask{ID: note.RemoteID, Title: note.Title, Description: note.Content, Completed: note.Done, DueAt: note.Due}
+	if note.Title == "" {
+		task.Title, task.Description, _ = strings.Cut(note.Content, "\n")
+	}
+	return task
+}
+
+// Функция переноса полей задачи в заметку; now — время синхронизации
+func applyTask(note *Note, task remoteTask, now time.Time) {
+	if task.Description == "" {
+		note.Title, note.Content = "", task.Title
+	} else {
+		note.Title, note.Content = task.Title, task.Description
+	}
+	note.Tags = extractTags(note.Content)
+	note.Done = task.Completed
+	note.Due = task.DueAt
+	note.RemoteID = task.ID
+	note.SyncHash = taskHash(task)
+	note.UpdatedAt, note.SyncedAt = now, &now
+}
+
+// Функция проверки, менялась ли заметка после последней синхронизации:
+// по updated_at, а для синхронизированных до его появления — по отпечатку
+func changedSinceSync(note Note) bool {
+	if note.SyncedAt != nil {
+		return note.UpdatedAt.After(*note.SyncedAt)
+	}
+	return taskHash(noteToTask(note)) != note.SyncHash
+}
+
+// Функция отпечатка синхронизируемых полей: по нему видно, менялась ли
+// заметка или задача после последней синхронизации
+func taskHash(task remoteTask) string {
+	due := ""
+	if task.DueAt != nil {
+		due = strconv.FormatInt(task.DueAt.Unix(), 10)
+	}
+	sum := sha256.Sum256([]byte(strings.Join([]string{task.Title, task.Description, strconv.FormatBool(task.Completed), due}, "\x00")))
+	return hex.EncodeToString(sum[:8])
+}
+
+// Клиент сервера задач
+type syncClient struct {
+	server string
+	token  string
+	http   *http.Client
+}
+
+// Функция выполнения запроса к серверу задач; body и result могут быть nil
+func (c syncClient) do(method, path string, body, result interface{}) error {
+	var payload io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		payload = bytes.NewReader(data)
+	}
+	req, err := http.NewRequest(method, c.server+path, payload)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if c.token != "" {
+		req.Header.Set("Authorization", "Bearer "+c.token)
+	}
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		msg, _ := ioutil.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("%s %s: %s: %s", method, path, resp.Status, strings.TrimSpace(string(msg)))
+	}
+	if result == nil {
+		return nil
+	}
+	return json.NewDecoder(resp.Body).Decode(result)
+}
+
+// Функция синхронизации заметок с сервером задач. Изменения в обе стороны
+// планируются заранее; локальные заметки меняются после того, как все запросы
+// к серверу выполнились. Если запрос не удался, в заметках запоминаются только
+// уже созданные и обновлённые задачи (remote_id и отпечаток), чтобы следующая
+// синхронизация не создала их повторно; остальное не меняется.
+// Если с прошлой синхронизации изменились и заметка, и задача, сохраняются обе:
+// версия с сервера становится новой заметкой, а локальная — новой задачей.
+func syncNotes(c syncClient, dryRun bool) error {
+	now := time.Now()
+	var tasks []remoteTask
+	if err := c.do(http.MethodGet, "/tasks", nil, &tasks); err != nil {
+		return err
+	}
+	byID := make(map[int]remoteTask)
+	for _, task := range tasks {
+		byID[task.ID] = task
+	}
+
+	local := make([]Note, len(notes))
+	copy(local, notes)
+	linked := make(map[int]bool)
+	for _, note := range trash {
+		// Задачи для заметок в корзине не возвращаются обратно
+		linked[note.RemoteID] = true
+	}
+	var pushCreate, pushUpdate []int // индексы в local
+	var pulled []Note
+	for i := range local {
+		note := &local[i]
+		if note.RemoteID == 0 {
+			pushCreate = append(pushCreate, i)
+			continue
+		}
+		task, ok := byID[note.RemoteID]
+		if !ok {
+			fmt.Printf("Задача %d для заметки %d удалена на сервере, заметка будет отправлена заново.\n", note.RemoteID, note.ID)
+			note.RemoteID, note.SyncHash, note.SyncedAt = 0, "", nil
+			pushCreate = append(pushCreate, i)
+			continue
+		}
+		linked[task.ID] = true
+		localChanged := changedSinceSync(*note)
+		remoteChanged := taskHash(task) != note.SyncHash
+		switch {
+		case localChanged && remoteChanged:
+			fmt.Printf("Конфликт: заметка %d и задача %d изменены с прошлой синхронизации, сохраняются обе версии.\n", note.ID, task.ID)
+			copyNote := Note{CreatedAt: now}
+			applyTask(&copyNote, task, now)
+			pulled = append(pulled, copyNote)
+			note.RemoteID, note.SyncHash, note.SyncedAt = 0, "", nil
+			pushCreate = append(pushCreate, i)
+		case localChanged:
+			pushUpdate = append(pushUpdate, i)
+		case remoteChanged:
+			fmt.Printf("← заметка %d: обновить из задачи %d\n", note.ID, task.ID)
+			applyTask(note, task, now)
+		}
+	}
+	for _, task := range tasks {
+		if !linked[task.ID] {
+			note := Note{CreatedAt: now}
+			applyTask(&note, task, now)
+			pulled = append(pulled, note)
+		}
+	}
+
+	for _, i := range pushCreate {
+		fmt.Printf("→ сервер: создать задачу из заметки %d «%s»\n", local[i].ID, noteTitle(local[i]))
+	}
+	for _, i := range pushUpdate {
+		fmt.Printf("→ сервер: обновить задачу %d из заметки %d\n", local[i].RemoteID, local[i].ID)
+	}
+	for _, note := range pulled {
+		fmt.Printf("← новая заметка из задачи %d «%s»\n", note.RemoteID, noteTitle(note))
+	}
+	if dryRun {
+		fmt.Println("Пробный запуск, изменения не выполняются.")
+		return nil
+	}
+
+	var pushed []int // индексы отправленных заметок
+	abort := func(err error) error {
+		for _, i := range pushed {
+			notes[i].RemoteID, notes[i].SyncHash, notes[i].SyncedAt = local[i].RemoteID, local[i].SyncHash, local[i].SyncedAt
+		}
+		if len(pushed) > 0 {
+			changed = true
+			fmt.Printf("Синхронизация прервана: отправлено %d из %d изменений, они запомнены в заметках.\n", len(pushed), len(pushCreate)+len(pushUpdate))
+		}
+		return err
+	}
+	for _, i := range pushCreate {
+		var created remoteTask
+		if err := c.do(http.MethodPost, "/tasks", noteToTask(local[i]), &created); err != nil {
+			return abort(err)
+		}
+		local[i].RemoteID = created.ID
+		local[i].SyncHash = taskHash(noteToTask(local[i]))
+		local[i].SyncedAt = &now
+		pushed = append(pushed, i)
+	}
+	for _, i := range pushUpdate {
+		task := noteToTask(local[i])
+		if err := c.do(http.MethodPut, "/tasks/"+strconv.Itoa(task.ID), task, nil); err != nil {
+			return abort(err)
+		}
+		local[i].SyncHash = taskHash(task)
+		local[i].SyncedAt = &now
+		pushed = append(pushed, i)
+	}
+
+	notes = local
+	for _, note := range pulled {
+		note.ID = nextID()
+		notes = append(notes, note)
+	}
+	changed = true
+	fmt.Printf("Синхронизировано: отправлено %d новых и %d изменённых, получено %d новых.\n", len(pushCreate), len(pushUpdate), len(pulled))
+	return nil
+}
+
+// Правило повторения шаблона заметки
+type repeatRule struct {
+	Every string   `json:"every"`          // daily, weekly, monthly или days (по дням недели)
+	Days  []string `json:"days,omitempty"` // Для days: mon, thu, ...
+	Start string   `json:"start"`          // Первый день повторения (2006-01-02)
+	Last  string   `json:"last,omitempty"` // Последний день, за который созданы заметки
+}
+
+// Функция разбора --repeat: daily, weekly, monthly или список дней недели "mon,thu"
+func parseRepeat(expr string, now time.Time) (*repeatRule, error) {
+	rule := &repeatRule{Every: strings.ToLower(strings.TrimSpace(expr)), Start: startOfDay(now).Format(dateLayout)}
+	switch rule.Every {
+	case "daily", "weekly", "monthly":
+		return rule, nil
+	}
+	for _, day := range strings.Split(rule.Every, ",") {
+		day = strings.TrimSpace(day)
+		if _, ok := weekdays[day]; !ok {
+			return nil, fmt.Errorf("неверное повторение %q; допустимо: daily, weekly, monthly или дни недели через запятую (mon,thu)", expr)
+		}
+		rule.Days = append(rule.Days, day)
+	}
+	rule.Every = "days"
+	return rule, nil
+}
+
+// Функция проверки, приходится ли повторение на день day (полночь по местному времени)
+func (r repeatRule) matches(day, start time.Time) bool {
+	switch r.Every {
+	case "daily":
+		return true
+	case "weekly":
+		return day.Weekday() == start.Weekday()
+	case "monthly":
+		// 31-е число в коротком месяце переносится на последний день месяца
+		lastDay := time.Date(day.Year(), day.Month()+1, 0, 12, 0, 0, 0, time.Local).Day()
+		return day.Day() == min(start.Day(), lastDay)
+	case "days":
+		for _, name := range r.Days {
+			if weekdays[name] == day.Weekday() {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// Функция описания правила для вывода
+func (r repeatRule) String() string {
+	if r.Every == "days" {
+		return strings.Join(r.Days, ",")
+	}
+	return r.Every
+}
+
+// Функция создания заметок по шаблонам за дни с последнего запуска по сегодняшний
+// включительно. День последнего создания запоминается в шаблоне, поэтому
+// повторный запуск заметок не дублирует. Возвращает число созданных заметок.
+func materializeRepeats(now time.Time) int {
+	today := startOfDay(now)
+	created := 0
+	for i := range repeats {
+		tmpl := &repeats[i]
+		start, err := parseDay(tmpl.Repeat.Start)
+		if err != nil {
+			continue
+		}
+		day := start
+		if last, err := parseDay(tmpl.Repeat.Last); err == nil && !last.Before(start) {
+			day = addDays(last, 1)
+		}
+		// Дни перебираются по календарю, а не прибавлением суток к моменту времени:
+		// иначе после дня без полуночи сдвинутое время переходит во все следующие дни
+		for ; !day.After(today); day = addDays(day, 1) {
+			if !tmpl.Repeat.matches(day, start) {
+				continue
+			}
+			due := day
+			notes = append(notes, Note{
+				ID:         nextID(),
+				Title:      tmpl.Title,
+				Content:    tmpl.Content,
+				CreatedAt:  now,
+				UpdatedAt:  now,
+				Tags:       append([]string(nil), tmpl.Tags...),
+				Due:        &due,
+				TemplateID: tmpl.ID,
+			})
+			created++
+		}
+		if tmpl.Repeat.Last != today.Format(dateLayout) {
+			tmpl.Repeat.Last = today.Format(dateLayout)
+			changed = true
+		}
+	}
+	return created
+}
+
+// Функция вывода шаблонов повторяющихся заметок
+func listRepeats() {
+	if jsonOutput {
+		printJSON(repeats)
+		return
+	}
+	if len(repeats) == 0 {
+		fmt.Println("Повторяющихся заметок нет.")
+		return
+	}
+	for _, tmpl := range repeats {
+		fmt.Printf("[%d] %s (повтор: %s, с %s)\n", tmpl.ID, noteTitle(tmpl), tmpl.Repeat, tmpl.Repeat.Start)
+	}
+}
+
+// Функция удаления шаблона; уже созданные по нему заметки остаются
+func deleteRepeat(id int) {
+	for i, tmpl := range repeats {
+		if tmpl.ID == id {
+			repeats = append(repeats[:i], repeats[i+1:]...)
+			changed = true
+			fmt.Printf("Повторение %d удалено, созданные заметки сохранены.\n", id)
+			return
+		}
+	}
+	fail("Повторяющейся заметки с ID %d нет.", id)
+}
+
+// Итоги импорта
+type importResult struct {
+	notes      []Note   // Заметки для добавления, уже с новыми ID
+	updates    []Note   // Изменённые существующие заметки (CSV со знакомым id)
+	skipped    int      // Пустые строки и записи без текста
+	duplicates int      // Записи, текст которых уже есть среди заметок
+	warnings   []string // Предупреждения разбора (неизвестные столбцы CSV)
+}
+
+// Столбцы CSV при экспорте; импорт находит их по заголовку в любом порядке
+var csvColumns = []string{"id", "created_at", "updated_at", "title", "content", "tags", "done", "due", "pinned"}
+
+// Функция чтения CSV, сохраняющая \r внутри полей в кавычках: encoding/csv заменяет
+// в них \r\n на \n, и текст заметки не пережил бы export→import байт в байт. Перед
+// разбором такие \r подменяются символом, которого нет в данных, и возвращаются в поля
+// после него; \r вне кавычек (концы строк CRLF из таблиц) csv обрабатывает как обычно.
+// Чётность числа кавычек задаёт, внутри ли поля байт: "" внутри поля переключает её дважды
+func readCSV(data []byte) ([][]string, error) {
+	if !bytes.ContainsRune(data, '\r') {
+		return csv.NewReader(bytes.NewReader(data)).ReadAll()
+	}
+	mark := '\uE000'
+	for bytes.ContainsRune(data, mark) {
+		mark++
+	}
+	var buf bytes.Buffer
+	quoted := false
+	for _, c := range data {
+		switch {
+		case c == '"':
+			quoted = !quoted
+		case c == '\r' && quoted:
+			buf.WriteRune(mark)
+			continue
+		}
+		buf.WriteByte(c)
+	}
+	records, err := csv.NewReader(&buf).ReadAll()
+	if err != nil {
+		return nil, err
+	}
+	for _, record := range records {
+		for i := range record {
+			record[i] = strings.ReplaceAll(record[i], string(mark), "\r")
+		}
+	}
+	return records, nil
+}
+
+// Функция разбора CSV в формате экспорта. Для строк с id возвращает и
+// их позиции в entries (ids[i] — id строки или 0, если его нет).
+func parseImportCSV(data []byte) (entries []Note, ids []int, warnings []string, err error) {
+	records, err := readCSV(data)
+	if err != nil {
+		return nil, nil, nil, fmt.Errorf("ошибка разбора CSV: %v", err)
+	}
+	if len(records) == 0 {
+		return nil, nil, nil, nil
+	}
+	column := make(map[string]int)
+	for i, name := range records[0] {
+		name = strings.ToLower(strings.TrimSpace(name))
+		if slices.Contains(csvColumns, name) {
+			column[name] = i
+		} else {
+			warnings = append(warnings, fmt.Sprintf("неизвестный столбец %q пропущен", records[0][i]))
+		}
+	}
+	if _, ok := column["content"]; !ok {
+		return nil, nil, nil, fmt.Errorf("в CSV нет столбца content")
+	}
+	for n, record := range records[1:] {
+		line := n + 2
+		field := func(name string) string {
+			if i, ok := column[name]; ok && i < len(record) {
+				return record[i]
+			}
+			return ""
+		}
+		entry := Note{Title: field("title"), Content: field("content")}
+		id := 0
+		if v := strings.TrimSpace(field("id")); v != "" {
+			if id, err = strconv.Atoi(v); err != nil {
+				return nil, nil, nil, fmt.Errorf("строка %d: неверный id %q", line, v)
+			}
+		}
+		for name, dst := range map[string]*time.Time{"created_at": &entry.CreatedAt, "updated_at": &entry.UpdatedAt} {
+			if v := field(name); v != "" {
+				if *dst, err = time.Parse(time.RFC3339, v); err != nil {
+					return nil, nil, nil, fmt.Errorf("строка %d: неверная дата %s %q", line, name, v)
+				}
+			}
+		}
+		for _, tag := range strings.Split(field("tags"), ";") {
+			if tag = strings.TrimSpace(tag); tag != "" {
+				entry.Tags = append(entry.Tags, tag)
+			}
+		}
+		for name, dst := range map[string]*bool{"done": &entry.Done, "pinned": &entry.Pinned} {
+			if v := field(name); v != "" {
+				if *dst, err = strconv.ParseBool(v); err != nil {
+					return nil, nil, nil, fmt.Errorf("строка %d: неверное значение %s %q", line, name, v)
+				}
+			}
+		}
+		if v := field("due"); v != "" {
+			due, err := time.ParseInLocation(dateLayout, v, time.Local)
+			if err != nil {
+				return nil, nil, nil, fmt.Errorf("строка %d: неверный срок %q", line, v)
+			}
+			entry.Due = &due
+		}
+		entries = append(entries, entry)
+		ids = append(ids, id)
+	}
+	return entries, ids, warnings, nil
+}
+
+// Функция разбора файла импорта: lines — заметка на строку, json — массив заметок
+// (created_at сохраняется, если указан), csv — формат export --format=csv;
+// строки CSV с id существующей заметки обновляют её. Текущие заметки не изменяются.
+func parseImport(data []byte, format string, allowDuplicates bool, now time.Time) (importResult, error) {
+	var result importResult
+	var entries []Note
+	var ids []int
+	switch format {
+	case "lines":
+		for _, line := range strings.Split(strings.TrimSuffix(string(data), "\n"), "\n") {
+			entries = append(entries, Note{Content: strings.TrimRight(line, "\r")})
+		}
+	case "json":
+		if err := json.Unmarshal(data, &entries); err != nil {
+			return importResult{}, fmt.Errorf("ошибка разбора JSON: %v", err)
+		}
+	case "csv":
+		var err error
+		if entries, ids, result.warnings, err = parseImportCSV(data); err != nil {
+			return importResult{}, err
+		}
+	default:
+		return importResult{}, fmt.Errorf("--format: ожидается lines, json или csv, получено %q", format)
+	}
+
+	existing := make(map[string]bool)
+	for _, note := range notes {
+		existing[note.Content] = true
+	}
+	for n, entry := range entries {
+		if strings.TrimSpace(entry.Content) == "" {
+			result.skipped++
+			continue
+		}
+		if n < len(ids) && ids[n] != 0 {
+			if i := noteIndex(ids[n]); i >= 0 {
+				updated := notes[i]
+				updated.Title, updated.Content, updated.Done, updated.Pinned, updated.Due = entry.Title, entry.Content, entry.Done, entry.Pinned, entry.Due
+				updated.Tags = normalizeTags(append(extractTags(entry.Content), entry.Tags...))
+				// Строки, совпадающие с заметкой, не считаются изменением
+				before, _ := json.Marshal(notes[i])
+				after, _ := json.Marshal(updated)
+				if !bytes.Equal(before, after) {
+					updated.UpdatedAt = now
+					result.updates = append(result.updates, updated)
+				}
+				continue
+			}
+		}
+		if existing[entry.Content] && !allowDuplicates {
+			result.duplicates++
+			continue
+		}
+		existing[entry.Content] = true
+		created := entry.CreatedAt
+		if created.IsZero() {
+			created = now
+		}
+		updated := entry.UpdatedAt
+		if updated.Before(created) {
+			updated = created
+		}
+		result.notes = append(result.notes, Note{
+			ID:        nextID(),
+			Title:     entry.Title,
+			Content:   entry.Content,
+			CreatedAt: created,
+			UpdatedAt: updated,
+			Tags:      normalizeTags(append(extractTags(entry.Content), entry.Tags...)),
+			Due:       entry.Due,
+			Done:      entry.Done,
+			Pinned:    entry.Pinned,
+		})
+	}
+	return result, nil
+}
+
+// Символы, которые в Markdown нужно экранировать обратной косой чертой
+var markdownEscaper = strings.NewReplacer(
+	`\`, `\\`, "`", "\\`", "*", `\*`, "_", `\_`, "[", `\[`, "]", `\]`,
+	"<", `\<`, ">", `\>`, "#", `\#`, "|", `\|`, "~", `\~`,
+)
+
+// Функция экранирования текста заметки для Markdown; строки после первой
+// сдвигаются, чтобы остаться внутри пункта списка
+func escapeMarkdown(content string) string {
+	lines := strings.Split(content, "\n")
+	for i, line := range lines {
+		line = markdownEscaper.Replace(line)
+		// "1. текст" в начале строки Markdown считает нумерованным списком
+		if j := strings.IndexFunc(line, func(r rune) bool { return !unicode.IsDigit(r) }); j > 0 && line[j] == '.' {
+			line = line[:j] + `\` + line[j:]
+		}
+		if i > 0 {
+			line = "  " + line
+		}
+		lines[i] = line
+	}
+	return strings.Join(lines, "\n")
+}
+
+// Функция формирования списка тегов вида " #work #home"; теги,
+// уже записанные хэштегами в тексте, не повторяются
+func tagSuffix(note Note) string {
+	inline := make(map[string]bool)
+	for _, tag := range extractTags(note.Content) {
+		inline[tag] = true
+	}
+	var suffix string
+	for _, tag := range note.Tags {
+		if !inline[tag] {
+			suffix += " #" + tag
+		}
+	}
+	return suffix
+}
+
+// Функция экспорта заметок в Markdown, простой текст или CSV
+func exportNotes(list []Note, format string) ([]byte, error) {
+	var buf bytes.Buffer
+	switch format {
+	case "md":
+		for i, note := range list {
+			day := note.CreatedAt.Local().Format(dateLayout)
+			if i == 0 || day != list[i-1].CreatedAt.Local().Format(dateLayout) {
+				if i > 0 {
+					buf.WriteString("\n")
+				}
+				fmt.Fprintf(&buf, "## %s\n\n", day)
+			}
+			if note.Done {
+				buf.WriteString("- [x] ")
+			} else {
+				buf.WriteString("- [ ] ")
+			}
+			if note.Pinned {
+				buf.WriteString(pinMark + " ")
+			}
+			if note.Title != "" {
+				fmt.Fprintf(&buf, "**%s** — ", markdownEscaper.Replace(note.Title))
+			}
+			fmt.Fprintf(&buf, "%s%s", escapeMarkdown(note.Content), tagSuffix(note))
+			if note.Due != nil {
+				fmt.Fprintf(&buf, " (срок: %s)", note.Due.Format(dateLayout))
+			}
+			buf.WriteString("\n")
+		}
+	case "txt":
+		for _, note := range list {
+			content := strings.ReplaceAll(note.Content, "\n", "\n    ")
+			if note.Title != "" {
+				content = note.Title + " — " + content
+			}
+			if note.Pinned {
+				content = pinMark + " " + content
+			}
+			fmt.Fprintf(&buf, "%s [%d] %s%s", note.CreatedAt.Local().Format("2006-01-02 15:04"), note.ID, content, tagSuffix(note))
+			if note.Due != nil {
+				fmt.Fprintf(&buf, " (срок: %s)", note.Due.Format(dateLayout))
+			}
+			buf.WriteString("\n")
+		}
+	case "csv":
+		w := csv.NewWriter(&buf)
+		w.Write(csvColumns)
+		for _, note := range list {
+			due := ""
+			if note.Due != nil {
+				due = note.Due.Format(dateLayout)
+			}
+			w.Write([]string{strconv.Itoa(note.ID), note.CreatedAt.Format(time.RFC3339), note.UpdatedAt.Format(time.RFC3339), note.Title, note.Content,
+				strings.Join(note.Tags, ";"), strconv.FormatBool(note.Done), due, strconv.FormatBool(note.Pinned)})
+		}
+		w.Flush()
+		if err := w.Error(); err != nil {
+			return nil, err
+		}
+	default:
+		return nil, fmt.Errorf("--format: ожидается md, txt или csv, получено %q", format)
+	}
+	return buf.Bytes(), nil
+}
+
+// Основная логика
+func main() {
+	os.Args = extractGlobalFlags(os.Args)
+	var err error
+	if output, err = choosePainter(colorMode); err != nil {
+		fail("%v", err)
+	}
+
+	os.Args = stripTermuxPath(os.Args)
+
+	// Если аргументов меньше 2, выводим использование
+	if len(os.Args) < 2 {
+		fail("Использование: daylist [%s] [аргументы...]\nСправка: daylist help", strings.Join(commandNames(), "|"))
+	}
+	command := os.Args[1]
+
+	// Справка и автодополнение не читают файл заметок
+	switch command {
+	case "help":
+		if len(os.Args) < 3 {
+			printHelp()
+			return
+		}
+		if commandUsage(os.Args[2]) == "" {
+			fail("Неизвестная команда: %s", os.Args[2])
+		}
+		// help <команда> — то же, что <команда> -h
+		command = os.Args[2]
+		os.Args = []string{os.Args[0], command, "-h"}
+		helpMode = true
+	case "completion":
+		if len(os.Args) < 3 {
+			fail("Использование: daylist %s", commandUsage("completion"))
+		}
+		if err := printCompletion(os.Args[2]); err != nil {
+			fail("%v", err)
+		}
+		return
+	}
+
+	// Блокировка держится до выхода, чтобы параллельные запуски (например,
+	// remind из cron) не затирали изменения друг друга
+	if !helpMode {
+		if err := lockNotes(readOnlyCommands[command]); err != nil {
+			fail("Ошибка блокировки: %v", err)
+		}
+	}
+
+	// restore работает и с повреждённым файлом, поэтому выполняется до загрузки
+	if command == "restore" && len(os.Args) < 3 {
+		if err := restoreBackup(); err != nil {
+			fail("Ошибка восстановления: %v", err)
+		}
+		exit(0)
+	}
+
+	// Загружаем заметки из файла
+	if !helpMode {
+		if err := loadNotes(); err != nil {
+			fail("Ошибка загрузки заметок: %v", err)
+		}
+		autoPurgeTrash(time.Now())
+	}
+	if generated := materializeRepeats(time.Now()); command == "tick" && !helpMode {
+		fmt.Printf("Создано повторяющихся заметок: %d\n", generated)
+	}
+
+	switch command {
+	case "add":
+		fs := newFlagSet("add")
+		var tags stringList
+		fs.Var(&tags, "tag", "тег заметки (можно повторять)")
+		dueExpr := fs.String("due", "", "срок: 2024-05-12, today, tomorrow, friday, +3d")
+		edit := fs.Bool("edit", false, "набрать текст заметки в редакторе $EDITOR")
+		title := fs.String("title", "", "заголовок заметки")
+		repeatExpr := fs.String("repeat", "", "повторять: daily|weekly|monthly или дни недели (mon,thu)")
+		args := parseArgs(fs, os.Args[2:])
+		var content string
+		var err error
+		switch {
+		case *edit:
+			content, err = editContent()
+		case len(args) > 0 && args[0] == "-", len(args) == 0 && stdinPiped():
+			content, err = readContent(stdin)
+		case len(args) > 0:
+			content = args[0]
+		default:
+			fail("Использование: daylist add \"Содержание заметки\" [--tag=тег] [--due=срок]\n" +
+				"  или: daylist add - < файл, daylist add --edit")
+		}
+		if err != nil {
+			fail("Ошибка чтения заметки: %v", err)
+		}
+		if strings.TrimSpace(content) == "" {
+			fail("Заметка не может быть пустой.")
+		}
+		var due *time.Time
+		if *dueExpr != "" {
+			t, err := parseDue(*dueExpr, time.Now())
+			if err != nil {
+				fail("%v", err)
+			}
+			due = &t
+		}
+		if *repeatExpr != "" {
+			if due != nil {
+				fail("--repeat и --due нельзя использовать вместе: срок задаётся каждой созданной заметке")
+			}
+			rule, err := parseRepeat(*repeatExpr, time.Now())
+			if err != nil {
+				fail("%v", err)
+			}
+			tmpl := Note{ID: nextID(), Title: strings.TrimSpace(*title), Content: content, CreatedAt: time.Now(),
+				Tags: normalizeTags(append(extractTags(content), tags...)), Repeat: rule}
+			tmpl.UpdatedAt = tmpl.CreatedAt
+			repeats = append(repeats, tmpl)
+			changed = true
+			fmt.Printf("Повторяющаяся заметка добавлена с ID %d (%s)\n", tmpl.ID, rule)
+			materializeRepeats(time.Now())
+			break
+		}
+		addNote(strings.TrimSpace(*title), content, tags, due)
+	case "list", "days":
+		fs := newFlagSet(command)
+		var filter noteFilter
+		fs.StringVar(&filter.tag, "tag", "", "показать только заметки с этим тегом")
+		fs.BoolVar(&filter.overdue, "overdue", false, "показать только просроченные заметки")
+		fs.BoolVar(&filter.pinned, "pinned", false, "показать только закреплённые заметки")
+		fs.IntVar(&filter.last, "last", 0, "показать только N последних заметок")
+		fs.IntVar(&filter.minWords, "min-words", 0, "показать только заметки не короче N слов")
+		today := fs.Bool("today", false, "заметки, созданные сегодня")
+		yesterday := fs.Bool("yesterday", false, "заметки, созданные вчера")
+		date := fs.String("date", "", "заметки, созданные в этот день (2024-05-01)")
+		from := fs.String("from", "", "заметки, созданные с этого дня (включительно)")
+		to := fs.String("to", "", "заметки, созданные по этот день (включительно)")
+		sortKey := fs.String("sort", "created", "порядок: created|updated|due|id")
+		reverse := fs.Bool("reverse", false, "обратный порядок")
+		groupDefault := ""
+		if command == "days" {
+			groupDefault = "day"
+		}
+		groupBy := fs.String("group-by", groupDefault, "группировка: day")
+		fs.IntVar(&rowWidth, "width", 0, "ширина строки (по умолчанию ширина терминала)")
+		fs.BoolVar(&fullRows, "full", false, "многострочный вывод с полным текстом")
+		archived := fs.Bool("archived", false, "показать заметки из архива (только чтение)")
+		month := fs.String("month", "", "с --archived: только архив месяца (2023-12)")
+		parseArgs(fs, os.Args[2:])
+		if err := dateRange(&filter, *today, *yesterday, *date, *from, *to, time.Now()); err != nil {
+			fail("%v", err)
+		}
+		source := notes
+		if *archived || *month != "" {
+			var err error
+			if source, err = loadArchives(*month); err != nil {
+				fail("%v", err)
+			}
+		}
+		listNotes(source, filter, *sortKey, *reverse, *groupBy)
+	case "agenda", "ui", "tick", "encrypt", "decrypt", "tags":
+		// Команды без аргументов; флаги разбираются ради -h
+		parseArgs(newFlagSet(command), os.Args[2:])
+		switch command {
+		case "agenda":
+			showAgenda()
+		case "ui":
+			runUI(stdin)
+		case "encrypt":
+			encryptNotes()
+		case "decrypt":
+			decryptNotes()
+		case "tags":
+			listTags()
+		}
+		// tick: заметки по шаблонам уже созданы при загрузке
+	case "_ids":
+		// Скрытая команда для автодополнения
+		for _, note := range notes {
+			fmt.Println(note.ID)
+		}
+	case "snooze":
+		fs := newFlagSet("snooze")
+		set := fs.Bool("set", false, "назначить срок заметке, у которой его нет")
+		args := parseArgs(fs, os.Args[2:])
+		if len(args) != 2 {
+			fail("Использование: daylist %s", commandUsage("snooze"))
+		}
+		id, err := strconv.Atoi(args[0])
+		if err != nil {
+			fail("ID заметки должно быть числом.")
+		}
+		snoozeNote(id, args[1], *set, time.Now())
+	case "copy":
+		fs := newFlagSet("copy")
+		dueExpr := fs.String("due", "", "срок копии: 2024-05-12, today, tomorrow, friday, +3d")
+		args := parseArgs(fs, os.Args[2:])
+		if len(args) != 1 {
+			fail("Использование: daylist copy <ID_заметки> [--due=tomorrow]")
+		}
+		id, err := strconv.Atoi(args[0])
+		if err != nil {
+			fail("ID заметки должно быть числом.")
+		}
+		var due *time.Time
+		if *dueExpr != "" {
+			t, err := parseDue(*dueExpr, time.Now())
+			if err != nil {
+				fail("%v", err)
+			}
+			due = &t
+		}
+		copyNote(id, due)
+	case "attach":
+		fs := newFlagSet("attach")
+		copyFile := fs.Bool("copy", false, "скопировать файл в каталог attachments рядом с notes.json")
+		args := parseArgs(fs, os.Args[2:])
+		if len(args) != 2 {
+			fail("Использование: daylist attach <ID_заметки> <путь> [--copy]")
+		}
+		id, err := strconv.Atoi(args[0])
+		if err != nil {
+			fail("ID заметки должно быть числом.")
+		}
+		attachFile(id, args[1], *copyFile)
+	case "detach":
+		args := parseArgs(newFlagSet("detach"), os.Args[2:])
+		if len(args) < 2 {
+			fail("Использование: daylist detach <ID_заметки> <номер_вложения>")
+		}
+		id, err := strconv.Atoi(args[0])
+		if err != nil {
+			fail("ID заметки должно быть числом.")
+		}
+		index, err := strconv.Atoi(args[1])
+		if err != nil {
+			fail("Номер вложения должен быть числом.")
+		}
+		detachFile(id, index)
+	case "show":
+		fs := newFlagSet("show")
+		withLinks := fs.Bool("with-links", false, "вывести и связанные заметки")
+		args := parseArgs(fs, os.Args[2:])
+		if len(args) < 1 {
+			fail("Использование: daylist show <ID_или_начало_текста>... [--with-links]")
+		}
+		showNotes(args, *withLinks)
+	case "link":
+		args := parseArgs(newFlagSet("link"), os.Args[2:])
+		if len(args) < 2 {
+			fail("Использование: daylist link <ID1> <ID2>")
+		}
+		a, errA := strconv.Atoi(args[0])
+		b, errB := strconv.Atoi(args[1])
+		if errA != nil || errB != nil {
+			fail("ID заметки должно быть числом.")
+		}
+		linkNotes(a, b)
+	case "export":
+		fs := newFlagSet("export")
+		var filter noteFilter
+		format := fs.String("format", "md", "формат: md|txt|csv")
+		out := fs.String("out", "", "файл для записи (по умолчанию stdout)")
+		fs.StringVar(&filter.tag, "tag", "", "только заметки с этим тегом")
+		from := fs.String("from", "", "заметки, созданные с этого дня (включительно)")
+		to := fs.String("to", "", "заметки, созданные по этот день (включительно)")
+		parseArgs(fs, os.Args[2:])
+		if err := dateRange(&filter, false, false, "", *from, *to, time.Now()); err != nil {
+			fail("%v", err)
+		}
+		list := filterNotes(notes, filter, time.Now())
+		sortNotes(list, "created", false)
+		data, err := exportNotes(list, *format)
+		if err != nil {
+			fail("%v", err)
+		}
+		if *out == "" {
+			os.Stdout.Write(data)
+		} else if err := ioutil.WriteFile(*out, data, 0644); err != nil {
+			fail("Ошибка записи файла: %v", err)
+		} else {
+			fmt.Printf("Экспортировано заметок: %d в %s\n", len(list), *out)
+		}
+	case "edit":
+		fs := newFlagSet("edit")
+		var tags stringList
+		fs.Var(&tags, "tag", "добавить тег (можно повторять)")
+		title := fs.String("title", "", "новый заголовок")
+		args := parseArgs(fs, os.Args[2:])
+		if len(args) < 2 {
+			fail("Использование: daylist edit <ID_заметки> \"Новое содержание\" [--tag=тег] [--title=заголовок]")
+		}
+		id, err := strconv.Atoi(args[0])
+		if err != nil {
+			fail("ID заметки должно быть числом.")
+		}
+		var newTitle *string
+		fs.Visit(func(f *flag.Flag) {
+			if f.Name == "title" {
+				t := strings.TrimSpace(*title)
+				newTitle = &t
+			}
+		})
+		editNote(id, newTitle, args[1], tags)
+	case "search":
+		fs := newFlagSet("search")
+		titleOnly := fs.Bool("title-only", false, "искать только в заголовках")
+		fs.IntVar(&rowWidth, "width", 0, "ширина строки (по умолчанию ширина терминала)")
+		fs.BoolVar(&fullRows, "full", false, "многострочный вывод с полным текстом")
+		archived := fs.Bool("archived", false, "искать в архиве (только чтение)")
+		fuzzy := fs.Bool("fuzzy", false, "нечёткий поиск с оценкой, терпит опечатки")
+		minWords := fs.Int("min-words", 0, "только заметки не короче N слов")
+		limit := fs.Int("limit", 10, "с --fuzzy: сколько лучших заметок показать")
+		args := parseArgs(fs, os.Args[2:])
+		if len(args) < 1 {
+			fail("Использование: daylist search <текст> [--title-only] [--archived] [--fuzzy [--limit=N]]")
+		}
+		source := notes
+		if *archived {
+			var err error
+			if source, err = loadArchives(""); err != nil {
+				fail("%v", err)
+			}
+		}
+		source = filterNotes(source, noteFilter{minWords: *minWords}, time.Now())
+		if *fuzzy {
+			ranked := fuzzySearch(source, strings.Join(args, " "), *limit, *titleOnly)
+			if jsonOutput {
+				list := make([]Note, len(ranked))
+				for i, r := range ranked {
+					list[i] = r.note
+				}
+				printJSON(list)
+				break
+			}
+			if len(ranked) == 0 {
+				fmt.Println("Заметок не найдено.")
+			}
+			// Оценка выводится перед строкой, поэтому строка короче на её ширину
+			if rowWidth <= 0 {
+				rowWidth = terminalWidth()
+			}
+			rowWidth -= 6
+			for _, r := range ranked {
+				fmt.Printf("%5d ", r.score)
+				printRow(r.note, "")
+			}
+			break
+		}
+		result := searchNotes(source, strings.Join(args, " "), *titleOnly)
+		if jsonOutput {
+			printJSON(result)
+			break
+		}
+		if len(result) == 0 {
+			fmt.Println("Заметок не найдено.")
+		}
+		for _, note := range result {
+			printRow(note, "")
+		}
+	case "done", "undone":
+		args := parseArgs(newFlagSet(command), os.Args[2:])
+		if len(args) < 1 {
+			fail("Использование: daylist %s <ID_заметки>", command)
+		}
+		id, err := strconv.Atoi(args[0])
+		if err != nil {
+			fail("ID заметки должно быть числом.")
+		}
+		setDone(id, command == "done")
+	case "pin", "unpin":
+		args := parseArgs(newFlagSet(command), os.Args[2:])
+		if len(args) < 1 {
+			fail("Использование: daylist %s <ID_заметки>", command)
+		}
+		id, err := strconv.Atoi(args[0])
+		if err != nil {
+			fail("ID заметки должно быть числом.")
+		}
+		pinNote(id, command == "pin")
+	case "sync":
+		fs := newFlagSet("sync")
+		server := fs.String("server", "http://localhost:8080", "адрес сервера RESTful_API.go")
+		token := fs.String("token", "", "токен для заголовка Authorization: Bearer")
+		dryRun := fs.Bool("dry-run", false, "только показать, что будет отправлено и получено")
+		parseArgs(fs, os.Args[2:])
+		client := syncClient{server: strings.TrimRight(*server, "/"), token: *token, http: &http.Client{Timeout: 15 * time.Second}}
+		if err := syncNotes(client, *dryRun); err != nil {
+			if !changed {
+				fail("Ошибка синхронизации (локальные заметки не изменены): %v", err)
+			}
+			if err := saveNotes(); err != nil {
+				fail("Ошибка сохранения заметок: %v", err)
+			}
+			fail("Ошибка синхронизации: %v", err)
+		}
+	case "repeat":
+		args := parseArgs(newFlagSet("repeat"), os.Args[2:])
+		switch {
+		case len(args) == 0 || args[0] == "list":
+			listRepeats()
+		case args[0] == "delete" && len(args) > 1:
+			id, err := strconv.Atoi(args[1])
+			if err != nil {
+				fail("ID заметки должно быть числом.")
+			}
+			deleteRepeat(id)
+		default:
+			fail("Использование: daylist repeat list|delete <ID>")
+		}
+	case "import":
+		fs := newFlagSet("import")
+		format := fs.String("format", "", "формат: lines|json|csv (по умолчанию по расширению файла)")
+		allowDuplicates := fs.Bool("allow-duplicates", false, "импортировать и заметки, текст которых уже есть")
+		dryRun := fs.Bool("dry-run", false, "только показать, что будет импортировано")
+		args := parseArgs(fs, os.Args[2:])
+		if len(args) < 1 {
+			fail("Использование: daylist import <файл> [--format=lines|json|csv] [--dry-run]")
+		}
+		if *format == "" {
+			switch strings.ToLower(filepath.Ext(args[0])) {
+			case ".json":
+				*format = "json"
+			case ".csv":
+				*format = "csv"
+			default:
+				*format = "lines"
+			}
+		}
+		data, err := ioutil.ReadFile(args[0])
+		if err != nil {
+			fail("Ошибка чтения файла: %v", err)
+		}
+		result, err := parseImport(data, *format, *allowDuplicates, time.Now())
+		if err != nil {
+			fail("%v", err)
+		}
+		for _, warning := range result.warnings {
+			fmt.Fprintf(os.Stderr, "Предупреждение: %s\n", warning)
+		}
+		if *dryRun {
+			fmt.Println("Пробный запуск, заметки не добавляются:")
+			for _, note := range result.notes {
+				fmt.Printf("  [%d] %s\n", note.ID, note.Content)
+			}
+			for _, note := range result.updates {
+				fmt.Printf("  [%d] (изменится) %s\n", note.ID, firstLine(note.Content))
+			}
+		} else {
+			// Заметки добавляются одним шагом только после разбора всего файла
+			notes = append(notes, result.notes...)
+			for _, note := range result.updates {
+				notes[noteIndex(note.ID)] = note
+			}
+			changed = len(result.notes)+len(result.updates) > 0
+		}
+		fmt.Printf("Импортировано: %d, обновлено: %d, пропущено: %d, дубликатов: %d\n", len(result.notes), len(result.updates), result.skipped, result.duplicates)
+	case "delete":
+		fs := newFlagSet("delete")
+		yes := fs.Bool("yes", false, "не спрашивать подтверждения")
+		force := fs.Bool("force", false, "удалить насовсем, минуя корзину")
+		args := parseArgs(fs, os.Args[2:])
+		if len(args) < 1 {
+			fail("Использование: daylist delete <ID_заметки>... (например, 3 5 7-12) [--yes] [--force]")
+		}
+		ids, err := parseIDs(args)
+		if err != nil {
+			fail("%v", err)
+		}
+		deleteNotes(ids, *yes, *force)
+	case "stats":
+		fs := newFlagSet("stats")
+		journal := fs.Bool("journal", false, "слов за каждый день, итог и среднее")
+		from := fs.String("from", "", "с --journal: с этого дня (включительно)")
+		to := fs.String("to", "", "с --journal: по этот день (включительно)")
+		parseArgs(fs, os.Args[2:])
+		if !*journal {
+			showStats()
+			break
+		}
+		var filter noteFilter
+		if err := dateRange(&filter, false, false, "", *from, *to, time.Now()); err != nil {
+			fail("%v", err)
+		}
+		showJournal(filter, time.Now())
+	case "archive":
+		fs := newFlagSet("archive")
+		before := fs.String("before", "", "заметки, созданные до этого дня (по умолчанию — до начала текущего месяца)")
+		parseArgs(fs, os.Args[2:])
+		now := time.Now()
+		limit := time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, time.Local)
+		if *before != "" {
+			t, err := time.ParseInLocation(dateLayout, *before, time.Local)
+			if err != nil {
+				fail("Неверная дата --before %q, ожидается формат 2024-05-01", *before)
+			}
+			limit = t
+		}
+		archiveNotes(limit)
+	case "unarchive":
+		args := parseArgs(newFlagSet("unarchive"), os.Args[2:])
+		if len(args) < 1 {
+			fail("Использование: daylist %s", commandUsage("unarchive"))
+		}
+		ids, err := parseIDs(args)
+		if err != nil {
+			fail("%v", err)
+		}
+		unarchiveNotes(ids)
+	case "clear":
+		fs := newFlagSet("clear")
+		before := fs.String("before", "", "только заметки, созданные до этого дня (2024-05-01)")
+		tag := fs.String("tag", "", "только заметки с этим тегом")
+		yes := fs.Bool("yes", false, "не спрашивать подтверждения")
+		force := fs.Bool("force", false, "удалить насовсем, минуя корзину")
+		if args := parseArgs(fs, os.Args[2:]); len(args) > 0 {
+			fail("Использование: daylist clear [--before=2024-05-01] [--tag=...] [--yes] [--force]")
+		}
+		var limit time.Time
+		if *before != "" {
+			t, err := time.ParseInLocation(dateLayout, *before, time.Local)
+			if err != nil {
+				fail("Неверная дата --before %q, ожидается формат 2024-05-01", *before)
+			}
+			limit = t
+		}
+		clearNotes(limit, *tag, *yes, *force)
+	case "trash":
+		fs := newFlagSet("trash")
+		empty := fs.Bool("empty", false, "очистить корзину")
+		olderThan := fs.String("older-than", "", "с --empty: только заметки, удалённые раньше (30d, 2w)")
+		parseArgs(fs, os.Args[2:])
+		if !*empty {
+			listTrash()
+			break
+		}
+		before := time.Now()
+		if *olderThan != "" {
+			age, err := parseAge(*olderThan)
+			if err != nil {
+				fail("%v", err)
+			}
+			before = before.Add(-age)
+		}
+		fmt.Printf("Удалено из корзины: %d\n", purgeTrash(before))
+	case "remind":
+		fs := newFlagSet("remind")
+		withinExpr := fs.String("within", "24h", "окно напоминания: 2h, 1d, 1w")
+		execTmpl := fs.String("exec", "", "команда для каждой заметки; {id}, {title}, {content}, {due} передаются ей отдельными аргументами")
+		again := fs.Bool("again", false, "напомнить и о заметках, о которых уже напоминали")
+		parseArgs(fs, os.Args[2:])
+		within, err := parseAge(*withinExpr)
+		if err != nil {
+			fail("--within: %v", err)
+		}
+		script, err := compileExec(*execTmpl, remindPlaceholders)
+		if err != nil {
+			fail("--exec: %v", err)
+		}
+		remind(time.Now(), within, script, *again)
+	case "restore":
+		ids, err := parseIDs(parseArgs(newFlagSet("restore"), os.Args[2:]))
+		if err != nil {
+			fail("%v", err)
+		}
+		restoreNotes(ids)
+	default:
+		fail("Неизвестная команда: %s\nДоступные команды: %s", command, strings.Join(commandNames(), ", "))
+	}
+
+	// Сохраняем заметки в файл, только если команда их изменила
+	if changed && !readOnlyCommands[command] {
+		if err := saveNotes(); err != nil {
+			fail("Ошибка сохранения заметок: %v", err)
+		}
+	}
+	if changed && command == "encrypt" {
+		// Резервная копия содержит прежнюю открытую версию
+		if err := os.Remove(backupFile); err != nil && !os.IsNotExist(err) {
+			fail("Ошибка удаления открытой резервной копии %s: %v", backupFile, err)
+		}
+		fmt.Printf("Файл зашифрован, открытая резервная копия %s удалена.\n", backupFile)
+		sealed, err := sealPlainFiles()
+		for _, path := range sealed {
+			fmt.Printf("Зашифрован также %s\n", path)
+		}
+		if err != nil {
+			fail("Ошибка шифрования архивов и резервных копий: %v", err)
+		}
+	}
+	exit(exitCode)
+}
@@ -0,0 +1,1214 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+	_ "time/tzdata"
+	"unicode/utf8"
+
+	"golang.org/x/crypto/pbkdf2"
+	"golang.org/x/crypto/scrypt"
+)
+
+// Флаг -update перезаписывает эталонные файлы в testdata вместо сравнения с ними
+var update = flag.Bool("update", false, "перезаписать эталоны в testdata")
+
+// TestMain запускает программу вместо тестов, если тест перезапустил себя как daylist
+// (см. runDayList): так параллельные команды выполняются в отдельных процессах.
+func TestMain(m *testing.M) {
+	if os.Getenv("DAYLIST_TEST_MAIN") == "1" {
+		os.Args = append([]string{"daylist"}, os.Args[1:]...)
+		main()
+		exit(0)
+	}
+	os.Exit(m.Run())
+}
+
+// runDayList выполняет команду daylist в директории dir в отдельном процессе.
+func runDayList(dir string, args ...string) ([]byte, error) {
+	return runDayListEnv(dir, nil, args...)
+}
+
+// runDayListEnv — runDayList с дополнительными переменными окружения env.
+func runDayListEnv(dir string, env []string, args ...string) ([]byte, error) {
+	cmd := exec.Command(os.Args[0], args...)
+	cmd.Dir = dir
+	cmd.Env = append(append(os.Environ(), "DAYLIST_TEST_MAIN=1"), env...)
+	return cmd.CombinedOutput()
+}
+
+// readNotesFile читает заметки из notes.json в dir.
+func readNotesFile(t *testing.T, dir string) notesData {
+	t.Helper()
+	data, err := os.ReadFile(filepath.Join(dir, notesFile))
+	if err != nil {
+		t.Fatal(err)
+	}
+	parsed, err := parseNotes(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return parsed
+}
+
+// TestConcurrentAdd запускает параллельные add и list через flock и через файл-метку
+// (DAYLIST_LOCK=marker, как на ФС без flock). Для метки в начале лежит устаревшая метка
+// завершившегося процесса: её забирают несколько процессов сразу, и ни одна заметка
+// не должна потеряться.
+func TestConcurrentAdd(t *testing.T) {
+	for _, tt := range []struct {
+		name  string
+		env   []string
+		stale bool
+	}{
+		{"flock", nil, false},
+		{"файл-метка", []string{"DAYLIST_LOCK=marker"}, true},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			if tt.stale {
+				dead := exec.Command(os.Args[0], "-test.run=^$")
+				if err := dead.Run(); err != nil {
+					t.Fatal(err)
+				}
+				if err := os.WriteFile(filepath.Join(dir, lockFile+".pid"), []byte(strconv.Itoa(dead.Process.Pid)), 0644); err != nil {
+					t.Fatal(err)
+				}
+			}
+			concurrentAdd(t, dir, tt.env)
+		})
+	}
+}
+
+// concurrentAdd добавляет заметки параллельными процессами с окружением env
+// и проверяет, что сохранились все, а метка блокировки не осталась.
+func concurrentAdd(t *testing.T, dir string, env []string) {
+	const n = 8
+	var wg sync.WaitGroup
+	errs := make([]error, n)
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			if out, err := runDayListEnv(dir, env, "add", fmt.Sprintf("заметка %d", i)); err != nil {
+				errs[i] = fmt.Errorf("%v: %s", err, out)
+			}
+		}(i)
+	}
+	wg.Wait()
+	for _, err := range errs {
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	parsed := readNotesFile(t, dir)
+	var contents []string
+	ids := map[int]bool{}
+	for _, note := range parsed.Notes {
+		contents = append(contents, note.Content)
+		ids[note.ID] = true
+	}
+	sort.Strings(contents)
+	if len(contents) != n {
+		t.Fatalf("сохранилось заметок %d из %d: %q", len(contents), n, contents)
+	}
+	for i, c := range contents {
+		if want := fmt.Sprintf("заметка %d", i); c != want {
+			t.Errorf("заметка %q, ожидалась %q", c, want)
+		}
+	}
+	if len(ids) != n {
+		t.Errorf("ID заметок повторяются: %v", ids)
+	}
+	if left, _ := filepath.Glob(filepath.Join(dir, lockFile+".pid*")); len(left) > 0 {
+		t.Errorf("после завершения команд остались файлы метки: %v", left)
+	}
+
+	// Чтение во время записи видит целый файл.
+	var readers sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		readers.Add(2)
+		go func(i int) {
+			defer readers.Done()
+			if out, err := runDayListEnv(dir, env, "add", fmt.Sprintf("ещё %d", i)); err != nil {
+				t.Errorf("add: %v: %s", err, out)
+			}
+		}(i)
+		go func() {
+			defer readers.Done()
+			out, err := runDayListEnv(dir, env, "--json", "list")
+			var list []json.RawMessage
+			if err != nil || json.Unmarshal(out, &list) != nil || len(list) < n {
+				t.Errorf("list --json во время записи: %v: %s", err, out)
+			}
+		}()
+	}
+	readers.Wait()
+	if got := len(readNotesFile(t, dir).Notes); got != n+4 {
+		t.Errorf("после второй серии заметок %d, ожидалось %d", got, n+4)
+	}
+}
+
+// TestMaterializeRepeatsTimezones проверяет создание заметок по шаблону в часовых поясах
+// с переходами на летнее время и сменой смещения: каждый день повторения даёт ровно
+// одну заметку со сроком в местную полночь, дни не пропускаются и не дублируются.
+func TestMaterializeRepeatsTimezones(t *testing.T) {
+	tests := []struct {
+		name  string
+		zone  string
+		every string
+		start string
+		runs  []string // Моменты запуска (местное время)
+		want  []string // Дни созданных заметок
+	}{
+		{"Москва, летнее время 2010", "Europe/Moscow", "daily", "2010-03-27",
+			[]string{"2010-03-27 23:59", "2010-03-29 00:30"},
+			[]string{"2010-03-27", "2010-03-28", "2010-03-29"}},
+		{"Москва, зимнее время 2010", "Europe/Moscow", "daily", "2010-10-30",
+			[]string{"2010-10-30 23:59", "2010-10-31 00:00", "2010-11-01 00:00"},
+			[]string{"2010-10-30", "2010-10-31", "2010-11-01"}},
+		{"Москва, переход на +4 в 2011", "Europe/Moscow", "weekly", "2011-03-20",
+			[]string{"2011-04-03 00:00"},
+			[]string{"2011-03-20", "2011-03-27", "2011-04-03"}},
+		{"Москва, возврат на +3 в 2014", "Europe/Moscow", "days", "2014-10-25",
+			[]string{"2014-10-27 23:59"},
+			[]string{"2014-10-26", "2014-10-27"}},
+		{"Нью-Йорк, март", "America/New_York", "daily", "2026-03-07",
+			[]string{"2026-03-07 23:59", "2026-03-08 00:00", "2026-03-09 01:00"},
+			[]string{"2026-03-07", "2026-03-08", "2026-03-09"}},
+		{"Нью-Йорк, ноябрь", "America/New_York", "days", "2026-10-30",
+			[]string{"2026-11-01 00:30", "2026-11-02 23:59"},
+			[]string{"2026-11-01", "2026-11-02"}},
+		{"Нью-Йорк, ежемесячно", "America/New_York", "monthly", "2026-01-31",
+			[]string{"2026-04-30 00:00"},
+			[]string{"2026-01-31", "2026-02-28", "2026-03-31", "2026-04-30"}},
+		// Часы переводятся ровно в полночь: 4 ноября 2018 года полуночи нет
+		{"Сан-Паулу, полночь пропущена", "America/Sao_Paulo", "daily", "2018-11-03",
+			[]string{"2018-11-04 01:00", "2018-11-06 00:30"},
+			[]string{"2018-11-03", "2018-11-04", "2018-11-05", "2018-11-06"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			loc, err := time.LoadLocation(tt.zone)
+			if err != nil {
+				t.Skip(err)
+			}
+			savedLocal := time.Local
+			time.Local = loc
+			defer func() { time.Local = savedLocal }()
+
+			start, err := time.ParseInLocation(dateLayout, tt.start, loc)
+			if err != nil {
+				t.Fatal(err)
+			}
+			expr := tt.every
+			if expr == "days" {
+				expr = "sun,mon"
+			}
+			rule, err := parseRepeat(expr, start)
+			if err != nil {
+				t.Fatal(err)
+			}
+			notes, repeats, nextNoteID = nil, []Note{{ID: 1, Content: "шаблон", Repeat: rule}}, 2
+
+			for _, run := range tt.runs {
+				now, err := time.ParseInLocation("2006-01-02 15:04", run, loc)
+				if err != nil {
+					t.Fatal(err)
+				}
+				materializeRepeats(now)
+				if n := materializeRepeats(now); n != 0 {
+					t.Errorf("повторный запуск в %s создал %d заметок", run, n)
+				}
+			}
+
+			var got []string
+			for _, note := range notes {
+				day := note.Due.In(loc)
+				got = append(got, day.Format(dateLayout))
+				if midnight := startOfDay(day); !day.Equal(midnight) {
+					t.Errorf("срок %s не в полночь (%s)", day, midnight)
+				}
+			}
+			if strings.Join(got, " ") != strings.Join(tt.want, " ") {
+				t.Errorf("дни заметок %v, ожидалось %v", got, tt.want)
+			}
+		})
+	}
+}
+
+// TestMaterializeRepeatsCopiesTags проверяет, что заметки по шаблону получают
+// собственную копию тегов: изменение тегов одной заметки не меняет шаблон.
+func TestMaterializeRepeatsCopiesTags(t *testing.T) {
+	now := time.Date(2026, 10, 14, 12, 0, 0, 0, time.Local)
+	rule, err := parseRepeat("daily", now.AddDate(0, 0, -1))
+	if err != nil {
+		t.Fatal(err)
+	}
+	notes, repeats, nextNoteID = nil, []Note{{ID: 1, Content: "шаблон", Tags: []string{"work"}, Repeat: rule}}, 2
+	if n := materializeRepeats(now); n != 2 {
+		t.Fatalf("создано %d заметок, ожидалось 2", n)
+	}
+	notes[0].Tags[0] = "home"
+	if fmt.Sprint(repeats[0].Tags) != "[work]" || fmt.Sprint(notes[1].Tags) != "[work]" {
+		t.Errorf("теги шаблона %v и второй заметки %v изменились вместе с первой", repeats[0].Tags, notes[1].Tags)
+	}
+}
+
+// TestDateRange проверяет границы дней у --today, --yesterday, --date и --from/--to:
+// заметка в 23:59:59 относится к своему дню, в 00:00 — уже к следующему, в том числе
+// в день, когда полуночи нет (Сан-Паулу, 4 ноября 2018 года).
+func TestDateRange(t *testing.T) {
+	const layout = "2006-01-02 15:04:05"
+	tests := []struct {
+		name             string
+		zone             string
+		today, yesterday bool
+		date, from, to   string
+		now              string
+		created          []string // Время создания заметок (местное)
+		want             []string // Заметки, попавшие в отбор
+	}{
+		{name: "Москва --today", zone: "Europe/Moscow", today: true, now: "2026-10-14 00:00:00",
+			created: []string{"2026-10-13 23:59:59", "2026-10-14 00:00:00", "2026-10-14 23:59:59", "2026-10-15 00:00:00"},
+			want:    []string{"2026-10-14 00:00:00", "2026-10-14 23:59:59"}},
+		{name: "Москва --yesterday", zone: "Europe/Moscow", yesterday: true, now: "2026-10-14 00:00:01",
+			created: []string{"2026-10-12 23:59:59", "2026-10-13 00:00:00", "2026-10-13 23:59:59", "2026-10-14 00:00:00"},
+			want:    []string{"2026-10-13 00:00:00", "2026-10-13 23:59:59"}},
+		{name: "Москва --from/--to включительно", zone: "Europe/Moscow", from: "2010-10-30", to: "2010-10-31", now: "2026-10-14 12:00:00",
+			created: []string{"2010-10-29 23:59:59", "2010-10-30 00:00:00", "2010-10-31 23:59:59", "2010-11-01 00:00:00"},
+			want:    []string{"2010-10-30 00:00:00", "2010-10-31 23:59:59"}},
+		{name: "Нью-Йорк --date в день перевода", zone: "America/New_York", date: "2026-03-08", now: "2026-10-14 12:00:00",
+			created: []string{"2026-03-07 23:59:59", "2026-03-08 00:00:00", "2026-03-08 23:59:59", "2026-03-09 00:00:00"},
+			want:    []string{"2026-03-08 00:00:00", "2026-03-08 23:59:59"}},
+		{name: "Сан-Паулу --date без полуночи", zone: "America/Sao_Paulo", date: "2018-11-04", now: "2026-10-14 12:00:00",
+			created: []string{"2018-11-03 23:30:00", "2018-11-04 01:00:00", "2018-11-04 23:59:59", "2018-11-05 00:00:00"},
+			want:    []string{"2018-11-04 01:00:00", "2018-11-04 23:59:59"}},
+		{name: "Сан-Паулу --to перед днём без полуночи", zone: "America/Sao_Paulo", to: "2018-11-03", now: "2026-10-14 12:00:00",
+			created: []string{"2018-11-03 23:30:00", "2018-11-04 01:00:00"},
+			want:    []string{"2018-11-03 23:30:00"}},
+		{name: "Сан-Паулу --yesterday", zone: "America/Sao_Paulo", yesterday: true, now: "2018-11-05 08:00:00",
+			created: []string{"2018-11-03 23:30:00", "2018-11-04 01:00:00", "2018-11-05 00:00:00"},
+			want:    []string{"2018-11-04 01:00:00"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			loc, err := time.LoadLocation(tt.zone)
+			if err != nil {
+				t.Skip(err)
+			}
+			savedLocal := time.Local
+			time.Local = loc
+			defer func() { time.Local = savedLocal }()
+
+			now, err := time.ParseInLocation(layout, tt.now, loc)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var f noteFilter
+			if err := dateRange(&f, tt.today, tt.yesterday, tt.date, tt.from, tt.to, now); err != nil {
+				t.Fatal(err)
+			}
+			var got []string
+			for _, c := range tt.created {
+				created, err := time.ParseInLocation(layout, c, loc)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if f.match(Note{Content: c, CreatedAt: created}, now) {
+					got = append(got, c)
+				}
+			}
+			if fmt.Sprint(got) != fmt.Sprint(tt.want) {
+				t.Errorf("отобраны %v, ожидалось %v", got, tt.want)
+			}
+		})
+	}
+}
+
+// TestCSVRoundTrip проверяет, что заметки, выгруженные export --format=csv, загружаются
+// import --format=csv байт в байт: многострочный текст (в том числе с \r\n и одиночным \r),
+// кавычки, запятые и теги через ";".
+func TestCSVRoundTrip(t *testing.T) {
+	created := time.Date(2026, 10, 1, 9, 30, 0, 0, time.Local)
+	due := startOfDay(created.AddDate(0, 0, 7))
+	list := []Note{
+		{ID: 1, Content: "Купить молоко", CreatedAt: created, UpdatedAt: created},
+		{ID: 2, Title: "План", Content: "Первая строка\nвторая, с запятой\n\"третья\" в кавычках; и точка с запятой",
+			CreatedAt: created, UpdatedAt: created.Add(time.Hour), Tags: []string{"work", "дом"}, Due: &due, Pinned: true},
+		{ID: 3, Title: "Звонок\r\n", Content: "Позвонить #маме\r\nвечером\rи \"\r\n\" ещё\r\n", CreatedAt: created, UpdatedAt: created, Tags: []string{"маме", "звонки"}, Done: true},
+	}
+
+	data, err := exportNotes(list, "csv")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	t.Run("новые заметки", func(t *testing.T) {
+		notes, nextNoteID = nil, 1
+		result, err := parseImport(data, "csv", false, created.AddDate(0, 1, 0))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(result.warnings) != 0 || result.skipped != 0 || result.duplicates != 0 || len(result.updates) != 0 {
+			t.Fatalf("неожиданные итоги импорта: %+v", result)
+		}
+		compareNotes(t, result.notes, list)
+		if again, err := exportNotes(result.notes, "csv"); err != nil || !bytes.Equal(again, data) {
+			t.Errorf("повторный экспорт отличается: %v\n%q\n%q", err, again, data)
+		}
+	})
+
+	t.Run("те же заметки", func(t *testing.T) {
+		notes, nextNoteID = list, 4
+		result, err := parseImport(data, "csv", false, created.AddDate(0, 1, 0))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(result.notes) != 0 || len(result.updates) != 0 {
+			t.Errorf("повторный импорт: %d новых, %d изменённых, ожидалось 0", len(result.notes), len(result.updates))
+		}
+	})
+
+	// Таблицы сохраняют CSV с концами строк CRLF, а переводы строк в ячейках — как \n.
+	t.Run("концы строк CRLF", func(t *testing.T) {
+		entries, _, _, err := parseImportCSV([]byte("id,content,done\r\n,\"первая\nвторая\",true\r\n,\"ещё\",false\r\n"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(entries) != 2 || entries[0].Content != "первая\nвторая" || !entries[0].Done || entries[1].Content != "ещё" {
+			t.Errorf("разобрано %+v", entries)
+		}
+	})
+}
+
+// compareNotes сравнивает заметки через их JSON-представление.
+func compareNotes(t *testing.T, got, want []Note) {
+	t.Helper()
+	if len(got) != len(want) {
+		t.Fatalf("получено %d заметок, ожидалось %d", len(got), len(want))
+	}
+	for i := range want {
+		g, _ := json.Marshal(got[i])
+		w, _ := json.Marshal(want[i])
+		if string(g) != string(w) {
+			t.Errorf("заметка %d:\n получено %s\nожидалось %s", i, g, w)
+		}
+	}
+}
+
+// TestFuzzyScore проверяет оценку отдельного совпадения по видам и позиции.
+func TestFuzzyScore(t *testing.T) {
+	tests := []struct {
+		query, text string
+		want        int
+	}{
+		{"молоко", "Купить молоко", 1000 - 7},
+		{"Ёлка", "елка во дворе", 1000},
+		{"малако", "купить молоко", 600 - 2*50 - 10},
+		{"отчот", "сдать отчёт", 600 - 50 - 10},
+		{"thrd", "third note", 600 - 50},
+		{"кпт млк", "купить молоко", 300 - 6},
+		{"ab", "ac", 0},
+		{"молоко", "хлеб", 0},
+		{"  ", "что угодно", 0},
+	}
+	for _, tt := range tests {
+		if got := fuzzyScore(tt.query, tt.text); got != tt.want {
+			t.Errorf("fuzzyScore(%q, %q) = %d, ожидалось %d", tt.query, tt.text, got, tt.want)
+		}
+	}
+
+	// Пары текстов, где первый должен оцениваться выше второго
+	ranking := []struct {
+		query, better, worse string
+	}{
+		{"отчёт", "отчёт за май", "сдать отчёт"},                       // точное вхождение ближе к началу
+		{"отчет", "сдать отчёт", "сдать отчт"},                         // точное выше опечатки
+		{"отчот", "отчёт за май", "за май отчёт"},                      // опечатка в слове ближе к началу
+		{"отчот", "сдать отчёт", "о т ч ё т"},                          // опечатка выше букв по порядку
+		{"thrd", "the third", "the thread"},                            // опечатка в целом слове выше начала слова
+		{"thrd", "the thread", "the other third"},                      // позиция важнее целого слова
+		{"птн", "пятница", "позвонить тане"},                           // буквы на коротком отрезке
+		{"птн", "сегодня пятница", "сегодня и завтра пятница вечером"}, // буквы ближе к началу
+	}
+	for _, tt := range ranking {
+		better, worse := fuzzyScore(tt.query, tt.better), fuzzyScore(tt.query, tt.worse)
+		if better <= worse {
+			t.Errorf("%q: %q = %d не выше %q = %d", tt.query, tt.better, better, tt.worse, worse)
+		}
+	}
+}
+
+// TestFuzzySearch проверяет порядок результатов: заголовок важнее текста, короткие
+// заметки выше длинных, при равной оценке — по ID.
+func TestFuzzySearch(t *testing.T) {
+	long := strings.Repeat("прочий текст ", 40)
+	source := []Note{
+		{ID: 1, Content: "Купить хлеб"},
+		{ID: 2, Title: "Планы", Content: "обсудить отчёт с командой"}, // совпадение только в тексте
+		{ID: 3, Title: "Отчёт", Content: "собрать цифры"},
+		// Без заголовка заголовком считается первая строка
+		{ID: 4, Content: "Сдать отчёт до пятницы " + long},
+		{ID: 5, Content: "Сдать отчёт до пятницы"},
+		{ID: 6, Title: "Отчёт", Content: "собрать цифры"}, // копия заметки 3
+	}
+	ids := func(result []scoredNote) []int {
+		var ids []int
+		for _, r := range result {
+			ids = append(ids, r.note.ID)
+		}
+		return ids
+	}
+
+	tests := []struct {
+		name      string
+		query     string
+		limit     int
+		titleOnly bool
+		want      []int
+	}{
+		{"заголовок выше текста", "отчет", 0, false, []int{3, 6, 5, 4, 2}},
+		{"опечатка", "отчот", 0, false, []int{3, 6, 5, 4, 2}},
+		{"ограничение", "отчёт", 2, false, []int{3, 6}},
+		{"только заголовки", "отчёт", 0, true, []int{3, 6, 5, 4}},
+		{"кириллица и регистр", "ХЛЕБ", 0, false, []int{1}},
+		{"нет совпадений", "молоко", 0, false, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result := fuzzySearch(source, tt.query, tt.limit, tt.titleOnly)
+			if got := ids(result); fmt.Sprint(got) != fmt.Sprint(tt.want) {
+				t.Errorf("порядок %v, ожидалось %v (%v)", got, tt.want, result)
+			}
+			for i := 1; i < len(result); i++ {
+				if result[i].score > result[i-1].score {
+					t.Errorf("оценки не по убыванию: %v", result)
+				}
+			}
+		})
+	}
+}
+
+// TestKDFVectors сверяет ключи PBKDF2-HMAC-SHA256 и scrypt, которыми шифруются заметки,
+// с тестовыми векторами RFC 7914: смена KDF или его параметров сломала бы старые файлы.
+func TestKDFVectors(t *testing.T) {
+	pbkdf2Tests := []struct {
+		password, salt string
+		iter           int
+		want           string
+	}{
+		{"passwd", "salt", 1, "55ac046e56e3089fec1691c22544b605f94185216dde0465e68b9d57c20dacbc49ca9cccf179b645991664b39d77ef317c71b845b1e30bd509112041d3a19783"},
+		{"Password", "NaCl", 80000, "4ddcd8f60b98be21830cee5ef22701f9641a4418d04c0414aeff08876b34ab56a1d425a1225833549adb841b51c9b3176a272bdebba1d078478f62b397f33c8d"},
+	}
+	for _, tt := range pbkdf2Tests {
+		if got := hex.EncodeToString(pbkdf2.Key([]byte(tt.password), []byte(tt.salt), tt.iter, 64, sha256.New)); got != tt.want {
+			t.Errorf("pbkdf2.Key(%q, %q, %d) = %s, ожидалось %s", tt.password, tt.salt, tt.iter, got, tt.want)
+		}
+	}
+
+	scryptTests := []struct {
+		password, salt string
+		n, r, p        int
+		want           string
+	}{
+		{"", "", 16, 1, 1, "77d6576238657b203b19ca42c18a0497f16b4844e3074ae8dfdffa3fede21442fcd0069ded0948f8326a753a0fc81f17e8d3e0fb2e0d3628cf35e20c38d18906"},
+		{"password", "NaCl", 1024, 8, 16, "fdbabe1c9d3472007856e7190d01e9fe7c6ad7cbc8237830e77376634b3731622eaf30d92e22a3886ff109279d9830dac727afb94a83ee6d8360cbdfa2cc0640"},
+	}
+	for _, tt := range scryptTests {
+		key, err := scrypt.Key([]byte(tt.password), []byte(tt.salt), tt.n, tt.r, tt.p, 64)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := hex.EncodeToString(key); got != tt.want {
+			t.Errorf("scrypt.Key(%q, %q, %d, %d, %d) = %s, ожидалось %s", tt.password, tt.salt, tt.n, tt.r, tt.p, got, tt.want)
+		}
+	}
+	if _, err := scrypt.Key(nil, nil, 1000, 8, 1, 32); err == nil {
+		t.Error("scrypt с n, не равным степени двойки, не дал ошибки")
+	}
+}
+
+// TestEncryptRoundTrip шифрует заметки ключом с фиксированной солью и расшифровывает
+// их той же фразой: для scrypt (версия 2) и для файлов версии 1 (PBKDF2).
+func TestEncryptRoundTrip(t *testing.T) {
+	salt := []byte("0123456789abcdef")
+	headers := map[string]encryptedFile{
+		"scrypt": {Format: encryptedFormat, Version: 2, KDF: "scrypt", N: 1024, R: 8, P: 1, Salt: salt},
+		"pbkdf2": {Format: encryptedFormat, Version: 1, KDF: "pbkdf2-sha256", Iterations: 1000, Salt: salt},
+	}
+	plain := []byte(`{"version":2,"notes":[{"id":1,"content":"секрет"}]}`)
+	for name, header := range headers {
+		t.Run(name, func(t *testing.T) {
+			key, err := deriveKey("фраза", header)
+			if err != nil {
+				t.Fatal(err)
+			}
+			// Тот же ключ из той же фразы и соли
+			again, err := deriveKey("фраза", header)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(key.key, again.key) {
+				t.Fatal("ключ из одной фразы и соли различается")
+			}
+			data, err := key.seal(plain)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if bytes.Contains(data, []byte("секрет")) {
+				t.Fatal("в зашифрованном файле виден текст заметки")
+			}
+			env, ok := isEncrypted(data)
+			if !ok {
+				t.Fatalf("файл не распознан как зашифрованный: %s", data)
+			}
+			if env.Version != header.Version || env.KDF != header.KDF || !key.matches(env) {
+				t.Errorf("заголовок %+v не совпадает с ключом %+v", env, header)
+			}
+			got, _, err := openEncrypted(env, "фраза")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(got, plain) {
+				t.Errorf("расшифровано %s, ожидалось %s", got, plain)
+			}
+			// Каждое сохранение — новый nonce
+			second, err := key.seal(plain)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if env2, _ := isEncrypted(second); bytes.Equal(env.Nonce, env2.Nonce) {
+				t.Error("nonce повторился при повторном сохранении")
+			}
+		})
+	}
+}
+
+// TestWrongPassphrase проверяет, что неверная фраза даёт ошибку и не меняет файл,
+// а верная по-прежнему открывает заметки.
+func TestWrongPassphrase(t *testing.T) {
+	env, ok := isEncrypted(mustSeal(t, "верная"))
+	if !ok {
+		t.Fatal("файл не распознан как зашифрованный")
+	}
+	if _, _, err := openEncrypted(env, "неверная"); err == nil {
+		t.Error("неверная фраза не дала ошибки")
+	}
+
+	dir := t.TempDir()
+	t.Setenv("DAYLIST_PASSPHRASE", "верная")
+	for _, args := range [][]string{{"add", "секретная заметка"}, {"encrypt"}} {
+		if out, err := runDayList(dir, args...); err != nil {
+			t.Fatalf("%v: %v\n%s", args, err, out)
+		}
+	}
+	before, err := os.ReadFile(filepath.Join(dir, notesFile))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := isEncrypted(before); !ok {
+		t.Fatalf("после encrypt файл не зашифрован: %s", before)
+	}
+
+	t.Setenv("DAYLIST_PASSPHRASE", "неверная")
+	for _, args := range [][]string{{"list"}, {"add", "ещё одна"}} {
+		out, err := runDayList(dir, args...)
+		if exitErr, ok := err.(*exec.ExitError); !ok || exitErr.ExitCode() != 1 {
+			t.Errorf("%v с неверной фразой: %v, ожидался код 1\n%s", args, err, out)
+		}
+	}
+	after, err := os.ReadFile(filepath.Join(dir, notesFile))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(before, after) {
+		t.Error("неверная фраза изменила файл заметок")
+	}
+
+	t.Setenv("DAYLIST_PASSPHRASE", "верная")
+	out, err := runDayList(dir, "list")
+	if err != nil || !strings.Contains(string(out), "секретная заметка") {
+		t.Errorf("верная фраза не открыла заметки: %v\n%s", err, out)
+	}
+}
+
+// TestEncryptPipedPassphrase вводит фразу и подтверждение одним перенаправленным
+// stdin и проверяет, что encrypt шифрует и открытые архивы и копии очистки.
+func TestEncryptPipedPassphrase(t *testing.T) {
+	dir := t.TempDir()
+	t.Setenv("DAYLIST_PASSPHRASE", "")
+	os.Unsetenv("DAYLIST_PASSPHRASE")
+	tomorrow := time.Now().AddDate(0, 0, 1).Format("2006-01-02")
+	for _, args := range [][]string{
+		{"add", "архивная заметка"}, {"archive", "--before=" + tomorrow},
+		{"add", "очищенная заметка"}, {"clear", "--yes"},
+		{"add", "секретная заметка"},
+	} {
+		if out, err := runDayList(dir, args...); err != nil {
+			t.Fatalf("%v: %v\n%s", args, err, out)
+		}
+	}
+	plain, _ := filepath.Glob(filepath.Join(dir, archiveDir, "notes-*.json"))
+	backups, _ := filepath.Glob(filepath.Join(dir, notesFile+".*.bak"))
+	if len(plain) != 1 || len(backups) != 1 {
+		t.Fatalf("архивы %v, копии очистки %v; ожидалось по одному", plain, backups)
+	}
+
+	cmd := exec.Command(os.Args[0], "encrypt")
+	cmd.Dir = dir
+	cmd.Env = append(os.Environ(), "DAYLIST_TEST_MAIN=1")
+	cmd.Stdin = strings.NewReader("фраза\nфраза\n")
+	if out, err := cmd.CombinedOutput(); err != nil {
+		t.Fatalf("encrypt с фразой из stdin: %v\n%s", err, out)
+	}
+	for _, path := range append([]string{filepath.Join(dir, notesFile)}, append(plain, backups...)...) {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, ok := isEncrypted(data); !ok {
+			t.Errorf("после encrypt %s не зашифрован", path)
+		}
+	}
+
+	t.Setenv("DAYLIST_PASSPHRASE", "фраза")
+	out, err := runDayList(dir, "list", "--archived")
+	if err != nil || !strings.Contains(string(out), "архивная заметка") {
+		t.Errorf("зашифрованный архив не читается: %v\n%s", err, out)
+	}
+}
+
+// mustSeal шифрует небольшой файл заметок ключом из фразы passphrase.
+func mustSeal(t *testing.T, passphrase string) []byte {
+	t.Helper()
+	key, err := deriveKey(passphrase, encryptedFile{Format: encryptedFormat, Version: 2, KDF: "scrypt", N: 1024, R: 8, P: 1, Salt: []byte("0123456789abcdef")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := key.seal([]byte(`{"notes":[]}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return data
+}
+
+// TestSyncPartialFailure проверяет, что при ошибке на втором POST уже созданная на
+// сервере задача запоминается в заметке, и повторная синхронизация её не дублирует.
+func TestSyncPartialFailure(t *testing.T) {
+	var mu sync.Mutex
+	var tasks []remoteTask
+	posts, failPost := 0, 2 // номер POST, на котором сервер ответит ошибкой
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		switch {
+		case r.Method == http.MethodGet && r.URL.Path == "/tasks":
+			json.NewEncoder(w).Encode(tasks)
+		case r.Method == http.MethodPost && r.URL.Path == "/tasks":
+			posts++
+			if posts == failPost {
+				http.Error(w, "disk full", http.StatusInternalServerError)
+				return
+			}
+			var task remoteTask
+			json.NewDecoder(r.Body).Decode(&task)
+			task.ID = 100 + len(tasks) + 1
+			tasks = append(tasks, task)
+			w.WriteHeader(http.StatusCreated)
+			json.NewEncoder(w).Encode(task)
+		default:
+			http.Error(w, "unexpected "+r.Method+" "+r.URL.Path, http.StatusBadRequest)
+		}
+	}))
+	defer srv.Close()
+	client := syncClient{server: srv.URL, http: srv.Client()}
+
+	created := time.Date(2026, 10, 1, 9, 0, 0, 0, time.Local)
+	notes = []Note{
+		{ID: 1, Content: "первая", CreatedAt: created, UpdatedAt: created},
+		{ID: 2, Content: "вторая", CreatedAt: created, UpdatedAt: created},
+		{ID: 3, Content: "третья", CreatedAt: created, UpdatedAt: created},
+	}
+	trash, nextNoteID, changed = nil, 4, false
+
+	if err := syncNotes(client, false); err == nil {
+		t.Fatal("ошибка сервера на втором POST не вернулась")
+	}
+	if notes[0].RemoteID != 101 || notes[0].SyncHash == "" || notes[0].SyncedAt == nil {
+		t.Errorf("созданная задача не запомнена в заметке 1: %+v", notes[0])
+	}
+	if notes[1].RemoteID != 0 || notes[2].RemoteID != 0 {
+		t.Errorf("неотправленные заметки получили remote_id: %d, %d", notes[1].RemoteID, notes[2].RemoteID)
+	}
+	if !changed {
+		t.Error("частичная синхронизация не отмечена для сохранения")
+	}
+
+	if err := syncNotes(client, false); err != nil {
+		t.Fatal(err)
+	}
+	var titles []string
+	for _, task := range tasks {
+		titles = append(titles, task.Title)
+	}
+	if fmt.Sprint(titles) != "[первая вторая третья]" {
+		t.Errorf("задачи на сервере %v, ожидалась каждая заметка ровно один раз", titles)
+	}
+	if len(notes) != 3 {
+		t.Errorf("после синхронизации %d заметок, ожидалось 3", len(notes))
+	}
+	for _, note := range notes {
+		if note.RemoteID == 0 {
+			t.Errorf("заметка %d не связана с задачей", note.ID)
+		}
+	}
+}
+
+// chdirTemp переходит во временную директорию до конца теста и сбрасывает
+// заметки в памяти: файлы заметок ищутся в текущей директории.
+func chdirTemp(t *testing.T) string {
+	t.Helper()
+	dir := t.TempDir()
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chdir(dir); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.Chdir(wd) })
+	notes, trash, repeats, nextNoteID, changed, encryption = nil, nil, nil, 1, false, nil
+	return dir
+}
+
+// TestRemindExec проверяет, что текст заметки доходит до команды --exec как есть:
+// $(...), кавычки и переводы строк не исполняются ни вне кавычек, ни внутри двойных,
+// а подстановка в одинарных кавычках отклоняется до запуска.
+func TestRemindExec(t *testing.T) {
+	if _, err := exec.LookPath("sh"); err != nil {
+		t.Skip("нет sh")
+	}
+	dir := t.TempDir()
+	pwned := filepath.Join(dir, "pwned")
+	content := "Позвонить \"Ивану\" $(touch " + pwned + ")\nit's `touch " + pwned + "` $HOME \\"
+	if out, err := runDayList(dir, "add", content, "--due=today"); err != nil {
+		t.Fatalf("add: %v\n%s", err, out)
+	}
+
+	if out, err := runDayList(dir, "remind", "--within=48h", "--exec=echo '{title}'"); err == nil || !strings.Contains(string(out), "одинарных кавычек") {
+		t.Errorf("подстановка в одинарных кавычках принята: %v\n%s", err, out)
+	}
+	// Поля разделены нулевым байтом: в тексте заметки есть перевод строки.
+	tmpl := `printf '%s\0' {id} "заголовок: {title}" {content} "срок {due}" >> log`
+	if out, err := runDayList(dir, "remind", "--within=48h", "--exec="+tmpl); err != nil {
+		t.Fatalf("remind: %v\n%s", err, out)
+	}
+	if _, err := os.Stat(pwned); err == nil {
+		t.Error("подстановка команды из текста заметки выполнена")
+	}
+	data, err := os.ReadFile(filepath.Join(dir, "log"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	note := readNotesFile(t, dir).Notes[0]
+	got := strings.Split(strings.TrimSuffix(string(data), "\x00"), "\x00")
+	want := []string{"1", "заголовок: " + strings.Split(content, "\n")[0], content, "срок " + note.Due.Format(dateLayout)}
+	if !slices.Equal(got, want) {
+		t.Errorf("команда получила:\n%q\nожидалось:\n%q", got, want)
+	}
+	if !note.Notified {
+		t.Error("после успешной команды напоминание не отмечено")
+	}
+}
+
+// TestRestoreTruncatedNotes обрезает notes.json посередине: loadNotes должен сообщить
+// о повреждении и подсказать restore, а restoreBackup — вернуть предыдущую версию,
+// сохранив обрезанный файл как notes.json.broken.
+func TestRestoreTruncatedNotes(t *testing.T) {
+	chdirTemp(t)
+	created := time.Date(2026, 10, 1, 9, 0, 0, 0, time.UTC)
+	notes = []Note{{ID: 1, Content: "первая", CreatedAt: created, UpdatedAt: created}}
+	nextNoteID = 2
+	if err := saveNotes(); err != nil {
+		t.Fatal(err)
+	}
+	notes = append(notes, Note{ID: 2, Content: "вторая", CreatedAt: created, UpdatedAt: created})
+	nextNoteID = 3
+	if err := saveNotes(); err != nil {
+		t.Fatal(err)
+	}
+
+	data, err := os.ReadFile(notesFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	truncated := data[:len(data)/2]
+	if err := os.WriteFile(notesFile, truncated, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	notes = nil
+	err = loadNotes()
+	if err == nil || !strings.Contains(err.Error(), "повреждён") || !strings.Contains(err.Error(), "restore") {
+		t.Fatalf("loadNotes на обрезанном файле: %v, ожидалась ошибка с подсказкой restore", err)
+	}
+
+	if err := restoreBackup(); err != nil {
+		t.Fatal(err)
+	}
+	if broken, err := os.ReadFile(notesFile + ".broken"); err != nil || !bytes.Equal(broken, truncated) {
+		t.Errorf("notes.json.broken не содержит обрезанный файл: %v", err)
+	}
+	if err := loadNotes(); err != nil {
+		t.Fatalf("после restore: %v", err)
+	}
+	if len(notes) != 1 || notes[0].Content != "первая" {
+		t.Errorf("восстановлены заметки %+v, ожидалась версия до второго сохранения", notes)
+	}
+	if nextNoteID != 2 {
+		t.Errorf("следующий ID %d, ожидалось 2", nextNoteID)
+	}
+}
+
+// TestDeleteLastThenAdd — регрессия: после удаления последней заметки новая получает
+// свежий ID, а не ID удалённой (и при удалении в корзину, и насовсем).
+func TestDeleteLastThenAdd(t *testing.T) {
+	for _, del := range [][]string{{"delete", "2"}, {"delete", "2", "--force"}} {
+		t.Run(strings.Join(del, " "), func(t *testing.T) {
+			dir := t.TempDir()
+			for _, args := range [][]string{{"add", "первая"}, {"add", "вторая"}, del, {"trash", "--empty"}, {"add", "третья"}} {
+				if out, err := runDayList(dir, args...); err != nil {
+					t.Fatalf("%v: %v\n%s", args, err, out)
+				}
+			}
+			data := readNotesFile(t, dir)
+			var ids []int
+			for _, note := range data.Notes {
+				ids = append(ids, note.ID)
+			}
+			if fmt.Sprint(ids) != "[1 3]" || data.NextID != 4 {
+				t.Errorf("ID заметок %v, next_id %d; ожидалось [1 3] и 4", ids, data.NextID)
+			}
+		})
+	}
+}
+
+// TestLoadLegacyArray проверяет загрузку старого файла — массива заметок без
+// версии и счётчика: счётчик продолжается после наибольшего ID, время изменения
+// берётся из времени создания, а сохранение переводит файл в новый формат.
+func TestLoadLegacyArray(t *testing.T) {
+	chdirTemp(t)
+	legacy := `[
+  {"id": 1, "content": "старая", "created_at": "2024-05-01T10:00:00Z"},
+  {"id": 7, "content": "последняя", "created_at": "2024-05-02T10:00:00Z", "tags": ["work"]}
+]`
+	if err := os.WriteFile(notesFile, []byte(legacy), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := loadNotes(); err != nil {
+		t.Fatal(err)
+	}
+	if len(notes) != 2 || notes[1].Content != "последняя" || fmt.Sprint(notes[1].Tags) != "[work]" {
+		t.Fatalf("загружены заметки %+v", notes)
+	}
+	if nextNoteID != 8 {
+		t.Errorf("следующий ID %d, ожидалось 8", nextNoteID)
+	}
+	for _, note := range notes {
+		if !note.UpdatedAt.Equal(note.CreatedAt) {
+			t.Errorf("заметка %d: updated_at %v, ожидалось время создания %v", note.ID, note.UpdatedAt, note.CreatedAt)
+		}
+	}
+
+	if err := saveNotes(); err != nil {
+		t.Fatal(err)
+	}
+	data, err := os.ReadFile(notesFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var saved notesData
+	if err := json.Unmarshal(data, &saved); err != nil {
+		t.Fatalf("после сохранения файл не объект: %v\n%s", err, data)
+	}
+	if saved.Version != notesVersion || saved.NextID != 8 || len(saved.Notes) != 2 {
+		t.Errorf("сохранено version=%d next_id=%d заметок %d", saved.Version, saved.NextID, len(saved.Notes))
+	}
+}
+
+// TestSortNotes проверяет порядок по каждому ключу --sort с --reverse и без:
+// равные ключи — по ID, заметки без срока при --sort=due всегда в конце.
+func TestSortNotes(t *testing.T) {
+	day := func(d int) time.Time { return time.Date(2026, 10, d, 9, 0, 0, 0, time.UTC) }
+	due := func(d int) *time.Time { t := day(d); return &t }
+	source := []Note{
+		{ID: 1, CreatedAt: day(3), UpdatedAt: day(5), Due: due(2)},
+		{ID: 2, CreatedAt: day(1), UpdatedAt: day(1)},
+		{ID: 3, CreatedAt: day(2), UpdatedAt: day(6), Due: due(1)},
+		{ID: 4, CreatedAt: day(1), UpdatedAt: day(4), Due: due(2)},
+		{ID: 5, CreatedAt: day(4), UpdatedAt: day(2)},
+	}
+	tests := []struct {
+		key     string
+		reverse bool
+		want    string
+	}{
+		{"", false, "[2 4 3 1 5]"},
+		{"created", false, "[2 4 3 1 5]"},
+		{"created", true, "[5 1 3 2 4]"},
+		{"updated", false, "[2 5 4 1 3]"},
+		{"updated", true, "[3 1 4 5 2]"},
+		{"due", false, "[3 1 4 2 5]"},
+		{"due", true, "[1 4 3 2 5]"},
+		{"id", false, "[1 2 3 4 5]"},
+		{"id", true, "[5 4 3 2 1]"},
+	}
+	for _, tt := range tests {
+		list := append([]Note(nil), source...)
+		if err := sortNotes(list, tt.key, tt.reverse); err != nil {
+			t.Fatal(err)
+		}
+		var ids []int
+		for _, note := range list {
+			ids = append(ids, note.ID)
+		}
+		if got := fmt.Sprint(ids); got != tt.want {
+			t.Errorf("--sort=%s reverse=%v: %s, ожидалось %s", tt.key, tt.reverse, got, tt.want)
+		}
+	}
+	if err := sortNotes(append([]Note(nil), source...), "title", false); err == nil {
+		t.Error("неизвестный ключ сортировки не дал ошибки")
+	}
+}
+
+// checkGolden сравнивает got с эталоном testdata/name (с -update — перезаписывает его).
+func checkGolden(t *testing.T, name string, got []byte) {
+	t.Helper()
+	path := filepath.Join("testdata", name)
+	if *update {
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, got, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	want, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, want) {
+		t.Errorf("%s не совпадает с эталоном:\n--- получено\n%s\n--- ожидалось\n%s", path, got, want)
+	}
+}
+
+// TestExportGolden сверяет export --format=md|txt|csv с эталонами: спецсимволы
+// Markdown, «1.» в начале строки, многострочный текст, заголовки, теги, сроки и отметки.
+func TestExportGolden(t *testing.T) {
+	savedLocal := time.Local
+	time.Local = time.UTC
+	defer func() { time.Local = savedLocal }()
+
+	at := func(d, h int) time.Time { return time.Date(2026, 10, d, h, 30, 0, 0, time.UTC) }
+	due := at(20, 0).Truncate(24 * time.Hour)
+	list := []Note{
+		{ID: 1, Content: "Купить молоко #дом", CreatedAt: at(1, 9), UpdatedAt: at(1, 9), Tags: []string{"дом", "покупки"}},
+		{ID: 2, Title: "План [черновик]", Content: "1. собрать *цифры* и _графики_\n2. <отправить> #отчёт | a~b\n\\путь\\к\\файлу",
+			CreatedAt: at(1, 18), UpdatedAt: at(2, 10), Tags: []string{"отчёт"}, Due: &due, Pinned: true},
+		{ID: 3, Content: "Позвонить, \"срочно\"; вечером", CreatedAt: at(3, 8), UpdatedAt: at(3, 8), Done: true},
+	}
+	for _, format := range []string{"md", "txt", "csv"} {
+		t.Run(format, func(t *testing.T) {
+			got, err := exportNotes(list, format)
+			if err != nil {
+				t.Fatal(err)
+			}
+			checkGolden(t, "export/notes."+format, got)
+		})
+	}
+}
+
+// captureStdout возвращает всё, что f напечатала в os.Stdout
+func captureStdout(t *testing.T, f func()) string {
+	t.Helper()
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	saved := os.Stdout
+	os.Stdout = w
+	done := make(chan []byte)
+	go func() {
+		data, _ := ioutil.ReadAll(r)
+		done <- data
+	}()
+	f()
+	os.Stdout = saved
+	w.Close()
+	return string(<-done)
+}
+
+// TestFitSegments проверяет обрезку частей строки по ширине: кириллица и
+// эмодзи режутся по границам символов, оформление добавляется после обрезки.
+func TestFitSegments(t *testing.T) {
+	defer func(saved painter) { output = saved }(output)
+	tests := []struct {
+		name     string
+		segments []segment
+		width    int
+		ansi     bool
+		want     string
+	}{
+		{"влезает", []segment{{text: "Купить"}, {text: " #дом", style: styleTag}}, 20, false, "Купить #дом"},
+		{"ровно по ширине", []segment{{text: "Купить"}, {text: " #дом", style: styleTag}}, 11, false, "Купить #дом"},
+		{"кириллица", []segment{{text: "Купить молоко и хлеб"}}, 10, false, "Купить мо…"},
+		{"обрезка второй части", []segment{{text: "Купить"}, {text: " #дом #покупки", style: styleTag}, {text: " (срок)"}}, 12, false, "Купить #дом…"},
+		{"первая часть съела ширину", []segment{{text: "Молоко"}, {text: " #дом", style: styleTag}}, 6, false, "Молоко"},
+		{"эмодзи шириной 2", []segment{{text: "📌📌📌"}}, 4, false, "📌…"},
+		{"цвет после обрезки", []segment{{text: "Купить"}, {text: " #дом #покупки", style: styleTag}}, 10, true, "Купить\x1b[36m #д…\x1b[0m"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			output = plainPainter{}
+			if tt.ansi {
+				output = ansiPainter{}
+			}
+			got := fitSegments(tt.segments, tt.width)
+			if got != tt.want {
+				t.Errorf("fitSegments(%d) = %q, ожидалось %q", tt.width, got, tt.want)
+			}
+			if !tt.ansi && textWidth(got) > tt.width {
+				t.Errorf("fitSegments(%d) = %q шире %d колонок", tt.width, got, tt.width)
+			}
+		})
+	}
+}
+
+// TestPrintRowNarrow проверяет, что строка списка не выходит за ширину
+// терминала и не ломает кириллицу даже в узком окне.
+func TestPrintRowNarrow(t *testing.T) {
+	defer func(saved painter, width, next int) { output, rowWidth, nextNoteID = saved, width, next }(output, rowWidth, nextNoteID)
+	output, nextNoteID = plainPainter{}, 11
+	at := time.Date(2020, 3, 1, 9, 0, 0, 0, time.Local)
+	note := Note{ID: 7, Content: "Съездить на дачу и забрать урожай яблок", Tags: []string{"дача"}, CreatedAt: at, UpdatedAt: at}
+	for _, width := range []int{80, 50, 40, 32} {
+		rowWidth = width
+		line := strings.TrimSuffix(captureStdout(t, func() { printRow(note, "") }), "\n")
+		if w := textWidth(line); w > width {
+			t.Errorf("ширина %d: строка %q занимает %d колонок", width, line, w)
+		}
+		if !utf8.ValidString(line) {
+			t.Errorf("ширина %d: строка %q разрезана посреди символа", width, line)
+		}
+		if !strings.HasPrefix(line, "[ 7] 2020-03-01") {
+			t.Errorf("ширина %d: строка %q без ID и даты", width, line)
+		}
+	}
+	// Уже префикса с отметками: под текст всё равно остаётся 10 колонок
+	rowWidth = 5
+	line := strings.TrimSuffix(captureStdout(t, func() { printRow(note, "") }), "\n")
+	if want := "[ 7] 2020-03-01       Съездить …"; line != want {
+		t.Errorf("ширина 5: %q, ожидалось %q", line, want)
+	}
+}
+
+// TestStripTermuxPath проверяет удаление абсолютного пути программы, который
+// Termux подставляет вторым аргументом при go run.
+func TestStripTermuxPath(t *testing.T) {
+	tests := []struct {
+		args, want []string
+	}{
+		{[]string{"daylist", "/data/data/com.termux/files/usr/tmp/go-build1/exe/DayList", "list"}, []string{"daylist", "list"}},
+		{[]string{"daylist", "/tmp/DayList", "add", "/home/заметка"}, []string{"daylist", "add", "/home/заметка"}},
+		{[]string{"daylist", "add", "/home/заметка"}, []string{"daylist", "add", "/home/заметка"}},
+		{[]string{"daylist", "/tmp/DayList"}, []string{"daylist", "/tmp/DayList"}},
+		{[]string{"daylist", "list"}, []string{"daylist", "list"}},
+		{[]string{"daylist"}, []string{"daylist"}},
+	}
+	for _, tt := range tests {
+		got := stripTermuxPath(append([]string(nil), tt.args...))
+		if strings.Join(got, "\x00") != strings.Join(tt.want, "\x00") {
+			t.Errorf("stripTermuxPath(%q) = %q, ожидалось %q", tt.args, got, tt.want)
+		}
+	}
+}
+
+// TestPrintRowPlain проверяет, что без цвета строки списка выходят без
+// кодов ANSI, а с цветом отличаются от них только этими кодами.
+func TestPrintRowPlain(t *testing.T) {
+	defer func(saved painter, width, next int) { output, rowWidth, nextNoteID = saved, width, next }(output, rowWidth, nextNoteID)
+	rowWidth, nextNoteID = 80, 3
+	at := time.Date(2020, 3, 1, 9, 0, 0, 0, time.Local)
+	due := time.Date(2020, 3, 5, 0, 0, 0, 0, time.Local)
+	list := []Note{
+		{ID: 1, Content: "Сдать отчёт", Tags: []string{"работа"}, Due: &due, Pinned: true, CreatedAt: at, UpdatedAt: at},
+		{ID: 2, Content: "Купить молоко", Done: true, CreatedAt: at, UpdatedAt: at},
+	}
+	render := func(p painter) string {
+		output = p
+		return captureStdout(t, func() {
+			for _, note := range list {
+				printRow(note, "")
+			}
+		})
+	}
+	plain := render(plainPainter{})
+	want := "[1] 2020-03-01    " + pinMark + " Сдать отчёт #работа (срок: 2020-03-05)\n" +
+		"[2] 2020-03-01  " + doneMark + "    Купить молоко\n"
+	if plain != want {
+		t.Errorf("без цвета:\n%q\nожидалось:\n%q", plain, want)
+	}
+	colored := render(ansiPainter{})
+	if !strings.Contains(colored, "\x1b[") {
+		t.Fatalf("с цветом нет кодов ANSI: %q", colored)
+	}
+	if stripped := regexp.MustCompile("\x1b\\[[0-9;]*m").ReplaceAllString(colored, ""); stripped != plain {
+		t.Errorf("с цветом без кодов ANSI:\n%q\nотличается от вывода без цвета:\n%q", stripped, plain)
+	}
+}
+
+// TestCountWords проверяет подсчёт слов в кириллице, латинице и с пунктуацией
+func TestCountWords(t *testing.T) {
+	tests := []struct {
+		in   string
+		want int
+	}{
+		{"", 0},
+		{"   \n\t", 0},
+		{"Привет, мир!", 2},
+		{"Hello, world!", 2},
+		{"Купить milk и bread", 4},
+		{"кто-то сказал: don't panic", 4},
+		{"rock’n’roll", 1},
+		{"раз — два – три - четыре", 4},
+		{"... !!! ??? ---", 0},
+		{"в 2026 году 12 месяцев", 5},
+		{"#тег (в скобках) «в кавычках»", 5},
+		{"ёлка Ёжик", 2},
+	}
+	for _, tt := range tests {
+		if got := countWords(tt.in); got != tt.want {
+			t.Errorf("countWords(%q) = %d, ожидалось %d", tt.in, got, tt.want)
+		}
+	}
+}
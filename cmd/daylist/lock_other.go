@@ -0,0 +1,25 @@
+//go:build !unix
+
+package main
+
+import (
+	"os"
+	"time"
+)
+
+// Функция блокировки заметок на время команды. flock здесь нет, поэтому
+// блокировка всегда исключительная, файлом-меткой с PID процесса.
+func lockNotes(shared bool) error {
+	return lockWithMarker(time.Now().Add(lockWait))
+}
+
+// Функция проверки, что процесс с таким PID существует (в Windows
+// FindProcess открывает процесс и завершается ошибкой, если его нет)
+func processExists(pid int) bool {
+	p, err := os.FindProcess(pid)
+	if err != nil {
+		return false
+	}
+	p.Release()
+	return true
+}
@@ -0,0 +1,50 @@
+//go:build unix
+
+package main
+
+import (
+	"os"
+	"syscall"
+	"time"
+)
+
+// Функция блокировки заметок на время команды: общей (shared) для чтения,
+// исключительной для изменений. Если flock недоступен (бывает на ФС Android)
+// или DAYLIST_LOCK=marker (flock на NFS действует только на одной машине),
+// используется файл-метка с PID процесса.
+func lockNotes(shared bool) error {
+	deadline := time.Now().Add(lockWait)
+	if os.Getenv("DAYLIST_LOCK") == "marker" {
+		return lockWithMarker(deadline)
+	}
+	f, err := os.OpenFile(lockFile, os.O_RDWR|os.O_CREATE, 0644)
+	if err != nil {
+		return err
+	}
+	how := syscall.LOCK_EX
+	if shared {
+		how = syscall.LOCK_SH
+	}
+	for {
+		err := syscall.Flock(int(f.Fd()), how|syscall.LOCK_NB)
+		if err == nil {
+			// Блокировка снимается закрытием файла или завершением процесса
+			unlock = func() { f.Close() }
+			return nil
+		}
+		if err != syscall.EWOULDBLOCK {
+			f.Close()
+			return lockWithMarker(deadline)
+		}
+		if time.Now().After(deadline) {
+			f.Close()
+			return errLocked
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+}
+
+// Функция проверки, что процесс с таким PID существует
+func processExists(pid int) bool {
+	return syscall.Kill(pid, 0) != syscall.ESRCH
+}
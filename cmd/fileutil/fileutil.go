@@ -0,0 +1,2210 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"math"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/KiraLYG/Portfolio/fileutil"
+)
+
+// scanOptions задаёт фильтры, применяемые при обходе директории.
+type scanOptions struct {
+	minSize       int64      // Минимальный размер файла в байтах (0 — без ограничения)
+	maxSize       int64      // Максимальный размер файла в байтах (0 — без ограничения)
+	exclude       stringList // Glob-шаблоны исключаемых путей
+	excludeHidden bool       // Исключать файлы и директории, начинающиеся с точки
+
+	followSymlinks bool // Переходить по символическим ссылкам
+	verbose        bool // Перечислять файлы, пропущенные из-за ошибок
+
+	includeExt stringList // Учитывать только файлы с этими расширениями
+	excludeExt stringList // Пропускать файлы с этими расширениями
+}
+
+// stringList — повторяемый строковый флаг (--exclude=a --exclude=b).
+type stringList []string
+
+func (l *stringList) String() string { return strings.Join(*l, ",") }
+
+func (l *stringList) Set(value string) error {
+	*l = append(*l, value)
+	return nil
+}
+
+// sizeValue — флаг размера с суффиксами K/M/G/T (см. parseSize).
+type sizeValue int64
+
+func (v *sizeValue) String() string { return strconv.FormatInt(int64(*v), 10) }
+
+func (v *sizeValue) Set(value string) error {
+	size, err := parseSize(value)
+	if err != nil {
+		return err
+	}
+	*v = sizeValue(size)
+	return nil
+}
+
+// addSizeFlags регистрирует флаги фильтра по размеру файла.
+func addSizeFlags(fs *flag.FlagSet, opts *scanOptions) {
+	fs.Var((*sizeValue)(&opts.minSize), "min-size", "пропускать файлы меньше указанного размера (например, 1M)")
+	fs.Var((*sizeValue)(&opts.maxSize), "max-size", "пропускать файлы больше указанного размера (например, 1G)")
+}
+
+// addExcludeFlags регистрирует флаги исключения путей.
+func addExcludeFlags(fs *flag.FlagSet, opts *scanOptions) {
+	fs.Var(&opts.exclude, "exclude", "исключить пути по glob-шаблону (имя или относительный путь), можно повторять")
+	fs.BoolVar(&opts.excludeHidden, "exclude-hidden", false, "исключить файлы и директории, начинающиеся с точки")
+	fs.BoolVar(&opts.excludeHidden, "skip-hidden", false, "то же, что --exclude-hidden")
+}
+
+// addWalkFlags регистрирует флаги рекурсивного обхода.
+func addWalkFlags(fs *flag.FlagSet, opts *scanOptions) {
+	fs.BoolVar(&opts.followSymlinks, "follow-symlinks", false, "переходить по символическим ссылкам (циклы обнаруживаются)")
+	fs.BoolVar(&opts.verbose, "verbose", false, "перечислить файлы, пропущенные из-за ошибок")
+}
+
+// addExtFlags регистрирует фильтры по расширению файла.
+func addExtFlags(fs *flag.FlagSet, opts *scanOptions) {
+	fs.Var(&opts.includeExt, "include-ext", "учитывать только файлы с указанными расширениями (jpg,png), можно повторять")
+	fs.Var(&opts.excludeExt, "exclude-ext", "пропускать файлы с указанными расширениями (log,tmp), можно повторять")
+}
+
+// checkExtFlags проверяет, что --include-ext и --exclude-ext не заданы одновременно.
+func (o scanOptions) checkExtFlags() error {
+	if len(o.includeExt) > 0 && len(o.excludeExt) > 0 {
+		return fmt.Errorf("--include-ext и --exclude-ext нельзя использовать вместе")
+	}
+	return nil
+}
+
+// options переводит фильтры обхода в опции пакета fileutil.
+func (o scanOptions) options() []fileutil.Option {
+	opts := []fileutil.Option{
+		fileutil.WithMinSize(o.minSize),
+		fileutil.WithMaxSize(o.maxSize),
+		fileutil.WithExclude(o.exclude...),
+		fileutil.WithIncludeExt(o.includeExt...),
+		fileutil.WithExcludeExt(o.excludeExt...),
+	}
+	if o.excludeHidden {
+		opts = append(opts, fileutil.WithSkipHidden())
+	}
+	if o.followSymlinks {
+		opts = append(opts, fileutil.WithFollowSymlinks())
+	}
+	return opts
+}
+
+// sizeAllowed проверяет, попадает ли размер файла в заданный диапазон.
+func (o scanOptions) sizeAllowed(size int64) bool {
+	if o.minSize > 0 && size < o.minSize {
+		return false
+	}
+	if o.maxSize > 0 && size > o.maxSize {
+		return false
+	}
+	return true
+}
+
+// parseSize разбирает размер вида "512", "10K", "1.5M", "2G" (регистр не важен, суффикс B допустим).
+// Используются двоичные единицы: 1K = 1024 байта, 1M = 1024K, 1G = 1024M, 1T = 1024G.
+func parseSize(s string) (int64, error) {
+	str := strings.ToUpper(strings.TrimSpace(s))
+	str = strings.TrimSuffix(str, "B")
+	multiplier := int64(1)
+	if str != "" {
+		switch str[len(str)-1] {
+		case 'K':
+			multiplier = 1 << 10
+		case 'M':
+			multiplier = 1 << 20
+		case 'G':
+			multiplier = 1 << 30
+		case 'T':
+			multiplier = 1 << 40
+		}
+		if multiplier > 1 {
+			str = str[:len(str)-1]
+		}
+	}
+	value, err := strconv.ParseFloat(str, 64)
+	if err != nil || value < 0 || math.IsNaN(value) || math.IsInf(value, 0) {
+		return 0, fmt.Errorf("неверный размер %q (примеры: 512, 10K, 1.5M, 2G)", s)
+	}
+	// float64(math.MaxInt64) равно 2^63, поэтому сравнение нестрогое: такое значение уже не помещается в int64.
+	if value*float64(multiplier) >= math.MaxInt64 {
+		return 0, fmt.Errorf("слишком большой размер %q", s)
+	}
+	return int64(value * float64(multiplier)), nil
+}
+
+// dupOptions задаёт параметры команды duplicates.
+type dupOptions struct {
+	scan     scanOptions             // Фильтры обхода
+	hash     string                  // Алгоритм хэширования (см. fileutil.NewHasher)
+	progress func(fileutil.Progress) // Ход поиска (nil — не сообщать)
+	top      int                     // Показать только N групп с наибольшим лишним объёмом (0 — все)
+
+	quick  bool   // Остановиться на предварительном хэше начала и конца файла
+	by     string // Способ группировки: content или name-size
+	verify bool   // Для --by=name-size: подтвердить группы хэшем содержимого
+
+	interactive bool   // Интерактивно выбрать, какие копии удалить
+	action      string // Действие с дубликатами: report, delete, move или hardlink
+	target      string // Директория карантина для --action=move
+	dryRun      bool   // Только показать, что было бы удалено или перемещено
+
+	sides    []string // Стороны для --across-only: показывать только группы, охватывающие несколько сторон
+	keepSide int      // Номер стороны, файлы которой всегда остаются (-1 — не задана)
+
+	cache *fileutil.HashCache // Кэш хэшей между запусками (nil — выключен)
+}
+
+// options переводит параметры поиска в опции fileutil.FindDuplicates; чтение
+// ограничивается readLimits.
+func (o dupOptions) options() []fileutil.Option {
+	opts := readLimits.options(o.scan.options()...)
+	opts = append(opts, fileutil.WithHash(o.hash), fileutil.WithCache(o.cache), fileutil.WithProgress(o.progress))
+	if o.quick {
+		opts = append(opts, fileutil.WithQuick())
+	}
+	if o.by == "name-size" {
+		opts = append(opts, fileutil.WithNameSize(o.verify))
+	}
+	return opts
+}
+
+// printScanProgress возвращает обратный вызов для dupOptions.progress, выводящий ход поиска через prog.
+func printScanProgress(prog *progress) func(fileutil.Progress) {
+	return func(p fileutil.Progress) {
+		report := prog.update
+		if p.Final {
+			report = prog.finish
+		}
+		switch p.Stage {
+		case "walk":
+			report("Найдено файлов: %d", p.Done)
+		case "partial":
+			report("Предварительное хэширование: %d/%d файлов", p.Done, p.Total)
+		case "hash":
+			report("Хэширование: %d/%d файлов, %s", p.Done, p.Total, formatSize(p.Bytes))
+		case "verify":
+			report("Проверка: %d файлов", p.Done)
+		}
+	}
+}
+
+// progress выводит ход длительной операции в stderr не чаще нескольких раз в секунду.
+// В терминале строка перезаписывается через \r, иначе периодически печатаются новые строки.
+type progress struct {
+	enabled bool
+	tty     bool
+	last    time.Time
+}
+
+// newProgress создаёт индикатор прогресса; при quiet он ничего не выводит.
+func newProgress(quiet bool) *progress {
+	p := &progress{enabled: !quiet}
+	if info, err := os.Stderr.Stat(); err == nil {
+		p.tty = info.Mode()&os.ModeCharDevice != 0
+	}
+	return p
+}
+
+// update выводит сообщение, если с прошлого вывода прошло достаточно времени.
+func (p *progress) update(format string, args ...interface{}) {
+	if !p.enabled {
+		return
+	}
+	interval := 5 * time.Second
+	if p.tty {
+		interval = 250 * time.Millisecond
+	}
+	if time.Since(p.last) < interval {
+		return
+	}
+	p.last = time.Now()
+	p.print(format, args...)
+}
+
+// finish выводит итоговое сообщение этапа и завершает строку.
+func (p *progress) finish(format string, args ...interface{}) {
+	if !p.enabled {
+		return
+	}
+	p.print(format, args...)
+	if p.tty {
+		fmt.Fprintln(os.Stderr)
+	}
+	p.last = time.Time{}
+}
+
+func (p *progress) print(format string, args ...interface{}) {
+	if p.tty {
+		// \033[K очищает остаток строки от предыдущего, более длинного сообщения.
+		fmt.Fprintf(os.Stderr, "\r"+format+"\033[K", args...)
+		return
+	}
+	fmt.Fprintf(os.Stderr, format+"\n", args...)
+}
+
+// formatSize форматирует размер в байтах в человекочитаемом виде (двоичные единицы).
+func formatSize(bytes int64) string {
+	const unit = 1024
+	if bytes < unit {
+		return fmt.Sprintf("%d B", bytes)
+	}
+	div, exp := int64(unit), 0
+	for n := bytes / unit; n >= unit; n /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %ciB", float64(bytes)/float64(div), "KMGTPE"[exp])
+}
+
+// Коды выхода, общие для всех команд.
+const (
+	exitClean      = 0 // Всё выполнено: дубликатов или различий нет, ошибок нет
+	exitFound      = 1 // Найдены дубликаты или различия; дубликаты, обработанные --action или --interactive, не в счёт
+	exitFileErrors = 2 // Команда завершилась, но часть файлов пропущена из-за ошибок
+	exitFatal      = 3 // Фатальная ошибка: неверные аргументы, недоступная директория и т. п.
+)
+
+// runSummary — машиночитаемая сводка запуска для --summary-json.
+type runSummary struct {
+	Command          string         `json:"command"`
+	ExitCode         int            `json:"exit_code"`
+	StartedAt        time.Time      `json:"started_at"`
+	DurationSeconds  float64        `json:"duration_seconds"`
+	FilesScanned     int            `json:"files_scanned"`
+	BytesHashed      int64          `json:"bytes_hashed"`
+	DuplicateGroups  int            `json:"duplicate_groups"`
+	DuplicateFiles   int            `json:"duplicate_files"` // Лишние копии (без оставляемого файла)
+	BytesReclaimable int64          `json:"bytes_reclaimable"`
+	Actions          map[string]int `json:"actions"` // Выполненные действия: deleted, moved, renamed...
+	Errors           []fileError    `json:"errors"`
+	Fatal            string         `json:"fatal,omitempty"` // Сообщение фатальной ошибки
+
+	found    bool // Найдены различия (compare, checksum verify)
+	resolved bool // Все группы дубликатов обработаны (--action, --interactive), а не только показаны
+}
+
+// summary накапливает сводку текущего запуска; summaryPath задаётся флагом --summary-json.
+var (
+	summary     = runSummary{StartedAt: time.Now(), Actions: map[string]int{}, Errors: []fileError{}}
+	summaryPath string
+)
+
+// addSummaryFlag регистрирует флаг --summary-json.
+func addSummaryFlag(fs *flag.FlagSet) {
+	fs.StringVar(&summaryPath, "summary-json", "", "записать сводку запуска в JSON-файл")
+}
+
+// action учитывает выполненное действие в сводке.
+func (r *runSummary) action(name string) {
+	r.Actions[name]++
+}
+
+// exitCode возвращает код выхода по сводке: пропущенные из-за ошибок файлы важнее
+// найденных дубликатов и различий. Обработанные без ошибок дубликаты — чистый запуск.
+func (r *runSummary) exitCode() int {
+	switch {
+	case len(r.Errors) > 0:
+		return exitFileErrors
+	case r.DuplicateGroups > 0 && !r.resolved || r.found:
+		return exitFound
+	}
+	return exitClean
+}
+
+// exit записывает сводку (если задан --summary-json) и завершает процесс с кодом code.
+func exit(code int) {
+	if summaryPath != "" {
+		summary.ExitCode = code
+		summary.DurationSeconds = time.Since(summary.StartedAt).Seconds()
+		data, err := json.MarshalIndent(summary, "", "  ")
+		if err == nil {
+			err = fileutil.WriteFileAtomic(summaryPath, data)
+		}
+		if err != nil {
+			log.Printf("Ошибка записи сводки %s: %v", summaryPath, err)
+		}
+	}
+	os.Exit(code)
+}
+
+// fatalf выводит сообщение об ошибке и завершает процесс с кодом exitFatal.
+func fatalf(format string, args ...interface{}) {
+	msg := fmt.Sprintf(format, args...)
+	log.Print(msg)
+	summary.Fatal = msg
+	exit(exitFatal)
+}
+
+// fileError — файл, пропущенный из-за ошибки.
+type fileError struct {
+	Path  string `json:"path"`
+	Kind  string `json:"kind"` // permission, vanished, read, rename, device или undo
+	Error string `json:"error"`
+}
+
+// newFileError классифицирует ошибку доступа к файлу path.
+func newFileError(path string, err error) fileError {
+	e := &fileutil.FileError{Path: path, Err: err}
+	return fileError{Path: path, Kind: e.Kind(), Error: err.Error()}
+}
+
+// fileErrors переводит ошибки обхода и чтения пакета fileutil в записи сводки.
+func fileErrors(errs []*fileutil.FileError) []fileError {
+	out := make([]fileError, len(errs))
+	for i, e := range errs {
+		out[i] = newFileError(e.Path, e.Err)
+	}
+	return out
+}
+
+// printWalkStats выводит ненулевые счётчики пропущенных записей.
+func printWalkStats(w io.Writer, s fileutil.WalkStats, opts scanOptions) {
+	if opts.minSize > 0 || opts.maxSize > 0 {
+		fmt.Fprintf(w, "Пропущено файлов по фильтру размера: %d\n", s.SkippedBySize)
+	}
+	if s.Symlinks > 0 {
+		fmt.Fprintf(w, "Пропущено символических ссылок: %d (используйте --follow-symlinks)\n", s.Symlinks)
+	}
+	if s.Hidden > 0 {
+		fmt.Fprintf(w, "Пропущено скрытых файлов и директорий: %d\n", s.Hidden)
+	}
+	if s.Excluded > 0 {
+		fmt.Fprintf(w, "Исключено шаблонами --exclude: %d\n", s.Excluded)
+	}
+	if len(opts.includeExt) > 0 || len(opts.excludeExt) > 0 {
+		fmt.Fprintf(w, "Пропущено файлов по фильтру расширений: %d\n", s.SkippedByExt)
+	}
+	if len(s.Errors) > 0 {
+		counts := make(map[string]int)
+		for _, e := range s.Errors {
+			counts[e.Kind()]++
+		}
+		var parts []string
+		for _, k := range []struct{ kind, label string }{
+			{"permission", "доступ запрещён"},
+			{"vanished", "файл исчез"},
+			{"read", "ошибка чтения"},
+		} {
+			if n := counts[k.kind]; n > 0 {
+				parts = append(parts, fmt.Sprintf("%s: %d", k.label, n))
+			}
+		}
+		fmt.Fprintf(w, "Пропущено из-за ошибок: %d (%s)\n", len(s.Errors), strings.Join(parts, ", "))
+		if opts.verbose {
+			for _, e := range s.Errors {
+				fmt.Fprintf(w, "  %s: %v\n", e.Path, e.Err)
+			}
+		} else {
+			fmt.Fprintln(w, "Список пропущенных файлов: --verbose")
+		}
+	}
+}
+
+// sideIndex — как fileutil.RootIndex, но для пути вне всех директорий dirs возвращает -1.
+func sideIndex(path string, dirs []string) int {
+	best, bestLen := -1, -1
+	for i, root := range dirs {
+		root = filepath.Clean(root)
+		if rel, err := filepath.Rel(root, path); err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+			if len(root) > bestLen {
+				best, bestLen = i, len(root)
+			}
+		}
+	}
+	return best
+}
+
+// sideLabel возвращает обозначение стороны для --across-only: A, B, C...
+func sideLabel(i int) string {
+	return string(rune('A' + i))
+}
+
+// acrossFlag — флаг --across-only: без значения стороны берутся из корней сканирования,
+// со значением dirA:dirB (разделитель списка путей ОС) — из указанных директорий.
+type acrossFlag struct{ sides *[]string }
+
+func (f acrossFlag) IsBoolFlag() bool { return true }
+
+func (f acrossFlag) String() string {
+	if f.sides == nil {
+		return ""
+	}
+	return strings.Join(*f.sides, string(filepath.ListSeparator))
+}
+
+func (f acrossFlag) Set(value string) error {
+	switch value {
+	case "true":
+		*f.sides = []string{acrossRoots}
+	case "false":
+		*f.sides = nil
+	default:
+		*f.sides = filepath.SplitList(value)
+		if len(*f.sides) < 2 {
+			return fmt.Errorf("ожидается минимум две директории через %q", string(filepath.ListSeparator))
+		}
+	}
+	return nil
+}
+
+// acrossRoots — значение-заглушка: стороны --across-only совпадают с корнями сканирования.
+const acrossRoots = "\x00roots"
+
+// spansSides сообщает, что в группе есть файлы хотя бы с двух разных сторон.
+func spansSides(paths []string, sides []string) bool {
+	first := -2
+	for _, p := range paths {
+		i := sideIndex(p, sides)
+		if i < 0 {
+			continue
+		}
+		if first == -2 {
+			first = i
+		} else if i != first {
+			return true
+		}
+	}
+	return false
+}
+
+// filterAcross оставляет только группы, в которых есть файлы с разных сторон.
+func filterAcross(groups []fileutil.Group, sides []string) []fileutil.Group {
+	if len(sides) == 0 {
+		return groups
+	}
+	var kept []fileutil.Group
+	for _, g := range groups {
+		if spansSides(g.Paths, sides) {
+			kept = append(kept, g)
+		}
+	}
+	return kept
+}
+
+// keptPaths возвращает признаки "оставить" для путей группы: с keepSide >= 0 остаются
+// все файлы этой стороны, а если их нет (или keepSide < 0) — только первый файл.
+func keptPaths(group fileutil.Group, sides []string, keepSide int) []bool {
+	keep := make([]bool, len(group.Paths))
+	found := false
+	if keepSide >= 0 {
+		for i, p := range group.Paths {
+			if sideIndex(p, sides) == keepSide {
+				keep[i], found = true, true
+			}
+		}
+	}
+	if !found {
+		keep[0] = true
+	}
+	return keep
+}
+
+// findDuplicates ищет дубликаты в директориях roots и выводит отчёт,
+// а с opts.interactive — предлагает выбрать, какие копии удалить.
+// Если корней несколько, у каждого пути указывается номер его корня.
+func findDuplicates(roots []string, opts dupOptions) {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	groups, stats, err := fileutil.FindDuplicates(ctx, roots, opts.options()...)
+	stop()
+	if errors.Is(err, context.Canceled) {
+		fatalf("Поиск прерван")
+	}
+	if err != nil {
+		fatalf("Ошибка обхода директории: %v", err)
+	}
+	groups = filterAcross(groups, opts.sides)
+	summary.FilesScanned += stats.Files
+	summary.Errors = append(summary.Errors, fileErrors(stats.Errors)...)
+	for _, g := range groups {
+		summary.DuplicateGroups++
+		summary.DuplicateFiles += len(g.Paths) - 1
+		summary.BytesReclaimable += g.Wasted()
+	}
+	if opts.interactive {
+		resolveInteractive(groups, os.Stdin, opts.dryRun)
+		return
+	}
+	// Ошибки отдельных файлов действия записывают в сводку сами, и код выхода тогда 2.
+	summary.resolved = opts.action != "report" && !opts.dryRun
+	switch opts.action {
+	case "delete":
+		deleteDuplicates(groups, opts)
+		return
+	case "move":
+		moveDuplicates(groups, roots, opts)
+		return
+	case "hardlink":
+		hardlinkDuplicates(groups, opts)
+		return
+	}
+	printDuplicates(groups, stats, roots, opts)
+}
+
+// printDuplicates выводит отчёт о найденных группах и итоговую сводку.
+func printDuplicates(groups []fileutil.Group, stats fileutil.Stats, roots []string, opts dupOptions) {
+	// Выводим группы дубликатов (если найдено больше одного файла с одинаковым хэшем).
+	nameOnly := opts.by == "name-size" && !opts.verify
+	switch {
+	case nameOnly:
+		fmt.Println("Файлы с одинаковым именем и размером (--by=name-size): содержимое не проверено, используйте --verify")
+	case opts.by == "name-size":
+		fmt.Printf("Файлы с одинаковым именем и размером, подтверждённые хэшем (%s):\n", opts.hash)
+	case opts.quick:
+		fmt.Printf("Вероятные дубликаты (%s, --quick): у файлов больше %s сравнены только первые и последние %s, содержимое целиком не проверено\n",
+			opts.hash, formatSize(2*fileutil.PartialBlock), formatSize(fileutil.PartialBlock))
+	default:
+		fmt.Printf("Найденные дубликаты (%s):\n", opts.hash)
+	}
+	if len(opts.sides) > 0 {
+		for i, side := range opts.sides {
+			fmt.Printf("[%s] %s\n", sideLabel(i), side)
+		}
+		fmt.Println()
+	} else if len(roots) > 1 {
+		for i, root := range roots {
+			fmt.Printf("[%d] %s\n", i+1, root)
+		}
+		fmt.Println()
+	}
+	var totalWasted int64
+	for i, group := range groups {
+		totalWasted += group.Wasted()
+		if opts.top > 0 && i >= opts.top {
+			continue
+		}
+		if nameOnly {
+			fmt.Printf("Имя: %s\n", group.Hash)
+		} else {
+			fmt.Printf("Hash: %s\n", group.Hash)
+		}
+		fmt.Printf("Размер: %s, копий: %d, лишнее: %s\n", formatSize(group.Size), len(group.Paths), formatSize(group.Wasted()))
+		for _, p := range group.Paths {
+			if len(opts.sides) > 0 {
+				label := "-"
+				if i := sideIndex(p, opts.sides); i >= 0 {
+					label = sideLabel(i)
+				}
+				fmt.Printf("  [%s] %s\n", label, p)
+			} else if len(roots) > 1 {
+				fmt.Printf("  [%d] %s\n", fileutil.RootIndex(p, roots)+1, p)
+			} else {
+				fmt.Printf("  %s\n", p)
+			}
+		}
+		fmt.Println()
+	}
+	if len(groups) == 0 {
+		fmt.Println("Дубликаты не найдены.")
+	} else {
+		if opts.top > 0 && len(groups) > opts.top {
+			fmt.Printf("Показано групп: %d из %d\n", opts.top, len(groups))
+		}
+		fmt.Printf("Потенциальная экономия: %s\n", formatSize(totalWasted))
+	}
+	printWalkStats(os.Stdout, stats.WalkStats, opts.scan)
+	if opts.cache.Path() != "" {
+		fmt.Printf("Хэшей взято из кэша: %d\n", stats.CacheHits)
+	}
+	if stats.PartialHashed > 0 {
+		fmt.Printf("Предварительно хэшировано больших файлов: %d, отсеяно без полного хэширования: %d\n", stats.PartialHashed, stats.PartialUnique)
+	}
+}
+
+// watchDuplicates выполняет обычный поиск, а затем каждые interval повторно обходит
+// директории и сообщает о новых дубликатах, пока процесс не прервут (Ctrl+C).
+func watchDuplicates(roots []string, opts dupOptions, interval time.Duration) {
+	if opts.cache == nil {
+		// Кэш в памяти: между проверками хэш неизменённого файла не пересчитывается.
+		opts.cache, _ = fileutil.LoadHashCache("", false)
+	}
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	groups, stats, err := fileutil.FindDuplicates(ctx, roots, opts.options()...)
+	if errors.Is(err, context.Canceled) {
+		fatalf("Поиск прерван")
+	}
+	if err != nil {
+		fatalf("Ошибка обхода директории: %v", err)
+	}
+	summary.FilesScanned += stats.Files
+	printDuplicates(groups, stats, roots, opts)
+
+	w := fileutil.NewWatcher(ctx, roots, readLimits.options(append(opts.scan.options(), fileutil.WithHash(opts.hash), fileutil.WithCache(opts.cache))...)...)
+	fmt.Printf("\nОжидание новых файлов (проверка каждые %s, Ctrl+C — выход)...\n", interval)
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			if err := opts.cache.Save(); err != nil {
+				log.Printf("Ошибка сохранения кэша хэшей: %v", err)
+			}
+			fmt.Println("Наблюдение остановлено.")
+			return
+		case <-ticker.C:
+			found, errs := w.Check(ctx)
+			for _, e := range errs {
+				log.Printf("Ошибка чтения файла %s: %v", e.Path, e.Err)
+			}
+			for _, d := range found {
+				if len(opts.sides) > 0 && !spansSides(append([]string{d.Path}, d.Copies...), opts.sides) {
+					continue
+				}
+				fmt.Printf("[%s] Новый дубликат (%s, %s):\n", time.Now().Format("15:04:05"), formatSize(d.Size), d.Hash)
+				fmt.Printf("  %s (новый)\n", d.Path)
+				for _, c := range d.Copies {
+					fmt.Printf("  %s\n", c)
+				}
+			}
+			if err := opts.cache.Save(); err != nil {
+				log.Printf("Ошибка сохранения кэша хэшей: %v", err)
+			}
+		}
+	}
+}
+
+// compareOptions задаёт параметры команды compare.
+type compareOptions struct {
+	scan   scanOptions // Фильтры обхода
+	hash   string      // Алгоритм хэширования
+	output string      // Формат вывода: text или json
+}
+
+// printCompare выводит результат сравнения в текстовом виде.
+func printCompare(dirA, dirB string, result fileutil.CompareResult) {
+	fmt.Printf("Только в %s (%d):\n", dirA, len(result.OnlyInA))
+	for _, rel := range result.OnlyInA {
+		fmt.Printf("  %s\n", rel)
+	}
+	fmt.Printf("Только в %s (%d):\n", dirB, len(result.OnlyInB))
+	for _, rel := range result.OnlyInB {
+		fmt.Printf("  %s\n", rel)
+	}
+	fmt.Printf("Различаются (%d):\n", len(result.Different))
+	for _, d := range result.Different {
+		switch d.Reason {
+		case "size":
+			fmt.Printf("  %s (размер: %d / %d)\n", d.Path, d.SizeA, d.SizeB)
+		case "content":
+			fmt.Printf("  %s (содержимое)\n", d.Path)
+		default:
+			fmt.Printf("  %s (ошибка чтения: %s)\n", d.Path, d.Error)
+		}
+	}
+	fmt.Printf("Одинаковых файлов: %d\n", result.Identical)
+}
+
+// largeOptions задаёт параметры команды large.
+type largeOptions struct {
+	scan   scanOptions // Фильтры обхода
+	top    int         // Сколько записей выводить
+	dirs   bool        // Показывать и самые большие директории
+	output string      // Формат вывода: text или json
+}
+
+// sizedPath — путь с размером (файла или суммарным размером директории).
+type sizedPath struct {
+	Path string `json:"path"`
+	Size int64  `json:"size"`
+}
+
+// largeResult — результат команды large.
+type largeResult struct {
+	Files      []sizedPath        `json:"files"`
+	Dirs       []sizedPath        `json:"dirs,omitempty"`
+	TotalFiles int                `json:"total_files"` // Файлов, прошедших фильтры
+	TotalSize  int64              `json:"total_size"`  // Их суммарный размер
+	Skipped    fileutil.WalkStats `json:"skipped"`
+}
+
+// sortBySize сортирует по убыванию размера, при равенстве — по пути.
+func sortBySize(items []sizedPath) {
+	sort.Slice(items, func(i, j int) bool {
+		if items[i].Size != items[j].Size {
+			return items[i].Size > items[j].Size
+		}
+		return items[i].Path < items[j].Path
+	})
+}
+
+// findLarge обходит дерево и возвращает самые большие файлы, а с opts.dirs — и директории.
+// Размер директории считается по всем вложенным файлам, поэтому фильтр размера
+// применяется к списку файлов уже после обхода и на суммы директорий не влияет.
+func findLarge(dir string, opts largeOptions) (largeResult, error) {
+	var result largeResult
+	walkOpts := opts.scan
+	walkOpts.minSize, walkOpts.maxSize = 0, 0
+	dirSizes := make(map[string]int64)
+	root := filepath.Clean(dir)
+
+	stats, err := fileutil.Walk(context.Background(), dir, func(path string, info os.FileInfo) {
+		if opts.dirs {
+			for d := filepath.Dir(path); ; d = filepath.Dir(d) {
+				dirSizes[d] += info.Size()
+				if d == root || d == filepath.Dir(d) {
+					break
+				}
+			}
+		}
+		if !opts.scan.sizeAllowed(info.Size()) {
+			result.Skipped.SkippedBySize++
+			return
+		}
+		result.Files = append(result.Files, sizedPath{Path: path, Size: info.Size()})
+		result.TotalFiles++
+		result.TotalSize += info.Size()
+	}, walkOpts.options()...)
+	result.Skipped.Add(stats)
+	if err != nil {
+		return result, err
+	}
+
+	sortBySize(result.Files)
+	if opts.top > 0 && len(result.Files) > opts.top {
+		result.Files = result.Files[:opts.top]
+	}
+	if result.Files == nil {
+		result.Files = []sizedPath{}
+	}
+	if opts.dirs {
+		for path, size := range dirSizes {
+			result.Dirs = append(result.Dirs, sizedPath{Path: path, Size: size})
+		}
+		sortBySize(result.Dirs)
+		if opts.top > 0 && len(result.Dirs) > opts.top {
+			result.Dirs = result.Dirs[:opts.top]
+		}
+	}
+	return result, nil
+}
+
+// printLarge выводит результат команды large в текстовом виде.
+func printLarge(result largeResult, opts largeOptions) {
+	fmt.Printf("Самые большие файлы (%d из %d, всего %s):\n", len(result.Files), result.TotalFiles, formatSize(result.TotalSize))
+	for _, f := range result.Files {
+		fmt.Printf("  %10s  %s\n", formatSize(f.Size), f.Path)
+	}
+	if opts.dirs {
+		fmt.Println()
+		fmt.Println("Самые большие директории:")
+		for _, d := range result.Dirs {
+			fmt.Printf("  %10s  %s\n", formatSize(d.Size), d.Path)
+		}
+	}
+	printWalkStats(os.Stdout, result.Skipped, opts.scan)
+}
+
+// resolveInteractive проходит по группам дубликатов и спрашивает, какие файлы оставить.
+// Ответ: номера оставляемых файлов через пробел, "a" — оставить все, "s" — пропустить группу,
+// "q" — закончить выбор. Перед удалением выводится полный список и запрашивается подтверждение.
+// Конец ввода (EOF) завершает работу без удаления.
+func resolveInteractive(groups []fileutil.Group, input io.Reader, dryRun bool) {
+	if len(groups) == 0 {
+		fmt.Println("Дубликаты не найдены.")
+		return
+	}
+	reader := bufio.NewReader(input)
+	var queued []string
+	selected := 0 // Групп, в которых выбраны удаляемые файлы
+
+groups:
+	for gi, group := range groups {
+		fmt.Printf("\nГруппа %d из %d (размер: %s, лишнее: %s):\n", gi+1, len(groups), formatSize(group.Size), formatSize(group.Wasted()))
+		for i, path := range group.Paths {
+			mtime := "?"
+			if info, err := os.Stat(path); err == nil {
+				mtime = info.ModTime().Format("2006-01-02 15:04:05")
+			}
+			fmt.Printf("  [%d] %s (%s, %s)\n", i+1, path, formatSize(group.Size), mtime)
+		}
+		for {
+			fmt.Print("Какие оставить (номера через пробел, a — все, s — пропустить, q — выйти): ")
+			line, err := reader.ReadString('\n')
+			if err != nil && line == "" {
+				fmt.Println("\nВвод завершён, ничего не удалено.")
+				return
+			}
+			answer := strings.ToLower(strings.TrimSpace(line))
+			switch answer {
+			case "a", "s":
+				continue groups
+			case "q":
+				break groups
+			}
+			keep, ok := parseSelection(answer, len(group.Paths))
+			if !ok {
+				fmt.Println("Неверный ввод, попробуйте ещё раз.")
+				continue
+			}
+			before := len(queued)
+			for i, path := range group.Paths {
+				if !keep[i] {
+					queued = append(queued, path)
+				}
+			}
+			if len(queued) > before {
+				selected++
+			}
+			continue groups
+		}
+	}
+
+	if len(queued) == 0 {
+		fmt.Println("Нечего удалять.")
+		return
+	}
+	fmt.Printf("\nБудут удалены файлы (%d):\n", len(queued))
+	for _, path := range queued {
+		fmt.Printf("  %s\n", path)
+	}
+	fmt.Print("Удалить? (yes/no): ")
+	line, _ := reader.ReadString('\n')
+	if answer := strings.ToLower(strings.TrimSpace(line)); answer != "yes" && answer != "y" {
+		fmt.Println("Отменено, ничего не удалено.")
+		return
+	}
+	deleteFiles(queued, dryRun)
+	summary.resolved = selected == len(groups) && !dryRun
+}
+
+// parseSelection разбирает номера файлов (с 1) через пробел.
+// Возвращает отметки выбранных файлов; хотя бы один файл должен быть выбран.
+func parseSelection(answer string, count int) ([]bool, bool) {
+	fields := strings.Fields(answer)
+	if len(fields) == 0 {
+		return nil, false
+	}
+	selected := make([]bool, count)
+	for _, field := range fields {
+		n, err := strconv.Atoi(field)
+		if err != nil || n < 1 || n > count {
+			return nil, false
+		}
+		selected[n-1] = true
+	}
+	return selected, true
+}
+
+// deleteDuplicates оставляет в каждой группе первый файл (с --keep-side — все файлы
+// выбранной стороны), а остальные удаляет так же, как интерактивный режим.
+func deleteDuplicates(groups []fileutil.Group, opts dupOptions) {
+	if len(groups) == 0 {
+		fmt.Println("Дубликаты не найдены.")
+		return
+	}
+	var queued []string
+	for _, group := range groups {
+		keep := keptPaths(group, opts.sides, opts.keepSide)
+		for i, path := range group.Paths {
+			if keep[i] {
+				fmt.Printf("Оставлен: %s\n", path)
+			} else {
+				queued = append(queued, path)
+			}
+		}
+	}
+	deleteFiles(queued, opts.dryRun)
+}
+
+// deleteFiles удаляет файлы (в режиме dryRun только выводит их) и сообщает об ошибках.
+// Это общее действие удаления для всех режимов работы с дубликатами.
+func deleteFiles(paths []string, dryRun bool) {
+	if dryRun {
+		fmt.Println("Пробный запуск, файлы не удаляются:")
+	}
+	deleted := 0
+	for _, path := range paths {
+		if dryRun {
+			fmt.Printf("Будет удалён: %s\n", path)
+			continue
+		}
+		if err := os.Remove(path); err != nil {
+			log.Printf("Ошибка удаления файла %s: %v", path, err)
+			summary.Errors = append(summary.Errors, newFileError(path, err))
+			continue
+		}
+		fmt.Printf("Удалён: %s\n", path)
+		summary.action("deleted")
+		deleted++
+	}
+	if !dryRun {
+		fmt.Printf("Удалено файлов: %d из %d\n", deleted, len(paths))
+	}
+}
+
+// moveDuplicates оставляет в каждой группе первый файл (с --keep-side — все файлы выбранной
+// стороны), а остальные перемещает в карантин opts.target (см. fileutil.Quarantine), сохраняя
+// их путь относительно корня сканирования; по манифесту карантина работает команда restore.
+// Каждое перемещение сразу дописывается в журнал отмены: если запуск прервётся, уже
+// перемещённые файлы можно вернуть.
+func moveDuplicates(groups []fileutil.Group, roots []string, opts dupOptions) {
+	if len(groups) == 0 {
+		fmt.Println("Дубликаты не найдены.")
+		return
+	}
+	q, err := fileutil.OpenQuarantine(opts.target, roots, readLimits.options()...)
+	if err != nil {
+		fatalf("Ошибка чтения манифеста: %v", err)
+	}
+	if opts.dryRun {
+		fmt.Println("Пробный запуск, файлы не перемещаются:")
+	}
+	moved, failed, undoID := 0, 0, 0
+	var movedBytes int64
+	for _, group := range groups {
+		keep := keptPaths(group, opts.sides, opts.keepSide)
+		for i, path := range group.Paths {
+			if keep[i] {
+				fmt.Printf("Оставлен: %s\n", path)
+			}
+		}
+		for i, path := range group.Paths {
+			if keep[i] {
+				continue
+			}
+			if opts.dryRun {
+				fmt.Printf("  будет перемещён: %s -> %s\n", path, q.Path(path))
+				continue
+			}
+			e, err := q.Move(path, group.Size)
+			var fe *fileutil.FileError
+			if errors.As(err, &fe) {
+				log.Printf("Ошибка перемещения %s: %v", path, fe.Err)
+				summary.Errors = append(summary.Errors, newFileError(path, fe.Err))
+				failed++
+				continue
+			}
+			summary.action("moved")
+			fmt.Printf("  перемещён: %s -> %s\n", path, e.Path)
+			undoID = recordUndo("duplicates", 0, undoID, []fileutil.UndoOp{{Kind: "move", From: e.Original, To: e.Path, Manifest: q.Manifest}})
+			if err != nil {
+				fatalf("Ошибка записи манифеста: %v", err)
+			}
+			moved++
+			movedBytes += group.Size
+		}
+	}
+	if opts.dryRun {
+		return
+	}
+	fmt.Printf("Перемещено файлов: %d (%s), ошибок: %d\n", moved, formatSize(movedBytes), failed)
+	if moved > 0 {
+		fmt.Printf("Манифест: %s (вернуть файлы: fileutil restore --manifest=%s)\n", q.Manifest, q.Manifest)
+	}
+	if failed > 0 {
+		exit(exitFileErrors)
+	}
+}
+
+// hardlinkDuplicates оставляет в каждой группе первый файл (с --keep-side — первый файл
+// выбранной стороны), а остальные копии заменяет жёсткими ссылками на него. Группа,
+// файлы которой лежат на разных файловых системах, пропускается целиком и попадает
+// в ошибки запуска; копии, уже являющиеся ссылками на оставляемый файл, не трогаются.
+func hardlinkDuplicates(groups []fileutil.Group, opts dupOptions) {
+	if len(groups) == 0 {
+		fmt.Println("Дубликаты не найдены.")
+		return
+	}
+	if opts.dryRun {
+		fmt.Println("Пробный запуск, файлы не заменяются ссылками:")
+	}
+	linked, skipped, failed := 0, 0, 0
+	var savedBytes int64
+groups:
+	for _, group := range groups {
+		keep := keptPaths(group, opts.sides, opts.keepSide)
+		src := ""
+		for i, path := range group.Paths {
+			if keep[i] {
+				src = path
+				break
+			}
+		}
+		srcInfo, err := os.Stat(src)
+		if err != nil {
+			log.Printf("Ошибка чтения %s: %v", src, err)
+			summary.Errors = append(summary.Errors, newFileError(src, err))
+			failed++
+			continue
+		}
+		infos := make([]os.FileInfo, len(group.Paths))
+		for i, path := range group.Paths {
+			if keep[i] {
+				continue
+			}
+			if infos[i], err = os.Stat(path); err != nil {
+				log.Printf("Ошибка чтения %s: %v", path, err)
+				summary.Errors = append(summary.Errors, newFileError(path, err))
+				failed++
+				continue groups
+			}
+			if !fileutil.SameDevice(srcInfo, infos[i]) {
+				err := fmt.Errorf("%s и %s на разных файловых системах, жёсткая ссылка невозможна", src, path)
+				log.Printf("Группа пропущена: %v", err)
+				summary.Errors = append(summary.Errors, fileError{Path: path, Kind: "device", Error: err.Error()})
+				skipped++
+				continue groups
+			}
+		}
+		fmt.Printf("Оставлен: %s\n", src)
+		for i, path := range group.Paths {
+			switch {
+			case keep[i]:
+				continue
+			case os.SameFile(srcInfo, infos[i]):
+				fmt.Printf("  уже ссылка: %s\n", path)
+				continue
+			case opts.dryRun:
+				fmt.Printf("  будет заменён ссылкой: %s\n", path)
+				continue
+			}
+			if err := fileutil.LinkOver(src, path); err != nil {
+				log.Printf("Ошибка замены %s ссылкой: %v", path, err)
+				summary.Errors = append(summary.Errors, newFileError(path, err))
+				failed++
+				continue
+			}
+			summary.action("hardlinked")
+			fmt.Printf("  заменён ссылкой: %s\n", path)
+			linked++
+			savedBytes += group.Size
+		}
+	}
+	if opts.dryRun {
+		return
+	}
+	fmt.Printf("Заменено ссылками: %d (освобождено %s), групп пропущено: %d, ошибок: %d\n", linked, formatSize(savedBytes), skipped, failed)
+}
+
+// restoreQuarantine возвращает файлы из карантина на исходные места по манифесту
+// (см. fileutil.Restore); прерванный restore можно повторить.
+func restoreQuarantine(manifestPath string, dryRun bool) {
+	if dryRun {
+		entries, err := fileutil.ReadQuarantine(manifestPath)
+		if err != nil {
+			fatalf("Ошибка чтения манифеста: %v", err)
+		}
+		if len(entries) == 0 {
+			fmt.Println("Манифест пуст, восстанавливать нечего.")
+			return
+		}
+		fmt.Println("Пробный запуск, файлы не перемещаются:")
+		for _, e := range entries {
+			fmt.Printf("Будет восстановлен: %s -> %s\n", e.Path, e.Original)
+		}
+		return
+	}
+	result, err := fileutil.Restore(manifestPath, readLimits.options()...)
+	for _, e := range result.Restored {
+		summary.action("restored")
+		fmt.Printf("Восстановлен: %s\n", e.Original)
+	}
+	for _, e := range result.Errors {
+		log.Printf("Ошибка восстановления %s: %v", e.Path, e.Err)
+		summary.Errors = append(summary.Errors, newFileError(e.Path, e.Err))
+	}
+	if err != nil {
+		fatalf("Ошибка манифеста %s: %v", manifestPath, err)
+	}
+	if result.Total == 0 {
+		fmt.Println("Манифест пуст, восстанавливать нечего.")
+		return
+	}
+	fmt.Printf("Восстановлено файлов: %d из %d\n", len(result.Restored), result.Total)
+	if len(result.Errors) > 0 {
+		exit(exitFileErrors)
+	}
+}
+
+// undoLogPath — журнал отмены; задаётся флагом --undo-log.
+var undoLogPath string
+
+// defaultUndoLog возвращает журнал отмены по умолчанию в директории настроек пользователя.
+func defaultUndoLog() string {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(dir, "fileutil", "undo.jsonl")
+}
+
+// addUndoFlag регистрирует флаг --undo-log.
+func addUndoFlag(fs *flag.FlagSet) {
+	fs.StringVar(&undoLogPath, "undo-log", defaultUndoLog(), "журнал отмены (JSON Lines) для fileutil undo; пусто — не вести")
+}
+
+// recordUndo записывает операции запуска в журнал отмены (id — как у fileutil.AppendUndo)
+// и возвращает номер запуска; ошибка записи не отменяет выполненного, но выводится и
+// попадает в сводку (код выхода exitFileErrors).
+func recordUndo(command string, undoes, id int, ops []fileutil.UndoOp) int {
+	id, err := fileutil.AppendUndo(undoLogPath, command, undoes, id, ops)
+	if err != nil {
+		logUndoError(err)
+	}
+	return id
+}
+
+// logUndoError выводит ошибку записи журнала отмены и учитывает её в сводке.
+func logUndoError(err error) {
+	log.Printf("Ошибка записи журнала отмены %s: %v", undoLogPath, err)
+	summary.Errors = append(summary.Errors, fileError{Path: undoLogPath, Kind: "undo", Error: err.Error()})
+}
+
+// undoRun отменяет запуск id из журнала (0 — последний, у которого остались неотменённые
+// операции) через fileutil.Undo; сама отмена дописывается в журнал, так что повторный
+// undo её не повторит.
+func undoRun(id int, dryRun bool) {
+	if undoLogPath == "" {
+		fatalf("Журнал отмены не задан: укажите --undo-log")
+	}
+	run, pending, err := fileutil.FindUndo(undoLogPath, id)
+	switch {
+	case errors.Is(err, fileutil.ErrUndoNotFound):
+		fatalf("Запуск %d не найден в журнале отмены %s", id, undoLogPath)
+	case err != nil:
+		fatalf("Ошибка чтения журнала отмены: %v", err)
+	case run == nil:
+		fmt.Println("Отменять нечего.")
+		return
+	case len(pending) == 0:
+		fmt.Printf("Запуск %d (%s) уже отменён.\n", run.ID, run.Command)
+		return
+	}
+	fmt.Printf("Отмена запуска %d (%s, %s), операций: %d\n", run.ID, run.Command, run.Time.Local().Format("2006-01-02 15:04:05"), len(pending))
+	if dryRun {
+		fmt.Println("Пробный запуск, файлы не изменяются:")
+		for i := len(pending) - 1; i >= 0; i-- {
+			fmt.Printf("%s -> %s\n", pending[i].To, pending[i].From)
+		}
+		return
+	}
+
+	result := fileutil.Undo(undoLogPath, run, pending, readLimits.options()...)
+	if result.RenameErr != nil {
+		log.Printf("Ошибка отмены переименований: %v", result.RenameErr)
+		summary.Errors = append(summary.Errors, fileError{Path: undoLogPath, Kind: "rename", Error: result.RenameErr.Error()})
+	}
+	for _, op := range result.Done {
+		fmt.Printf("%s -> %s\n", op.To, op.From)
+	}
+	for _, err := range result.LogErrors {
+		logUndoError(err)
+	}
+	for _, e := range result.Errors {
+		log.Printf("Ошибка отмены %s: %v", e.Path, e.Err)
+		summary.Errors = append(summary.Errors, newFileError(e.Path, e.Err))
+	}
+	summary.Actions["undone"] += len(result.Done)
+	fmt.Printf("Отменено операций: %d из %d\n", len(result.Done), len(pending))
+}
+
+// hashFile вычисляет хэш содержимого файла выбранным алгоритмом с ограничениями readLimits.
+func hashFile(path string, algorithm string) (string, error) {
+	return fileutil.HashFile(context.Background(), path, readLimits.options(fileutil.WithHash(algorithm))...)
+}
+
+// readFlags — настройки чтения файлов при хэшировании (флаги --workers, --read-buffer, --throttle).
+type readFlags struct {
+	workers int                   // Число параллельно хэшируемых файлов (0 — по числу CPU)
+	bufSize int64                 // Размер буфера чтения
+	limiter *fileutil.RateLimiter // Ограничение суммарной скорости чтения (nil — без ограничения)
+}
+
+// readLimits действуют на хэширование команд; задаются флагами команды (см. addIOFlags).
+var readLimits = readFlags{bufSize: fileutil.DefaultReadBuffer}
+
+// options возвращает опции чтения для пакета fileutil вместе с extra;
+// прочитанные байты учитываются в сводке запуска.
+func (r readFlags) options(extra ...fileutil.Option) []fileutil.Option {
+	return append([]fileutil.Option{
+		fileutil.WithWorkers(r.workers),
+		fileutil.WithReadBuffer(r.bufSize),
+		fileutil.WithThrottle(r.limiter),
+		fileutil.WithReadCounter(&summary.BytesHashed),
+	}, extra...)
+}
+
+// addIOFlags регистрирует флаги параллельности и ограничения чтения.
+func addIOFlags(fs *flag.FlagSet) {
+	fs.IntVar(&readLimits.workers, "workers", 0, "сколько файлов хэшировать параллельно (0 — по числу CPU, 1 — последовательно)")
+	fs.Var((*sizeValue)(&readLimits.bufSize), "read-buffer", "размер буфера чтения (например, 1M)")
+	fs.Var(rateFlag{&readLimits.limiter}, "throttle", "ограничить суммарную скорость чтения (например, 50M/s)")
+}
+
+// rateFlag — флаг скорости вида "50M/s" (суффикс /s необязателен, единицы как у parseSize).
+type rateFlag struct{ limiter **fileutil.RateLimiter }
+
+func (f rateFlag) String() string {
+	if f.limiter == nil || *f.limiter == nil {
+		return ""
+	}
+	return formatSize((*f.limiter).Rate()) + "/s"
+}
+
+func (f rateFlag) Set(value string) error {
+	rate, err := parseSize(strings.TrimSuffix(strings.ToLower(value), "/s"))
+	if err != nil {
+		return err
+	}
+	if rate <= 0 {
+		return fmt.Errorf("скорость должна быть положительной")
+	}
+	*f.limiter = fileutil.NewRateLimiter(rate)
+	return nil
+}
+
+// renameOptions задаёт параметры команды rename.
+type renameOptions struct {
+	dryRun    bool        // Только показать новые имена
+	scan      scanOptions // Исключения путей
+	recursive bool        // Обходить поддиректории
+	numbering string      // per-dir — счётчик заново в каждой директории, global — сквозной
+	sortBy    string      // Порядок нумерации: name, mtime или size
+	reverse   bool        // Обратный порядок сортировки
+	template  string      // Шаблон нового имени (пусто — <prefix>_<NNN><ext>)
+	exts      stringList  // Переименовывать только файлы с этими расширениями
+	byDate    bool        // Имя из даты съёмки (EXIF) или времени изменения файла
+	dateFmt   string      // Формат даты для byDate (раскладка пакета time)
+	start     int         // Первый номер счётчика
+	step      int         // Шаг счётчика
+	width     int         // Ширина номера с ведущими нулями (0 — подобрать автоматически)
+	dest      string      // Копировать файлы под новыми именами в эту директорию вместо переименования
+	overwrite bool        // Для dest: перезаписывать существующие файлы
+	verify    bool        // Для dest: сверять копию с оригиналом по хэшу
+	keepOrig  string      // Сохранить исходное имя: "" — нет, suffix — в новом имени, log — в rename-map.csv
+
+	autoRollback bool // При ошибке откатывать выполненные переименования без вопроса
+}
+
+// options переводит параметры переименования в опции fileutil.RenamePlan;
+// skipped получает файлы, оставленные без изменений.
+func (o renameOptions) options(prefix string, skipped func(path, reason string)) []fileutil.Option {
+	opts := append(o.scan.options(),
+		fileutil.WithPrefix(prefix),
+		fileutil.WithNumbering(o.start, o.step),
+		fileutil.WithWidth(o.width),
+		fileutil.WithExtensions(o.exts...),
+		fileutil.WithSort(o.sortBy, o.reverse),
+		fileutil.WithTemplate(o.template),
+		fileutil.WithSkipped(skipped),
+	)
+	if o.recursive {
+		opts = append(opts, fileutil.WithRecursive())
+	}
+	if o.numbering == "global" {
+		opts = append(opts, fileutil.WithGlobalNumbering())
+	}
+	if o.byDate {
+		opts = append(opts, fileutil.WithByDate(o.dateFmt))
+	}
+	if o.keepOrig == "suffix" {
+		opts = append(opts, fileutil.WithOriginalSuffix())
+	}
+	if o.dest != "" {
+		opts = append(opts, fileutil.WithDest(o.dest, o.overwrite))
+	}
+	return opts
+}
+
+// skippedFile — файл, оставленный без изменений, и причина.
+type skippedFile struct {
+	Path   string
+	Reason string
+}
+
+// applyCopy копирует файлы плана под новыми именами, сохраняя время изменения,
+// и сверяет каждую копию по размеру, а с verify — и по хэшу. Ошибочные копии удаляются,
+// остальные файлы копируются дальше. Возвращает число ошибок.
+func applyCopy(plan []fileutil.Rename, opts renameOptions) int {
+	prog := newProgress(false)
+	var copiedBytes int64
+	copied, failed := 0, 0
+	for i, op := range plan {
+		prog.update("Копирование: %d/%d файлов, %s", i, len(plan), formatSize(copiedBytes))
+		size, err := copyVerified(op.From, op.To, opts)
+		if err != nil {
+			log.Printf("Ошибка копирования %s: %v", op.From, err)
+			summary.Errors = append(summary.Errors, newFileError(op.From, err))
+			failed++
+			continue
+		}
+		summary.action("copied")
+		copied++
+		copiedBytes += size
+	}
+	prog.finish("Копирование: %d/%d файлов, %s", copied, len(plan), formatSize(copiedBytes))
+	fmt.Printf("Скопировано файлов: %d, объём: %s\n", copied, formatSize(copiedBytes))
+	return failed
+}
+
+// copyVerified копирует src в dst и проверяет копию; возвращает размер скопированного файла.
+func copyVerified(src, dst string, opts renameOptions) (int64, error) {
+	if err := os.MkdirAll(filepath.Dir(dst), 0755); err != nil {
+		return 0, err
+	}
+	if err := fileutil.CopyFile(src, dst, opts.overwrite); err != nil {
+		return 0, err
+	}
+	srcInfo, err := os.Stat(src)
+	if err != nil {
+		return 0, err
+	}
+	dstInfo, err := os.Stat(dst)
+	if err == nil && dstInfo.Size() != srcInfo.Size() {
+		err = fmt.Errorf("размер копии %d, ожидалось %d", dstInfo.Size(), srcInfo.Size())
+	}
+	if err == nil && opts.verify {
+		var srcHash, dstHash string
+		if srcHash, err = hashFile(src, "sha256"); err == nil {
+			if dstHash, err = hashFile(dst, "sha256"); err == nil && srcHash != dstHash {
+				err = fmt.Errorf("хэш копии не совпадает с оригиналом")
+			}
+		}
+	}
+	if err != nil {
+		os.Remove(dst)
+		return 0, err
+	}
+	return srcInfo.Size(), nil
+}
+
+// confirmRollback спрашивает пользователя, откатить ли переименование после ошибки.
+// Если ввод не с терминала (или закончился), откат выполняется без вопроса.
+func confirmRollback(input *os.File) func(err error) bool {
+	return func(err error) bool {
+		log.Printf("Ошибка переименования: %v", err)
+		if info, statErr := input.Stat(); statErr != nil || info.Mode()&os.ModeCharDevice == 0 {
+			return true
+		}
+		reader := bufio.NewReader(input)
+		for {
+			fmt.Print("Откатить уже выполненные переименования? (yes/no): ")
+			line, readErr := reader.ReadString('\n')
+			switch strings.ToLower(strings.TrimSpace(line)) {
+			case "yes", "y":
+				return true
+			case "no", "n":
+				return false
+			}
+			if readErr != nil {
+				return true
+			}
+		}
+	}
+}
+
+// renameFiles переименовывает файлы в указанной директории по плану fileutil.RenamePlan.
+// В режиме opts.dryRun только выводит соответствие старых и новых имён в том же формате.
+// Конфликты имён обнаруживаются до начала переименования.
+func renameFiles(dir string, prefix string, opts renameOptions) {
+	var skipped []skippedFile
+	plan, err := fileutil.RenamePlan(dir, opts.options(prefix, func(path, reason string) {
+		skipped = append(skipped, skippedFile{Path: path, Reason: reason})
+	})...)
+	if err != nil {
+		fatalf("Ошибка подготовки переименования: %v", err)
+	}
+
+	failed := 0
+	switch {
+	case opts.dryRun && opts.dest != "":
+		fmt.Printf("Пробный запуск, файлы не копируются в %s:\n", opts.dest)
+	case opts.dryRun:
+		fmt.Println("Пробный запуск, файлы не изменяются:")
+	case opts.dest != "":
+		failed = applyCopy(plan, opts)
+	default:
+		rollback := confirmRollback(os.Stdin)
+		if opts.autoRollback {
+			rollback = func(error) bool { return true }
+		}
+		done, err := fileutil.ApplyRollback(plan, rollback)
+		if err != nil {
+			// Журнал отмены описывает состояние, в котором директория осталась после ошибки.
+			recordUndo("rename", 0, 0, fileutil.RenameUndoOps(done))
+			if len(done) == 0 {
+				fatalf("Ошибка переименования: %v", err)
+			}
+			summary.Errors = append(summary.Errors, fileError{Path: dir, Kind: "rename", Error: err.Error()})
+			// Каталог остался частично переименованным: сообщаем, что именно сделано.
+			log.Printf("Ошибка переименования: %v", err)
+			fmt.Println("Переименованы до ошибки:")
+			failed++
+			plan = done
+		} else {
+			recordUndo("rename", 0, 0, fileutil.RenameUndoOps(plan))
+		}
+		summary.Actions["renamed"] += len(plan)
+	}
+	summary.FilesScanned += len(plan) + len(skipped)
+	for _, op := range plan {
+		fmt.Printf("%s -> %s\n", op.From, op.To)
+	}
+	if opts.keepOrig == "log" && len(plan) > 0 {
+		if opts.dryRun {
+			fmt.Printf("Исходные имена будут записаны в %s\n", fileutil.RenameMapName)
+		} else if err := fileutil.WriteRenameMap(plan); err != nil {
+			log.Printf("Ошибка записи %s: %v", fileutil.RenameMapName, err)
+			failed++
+		} else {
+			fmt.Printf("Исходные имена записаны в %s\n", fileutil.RenameMapName)
+		}
+	}
+	if len(skipped) > 0 {
+		fmt.Printf("Пропущено файлов: %d\n", len(skipped))
+		for _, f := range skipped {
+			fmt.Printf("  %s (%s)\n", f.Path, f.Reason)
+		}
+	}
+	if failed > 0 {
+		exit(exitFileErrors)
+	}
+}
+
+// checksumOptions задаёт параметры команды checksum.
+type checksumOptions struct {
+	scan     scanOptions
+	manifest string // Путь к файлу манифеста
+}
+
+// createChecksums записывает манифест в формате sha256sum (см. fileutil.CreateChecksums).
+func createChecksums(dir string, opts checksumOptions) {
+	written, stats, err := fileutil.CreateChecksums(context.Background(), dir, opts.manifest, readLimits.options(opts.scan.options()...)...)
+	if err != nil {
+		fatalf("Ошибка создания манифеста: %v", err)
+	}
+	fmt.Printf("Записано в %s: %d файлов\n", opts.manifest, written)
+	printWalkStats(os.Stdout, stats, opts.scan)
+	summary.Actions["checksummed"] += written
+	summary.FilesScanned += stats.Files
+	summary.Errors = append(summary.Errors, fileErrors(stats.Errors)...)
+	if len(stats.Errors) > 0 {
+		exit(exitFileErrors)
+	}
+}
+
+// verifyChecksums пересчитывает хэши и сравнивает их с манифестом (см. fileutil.VerifyChecksums).
+// Выводит OK/FAILED/MISSING для каждого файла и NEW для файлов, которых нет в манифесте.
+// Код выхода 1, если есть FAILED или MISSING, и 2, если часть файлов не удалось прочитать.
+func verifyChecksums(dir string, opts checksumOptions) {
+	statuses, stats, err := fileutil.VerifyChecksums(context.Background(), dir, opts.manifest, readLimits.options(opts.scan.options()...)...)
+	if err != nil {
+		fatalf("Ошибка проверки манифеста: %v", err)
+	}
+	counts := make(map[string]int)
+	for _, s := range statuses {
+		counts[s.Status]++
+		if s.Err != nil {
+			fmt.Printf("%s: %s (%v)\n", s.Path, s.Status, s.Err)
+		} else {
+			fmt.Printf("%s: %s\n", s.Path, s.Status)
+		}
+	}
+	fmt.Printf("Итого: OK %d, FAILED %d, MISSING %d, NEW %d\n", counts["OK"], counts["FAILED"], counts["MISSING"], counts["NEW"])
+	printWalkStats(os.Stdout, stats, opts.scan)
+	summary.Actions["verified"] += counts["OK"] + counts["FAILED"]
+	summary.FilesScanned += stats.Files
+	summary.Errors = append(summary.Errors, fileErrors(stats.Errors)...)
+	summary.found = counts["FAILED"] > 0 || counts["MISSING"] > 0
+}
+
+// cleanOptions задаёт параметры команды clean.
+type cleanOptions struct {
+	scan        scanOptions // Исключаемые пути не удаляются, а их директории не считаются пустыми
+	emptyFiles  bool        // Удалять файлы нулевого размера
+	emptyDirs   bool        // Удалять пустые директории
+	dryRun      bool        // Только показать, что было бы удалено
+	force       bool        // Разрешить запуск на "/" и неглубоких путях
+	safetyDepth int         // Минимальное число компонентов абсолютного пути
+}
+
+// pathDepth возвращает число компонентов абсолютного пути ("/" — 0, "/home/user" — 2).
+func pathDepth(abs string) int {
+	abs = filepath.ToSlash(strings.TrimPrefix(abs, filepath.VolumeName(abs)))
+	depth := 0
+	for _, part := range strings.Split(abs, "/") {
+		if part != "" {
+			depth++
+		}
+	}
+	return depth
+}
+
+// cleanEmpty проверяет, что запуск безопасен, и удаляет пустые файлы и директории
+// (см. fileutil.Clean).
+func cleanEmpty(dir string, opts cleanOptions) {
+	abs, err := filepath.Abs(dir)
+	if err != nil {
+		fatalf("Ошибка определения пути: %v", err)
+	}
+	info, err := os.Lstat(abs)
+	if err != nil {
+		fatalf("Ошибка доступа к директории: %v", err)
+	}
+	if !info.IsDir() {
+		fatalf("%s не является директорией", dir)
+	}
+	if !opts.force && pathDepth(abs) < opts.safetyDepth {
+		fatalf("Отказ: путь %s короче %d компонентов (используйте --force)", abs, opts.safetyDepth)
+	}
+
+	if opts.dryRun {
+		fmt.Println("Пробный запуск, ничего не удаляется:")
+	}
+	result := fileutil.Clean(abs, fileutil.Cleanup{EmptyFiles: opts.emptyFiles, EmptyDirs: opts.emptyDirs, DryRun: opts.dryRun}, opts.scan.options()...)
+	for _, r := range result.Removed {
+		kind := "файл"
+		if r.Dir {
+			kind = "директория"
+		}
+		if opts.dryRun {
+			fmt.Printf("Будет удалён (%s): %s\n", kind, r.Path)
+		} else {
+			fmt.Printf("Удалён (%s): %s\n", kind, r.Path)
+			summary.action("removed")
+		}
+	}
+	for _, e := range result.Errors {
+		log.Printf("Ошибка очистки %s: %v", e.Path, e.Err)
+		summary.Errors = append(summary.Errors, newFileError(e.Path, e.Err))
+	}
+	summary.FilesScanned += result.Scanned
+	if opts.dryRun {
+		fmt.Printf("Будет удалено: %d\n", len(result.Removed))
+	} else {
+		fmt.Printf("Удалено: %d\n", len(result.Removed))
+	}
+}
+
+// normalizeOptions задаёт, какие преобразования имён выполняет команда normalize.
+type normalizeOptions struct {
+	dryRun    bool
+	recursive bool
+	scan      scanOptions
+	names     fileutil.Normalization // Преобразования имён
+}
+
+// normalizeFiles нормализует имена файлов в директории (с --dry-run — только показывает план).
+func normalizeFiles(dir string, opts normalizeOptions) {
+	walkOpts := opts.scan.options()
+	if opts.recursive {
+		walkOpts = append(walkOpts, fileutil.WithRecursive())
+	}
+	plan, err := fileutil.NormalizePlan(dir, opts.names, walkOpts...)
+	if err != nil {
+		fatalf("Ошибка подготовки переименования: %v", err)
+	}
+	if len(plan) == 0 {
+		fmt.Println("Все имена уже нормализованы.")
+		return
+	}
+	if opts.dryRun {
+		fmt.Println("Пробный запуск, файлы не изменяются:")
+	} else if err := fileutil.Apply(plan); err != nil {
+		fatalf("Ошибка переименования: %v", err)
+	} else {
+		summary.Actions["renamed"] += len(plan)
+		recordUndo("normalize", 0, 0, fileutil.RenameUndoOps(plan))
+	}
+	for _, op := range plan {
+		fmt.Printf("%s -> %s\n", op.From, op.To)
+	}
+}
+
+// parseArgs разбирает флаги, которые могут стоять как до, так и после позиционных аргументов,
+// и возвращает позиционные аргументы по порядку.
+func parseArgs(fs *flag.FlagSet, args []string) []string {
+	var positional []string
+	for {
+		// FlagSet создаётся с flag.ContinueOnError: ошибка уже выведена, остаётся выбрать код выхода.
+		if err := fs.Parse(args); err == flag.ErrHelp {
+			exit(exitClean)
+		} else if err != nil {
+			exit(exitFatal)
+		}
+		args = fs.Args()
+		if len(args) == 0 {
+			return positional
+		}
+		positional = append(positional, args[0])
+		args = args[1:]
+	}
+}
+
+func printUsage() {
+	fmt.Println("Использование:")
+	fmt.Println("  fileutil duplicates <directory>... [флаги]     - поиск дубликатов файлов (в одной или нескольких директориях)")
+	fmt.Println("  fileutil rename <directory> <prefix> [флаги]   - переименование файлов в директории с заданным префиксом")
+	fmt.Println("  fileutil compare <dirA> <dirB> [флаги]         - сравнение двух директорий (код выхода 0 — совпадают)")
+	fmt.Println("  fileutil normalize <directory> [флаги]         - приведение имён файлов к безопасному виду")
+	fmt.Println("  fileutil checksum create <directory> [--out=SHA256SUMS]      - создание манифеста контрольных сумм")
+	fmt.Println("  fileutil checksum verify <directory> [--manifest=SHA256SUMS] - проверка файлов по манифесту")
+	fmt.Println("  fileutil large <directory> [флаги]             - самые большие файлы (и директории)")
+	fmt.Println("  fileutil clean <directory> [флаги]             - удаление пустых файлов и директорий")
+	fmt.Println("  fileutil restore --manifest=FILE [--dry-run]   - вернуть файлы из карантина на прежние места")
+	fmt.Println("  fileutil undo [ID] [--dry-run]                 - отменить последний (или указанный) rename, normalize или --action=move")
+	fmt.Println()
+	fmt.Println("Флаги duplicates:")
+	fmt.Println("  --hash=sha256                 - алгоритм хэширования: sha256, sha1, md5, crc32, fnv")
+	fmt.Println("  --quiet                       - не выводить прогресс сканирования в stderr")
+	fmt.Println("  --top=20                      - показать только группы с наибольшим лишним объёмом")
+	fmt.Println("  --interactive                 - выбрать, какие копии оставить; остальные удаляются после подтверждения")
+	fmt.Println("  --dry-run                     - только показать, какие файлы были бы удалены или перемещены")
+	fmt.Println("  --action=delete               - оставить первый файл группы, остальные удалить")
+	fmt.Println("  --action=move --target=DIR    - оставить первый файл группы, остальные переместить в DIR (с манифестом)")
+	fmt.Println("  --action=hardlink             - оставить первый файл группы, остальные заменить жёсткими ссылками на него")
+	fmt.Println("  --cache=hashes.json           - кэш хэшей: неизменённые файлы (размер и mtime) не хэшируются повторно")
+	fmt.Println("  --no-cache-read               - пересчитать все хэши, но обновить кэш")
+	fmt.Println("  --across-only[=dirA:dirB]     - только группы с файлами с разных сторон (по умолчанию стороны — корни)")
+	fmt.Println("  --keep-side=A                 - с --action=delete|move|hardlink: всегда оставлять файлы этой стороны")
+	fmt.Println("  --watch [--interval=30s]      - после поиска следить за директориями и сообщать о новых дубликатах")
+	fmt.Println("  --by=content|name-size        - группировать по содержимому или по имени и размеру (без чтения файлов)")
+	fmt.Println("  --verify                      - с --by=name-size: подтвердить группы хэшем содержимого (обязателен для --interactive и --action)")
+	fmt.Println("  --quick                       - большие файлы сравнивать только по первым и последним 64 KiB (без проверки)")
+	fmt.Println()
+	fmt.Println("Флаги rename:")
+	fmt.Println("  --dry-run                     - только показать новые имена, не переименовывая файлы")
+	fmt.Println("  --recursive                   - переименовывать файлы и в поддиректориях")
+	fmt.Println("  --numbering=per-dir|global    - счётчик заново в каждой директории или сквозной по дереву")
+	fmt.Println("  --sort=name|mtime|size        - порядок нумерации (при равенстве — по имени)")
+	fmt.Println("  --reverse                     - обратный порядок сортировки")
+	fmt.Println("  --template=TEMPLATE           - шаблон имени: {num}, {num:4}, {ext}, {name}, {date}, {prefix}")
+	fmt.Println("  --ext=jpg,jpeg                - переименовывать только файлы с указанными расширениями")
+	fmt.Println("  --dest=DIR                    - копировать в DIR под новыми именами, оригиналы не трогать")
+	fmt.Println("  --overwrite, --verify         - с --dest: перезаписывать существующие файлы; сверять копии по хэшу")
+	fmt.Println("  --keep-original=suffix|log    - сохранить исходное имя: trip_001__DSC04512.jpg или rename-map.csv")
+	fmt.Println("  --start=1, --step=1           - первый номер и шаг счётчика")
+	fmt.Println("  --width=4                     - ширина номера (по умолчанию по последнему номеру, не меньше 3)")
+	fmt.Println("  --auto-rollback               - при ошибке откатить переименования без вопроса (иначе спросить)")
+	fmt.Println("  --by-date                     - имя из даты съёмки EXIF или времени изменения (префикс необязателен)")
+	fmt.Println("  --format=2006-01-02_150405    - формат даты для --by-date")
+	fmt.Println()
+	fmt.Println("Флаги compare:")
+	fmt.Println("  --hash=sha256                 - алгоритм хэширования")
+	fmt.Println("  --output=text|json            - формат вывода")
+	fmt.Println()
+	fmt.Println("Флаги large:")
+	fmt.Println("  --top=50                      - сколько файлов (и директорий) показать")
+	fmt.Println("  --dirs                        - показать также директории с наибольшим суммарным размером")
+	fmt.Println("  --output=text|json            - формат вывода")
+	fmt.Println()
+	fmt.Println("Флаги clean:")
+	fmt.Println("  --empty-files, --empty-dirs   - что удалять: файлы нулевого размера и/или пустые директории")
+	fmt.Println("  --dry-run                     - только показать, что было бы удалено")
+	fmt.Println("  --safety-depth=2              - отказываться от путей короче N компонентов (и от \"/\")")
+	fmt.Println("  --force                       - снять ограничение --safety-depth")
+	fmt.Println()
+	fmt.Println("Флаги normalize:")
+	fmt.Println("  --dry-run, --recursive        - как у rename")
+	fmt.Println("  --separator=_                 - чем заменять пробелы")
+	fmt.Println("  --ascii                       - транслитерировать кириллицу (по умолчанию она сохраняется)")
+	fmt.Println("  --lower-ext, --trim, --spaces, --strip, --collapse - отдельные преобразования (=false отключает)")
+	fmt.Println()
+	fmt.Println("Общие флаги:")
+	fmt.Println("  --min-size=1M, --max-size=1G  - учитывать только файлы указанного размера (K/M/G/T, основание 1024; duplicates, compare, checksum, large)")
+	fmt.Println("  --exclude=PATTERN             - исключить пути по glob-шаблону (можно повторять)")
+	fmt.Println("  --include-ext=jpg,png         - учитывать только файлы с указанными расширениями (duplicates, compare, large)")
+	fmt.Println("  --exclude-ext=log,tmp         - пропускать файлы с указанными расширениями (там же; несовместим с --include-ext)")
+	fmt.Println("  --workers=N                   - сколько файлов хэшировать параллельно (0 — по числу CPU, 1 — по порядку; duplicates, compare, checksum)")
+	fmt.Println("  --read-buffer=1M              - размер буфера чтения (там же)")
+	fmt.Println("  --throttle=50M/s              - ограничить суммарную скорость чтения всех потоков (там же)")
+	fmt.Println("  --exclude-hidden, --skip-hidden - исключить файлы и директории, начинающиеся с точки")
+	fmt.Println("  --follow-symlinks             - переходить по символическим ссылкам (duplicates, compare, checksum, large; по умолчанию они пропускаются)")
+	fmt.Println("  --verbose                     - перечислить файлы, пропущенные из-за ошибок (там же)")
+	fmt.Println()
+	fmt.Println("  --summary-json=FILE           - записать сводку запуска в JSON (все команды)")
+	fmt.Println()
+	fmt.Println("Коды выхода: 0 — всё в порядке и ничего не найдено, 1 — найдены дубликаты или различия,")
+	fmt.Println("2 — команда завершилась, но часть файлов пропущена из-за ошибок, 3 — фатальная ошибка.")
+}
+
+func main() {
+	// Дополнительная обработка аргументов для корректной работы через "go run" в Termux.
+	// Если первым аргументом является имя Go-файла или абсолютный путь, сдвигаем аргументы.
+	if len(os.Args) > 1 && (strings.HasSuffix(os.Args[1], ".go") || filepath.IsAbs(os.Args[1])) {
+		if len(os.Args) > 2 {
+			os.Args = append([]string{os.Args[0]}, os.Args[2:]...)
+		}
+	}
+
+	if len(os.Args) < 3 && (len(os.Args) < 2 || os.Args[1] != "undo") {
+		printUsage()
+		exit(exitFatal)
+	}
+
+	command := os.Args[1]
+	args := os.Args[2:]
+	summary.Command = command
+	switch command {
+	case "duplicates":
+		cmdDuplicates(args)
+	case "rename":
+		cmdRename(args)
+	case "compare":
+		cmdCompare(args)
+	case "normalize":
+		cmdNormalize(args)
+	case "checksum":
+		cmdChecksum(args)
+	case "large":
+		cmdLarge(args)
+	case "clean":
+		cmdClean(args)
+	case "restore":
+		cmdRestore(args)
+	case "undo":
+		cmdUndo(args)
+	default:
+		fmt.Println("Неизвестная команда:", command)
+		printUsage()
+		exit(exitFatal)
+	}
+	// Код выхода считается по сводке одинаково для всех команд и режимов
+	exit(summary.exitCode())
+}
+
+// cmdDuplicates разбирает аргументы команды duplicates и запускает поиск.
+// Можно указать несколько директорий: дубликаты ищутся по всем сразу.
+// Пример: fileutil duplicates /path/to/directory [/mnt/backup] [--min-size=1M] [--max-size=1G]
+func cmdDuplicates(args []string) {
+	var opts dupOptions
+	fs := flag.NewFlagSet("duplicates", flag.ContinueOnError)
+	addSummaryFlag(fs)
+	addUndoFlag(fs)
+	addSizeFlags(fs, &opts.scan)
+	addWalkFlags(fs, &opts.scan)
+	addIOFlags(fs)
+	addExtFlags(fs, &opts.scan)
+	fs.StringVar(&opts.hash, "hash", "sha256", "алгоритм хэширования: "+strings.Join(fileutil.HashAlgorithms, "|"))
+	quiet := fs.Bool("quiet", false, "не выводить прогресс в stderr")
+	fs.IntVar(&opts.top, "top", 0, "показать только N групп с наибольшим лишним объёмом")
+	fs.BoolVar(&opts.interactive, "interactive", false, "интерактивно выбрать, какие копии оставить, и удалить остальные")
+	fs.BoolVar(&opts.dryRun, "dry-run", false, "только показать, какие файлы были бы удалены или перемещены")
+	fs.StringVar(&opts.action, "action", "report", "действие: report — только отчёт, delete — удалить копии, move — переместить копии в --target, hardlink — заменить копии жёсткими ссылками")
+	fs.StringVar(&opts.target, "target", "", "директория карантина для --action=move")
+	fs.BoolVar(&opts.quick, "quick", false, "сравнивать большие файлы только по началу и концу (вероятные дубликаты)")
+	fs.StringVar(&opts.by, "by", "content", "способ группировки: content|name-size")
+	fs.BoolVar(&opts.verify, "verify", false, "с --by=name-size: подтвердить группы хэшем содержимого")
+	fs.Var(acrossFlag{&opts.sides}, "across-only", "только дубликаты между сторонами: без значения — между корнями, или dirA:dirB")
+	keepSide := fs.String("keep-side", "", "с --across-only и --action=delete|move|hardlink: всегда оставлять файлы стороны (A, B...)")
+	watch := fs.Bool("watch", false, "после поиска следить за директориями и сообщать о новых дубликатах")
+	interval := fs.Duration("interval", 30*time.Second, "период повторной проверки для --watch")
+	cachePath := fs.String("cache", "", "файл кэша хэшей (JSON) для повторных сканирований")
+	noCacheRead := fs.Bool("no-cache-read", false, "не использовать сохранённые хэши, но обновить кэш")
+	addExcludeFlags(fs, &opts.scan)
+	args = parseArgs(fs, args)
+	if readLimits.bufSize <= 0 {
+		fatalf("--read-buffer должен быть положительным")
+	}
+	if err := opts.scan.checkExtFlags(); err != nil {
+		fatalf("%v", err)
+	}
+	if len(args) < 1 {
+		fmt.Println("Укажите директорию для поиска дубликатов.")
+		printUsage()
+		exit(exitFatal)
+	}
+	if _, err := fileutil.NewHasher(opts.hash); err != nil {
+		fatalf("--hash: %v", err)
+	}
+	if opts.by != "content" && opts.by != "name-size" {
+		fatalf("--by: ожидается content или name-size, получено %q", opts.by)
+	}
+	if opts.verify && opts.by != "name-size" {
+		fatalf("--verify используется только с --by=name-size")
+	}
+	if opts.quick && opts.by == "name-size" {
+		fatalf("--quick нельзя использовать с --by=name-size")
+	}
+	if opts.quick && opts.interactive {
+		fatalf("--quick нельзя использовать с --interactive: вероятные дубликаты не проверены")
+	}
+	// Совпадение имени и размера не означает одинакового содержимого: удалять и перемещать
+	// такие «дубликаты» можно только после проверки хэшем.
+	if opts.by == "name-size" && !opts.verify && (opts.interactive || opts.action != "report") {
+		fatalf("--interactive и --action с --by=name-size требуют --verify: содержимое файлов не проверено")
+	}
+	if len(opts.sides) == 1 && opts.sides[0] == acrossRoots {
+		if len(args) < 2 {
+			fatalf("--across-only без значения требует нескольких директорий")
+		}
+		opts.sides = args
+	}
+	opts.keepSide = -1
+	if *keepSide != "" {
+		side := strings.ToUpper(*keepSide)
+		if len(opts.sides) == 0 {
+			fatalf("--keep-side используется только с --across-only")
+		}
+		if len(side) != 1 || side[0] < 'A' || int(side[0]-'A') >= len(opts.sides) {
+			fatalf("--keep-side: ожидается буква стороны от A до %s", sideLabel(len(opts.sides)-1))
+		}
+		if opts.action == "report" {
+			fatalf("--keep-side используется только с --action=delete, move или hardlink")
+		}
+		opts.keepSide = int(side[0] - 'A')
+	}
+	if *watch && (opts.interactive || opts.action != "report" || opts.quick || opts.by != "content") {
+		fatalf("--watch несовместим с --interactive, --action, --quick и --by=name-size")
+	}
+	if *watch && *interval <= 0 {
+		fatalf("--interval должен быть положительным")
+	}
+	switch opts.action {
+	case "report":
+	case "move":
+		if opts.target == "" {
+			fatalf("--action=move требует --target")
+		}
+		if opts.interactive || opts.quick {
+			fatalf("--action=move нельзя использовать с --interactive и --quick")
+		}
+	case "delete", "hardlink":
+		if opts.target != "" {
+			fatalf("--target используется только с --action=move")
+		}
+		if opts.interactive || opts.quick {
+			fatalf("--action=%s нельзя использовать с --interactive и --quick", opts.action)
+		}
+	default:
+		fatalf("--action: ожидается report, delete, move или hardlink, получено %q", opts.action)
+	}
+	if *cachePath != "" {
+		cache, err := fileutil.LoadHashCache(*cachePath, !*noCacheRead)
+		if err != nil {
+			fatalf("--cache: %v", err)
+		}
+		cache.Warn = func(err error) {
+			fmt.Fprintf(os.Stderr, "Предупреждение: не удалось сохранить кэш хэшей %s: %v\n", cache.Path(), err)
+		}
+		opts.cache = cache
+	}
+	opts.progress = printScanProgress(newProgress(*quiet))
+	if *watch {
+		watchDuplicates(args, opts, *interval)
+		return
+	}
+	findDuplicates(args, opts)
+}
+
+// cmdRename разбирает аргументы команды rename и запускает переименование.
+// Пример: fileutil rename /path/to/directory newname [--dry-run]
+func cmdRename(args []string) {
+	var opts renameOptions
+	fs := flag.NewFlagSet("rename", flag.ContinueOnError)
+	addSummaryFlag(fs)
+	addUndoFlag(fs)
+	fs.BoolVar(&opts.dryRun, "dry-run", false, "только показать новые имена, не переименовывая файлы")
+	fs.BoolVar(&opts.recursive, "recursive", false, "переименовывать файлы и в поддиректориях")
+	fs.StringVar(&opts.numbering, "numbering", "per-dir", "нумерация при --recursive: per-dir|global")
+	fs.StringVar(&opts.sortBy, "sort", "name", "порядок нумерации: name|mtime|size")
+	fs.BoolVar(&opts.reverse, "reverse", false, "обратный порядок сортировки")
+	fs.StringVar(&opts.template, "template", "", "шаблон имени, например {date}_{prefix}_{num:4}{ext}")
+	fs.Var(&opts.exts, "ext", "переименовывать только файлы с указанными расширениями (jpg,jpeg), можно повторять")
+	fs.BoolVar(&opts.byDate, "by-date", false, "имя из даты съёмки (EXIF) или времени изменения файла")
+	fs.StringVar(&opts.dateFmt, "format", "2006-01-02_150405", "формат даты для --by-date (раскладка Go)")
+	fs.StringVar(&opts.keepOrig, "keep-original", "", "сохранить исходное имя: suffix — в новом имени, log — в "+fileutil.RenameMapName)
+	fs.IntVar(&opts.start, "start", 1, "первый номер")
+	fs.IntVar(&opts.step, "step", 1, "шаг нумерации")
+	fs.StringVar(&opts.dest, "dest", "", "не переименовывать, а копировать файлы под новыми именами в эту директорию")
+	fs.BoolVar(&opts.overwrite, "overwrite", false, "с --dest: перезаписывать существующие файлы")
+	fs.BoolVar(&opts.verify, "verify", false, "с --dest: сверять копии с оригиналами по хэшу")
+	fs.IntVar(&opts.width, "width", 0, "ширина номера с ведущими нулями (0 — по последнему номеру, не меньше 3)")
+	fs.BoolVar(&opts.autoRollback, "auto-rollback", false, "при ошибке откатывать выполненные переименования без вопроса")
+	addExcludeFlags(fs, &opts.scan)
+	args = parseArgs(fs, args)
+	if opts.byDate && strings.ContainsAny(time.Now().Format(opts.dateFmt), `/\`) {
+		fatalf("--format не должен порождать разделители путей")
+	}
+	if opts.byDate && opts.template != "" {
+		fatalf("--by-date и --template нельзя использовать вместе")
+	}
+	// С --by-date префикс необязателен.
+	if opts.byDate && len(args) == 1 {
+		args = append(args, "")
+	}
+	if opts.sortBy != "name" && opts.sortBy != "mtime" && opts.sortBy != "size" {
+		fatalf("--sort: ожидается name, mtime или size, получено %q", opts.sortBy)
+	}
+	if (opts.overwrite || opts.verify) && opts.dest == "" {
+		fatalf("--overwrite и --verify используются только с --dest")
+	}
+	if opts.keepOrig != "" && opts.keepOrig != "suffix" && opts.keepOrig != "log" {
+		fatalf("--keep-original: ожидается suffix или log, получено %q", opts.keepOrig)
+	}
+	if opts.start < 0 {
+		fatalf("--start не может быть отрицательным")
+	}
+	if opts.step < 1 {
+		fatalf("--step должен быть не меньше 1")
+	}
+	if opts.width < 0 {
+		fatalf("--width не может быть отрицательной")
+	}
+	if opts.numbering != "per-dir" && opts.numbering != "global" {
+		fatalf("--numbering: ожидается per-dir или global, получено %q", opts.numbering)
+	}
+	if len(args) < 2 {
+		fmt.Println("Укажите директорию и префикс для переименования файлов.")
+		printUsage()
+		exit(exitFatal)
+	}
+	if opts.dest != "" {
+		src, errSrc := filepath.Abs(args[0])
+		dst, errDst := filepath.Abs(opts.dest)
+		if errSrc == nil && errDst == nil && src == dst {
+			fatalf("--dest совпадает с исходной директорией; для переименования на месте не указывайте --dest")
+		}
+	}
+	renameFiles(args[0], args[1], opts)
+}
+
+// cmdCompare разбирает аргументы команды compare и сравнивает две директории.
+// Код выхода 0 — деревья совпадают, 1 — есть различия, 2 — часть файлов не удалось прочитать.
+// Пример: fileutil compare /data /mnt/backup [--output=json]
+func cmdCompare(args []string) {
+	var opts compareOptions
+	fs := flag.NewFlagSet("compare", flag.ContinueOnError)
+	addSummaryFlag(fs)
+	addSizeFlags(fs, &opts.scan)
+	addWalkFlags(fs, &opts.scan)
+	addIOFlags(fs)
+	addExtFlags(fs, &opts.scan)
+	addExcludeFlags(fs, &opts.scan)
+	fs.StringVar(&opts.hash, "hash", "sha256", "алгоритм хэширования: "+strings.Join(fileutil.HashAlgorithms, "|"))
+	fs.StringVar(&opts.output, "output", "text", "формат вывода: text|json")
+	args = parseArgs(fs, args)
+	if readLimits.bufSize <= 0 {
+		fatalf("--read-buffer должен быть положительным")
+	}
+	if err := opts.scan.checkExtFlags(); err != nil {
+		fatalf("%v", err)
+	}
+	if len(args) < 2 {
+		fmt.Println("Укажите две директории для сравнения.")
+		printUsage()
+		exit(exitFatal)
+	}
+	if _, err := fileutil.NewHasher(opts.hash); err != nil {
+		fatalf("--hash: %v", err)
+	}
+	if opts.output != "text" && opts.output != "json" {
+		fatalf("--output: ожидается text или json, получено %q", opts.output)
+	}
+
+	result, err := fileutil.CompareDirs(context.Background(), args[0], args[1], readLimits.options(append(opts.scan.options(), fileutil.WithHash(opts.hash))...)...)
+	if err != nil {
+		fatalf("Ошибка сравнения директорий: %v", err)
+	}
+	if opts.output == "json" {
+		data, err := json.MarshalIndent(result, "", "  ")
+		if err != nil {
+			fatalf("Ошибка кодирования JSON: %v", err)
+		}
+		fmt.Println(string(data))
+	} else {
+		printCompare(args[0], args[1], result)
+		printWalkStats(os.Stdout, result.Skipped, opts.scan)
+	}
+	summary.FilesScanned += result.Skipped.Files
+	summary.Errors = append(summary.Errors, fileErrors(result.Skipped.Errors)...)
+	summary.found = len(result.OnlyInA) > 0 || len(result.OnlyInB) > 0 || len(result.Different) > 0
+}
+
+// cmdNormalize разбирает аргументы команды normalize и нормализует имена файлов.
+// Пример: fileutil normalize /path/to/directory [--recursive] [--ascii] [--dry-run]
+func cmdNormalize(args []string) {
+	var opts normalizeOptions
+	fs := flag.NewFlagSet("normalize", flag.ContinueOnError)
+	addSummaryFlag(fs)
+	addUndoFlag(fs)
+	fs.BoolVar(&opts.dryRun, "dry-run", false, "только показать новые имена, не переименовывая файлы")
+	fs.BoolVar(&opts.recursive, "recursive", false, "обрабатывать и поддиректории")
+	fs.StringVar(&opts.names.Separator, "separator", "_", "чем заменять пробелы")
+	fs.BoolVar(&opts.names.LowerExt, "lower-ext", true, "переводить расширение в нижний регистр")
+	fs.BoolVar(&opts.names.Trim, "trim", true, "убирать пробелы по краям имени")
+	fs.BoolVar(&opts.names.Spaces, "spaces", true, "заменять пробелы разделителем")
+	fs.BoolVar(&opts.names.Strip, "strip", true, "удалять символы вне безопасного набора")
+	fs.BoolVar(&opts.names.ASCII, "ascii", false, "транслитерировать кириллицу в латиницу")
+	fs.BoolVar(&opts.names.Collapse, "collapse", true, "схлопывать повторяющиеся разделители")
+	addExcludeFlags(fs, &opts.scan)
+	args = parseArgs(fs, args)
+	if len(args) < 1 {
+		fmt.Println("Укажите директорию для нормализации имён.")
+		printUsage()
+		exit(exitFatal)
+	}
+	if strings.ContainsAny(opts.names.Separator, `/\`) {
+		fatalf("--separator не может содержать разделители путей")
+	}
+	normalizeFiles(args[0], opts)
+}
+
+// cmdChecksum разбирает аргументы команды checksum и создаёт или проверяет манифест.
+// Пример: fileutil checksum create /archive --out=SHA256SUMS
+//
+//	fileutil checksum verify /archive --manifest=SHA256SUMS
+func cmdChecksum(args []string) {
+	if len(args) < 1 || (args[0] != "create" && args[0] != "verify") {
+		fmt.Println("Укажите действие: checksum create или checksum verify.")
+		printUsage()
+		exit(exitFatal)
+	}
+	action := args[0]
+	var opts checksumOptions
+	fs := flag.NewFlagSet("checksum "+action, flag.ContinueOnError)
+	addSummaryFlag(fs)
+	addSizeFlags(fs, &opts.scan)
+	addWalkFlags(fs, &opts.scan)
+	addIOFlags(fs)
+	addExcludeFlags(fs, &opts.scan)
+	if action == "create" {
+		fs.StringVar(&opts.manifest, "out", "SHA256SUMS", "файл манифеста")
+	} else {
+		fs.StringVar(&opts.manifest, "manifest", "SHA256SUMS", "файл манифеста")
+	}
+	rest := parseArgs(fs, args[1:])
+	if readLimits.bufSize <= 0 {
+		fatalf("--read-buffer должен быть положительным")
+	}
+	if len(rest) < 1 {
+		fmt.Println("Укажите директорию.")
+		printUsage()
+		exit(exitFatal)
+	}
+	if action == "create" {
+		createChecksums(rest[0], opts)
+	} else {
+		verifyChecksums(rest[0], opts)
+	}
+}
+
+// cmdLarge разбирает аргументы команды large и выводит самые большие файлы.
+// Пример: fileutil large /path/to/directory [--top=50] [--min-size=100M] [--dirs]
+func cmdLarge(args []string) {
+	var opts largeOptions
+	fs := flag.NewFlagSet("large", flag.ContinueOnError)
+	addSummaryFlag(fs)
+	addSizeFlags(fs, &opts.scan)
+	addWalkFlags(fs, &opts.scan)
+	addExtFlags(fs, &opts.scan)
+	addExcludeFlags(fs, &opts.scan)
+	fs.IntVar(&opts.top, "top", 50, "сколько файлов (и директорий) показать, 0 — все")
+	fs.BoolVar(&opts.dirs, "dirs", false, "показать также самые большие директории")
+	fs.StringVar(&opts.output, "output", "text", "формат вывода: text|json")
+	args = parseArgs(fs, args)
+	if err := opts.scan.checkExtFlags(); err != nil {
+		fatalf("%v", err)
+	}
+	if len(args) < 1 {
+		fmt.Println("Укажите директорию.")
+		printUsage()
+		exit(exitFatal)
+	}
+	if opts.output != "text" && opts.output != "json" {
+		fatalf("--output: ожидается text или json, получено %q", opts.output)
+	}
+
+	result, err := findLarge(args[0], opts)
+	if err != nil {
+		fatalf("Ошибка обхода директории: %v", err)
+	}
+	if opts.output == "json" {
+		data, err := json.MarshalIndent(result, "", "  ")
+		if err != nil {
+			fatalf("Ошибка кодирования JSON: %v", err)
+		}
+		fmt.Println(string(data))
+	} else {
+		printLarge(result, opts)
+	}
+	summary.FilesScanned += result.Skipped.Files
+	summary.Errors = append(summary.Errors, fileErrors(result.Skipped.Errors)...)
+	if len(result.Skipped.Errors) > 0 {
+		exit(exitFileErrors)
+	}
+}
+
+// cmdClean разбирает аргументы команды clean и удаляет пустые файлы и директории.
+// Пример: fileutil clean /path/to/directory --empty-files --empty-dirs [--dry-run]
+func cmdClean(args []string) {
+	var opts cleanOptions
+	fs := flag.NewFlagSet("clean", flag.ContinueOnError)
+	addSummaryFlag(fs)
+	fs.BoolVar(&opts.emptyFiles, "empty-files", false, "удалять файлы нулевого размера")
+	fs.BoolVar(&opts.emptyDirs, "empty-dirs", false, "удалять пустые директории (в том числе ставшие пустыми)")
+	fs.BoolVar(&opts.dryRun, "dry-run", false, "только показать, что было бы удалено")
+	fs.BoolVar(&opts.force, "force", false, "разрешить запуск на \"/\" и путях короче --safety-depth")
+	fs.IntVar(&opts.safetyDepth, "safety-depth", 2, "минимальное число компонентов абсолютного пути")
+	addExcludeFlags(fs, &opts.scan)
+	args = parseArgs(fs, args)
+	if len(args) < 1 {
+		fmt.Println("Укажите директорию для очистки.")
+		printUsage()
+		exit(exitFatal)
+	}
+	if !opts.emptyFiles && !opts.emptyDirs {
+		fatalf("Укажите, что удалять: --empty-files и/или --empty-dirs")
+	}
+	cleanEmpty(args[0], opts)
+}
+
+// cmdRestore разбирает аргументы команды restore и возвращает файлы из карантина.
+// Пример: fileutil restore --manifest=/quarantine/fileutil-quarantine.jsonl [--dry-run]
+func cmdRestore(args []string) {
+	fs := flag.NewFlagSet("restore", flag.ContinueOnError)
+	addSummaryFlag(fs)
+	manifest := fs.String("manifest", "", "манифест карантина ("+fileutil.QuarantineManifestName+")")
+	dryRun := fs.Bool("dry-run", false, "только показать, что было бы восстановлено")
+	args = parseArgs(fs, args)
+	if *manifest == "" && len(args) > 0 {
+		*manifest = args[0]
+	}
+	if *manifest == "" {
+		fmt.Println("Укажите манифест: --manifest=FILE.")
+		printUsage()
+		exit(exitFatal)
+	}
+	restoreQuarantine(*manifest, *dryRun)
+}
+
+// cmdUndo разбирает аргументы команды undo и отменяет запуск из журнала отмены.
+// Пример: fileutil undo [ID] [--undo-log=FILE] [--dry-run]
+func cmdUndo(args []string) {
+	fs := flag.NewFlagSet("undo", flag.ContinueOnError)
+	addSummaryFlag(fs)
+	addUndoFlag(fs)
+	dryRun := fs.Bool("dry-run", false, "только показать, что было бы возвращено")
+	args = parseArgs(fs, args)
+	id := 0
+	if len(args) > 0 {
+		n, err := strconv.Atoi(args[0])
+		if err != nil || n < 1 {
+			fatalf("undo: ожидается номер запуска, получено %q", args[0])
+		}
+		id = n
+	}
+	undoRun(id, *dryRun)
+}
@@ -0,0 +1,503 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"net"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/KiraLYG/Portfolio/fileutil"
+)
+
+// TestMain запускает программу вместо тестов, если тест перезапустил себя как fileutil
+// (см. runFileutil): так проверяются коды выхода, которые main передаёт os.Exit.
+func TestMain(m *testing.M) {
+	if os.Getenv("FILEUTIL_TEST_MAIN") == "1" {
+		os.Args = append([]string{"fileutil"}, os.Args[1:]...)
+		main()
+		os.Exit(exitClean)
+	}
+	// Журнал отмены по умолчанию лежит в директории настроек: тесты не должны трогать настоящую.
+	home, err := os.MkdirTemp("", "fileutil-home-")
+	if err != nil {
+		panic(err)
+	}
+	os.Setenv("HOME", home)
+	os.Setenv("XDG_CONFIG_HOME", filepath.Join(home, ".config"))
+	os.Setenv("AppData", filepath.Join(home, "AppData"))
+	code := m.Run()
+	os.RemoveAll(home)
+	os.Exit(code)
+}
+
+// runFileutil выполняет fileutil с аргументами args и вводом input в отдельном
+// процессе и возвращает вывод и код выхода.
+func runFileutil(t *testing.T, input string, args ...string) (string, int) {
+	t.Helper()
+	cmd := exec.Command(os.Args[0], args...)
+	cmd.Env = append(os.Environ(), "FILEUTIL_TEST_MAIN=1")
+	cmd.Stdin = strings.NewReader(input)
+	out, err := cmd.CombinedOutput()
+	var exitErr *exec.ExitError
+	if err != nil && !errors.As(err, &exitErr) {
+		t.Fatal(err)
+	}
+	return string(out), cmd.ProcessState.ExitCode()
+}
+
+// writeFiles создаёт в dir файлы с содержимым, равным их имени.
+func writeFiles(t *testing.T, dir string, names ...string) {
+	t.Helper()
+	for _, name := range names {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(name), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+// dirContents возвращает содержимое файлов dir по именам; временные имена тоже попадают в результат.
+func dirContents(t *testing.T, dir string) map[string]string {
+	t.Helper()
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	files := map[string]string{}
+	for _, e := range entries {
+		if e.IsDir() {
+			continue
+		}
+		data, err := os.ReadFile(filepath.Join(dir, e.Name()))
+		if err != nil {
+			t.Fatal(err)
+		}
+		files[e.Name()] = string(data)
+	}
+	return files
+}
+
+// unreadable создаёт в dir unix-сокет: обход видит его как файл, а открыть его нельзя
+// даже под root, поэтому хэширование завершается ошибкой чтения.
+func unreadable(t *testing.T, dir string) {
+	t.Helper()
+	l, err := net.Listen("unix", filepath.Join(dir, "s"))
+	if err != nil {
+		t.Skipf("unix-сокеты недоступны: %v", err)
+	}
+	l.(*net.UnixListener).SetUnlinkOnClose(false)
+	l.Close()
+}
+
+// checksums создаёт манифест {dir}/SUMS для {dir}/x и затем вызывает change, если он задан.
+func checksums(change func(t *testing.T, x string)) func(t *testing.T, dir string) {
+	return func(t *testing.T, dir string) {
+		t.Helper()
+		x := filepath.Join(dir, "x")
+		if out, code := runFileutil(t, "", "checksum", "create", x, "--out="+filepath.Join(dir, "SUMS")); code != exitClean {
+			t.Fatalf("checksum create: код %d\n%s", code, out)
+		}
+		if change != nil {
+			change(t, x)
+		}
+	}
+}
+
+// TestExitCodes проверяет коды выхода: дубликаты дают exitFound, только пока они
+// остаются — в отчёте, в пробном запуске и в группах, оставленных в интерактивном режиме;
+// обработанные без ошибок --action и --interactive дают exitClean.
+func TestExitCodes(t *testing.T) {
+	tests := []struct {
+		name  string
+		files []string // Содержимое файла равно имени: "a" и "a" в разных директориях — дубликаты
+		setup func(t *testing.T, dir string)
+		input string
+		args  []string // {dir} заменяется директорией с файлами, {target} — директорией карантина
+		want  int
+	}{
+		{"отчёт без дубликатов", []string{"x/a", "x/b"}, nil, "", []string{"duplicates", "{dir}"}, exitClean},
+		{"отчёт с дубликатами", []string{"x/a", "y/a"}, nil, "", []string{"duplicates", "{dir}"}, exitFound},
+		{"интерактивно, оставить все", []string{"x/a", "y/a"}, nil, "a\n", []string{"duplicates", "{dir}", "--interactive"}, exitFound},
+		{"интерактивно с удалением", []string{"x/a", "y/a"}, nil, "1\nyes\n", []string{"duplicates", "{dir}", "--interactive"}, exitClean},
+		{"интерактивно, удаление отменено", []string{"x/a", "y/a"}, nil, "1\nno\n", []string{"duplicates", "{dir}", "--interactive"}, exitFound},
+		{"интерактивно, пробное удаление", []string{"x/a", "y/a"}, nil, "1\nyes\n", []string{"duplicates", "{dir}", "--interactive", "--dry-run"}, exitFound},
+		{"интерактивно, конец ввода", []string{"x/a", "y/a"}, nil, "", []string{"duplicates", "{dir}", "--interactive"}, exitFound},
+		{"интерактивно без дубликатов", []string{"x/a", "x/b"}, nil, "", []string{"duplicates", "{dir}", "--interactive"}, exitClean},
+		{"перемещение", []string{"x/a", "y/a"}, nil, "", []string{"duplicates", "{dir}", "--action=move", "--target={target}"}, exitClean},
+		{"пробное перемещение", []string{"x/a", "y/a"}, nil, "", []string{"duplicates", "{dir}", "--action=move", "--target={target}", "--dry-run"}, exitFound},
+		{"удаление", []string{"x/a", "y/a", "z/a"}, nil, "", []string{"duplicates", "{dir}", "--action=delete"}, exitClean},
+		{"пробное удаление", []string{"x/a", "y/a"}, nil, "", []string{"duplicates", "{dir}", "--action=delete", "--dry-run"}, exitFound},
+		{"жёсткие ссылки", []string{"x/a", "y/a"}, nil, "", []string{"duplicates", "{dir}", "--action=hardlink"}, exitClean},
+		{"удаление с ошибкой чтения", []string{"x/a", "y/a", "z/b"}, func(t *testing.T, dir string) {
+			if err := os.WriteFile(filepath.Join(dir, "z", "empty"), nil, 0644); err != nil {
+				t.Fatal(err)
+			}
+			unreadable(t, filepath.Join(dir, "z"))
+		}, "", []string{"duplicates", "{dir}", "--action=delete"}, exitFileErrors},
+		{"перемещение без дубликатов", []string{"x/a", "x/b"}, nil, "", []string{"duplicates", "{dir}", "--action=move", "--target={target}"}, exitClean},
+		{"compare без различий", []string{"x/a", "y/a"}, nil, "", []string{"compare", "{dir}/x", "{dir}/y"}, exitClean},
+		{"compare с различиями", []string{"x/a", "y/b"}, nil, "", []string{"compare", "{dir}/x", "{dir}/y"}, exitFound},
+		{"rename", []string{"x/a", "x/b"}, nil, "", []string{"rename", "{dir}/x", "p"}, exitClean},
+		{"неверный флаг", []string{"x/a"}, nil, "", []string{"duplicates", "{dir}", "--no-such-flag"}, exitFatal},
+		{"несуществующая директория", nil, nil, "", []string{"duplicates", "{dir}/missing"}, exitFatal},
+		{"ошибка чтения", []string{"x/a", "y/a", "z/b"}, func(t *testing.T, dir string) {
+			// Размер сокета нулевой: он попадает в одну группу с пустым файлом и хэшируется.
+			if err := os.WriteFile(filepath.Join(dir, "z", "empty"), nil, 0644); err != nil {
+				t.Fatal(err)
+			}
+			unreadable(t, filepath.Join(dir, "z"))
+		}, "", []string{"duplicates", "{dir}"}, exitFileErrors},
+		{"checksum create", []string{"x/a", "x/b"}, nil, "", []string{"checksum", "create", "{dir}/x", "--out={dir}/SUMS"}, exitClean},
+		{"checksum create с ошибкой", []string{"x/a"}, func(t *testing.T, dir string) { unreadable(t, filepath.Join(dir, "x")) }, "", []string{"checksum", "create", "{dir}/x", "--out={dir}/SUMS"}, exitFileErrors},
+		{"checksum verify OK", []string{"x/a", "x/b"}, checksums(nil), "", []string{"checksum", "verify", "{dir}/x", "--manifest={dir}/SUMS"}, exitClean},
+		{"checksum verify FAILED", []string{"x/a", "x/b"}, checksums(func(t *testing.T, x string) {
+			if err := os.WriteFile(filepath.Join(x, "a"), []byte("изменён"), 0644); err != nil {
+				t.Fatal(err)
+			}
+		}), "", []string{"checksum", "verify", "{dir}/x", "--manifest={dir}/SUMS"}, exitFound},
+		{"checksum verify MISSING", []string{"x/a", "x/b"}, checksums(func(t *testing.T, x string) {
+			if err := os.Remove(filepath.Join(x, "a")); err != nil {
+				t.Fatal(err)
+			}
+		}), "", []string{"checksum", "verify", "{dir}/x", "--manifest={dir}/SUMS"}, exitFound},
+		{"checksum verify с ошибкой", []string{"x/a", "x/b"}, checksums(func(t *testing.T, x string) {
+			if err := os.Remove(filepath.Join(x, "a")); err != nil {
+				t.Fatal(err)
+			}
+			unreadable(t, x)
+			if err := os.Rename(filepath.Join(x, "s"), filepath.Join(x, "a")); err != nil {
+				t.Fatal(err)
+			}
+		}), "", []string{"checksum", "verify", "{dir}/x", "--manifest={dir}/SUMS"}, exitFileErrors},
+		{"clean", []string{"x/a"}, func(t *testing.T, dir string) {
+			if err := os.WriteFile(filepath.Join(dir, "x", "empty"), nil, 0644); err != nil {
+				t.Fatal(err)
+			}
+		}, "", []string{"clean", "{dir}", "--empty-files", "--empty-dirs"}, exitClean},
+		{"clean без режима", []string{"x/a"}, nil, "", []string{"clean", "{dir}"}, exitFatal},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir, target := t.TempDir(), t.TempDir()
+			for _, name := range tt.files {
+				path := filepath.Join(dir, filepath.FromSlash(name))
+				if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+					t.Fatal(err)
+				}
+				if err := os.WriteFile(path, []byte(filepath.Base(name)), 0644); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if tt.setup != nil {
+				tt.setup(t, dir)
+			}
+			args := make([]string, len(tt.args))
+			for i, arg := range tt.args {
+				args[i] = strings.NewReplacer("{dir}", dir, "{target}", target).Replace(arg)
+			}
+			out, code := runFileutil(t, tt.input, args...)
+			if code != tt.want {
+				t.Errorf("%v: код выхода %d, ожидался %d\n%s", tt.args, code, tt.want, out)
+			}
+		})
+	}
+}
+
+// TestSummaryJSON проверяет сводку --summary-json: счётчики, код выхода и ошибки файлов.
+func TestSummaryJSON(t *testing.T) {
+	dir := t.TempDir()
+	for _, sub := range []string{"x", "y"} {
+		if err := os.Mkdir(filepath.Join(dir, sub), 0755); err != nil {
+			t.Fatal(err)
+		}
+		writeFiles(t, filepath.Join(dir, sub), "a", "bb")
+	}
+	path := filepath.Join(t.TempDir(), "summary.json")
+	out, code := runFileutil(t, "", "duplicates", dir, "--summary-json="+path)
+	if code != exitFound {
+		t.Fatalf("код выхода %d, ожидался %d\n%s", code, exitFound, out)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got runSummary
+	if err := json.Unmarshal(data, &got); err != nil {
+		t.Fatalf("сводка не разбирается: %v\n%s", err, data)
+	}
+	if got.Command != "duplicates" || got.ExitCode != exitFound || got.FilesScanned != 4 ||
+		got.DuplicateGroups != 2 || got.DuplicateFiles != 2 || got.BytesReclaimable != 3 ||
+		got.BytesHashed != 6 || got.StartedAt.IsZero() || got.Fatal != "" {
+		t.Errorf("сводка %+v", got)
+	}
+	if got.Errors == nil || len(got.Errors) != 0 {
+		t.Errorf("errors: %#v, ожидался пустой список", got.Errors)
+	}
+
+	// Фатальная ошибка тоже попадает в сводку.
+	if _, code := runFileutil(t, "", "duplicates", filepath.Join(dir, "missing"), "--summary-json="+path); code != exitFatal {
+		t.Fatalf("код выхода %d, ожидался %d", code, exitFatal)
+	}
+	data, err = os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got = runSummary{}
+	if err := json.Unmarshal(data, &got); err != nil || got.ExitCode != exitFatal || got.Fatal == "" {
+		t.Errorf("сводка фатальной ошибки: %+v, %v", got, err)
+	}
+}
+
+// TestHardlinkDuplicates проверяет --action=hardlink: копии становятся ссылками на
+// оставленный файл без временных файлов, а группа на разных файловых системах не трогается.
+func TestHardlinkDuplicates(t *testing.T) {
+	dir := t.TempDir()
+	for _, sub := range []string{"x", "y", "z"} {
+		if err := os.Mkdir(filepath.Join(dir, sub), 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	writeFiles(t, filepath.Join(dir, "x"), "a", "b")
+	writeFiles(t, filepath.Join(dir, "y"), "a")
+	if err := os.Link(filepath.Join(dir, "x", "a"), filepath.Join(dir, "z", "a")); err != nil {
+		t.Fatal(err)
+	}
+	writeFiles(t, filepath.Join(dir, "z"), "b")
+
+	out, code := runFileutil(t, "", "duplicates", dir, "--action=hardlink", "--dry-run")
+	if code != exitFound || !strings.Contains(out, "будет заменён ссылкой") {
+		t.Fatalf("--dry-run: код %d\n%s", code, out)
+	}
+	if same(t, filepath.Join(dir, "x", "b"), filepath.Join(dir, "z", "b")) {
+		t.Fatal("--dry-run заменил файл ссылкой")
+	}
+
+	out, code = runFileutil(t, "", "duplicates", dir, "--action=hardlink")
+	if code != exitClean {
+		t.Fatalf("код выхода %d, ожидался %d\n%s", code, exitClean, out)
+	}
+	for _, pair := range [][2]string{{"x/a", "y/a"}, {"x/a", "z/a"}, {"x/b", "z/b"}} {
+		if !same(t, filepath.Join(dir, pair[0]), filepath.Join(dir, pair[1])) {
+			t.Errorf("%s и %s не стали одним файлом\n%s", pair[0], pair[1], out)
+		}
+	}
+	if !strings.Contains(out, "уже ссылка") {
+		t.Errorf("уже связанная копия не отмечена:\n%s", out)
+	}
+	for _, sub := range []string{"x", "y", "z"} {
+		for name, content := range dirContents(t, filepath.Join(dir, sub)) {
+			if content != name {
+				t.Errorf("%s/%s: содержимое %q или оставлен временный файл", sub, name, content)
+			}
+		}
+	}
+
+	// Между файловыми системами ссылки невозможны: группа пропускается целиком.
+	other, err := os.MkdirTemp("/dev/shm", "fileutil-test-")
+	if err != nil {
+		t.Skipf("нет второй файловой системы: %v", err)
+	}
+	defer os.RemoveAll(other)
+	infoA, _ := os.Stat(dir)
+	infoB, _ := os.Stat(other)
+	if fileutil.SameDevice(infoA, infoB) {
+		t.Skip("/dev/shm на той же файловой системе")
+	}
+	writeFiles(t, other, "c")
+	writeFiles(t, filepath.Join(dir, "x"), "c")
+	out, code = runFileutil(t, "", "duplicates", filepath.Join(dir, "x"), other, "--action=hardlink")
+	if code != exitFileErrors || !strings.Contains(out, "на разных файловых системах") {
+		t.Errorf("группа на разных файловых системах: код %d\n%s", code, out)
+	}
+	if same(t, filepath.Join(dir, "x", "c"), filepath.Join(other, "c")) {
+		t.Error("файлы на разных файловых системах оказались одним файлом")
+	}
+}
+
+// same сообщает, являются ли пути a и b одним и тем же файлом.
+func same(t *testing.T, a, b string) bool {
+	t.Helper()
+	infoA, err := os.Stat(a)
+	if err != nil {
+		t.Fatal(err)
+	}
+	infoB, err := os.Stat(b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return os.SameFile(infoA, infoB)
+}
+
+// TestDeleteDuplicates проверяет --action=delete: по умолчанию остаётся первый файл
+// группы, с --keep-side — все файлы выбранной стороны, а --dry-run ничего не удаляет.
+func TestDeleteDuplicates(t *testing.T) {
+	tests := []struct {
+		name string
+		args []string
+		want []string // Оставшиеся файлы
+		code int
+	}{
+		{"первый файл", nil, []string{"a/1", "a/2"}, exitClean},
+		{"пробный запуск", []string{"--dry-run"}, []string{"a/1", "a/2", "b/1", "b/1copy", "b/2"}, exitFound},
+		{"сторона A", []string{"--across-only", "--keep-side=A"}, []string{"a/1", "a/2"}, exitClean},
+		{"сторона B", []string{"--across-only", "--keep-side=B"}, []string{"b/1", "b/1copy", "b/2"}, exitClean},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			for name, content := range map[string]string{"a/1": "один", "a/2": "два", "b/1": "один", "b/1copy": "один", "b/2": "два"} {
+				path := filepath.Join(dir, filepath.FromSlash(name))
+				if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+					t.Fatal(err)
+				}
+				if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+					t.Fatal(err)
+				}
+			}
+			args := append([]string{"duplicates", filepath.Join(dir, "a"), filepath.Join(dir, "b"), "--action=delete"}, tt.args...)
+			out, code := runFileutil(t, "", args...)
+			if code != tt.code {
+				t.Fatalf("код выхода %d, ожидался %d\n%s", code, tt.code, out)
+			}
+			var left []string
+			for _, sub := range []string{"a", "b"} {
+				for name := range dirContents(t, filepath.Join(dir, sub)) {
+					left = append(left, sub+"/"+name)
+				}
+			}
+			sort.Strings(left)
+			if !reflect.DeepEqual(left, tt.want) {
+				t.Errorf("остались %q, ожидалось %q\n%s", left, tt.want, out)
+			}
+		})
+	}
+	if _, code := runFileutil(t, "", "duplicates", t.TempDir(), "--action=delete", "--target=/tmp"); code != exitFatal {
+		t.Errorf("--action=delete с --target: код %d, ожидался %d", code, exitFatal)
+	}
+}
+
+// TestUndoMove проверяет, что undo возвращает перемещённые в карантин файлы по журналу
+// отмены, вычёркивает их из манифеста и дописывает в журнал саму отмену.
+func TestUndoMove(t *testing.T) {
+	dir, target := t.TempDir(), t.TempDir()
+	undoLog := filepath.Join(t.TempDir(), "undo.jsonl")
+	for _, sub := range []string{"x", "y"} {
+		if err := os.Mkdir(filepath.Join(dir, sub), 0755); err != nil {
+			t.Fatal(err)
+		}
+		writeFiles(t, filepath.Join(dir, sub), "a", "b")
+	}
+	before := map[string]map[string]string{"x": dirContents(t, filepath.Join(dir, "x")), "y": dirContents(t, filepath.Join(dir, "y"))}
+
+	out, code := runFileutil(t, "", "duplicates", dir, "--action=move", "--target="+target, "--undo-log="+undoLog)
+	if code != exitClean {
+		t.Fatalf("move: код %d\n%s", code, out)
+	}
+	if got := dirContents(t, filepath.Join(dir, "y")); len(got) != 0 {
+		t.Fatalf("копии не перемещены: %v\n%s", got, out)
+	}
+	records, err := fileutil.ReadUndoLog(undoLog)
+	if err != nil || len(records) != 1 || records[0].Command != "duplicates" || len(records[0].Ops) != 2 {
+		t.Fatalf("журнал после move: %+v, %v", records, err)
+	}
+	logged, err := os.ReadFile(undoLog)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if out, code := runFileutil(t, "", "undo", "--dry-run", "--undo-log="+undoLog); code != exitClean || len(dirContents(t, filepath.Join(dir, "y"))) != 0 {
+		t.Fatalf("undo --dry-run: код %d\n%s", code, out)
+	}
+	out, code = runFileutil(t, "", "undo", "--undo-log="+undoLog)
+	if code != exitClean {
+		t.Fatalf("undo: код %d\n%s", code, out)
+	}
+	for sub, want := range before {
+		if got := dirContents(t, filepath.Join(dir, sub)); !reflect.DeepEqual(got, want) {
+			t.Errorf("%s после undo: %v, ожидалось %v\n%s", sub, got, want, out)
+		}
+	}
+	if _, err := os.Stat(filepath.Join(target, fileutil.QuarantineManifestName)); !os.IsNotExist(err) {
+		t.Errorf("манифест карантина не удалён после возврата всех файлов: %v", err)
+	}
+	data, err := os.ReadFile(undoLog)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.HasPrefix(data, logged) {
+		t.Errorf("журнал отмены переписан, а не дополнен:\n%s", data)
+	}
+	records, err = fileutil.ReadUndoLog(undoLog)
+	if err != nil || len(records) != 2 || records[1].Command != "undo" || records[1].Undoes != records[0].ID {
+		t.Fatalf("журнал после undo: %+v, %v", records, err)
+	}
+
+	out, code = runFileutil(t, "", "undo", "--undo-log="+undoLog)
+	if code != exitClean || !strings.Contains(out, "Отменять нечего") {
+		t.Errorf("повторный undo: код %d\n%s", code, out)
+	}
+}
+
+// TestUndoRename проверяет отмену переименования по журналу, в том числе с
+// --keep-original=suffix: исходные имена берутся из журнала, а не из суффиксов.
+func TestUndoRename(t *testing.T) {
+	for _, extra := range [][]string{nil, {"--keep-original=suffix"}, {"--recursive", "--numbering=global"}} {
+		dir := t.TempDir()
+		undoLog := filepath.Join(t.TempDir(), "undo.jsonl")
+		writeFiles(t, dir, "p_002.txt", "z.txt", "b__c.txt")
+		want := dirContents(t, dir)
+		args := append([]string{"rename", dir, "p", "--undo-log=" + undoLog}, extra...)
+		if out, code := runFileutil(t, "", args...); code != exitClean || reflect.DeepEqual(dirContents(t, dir), want) {
+			t.Fatalf("%v: код %d\n%s", extra, code, out)
+		}
+		if out, code := runFileutil(t, "", "undo", "--undo-log="+undoLog); code != exitClean {
+			t.Fatalf("%v: undo: код %d\n%s", extra, code, out)
+		}
+		if got := dirContents(t, dir); !reflect.DeepEqual(got, want) {
+			t.Errorf("%v: после undo %v, ожидалось %v", extra, got, want)
+		}
+	}
+}
+
+// TestHashCacheStoreError проверяет, что ошибка периодического сохранения кэша
+func TestParseSize(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    int64
+		wantErr bool
+	}{
+		{"512", 512, false},
+		{"0", 0, false},
+		{"10K", 10 << 10, false},
+		{"10kb", 10 << 10, false},
+		{" 2G ", 2 << 30, false},
+		{"1T", 1 << 40, false},
+		{"1.5M", 3 << 19, false},
+		{"0.5K", 512, false},
+		{"100B", 100, false},
+		{"8191P", 0, true}, // Неизвестный суффикс
+		{"", 0, true},
+		{"K", 0, true},
+		{"-1", 0, true},
+		{"abc", 0, true},
+		{"inf", 0, true},
+		{"+Inf", 0, true},
+		{"NaN", 0, true},
+		{"1e30", 0, true},
+		{"99999999T", 0, true},
+		{"9223372036854775807", 0, true}, // Ровно 2^63 после преобразования во float64
+		{"8388607T", 8388607 << 40, false},
+	}
+	for _, tt := range tests {
+		got, err := parseSize(tt.in)
+		if (err != nil) != tt.wantErr || got != tt.want {
+			t.Errorf("parseSize(%q) = %d, %v; ожидалось %d, ошибка: %v", tt.in, got, err, tt.want, tt.wantErr)
+		}
+	}
+}
@@ -0,0 +1,609 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"os/signal"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// Task описывает структуру задачи.
+type Task struct {
+	ID            int        `json:"id"`                       // Уникальный идентификатор задачи
+	Title         string     `json:"title"`                    // Заголовок задачи
+	Description   string     `json:"description"`              // Описание задачи
+	Completed     bool       `json:"completed"`                // Статус выполнения
+	Priority      string     `json:"priority,omitempty"`       // Приоритет (low, medium, high); пустой — без приоритета
+	Tags          []string   `json:"tags,omitempty"`           // Метки задачи
+	CreatedAt     time.Time  `json:"created_at"`               // Дата и время создания задачи
+	DueAt         *time.Time `json:"due_at,omitempty"`         // Срок выполнения (необязательный)
+	ReminderState string     `json:"reminder_state,omitempty"` // Последнее отправленное напоминание; сбрасывается при смене срока
+}
+
+// Состояния напоминаний о сроке задачи.
+const (
+	reminderDueSoon = "due_soon"
+	reminderOverdue = "overdue"
+)
+
+// Допустимые приоритеты задачи.
+var priorities = []string{"low", "medium", "high"}
+
+// noPriority — ключ в сводке для задач без приоритета.
+const noPriority = "none"
+
+// dueSoonWindow — за сколько до срока задача считается "скоро срок".
+const dueSoonWindow = 24 * time.Hour
+
+// tasks хранит список задач в памяти.
+var tasks []Task
+
+// nextID используется для генерации нового ID задачи.
+var nextID int = 1
+
+// mutex для защиты доступа к срезу tasks.
+// Чтение выполняется под RLock, изменения — под Lock.
+var mutex = &sync.RWMutex{}
+
+// Списки методов, которые поддерживает каждый маршрут (для заголовка Allow).
+const (
+	tasksAllow = "GET, HEAD, POST, OPTIONS"        // /tasks
+	taskAllow  = "GET, HEAD, PUT, DELETE, OPTIONS" // /tasks/{id}
+	statsAllow = "GET, HEAD, OPTIONS"              // /tasks/stats
+	dueAllow   = "GET, HEAD, OPTIONS"              // /tasks/due
+)
+
+// statsDays — за сколько последних дней считается количество созданных задач.
+const statsDays = 7
+
+// DayCount описывает количество задач, созданных за один день.
+type DayCount struct {
+	Date  string `json:"date"`  // День в формате YYYY-MM-DD
+	Count int    `json:"count"` // Количество созданных задач
+}
+
+// Stats описывает сводку по задачам для GET /tasks/stats.
+type Stats struct {
+	Total                int            `json:"total"`                             // Всего задач
+	Completed            int            `json:"completed"`                         // Выполненные задачи
+	Open                 int            `json:"open"`                              // Невыполненные задачи
+	ByPriority           map[string]int `json:"by_priority"`                       // Количество задач по приоритетам
+	ByTag                map[string]int `json:"by_tag"`                            // Количество задач по меткам
+	CreatedLastDays      []DayCount     `json:"created_last_7_days"`               // Созданные задачи по дням, от старых к новым
+	OldestOpenAge        string         `json:"oldest_open_age,omitempty"`         // Возраст самой старой открытой задачи
+	OldestOpenAgeSeconds *int64         `json:"oldest_open_age_seconds,omitempty"` // То же в секундах
+}
+
+// Event описывает событие, которое генерирует фоновый обработчик напоминаний.
+type Event struct {
+	Type string    `json:"type"` // task.due_soon или task.overdue
+	Task Task      `json:"task"` // Задача на момент события
+	At   time.Time `json:"at"`   // Время генерации события
+}
+
+func main() {
+	// Флаг для включения фоновых напоминаний (0 — выключены).
+	remindInterval := flag.Duration("remind-interval", 0, "интервал проверки сроков задач (например, 1h); 0 — напоминания выключены")
+	remindWebhook := flag.String("remind-webhook", "", "адрес, на который события напоминаний отправляются POST-запросом в JSON")
+	flag.Parse()
+	if *remindWebhook != "" && *remindInterval <= 0 {
+		log.Fatal("Флаг -remind-webhook работает только вместе с -remind-interval")
+	}
+
+	// Контекст отменяется по Ctrl+C или SIGTERM.
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	var wg sync.WaitGroup
+	if *remindInterval > 0 {
+		emit := logEvent
+		if *remindWebhook != "" {
+			post := webhookEmitter(&http.Client{Timeout: 10 * time.Second}, *remindWebhook)
+			emit = func(e Event) {
+				logEvent(e)
+				post(e)
+			}
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			runReminders(ctx, *remindInterval, emit)
+		}()
+	}
+
+	server := &http.Server{Addr: ":8080", Handler: newMux()}
+	// ListenAndServe возвращается сразу после начала Shutdown, поэтому завершение
+	// обработки текущих запросов ожидается отдельно, по закрытию shutdownDone.
+	shutdownDone := make(chan struct{})
+	go func() {
+		defer close(shutdownDone)
+		<-ctx.Done()
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		if err := server.Shutdown(shutdownCtx); err != nil {
+			log.Printf("Ошибка остановки сервера: %v", err)
+		}
+	}()
+
+	fmt.Println("Сервер запущен на порту 8080")
+	// Запускаем HTTP сервер на порту 8080.
+	if err := server.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		log.Fatal(err)
+	}
+	// Дожидаемся завершения текущих запросов и остановки фонового обработчика напоминаний.
+	<-shutdownDone
+	wg.Wait()
+	fmt.Println("Сервер остановлен")
+}
+
+// newMux регистрирует обработчики маршрутов API.
+func newMux() *http.ServeMux {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/tasks", tasksHandler) // для GET /tasks и POST /tasks
+	mux.HandleFunc("/tasks/", taskHandler) // для GET, PUT, DELETE с конкретным ID (например, /tasks/1)
+	return mux
+}
+
+// runReminders периодически проверяет сроки задач, пока не будет отменён ctx.
+func runReminders(ctx context.Context, interval time.Duration, emit func(Event)) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		checkReminders(time.Now(), emit)
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// checkReminders находит открытые задачи, перешедшие в состояние "скоро срок"
+// или "просрочена", и генерирует по одному событию на каждый переход.
+// Отправленное состояние запоминается в задаче, поэтому повторных событий нет.
+func checkReminders(now time.Time, emit func(Event)) {
+	var events []Event
+	mutex.Lock()
+	for i := range tasks {
+		t := &tasks[i]
+		if t.Completed || t.DueAt == nil {
+			continue
+		}
+		state := ""
+		switch {
+		case !now.Before(*t.DueAt):
+			state = reminderOverdue
+		case !now.Before(t.DueAt.Add(-dueSoonWindow)):
+			state = reminderDueSoon
+		}
+		if state == "" || state == t.ReminderState {
+			continue
+		}
+		t.ReminderState = state
+		events = append(events, Event{Type: "task." + state, Task: *t, At: now})
+	}
+	mutex.Unlock()
+
+	// События отправляются вне блокировки, чтобы медленный получатель не тормозил API.
+	for _, e := range events {
+		emit(e)
+	}
+}
+
+// logEvent выводит событие напоминания в лог в формате JSON.
+func logEvent(e Event) {
+	data, err := json.Marshal(e)
+	if err != nil {
+		log.Printf("Ошибка кодирования события: %v", err)
+		return
+	}
+	log.Printf("Событие: %s", data)
+}
+
+// webhookEmitter возвращает получателя событий, который отправляет каждое событие
+// POST-запросом в JSON на адрес url. Ошибки доставки только выводятся в лог: состояние
+// напоминания уже сохранено в задаче, поэтому событие повторно не отправляется.
+func webhookEmitter(client *http.Client, url string) func(Event) {
+	return func(e Event) {
+		data, err := json.Marshal(e)
+		if err != nil {
+			log.Printf("Ошибка кодирования события: %v", err)
+			return
+		}
+		resp, err := client.Post(url, "application/json", bytes.NewReader(data))
+		if err != nil {
+			log.Printf("Ошибка отправки события %s задачи %d: %v", e.Type, e.Task.ID, err)
+			return
+		}
+		resp.Body.Close()
+		if resp.StatusCode < 200 || resp.StatusCode > 299 {
+			log.Printf("Событие %s задачи %d не принято: статус %d", e.Type, e.Task.ID, resp.StatusCode)
+		}
+	}
+}
+
+// tasksHandler обрабатывает запросы к коллекции задач.
+func tasksHandler(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	// Получение списка задач (HEAD возвращает те же заголовки без тела)
+	case http.MethodGet, http.MethodHead:
+		getTasks(w, r)
+	// Создание новой задачи
+	case http.MethodPost:
+		createTask(w, r)
+	// Список поддерживаемых методов
+	case http.MethodOptions:
+		writeOptions(w, tasksAllow)
+	default:
+		methodNotAllowed(w, tasksAllow)
+	}
+}
+
+// taskHandler обрабатывает запросы для работы с конкретной задачей.
+func taskHandler(w http.ResponseWriter, r *http.Request) {
+	// Извлекаем ID из URL. Ожидается формат /tasks/{id}
+	parts := strings.Split(r.URL.Path, "/")
+	if len(parts) < 3 {
+		http.Error(w, "Неверный URL", http.StatusBadRequest)
+		return
+	}
+	switch parts[2] {
+	case "stats":
+		statsHandler(w, r)
+		return
+	case "due":
+		dueHandler(w, r)
+		return
+	}
+	id, err := strconv.Atoi(parts[2])
+	if err != nil {
+		http.Error(w, "Неверный ID задачи", http.StatusBadRequest)
+		return
+	}
+
+	switch r.Method {
+	// Получение задачи по ID (HEAD возвращает те же заголовки без тела)
+	case http.MethodGet, http.MethodHead:
+		getTask(w, r, id)
+	// Обновление задачи по ID
+	case http.MethodPut:
+		updateTask(w, r, id)
+	// Удаление задачи по ID
+	case http.MethodDelete:
+		deleteTask(w, r, id)
+	// Список поддерживаемых методов
+	case http.MethodOptions:
+		writeOptions(w, taskAllow)
+	default:
+		methodNotAllowed(w, taskAllow)
+	}
+}
+
+// statsHandler обрабатывает запросы к сводке по задачам.
+func statsHandler(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet, http.MethodHead:
+		getStats(w, r)
+	case http.MethodOptions:
+		writeOptions(w, statsAllow)
+	default:
+		methodNotAllowed(w, statsAllow)
+	}
+}
+
+// dueHandler обрабатывает запросы к списку задач с приближающимся сроком.
+func dueHandler(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet, http.MethodHead:
+		getDueTasks(w, r)
+	case http.MethodOptions:
+		writeOptions(w, dueAllow)
+	default:
+		methodNotAllowed(w, dueAllow)
+	}
+}
+
+// writeJSON кодирует v в JSON и отправляет его с указанным статусом.
+// Тело буферизуется, чтобы заранее выставить Content-Length; для HEAD-запросов
+// отправляются только заголовки.
+func writeJSON(w http.ResponseWriter, r *http.Request, status int, v interface{}) {
+	var buf bytes.Buffer
+	if err := json.NewEncoder(&buf).Encode(v); err != nil {
+		http.Error(w, "Ошибка кодирования ответа", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Content-Length", strconv.Itoa(buf.Len()))
+	w.WriteHeader(status)
+	if r.Method != http.MethodHead {
+		w.Write(buf.Bytes())
+	}
+}
+
+// writeOptions отвечает на OPTIONS-запрос списком поддерживаемых методов.
+func writeOptions(w http.ResponseWriter, allow string) {
+	w.Header().Set("Allow", allow)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// methodNotAllowed отвечает 405 с корректным заголовком Allow.
+func methodNotAllowed(w http.ResponseWriter, allow string) {
+	w.Header().Set("Allow", allow)
+	http.Error(w, "Метод не поддерживается", http.StatusMethodNotAllowed)
+}
+
+// taskFilter отбирает задачи по параметрам запроса GET /tasks и GET /tasks/stats.
+type taskFilter struct {
+	completed *bool  // ?completed=true|false; nil — любые
+	query     string // ?q= — подстрока заголовка или описания без учёта регистра
+	tag       string // ?tag= — задачи с этой меткой, без учёта регистра
+}
+
+// parseTaskFilter разбирает параметры фильтра из запроса.
+func parseTaskFilter(r *http.Request) (taskFilter, error) {
+	var f taskFilter
+	q := r.URL.Query()
+	if v := q.Get("completed"); v != "" {
+		completed, err := strconv.ParseBool(v)
+		if err != nil {
+			return f, errors.New("Неверный параметр completed")
+		}
+		f.completed = &completed
+	}
+	f.query = strings.ToLower(q.Get("q"))
+	f.tag = strings.ToLower(strings.TrimSpace(q.Get("tag")))
+	return f, nil
+}
+
+// match сообщает, подходит ли задача под фильтр.
+func (f taskFilter) match(t Task) bool {
+	if f.completed != nil && t.Completed != *f.completed {
+		return false
+	}
+	if f.tag != "" && !slices.Contains(t.Tags, f.tag) {
+		return false
+	}
+	return f.query == "" || strings.Contains(strings.ToLower(t.Title), f.query) ||
+		strings.Contains(strings.ToLower(t.Description), f.query)
+}
+
+// getTasks возвращает список задач, подходящих под фильтр.
+func getTasks(w http.ResponseWriter, r *http.Request) {
+	filter, err := parseTaskFilter(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	mutex.RLock()
+	defer mutex.RUnlock()
+	list := []Task{}
+	for _, t := range tasks {
+		if filter.match(t) {
+			list = append(list, t)
+		}
+	}
+	writeJSON(w, r, http.StatusOK, list)
+}
+
+// getTask возвращает одну задачу по ID.
+func getTask(w http.ResponseWriter, r *http.Request, id int) {
+	mutex.RLock()
+	defer mutex.RUnlock()
+	for _, t := range tasks {
+		if t.ID == id {
+			writeJSON(w, r, http.StatusOK, t)
+			return
+		}
+	}
+	http.Error(w, "Задача не найдена", http.StatusNotFound)
+}
+
+// getStats возвращает сводку по задачам с теми же фильтрами, что и GET /tasks.
+func getStats(w http.ResponseWriter, r *http.Request) {
+	filter, err := parseTaskFilter(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	mutex.RLock()
+	stats := computeStats(tasks, filter, time.Now())
+	mutex.RUnlock()
+	writeJSON(w, r, http.StatusOK, stats)
+}
+
+// computeStats считает сводку по задачам, подходящим под фильтр, за один проход по списку.
+func computeStats(list []Task, filter taskFilter, now time.Time) Stats {
+	// Первый день окна; корзины считаются в календарных днях локального времени.
+	first := now.AddDate(0, 0, -(statsDays - 1))
+
+	stats := Stats{
+		ByPriority:      map[string]int{},
+		ByTag:           map[string]int{},
+		CreatedLastDays: make([]DayCount, statsDays),
+	}
+	// dayIndex сопоставляет календарный день с его корзиной в CreatedLastDays.
+	dayIndex := make(map[string]int, statsDays)
+	for i := range stats.CreatedLastDays {
+		day := first.AddDate(0, 0, i).Format("2006-01-02")
+		stats.CreatedLastDays[i].Date = day
+		dayIndex[day] = i
+	}
+
+	var oldestOpen time.Time
+	for _, t := range list {
+		if !filter.match(t) {
+			continue
+		}
+		stats.Total++
+		if t.Completed {
+			stats.Completed++
+		} else {
+			stats.Open++
+			if oldestOpen.IsZero() || t.CreatedAt.Before(oldestOpen) {
+				oldestOpen = t.CreatedAt
+			}
+		}
+		priority := t.Priority
+		if priority == "" {
+			priority = noPriority
+		}
+		stats.ByPriority[priority]++
+		for _, tag := range t.Tags {
+			stats.ByTag[tag]++
+		}
+		if idx, ok := dayIndex[t.CreatedAt.In(now.Location()).Format("2006-01-02")]; ok {
+			stats.CreatedLastDays[idx].Count++
+		}
+	}
+
+	if !oldestOpen.IsZero() {
+		age := now.Sub(oldestOpen).Round(time.Second)
+		stats.OldestOpenAge = age.String()
+		seconds := int64(age / time.Second)
+		stats.OldestOpenAgeSeconds = &seconds
+	}
+	return stats
+}
+
+// getDueTasks возвращает открытые задачи со сроком в пределах окна ?within=
+// (по умолчанию 24h), включая уже просроченные, отсортированные по сроку.
+func getDueTasks(w http.ResponseWriter, r *http.Request) {
+	within := dueSoonWindow
+	if v := r.URL.Query().Get("within"); v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil || d < 0 {
+			http.Error(w, "Неверный параметр within", http.StatusBadRequest)
+			return
+		}
+		within = d
+	}
+	deadline := time.Now().Add(within)
+
+	mutex.RLock()
+	due := []Task{}
+	for _, t := range tasks {
+		if !t.Completed && t.DueAt != nil && !t.DueAt.After(deadline) {
+			due = append(due, t)
+		}
+	}
+	mutex.RUnlock()
+
+	sort.SliceStable(due, func(i, j int) bool {
+		return due[i].DueAt.Before(*due[j].DueAt)
+	})
+	writeJSON(w, r, http.StatusOK, due)
+}
+
+// createTask создаёт новую задачу.
+func createTask(w http.ResponseWriter, r *http.Request) {
+	var task Task
+	// Декодируем JSON из тела запроса.
+	if err := json.NewDecoder(r.Body).Decode(&task); err != nil {
+		http.Error(w, "Неверные данные", http.StatusBadRequest)
+		return
+	}
+	if err := normalizeTask(&task); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	mutex.Lock()
+	// Присваиваем задаче уникальный ID и заполняем дату создания.
+	task.ID = nextID
+	nextID++
+	task.CreatedAt = time.Now()
+	task.ReminderState = ""
+	tasks = append(tasks, task)
+	mutex.Unlock()
+
+	writeJSON(w, r, http.StatusCreated, task)
+}
+
+// updateTask обновляет данные задачи по ID.
+func updateTask(w http.ResponseWriter, r *http.Request, id int) {
+	var updatedTask Task
+	// Декодируем обновлённые данные задачи.
+	if err := json.NewDecoder(r.Body).Decode(&updatedTask); err != nil {
+		http.Error(w, "Неверные данные", http.StatusBadRequest)
+		return
+	}
+	if err := normalizeTask(&updatedTask); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	mutex.Lock()
+	defer mutex.Unlock()
+	for i, t := range tasks {
+		if t.ID == id {
+			// Обновляем поля задачи. ID и CreatedAt остаются неизменными.
+			tasks[i].Title = updatedTask.Title
+			tasks[i].Description = updatedTask.Description
+			tasks[i].Completed = updatedTask.Completed
+			tasks[i].Priority = updatedTask.Priority
+			tasks[i].Tags = updatedTask.Tags
+			// При изменении срока напоминания начинаются заново.
+			if !sameTime(tasks[i].DueAt, updatedTask.DueAt) {
+				tasks[i].ReminderState = ""
+			}
+			tasks[i].DueAt = updatedTask.DueAt
+			writeJSON(w, r, http.StatusOK, tasks[i])
+			return
+		}
+	}
+	http.Error(w, "Задача не найдена", http.StatusNotFound)
+}
+
+// normalizeTask проверяет приоритет и приводит метки к нижнему регистру
+// без пробелов по краям, пустых меток и повторов.
+func normalizeTask(t *Task) error {
+	t.Priority = strings.ToLower(strings.TrimSpace(t.Priority))
+	if t.Priority != "" && !slices.Contains(priorities, t.Priority) {
+		return fmt.Errorf("Неверный приоритет %q: допустимы %s", t.Priority, strings.Join(priorities, ", "))
+	}
+	var tags []string
+	for _, tag := range t.Tags {
+		tag = strings.ToLower(strings.TrimSpace(tag))
+		if tag != "" && !slices.Contains(tags, tag) {
+			tags = append(tags, tag)
+		}
+	}
+	t.Tags = tags
+	return nil
+}
+
+// sameTime сравнивает два необязательных момента времени.
+func sameTime(a, b *time.Time) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	return a.Equal(*b)
+}
+
+// deleteTask удаляет задачу по ID.
+func deleteTask(w http.ResponseWriter, r *http.Request, id int) {
+	mutex.Lock()
+	defer mutex.Unlock()
+	for i, t := range tasks {
+		if t.ID == id {
+			// Удаляем задачу из среза.
+			tasks = append(tasks[:i], tasks[i+1:]...)
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+	}
+	http.Error(w, "Задача не найдена", http.StatusNotFound)
+}
@@ -0,0 +1,434 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"maps"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+// setTasks подменяет хранилище задач на время теста.
+func setTasks(t *testing.T, list []Task) {
+	t.Helper()
+	mutex.Lock()
+	saved, savedID := tasks, nextID
+	tasks, nextID = list, len(list)+1
+	mutex.Unlock()
+	t.Cleanup(func() {
+		mutex.Lock()
+		tasks, nextID = saved, savedID
+		mutex.Unlock()
+	})
+}
+
+// TestCheckRemindersOnce проверяет, что каждый переход в "скоро срок" и "просрочена"
+// порождает ровно одно событие, а смена срока начинает напоминания заново.
+func TestCheckRemindersOnce(t *testing.T) {
+	start := time.Date(2026, time.October, 14, 12, 0, 0, 0, time.UTC)
+	due := start.Add(48 * time.Hour)
+	early, past := start.Add(time.Hour), start.Add(-time.Hour)
+	setTasks(t, []Task{
+		{ID: 1, Title: "через двое суток", DueAt: &due},
+		{ID: 2, Title: "выполнена", Completed: true, DueAt: &early},
+		{ID: 3, Title: "без срока"},
+		{ID: 4, Title: "через час", DueAt: &early},
+		{ID: 5, Title: "уже просрочена", DueAt: &past}, // Сразу "просрочена", без "скоро срок"
+	})
+
+	var events []string
+	emit := func(e Event) { events = append(events, e.Type+" "+e.Task.Title) }
+	steps := []struct {
+		at   time.Time
+		want []string
+	}{
+		{start, []string{"task.due_soon через час", "task.overdue уже просрочена"}},
+		{start, nil},
+		{early.Add(-time.Second), nil},
+		{early, []string{"task.overdue через час"}},
+		{due.Add(-dueSoonWindow - time.Second), nil},
+		{due.Add(-dueSoonWindow), []string{"task.due_soon через двое суток"}},
+		{due.Add(-time.Minute), nil},
+		{due, []string{"task.overdue через двое суток"}},
+		{due.Add(time.Hour), nil},
+	}
+	for _, step := range steps {
+		events = nil
+		checkReminders(step.at, emit)
+		if strings.Join(events, "; ") != strings.Join(step.want, "; ") {
+			t.Errorf("%s: события %q, ожидалось %q", step.at.Format(time.RFC3339), events, step.want)
+		}
+	}
+
+	// Перенос срока через PUT сбрасывает состояние: напоминания идут заново, по одному.
+	later := due.Add(72 * time.Hour)
+	body, _ := json.Marshal(Task{Title: "через двое суток", DueAt: &later})
+	rec := httptest.NewRecorder()
+	taskHandler(rec, httptest.NewRequest(http.MethodPut, "/tasks/1", strings.NewReader(string(body))))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("PUT /tasks/1: статус %d", rec.Code)
+	}
+	for i, at := range []time.Time{later.Add(-time.Hour), later.Add(-time.Minute), later} {
+		events = nil
+		checkReminders(at, emit)
+		want := [][]string{{"task.due_soon через двое суток"}, nil, {"task.overdue через двое суток"}}[i]
+		if strings.Join(events, "; ") != strings.Join(want, "; ") {
+			t.Errorf("после переноса, %s: события %q, ожидалось %q", at.Format(time.RFC3339), events, want)
+		}
+	}
+}
+
+func TestWebhookEmitter(t *testing.T) {
+	var got []Event
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost || r.Header.Get("Content-Type") != "application/json" {
+			t.Errorf("запрос %s, Content-Type %q", r.Method, r.Header.Get("Content-Type"))
+		}
+		data, _ := io.ReadAll(r.Body)
+		var e Event
+		if err := json.Unmarshal(data, &e); err != nil {
+			t.Errorf("тело не JSON события: %v: %s", err, data)
+		}
+		got = append(got, e)
+		if e.Task.ID == 2 {
+			http.Error(w, "занято", http.StatusServiceUnavailable)
+		}
+	}))
+	defer srv.Close()
+
+	at := time.Date(2026, time.October, 14, 12, 0, 0, 0, time.UTC)
+	post := webhookEmitter(srv.Client(), srv.URL)
+	post(Event{Type: "task.due_soon", Task: Task{ID: 1, Title: "Первая"}, At: at})
+	// Отказ получателя только выводится в лог и не мешает следующим событиям.
+	post(Event{Type: "task.overdue", Task: Task{ID: 2}, At: at})
+	post(Event{Type: "task.overdue", Task: Task{ID: 1}, At: at})
+	if len(got) != 3 || got[0].Type != "task.due_soon" || got[0].Task.Title != "Первая" || !got[0].At.Equal(at) || got[2].Task.ID != 1 {
+		t.Errorf("получены события %+v", got)
+	}
+}
+
+// TestComputeStats считает сводку по фиксированному набору задач на фиксированный момент.
+func TestComputeStats(t *testing.T) {
+	now := time.Date(2026, time.October, 14, 12, 0, 0, 0, time.UTC)
+	day := func(days, hours int) time.Time { return now.AddDate(0, 0, -days).Add(time.Duration(hours) * time.Hour) }
+	list := []Task{
+		{ID: 1, Title: "Отчёт за сентябрь", Priority: "high", Tags: []string{"work"}, CreatedAt: day(10, 0)}, // Вне окна в 7 дней
+		{ID: 2, Title: "Купить молоко", Completed: true, Tags: []string{"home"}, CreatedAt: day(6, -12)},
+		{ID: 3, Title: "Позвонить", Description: "про ОТЧЁТ", Priority: "low", Tags: []string{"work", "phone"}, CreatedAt: day(6, 11)},
+		{ID: 4, Title: "Полить цветы", Completed: true, Priority: "low", Tags: []string{"home"}, CreatedAt: day(0, -11)},
+		{ID: 5, Title: "Отчёт за октябрь", Priority: "high", Tags: []string{"work"}, CreatedAt: day(0, -1)},
+	}
+	yes, no := true, false
+	// Корзины по дням от 2026-10-08 до 2026-10-14.
+	tests := []struct {
+		name                   string
+		filter                 taskFilter
+		total, completed, open int
+		byPriority, byTag      map[string]int
+		perDay                 [statsDays]int
+		oldestAge              string
+		oldestAgeSeconds       int64 // Не проверяется, если oldestAge пустой
+	}{
+		{"все", taskFilter{}, 5, 2, 3,
+			map[string]int{"high": 2, "low": 2, "none": 1}, map[string]int{"work": 3, "home": 2, "phone": 1},
+			[statsDays]int{2, 0, 0, 0, 0, 0, 2}, "240h0m0s", 240 * 3600},
+		{"открытые", taskFilter{completed: &no}, 3, 0, 3,
+			map[string]int{"high": 2, "low": 1}, map[string]int{"work": 3, "phone": 1},
+			[statsDays]int{1, 0, 0, 0, 0, 0, 1}, "240h0m0s", 240 * 3600},
+		{"выполненные", taskFilter{completed: &yes}, 2, 2, 0,
+			map[string]int{"low": 1, "none": 1}, map[string]int{"home": 2},
+			[statsDays]int{1, 0, 0, 0, 0, 0, 1}, "", 0},
+		{"поиск", taskFilter{query: "отчёт"}, 3, 0, 3,
+			map[string]int{"high": 2, "low": 1}, map[string]int{"work": 3, "phone": 1},
+			[statsDays]int{1, 0, 0, 0, 0, 0, 1}, "240h0m0s", 240 * 3600},
+		{"поиск и выполненные", taskFilter{completed: &yes, query: "отчёт"}, 0, 0, 0,
+			map[string]int{}, map[string]int{},
+			[statsDays]int{}, "", 0},
+		{"поиск в описании", taskFilter{query: "про"}, 1, 0, 1,
+			map[string]int{"low": 1}, map[string]int{"work": 1, "phone": 1},
+			[statsDays]int{1, 0, 0, 0, 0, 0, 0}, "133h0m0s", 133 * 3600},
+		{"метка", taskFilter{tag: "home"}, 2, 2, 0,
+			map[string]int{"low": 1, "none": 1}, map[string]int{"home": 2},
+			[statsDays]int{1, 0, 0, 0, 0, 0, 1}, "", 0},
+		{"метка и открытые", taskFilter{tag: "work", completed: &no}, 3, 0, 3,
+			map[string]int{"high": 2, "low": 1}, map[string]int{"work": 3, "phone": 1},
+			[statsDays]int{1, 0, 0, 0, 0, 0, 1}, "240h0m0s", 240 * 3600},
+		{"нет такой метки", taskFilter{tag: "garden"}, 0, 0, 0,
+			map[string]int{}, map[string]int{},
+			[statsDays]int{}, "", 0},
+	}
+	for _, tt := range tests {
+		s := computeStats(list, tt.filter, now)
+		if s.Total != tt.total || s.Completed != tt.completed || s.Open != tt.open {
+			t.Errorf("%s: всего %d, выполнено %d, открыто %d; ожидалось %d, %d, %d", tt.name, s.Total, s.Completed, s.Open, tt.total, tt.completed, tt.open)
+		}
+		if !maps.Equal(s.ByPriority, tt.byPriority) || !maps.Equal(s.ByTag, tt.byTag) {
+			t.Errorf("%s: по приоритетам %v, по меткам %v; ожидалось %v, %v", tt.name, s.ByPriority, s.ByTag, tt.byPriority, tt.byTag)
+		}
+		if len(s.CreatedLastDays) != statsDays || s.CreatedLastDays[0].Date != "2026-10-08" || s.CreatedLastDays[statsDays-1].Date != "2026-10-14" {
+			t.Fatalf("%s: корзины %+v", tt.name, s.CreatedLastDays)
+		}
+		for i, want := range tt.perDay {
+			if got := s.CreatedLastDays[i].Count; got != want {
+				t.Errorf("%s: %s создано %d, ожидалось %d", tt.name, s.CreatedLastDays[i].Date, got, want)
+			}
+		}
+		switch {
+		case s.OldestOpenAge != tt.oldestAge:
+			t.Errorf("%s: возраст самой старой открытой %q, ожидалось %q", tt.name, s.OldestOpenAge, tt.oldestAge)
+		case tt.oldestAge == "" && s.OldestOpenAgeSeconds != nil:
+			t.Errorf("%s: oldest_open_age_seconds = %d без открытых задач", tt.name, *s.OldestOpenAgeSeconds)
+		case tt.oldestAge != "" && (s.OldestOpenAgeSeconds == nil || *s.OldestOpenAgeSeconds != tt.oldestAgeSeconds):
+			t.Errorf("%s: oldest_open_age_seconds = %v, ожидалось %d", tt.name, s.OldestOpenAgeSeconds, tt.oldestAgeSeconds)
+		}
+	}
+}
+
+// TestTaskFilterQuery проверяет, что GET /tasks и GET /tasks/stats отбирают задачи одинаково.
+func TestTaskFilterQuery(t *testing.T) {
+	now := time.Now()
+	setTasks(t, []Task{
+		{ID: 1, Title: "Отчёт", Tags: []string{"work"}, CreatedAt: now},
+		{ID: 2, Title: "Молоко", Completed: true, Tags: []string{"home"}, CreatedAt: now},
+		{ID: 3, Title: "ещё отчёт", Completed: true, Tags: []string{"work", "urgent"}, CreatedAt: now},
+	})
+	tests := []struct {
+		query string
+		ids   []int // nil — ожидается 400
+	}{
+		{"", []int{1, 2, 3}},
+		{"?completed=true", []int{2, 3}},
+		{"?completed=0", []int{1}},
+		{"?q=ОТЧЁТ", []int{1, 3}},
+		{"?q=отчёт&completed=false", []int{1}},
+		{"?q=нет такого", []int{}},
+		{"?tag=work", []int{1, 3}},
+		{"?tag=WORK&completed=true", []int{3}},
+		{"?tag=garden", []int{}},
+		{"?completed=maybe", nil},
+	}
+	for _, tt := range tests {
+		rec := httptest.NewRecorder()
+		tasksHandler(rec, httptest.NewRequest(http.MethodGet, "/tasks"+strings.ReplaceAll(tt.query, " ", "%20"), nil))
+		statsRec := httptest.NewRecorder()
+		taskHandler(statsRec, httptest.NewRequest(http.MethodGet, "/tasks/stats"+strings.ReplaceAll(tt.query, " ", "%20"), nil))
+		if tt.ids == nil {
+			if rec.Code != http.StatusBadRequest || statsRec.Code != http.StatusBadRequest {
+				t.Errorf("%q: статусы %d и %d, ожидалось 400", tt.query, rec.Code, statsRec.Code)
+			}
+			continue
+		}
+		var list []Task
+		var stats Stats
+		if err := json.Unmarshal(rec.Body.Bytes(), &list); err != nil || list == nil {
+			t.Errorf("%q: список %s: %v", tt.query, rec.Body.Bytes(), err)
+			continue
+		}
+		if err := json.Unmarshal(statsRec.Body.Bytes(), &stats); err != nil {
+			t.Errorf("%q: сводка %s: %v", tt.query, statsRec.Body.Bytes(), err)
+			continue
+		}
+		var ids []int
+		for _, task := range list {
+			ids = append(ids, task.ID)
+		}
+		if !slices.Equal(ids, tt.ids) || stats.Total != len(tt.ids) {
+			t.Errorf("%q: задачи %v, в сводке всего %d; ожидалось %v", tt.query, ids, stats.Total, tt.ids)
+		}
+	}
+}
+
+// TestMethods проходит по маршрутам и методам: HEAD отдаёт те же заголовки, что и GET,
+// включая Content-Length, но без тела; OPTIONS и 405 несут точный заголовок Allow.
+func TestMethods(t *testing.T) {
+	setTasks(t, []Task{{ID: 1, Title: "Первая", CreatedAt: time.Now()}})
+	srv := httptest.NewServer(newMux())
+	defer srv.Close()
+
+	routes := []struct {
+		path, allow string
+	}{
+		{"/tasks", tasksAllow},
+		{"/tasks/1", taskAllow},
+		{"/tasks/stats", statsAllow},
+		{"/tasks/due", dueAllow},
+	}
+	methods := []string{http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodPost, http.MethodPut, http.MethodDelete, http.MethodPatch}
+	for _, route := range routes {
+		// Тело и заголовки GET — эталон для HEAD.
+		var getBody []byte
+		var getLength string
+		for _, method := range methods {
+			allowed := slices.Contains(strings.Split(route.allow, ", "), method)
+			if allowed && method != http.MethodGet && method != http.MethodHead && method != http.MethodOptions {
+				continue // Изменяющие методы проверяются отдельными тестами
+			}
+			req, err := http.NewRequest(method, srv.URL+route.path, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			resp, err := http.DefaultClient.Do(req)
+			if err != nil {
+				t.Fatal(err)
+			}
+			body, _ := io.ReadAll(resp.Body)
+			resp.Body.Close()
+			name := method + " " + route.path
+
+			switch {
+			case method == http.MethodGet:
+				getBody, getLength = body, resp.Header.Get("Content-Length")
+				if resp.StatusCode != http.StatusOK || getLength != strconv.Itoa(len(body)) {
+					t.Errorf("%s: статус %d, Content-Length %q при теле %d байт", name, resp.StatusCode, getLength, len(body))
+				}
+			case method == http.MethodHead:
+				if resp.StatusCode != http.StatusOK || len(body) != 0 {
+					t.Errorf("%s: статус %d, тело %q", name, resp.StatusCode, body)
+				}
+				// Для /tasks/stats содержимое зависит от текущего времени, но длина — нет.
+				if got := resp.Header.Get("Content-Length"); got != getLength || got != strconv.Itoa(len(getBody)) {
+					t.Errorf("%s: Content-Length %q, у GET %q", name, got, getLength)
+				}
+				if ct := resp.Header.Get("Content-Type"); ct != "application/json" {
+					t.Errorf("%s: Content-Type %q", name, ct)
+				}
+			case method == http.MethodOptions:
+				if resp.StatusCode != http.StatusNoContent || len(body) != 0 {
+					t.Errorf("%s: статус %d, тело %q", name, resp.StatusCode, body)
+				}
+				if got := resp.Header.Get("Allow"); got != route.allow {
+					t.Errorf("%s: Allow %q, ожидалось %q", name, got, route.allow)
+				}
+			default:
+				if resp.StatusCode != http.StatusMethodNotAllowed {
+					t.Errorf("%s: статус %d, ожидалось 405", name, resp.StatusCode)
+				}
+				if got := resp.Header.Get("Allow"); got != route.allow {
+					t.Errorf("%s: Allow %q, ожидалось %q", name, got, route.allow)
+				}
+			}
+		}
+	}
+}
+
+// TestCreateTaskPriorityTags проверяет разбор приоритета и меток при создании и обновлении задачи.
+func TestCreateTaskPriorityTags(t *testing.T) {
+	setTasks(t, nil)
+	tests := []struct {
+		method, path, body string
+		status             int
+		priority           string
+		tags               []string
+	}{
+		{http.MethodPost, "/tasks", `{"title":"a","priority":" HIGH ","tags":[" Work ","work","","home"]}`, http.StatusCreated, "high", []string{"work", "home"}},
+		{http.MethodPost, "/tasks", `{"title":"b"}`, http.StatusCreated, "", nil},
+		{http.MethodPost, "/tasks", `{"title":"c","priority":"urgent"}`, http.StatusBadRequest, "", nil},
+		{http.MethodPut, "/tasks/1", `{"title":"a","priority":"low","tags":["x"]}`, http.StatusOK, "low", []string{"x"}},
+		{http.MethodPut, "/tasks/1", `{"title":"a","priority":"someday"}`, http.StatusBadRequest, "", nil},
+	}
+	for _, tt := range tests {
+		rec := httptest.NewRecorder()
+		newMux().ServeHTTP(rec, httptest.NewRequest(tt.method, tt.path, strings.NewReader(tt.body)))
+		if rec.Code != tt.status {
+			t.Errorf("%s %s %s: статус %d, ожидалось %d", tt.method, tt.path, tt.body, rec.Code, tt.status)
+			continue
+		}
+		if rec.Code >= 300 {
+			continue
+		}
+		var task Task
+		if err := json.Unmarshal(rec.Body.Bytes(), &task); err != nil {
+			t.Fatal(err)
+		}
+		if task.Priority != tt.priority || !slices.Equal(task.Tags, tt.tags) {
+			t.Errorf("%s %s %s: приоритет %q, метки %q; ожидалось %q, %q", tt.method, tt.path, tt.body, task.Priority, task.Tags, tt.priority, tt.tags)
+		}
+	}
+}
+
+// TestDueTasks проверяет окно ?within=, сортировку по сроку, просроченные
+// и выполненные задачи и отказ на неверном окне.
+func TestDueTasks(t *testing.T) {
+	now := time.Now()
+	at := func(d time.Duration) *time.Time { due := now.Add(d); return &due }
+	setTasks(t, []Task{
+		{ID: 1, Title: "через 3 часа", DueAt: at(3 * time.Hour)},
+		{ID: 2, Title: "через 2 дня", DueAt: at(48 * time.Hour)},
+		{ID: 3, Title: "просрочена", DueAt: at(-time.Hour)},
+		{ID: 4, Title: "выполнена", Completed: true, DueAt: at(time.Hour)},
+		{ID: 5, Title: "без срока"},
+		{ID: 6, Title: "через час", DueAt: at(time.Hour)},
+		{ID: 7, Title: "через 30 часов", DueAt: at(30 * time.Hour)},
+	})
+	tests := []struct {
+		query string
+		ids   []int // nil — ожидается 400
+	}{
+		{"", []int{3, 6, 1}}, // По умолчанию окно 24h
+		{"?within=2h", []int{3, 6}},
+		{"?within=0s", []int{3}}, // Только просроченные
+		{"?within=36h", []int{3, 6, 1, 7}},
+		{"?within=72h", []int{3, 6, 1, 7, 2}},
+		{"?within=-1h", nil},
+		{"?within=day", nil},
+	}
+	for _, tt := range tests {
+		rec := httptest.NewRecorder()
+		newMux().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/tasks/due"+tt.query, nil))
+		if tt.ids == nil {
+			if rec.Code != http.StatusBadRequest {
+				t.Errorf("%q: статус %d, ожидалось 400", tt.query, rec.Code)
+			}
+			continue
+		}
+		var list []Task
+		if err := json.Unmarshal(rec.Body.Bytes(), &list); rec.Code != http.StatusOK || err != nil || list == nil {
+			t.Errorf("%q: статус %d, тело %s: %v", tt.query, rec.Code, rec.Body.Bytes(), err)
+			continue
+		}
+		ids := []int{}
+		for _, task := range list {
+			ids = append(ids, task.ID)
+		}
+		if !slices.Equal(ids, tt.ids) {
+			t.Errorf("%q: задачи %v, ожидалось %v", tt.query, ids, tt.ids)
+		}
+	}
+}
+
+// TestRunRemindersStops проверяет, что обработчик напоминаний завершается после отмены контекста.
+func TestRunRemindersStops(t *testing.T) {
+	past := time.Now().Add(-time.Hour)
+	setTasks(t, []Task{{ID: 1, Title: "просрочена", DueAt: &past}})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	events := make(chan Event, 1)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		runReminders(ctx, time.Hour, func(e Event) { events <- e })
+	}()
+
+	// Первая проверка выполняется сразу, не дожидаясь интервала.
+	select {
+	case e := <-events:
+		if e.Type != "task.overdue" || e.Task.ID != 1 {
+			t.Errorf("событие %+v", e)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("нет события от первой проверки")
+	}
+
+	cancel()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("runReminders не завершился после отмены контекста")
+	}
+}
@@ -0,0 +1,3651 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"flag"
+	"fmt"
+	"html"
+	"io"
+	"io/ioutil"
+	"math/rand"
+	"mime"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"os/exec"
+	"os/signal"
+	"path"
+	"path/filepath"
+	"regexp"
+	"runtime"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"time"
+	"unicode"
+	"unicode/utf8"
+
+	"golang.org/x/text/encoding"
+	"golang.org/x/text/encoding/charmap"
+	"golang.org/x/text/encoding/htmlindex"
+	"golang.org/x/text/encoding/ianaindex"
+	textunicode "golang.org/x/text/encoding/unicode"
+	"golang.org/x/text/transform"
+)
+
+// Коды выхода. Если ленты завершились по-разному, выбирается худший исход: ошибка разбора,
+// затем сетевая ошибка, затем отсутствие статей; успешные ленты при этом всё равно выводятся.
+const (
+	exitOK      = 0 // Ленты получены, выведена хотя бы одна статья
+	exitUsage   = 1 // Ошибка аргументов, конфигурации или файлов состояния
+	exitNetwork = 2 // Сетевая ошибка или ошибочный ответ HTTP (в том числе при загрузке вложений)
+	exitParse   = 3 // Ленту не удалось разобрать: неверный XML, кодировка, нет статей, дата с --strict-dates
+	exitEmpty   = 4 // Ленты получены, но после фильтров (или с --new-only) статей не осталось
+)
+
+// parseError — ошибка разбора полученной ленты, в отличие от сетевых ошибок.
+type parseError struct {
+	err error
+}
+
+func (e *parseError) Error() string { return e.err.Error() }
+func (e *parseError) Unwrap() error { return e.err }
+
+// errorKind возвращает вид ошибки ленты для --output=json: "parse" или "network".
+func errorKind(err error) string {
+	var pe *parseError
+	if errors.As(err, &pe) {
+		return "parse"
+	}
+	return "network"
+}
+
+// exitCode выбирает код выхода по итогам запуска с несколькими лентами: берётся худший
+// исход — ошибка разбора важнее сетевой, сетевая (в том числе при загрузке вложений) —
+// отсутствия статей. С markRead статьи не выводятся, поэтому пустой вывод не ошибка.
+func exitCode(feedErrors []error, downloadsFailed, items int, markRead bool) int {
+	code := exitOK
+	for _, err := range feedErrors {
+		if errorKind(err) == "parse" {
+			return exitParse
+		}
+		code = exitNetwork
+	}
+	switch {
+	case downloadsFailed > 0:
+		code = exitNetwork
+	case code == exitOK && !markRead && items == 0:
+		code = exitEmpty
+	}
+	return code
+}
+
+// RSS описывает корневую структуру RSS-ленты.
+type RSS struct {
+	Channel Channel `xml:"channel"`
+
+	FinalURL string `xml:"-"` // Адрес после перенаправлений; пустой, если их не было
+	Moved    bool   `xml:"-"` // Все перенаправления постоянные (301, 308)
+}
+
+// Channel описывает канал RSS-ленты, содержащий заголовок и список элементов.
+type Channel struct {
+	Title string   `xml:"title"`
+	Links []string `xml:"link"` // link канала; atom:link с адресом самой ленты попадает сюда пустым
+	Items []Item   `xml:"item"`
+}
+
+// link возвращает адрес сайта канала или пустую строку.
+func (ch Channel) link() string {
+	for _, l := range ch.Links {
+		if l = strings.TrimSpace(l); l != "" {
+			return l
+		}
+	}
+	return ""
+}
+
+// Item описывает отдельную статью (элемент RSS-ленты).
+type Item struct {
+	Title       string   `xml:"title"`
+	Link        string   `xml:"link"`
+	Description string   `xml:"description"`
+	PubDate     string   `xml:"pubDate"`
+	GUID        itemGUID `xml:"guid"`
+	ID          string   `xml:"id"` // Atom-поле id, встречается в RSS-лентах
+
+	Enclosures []Enclosure `xml:"enclosure"`                             // Вложения: выпуски подкастов, видео и т. п.
+	DCDate     string      `xml:"http://purl.org/dc/elements/1.1/ date"` // dc:date, если pubDate нет
+	Updated    string      `xml:"updated"`                               // Atom-поле updated, встречается в RSS-лентах
+	Comments   string      `xml:"comments"`                              // Адрес страницы комментариев
+	Source     *itemSource `xml:"source"`                                // Исходная лента статьи (в объединённых лентах)
+
+	RawAuthor     itemAuthor     `xml:"author"`                                   // author (RSS) или atom:author
+	Creator       string         `xml:"http://purl.org/dc/elements/1.1/ creator"` // dc:creator
+	RawCategories []itemCategory `xml:"category"`                                 // category (RSS) или atom:category
+
+	MediaContents   []mediaObject `xml:"http://search.yahoo.com/mrss/ content"`   // media:content
+	MediaThumbnails []mediaObject `xml:"http://search.yahoo.com/mrss/ thumbnail"` // media:thumbnail
+	MediaGroup      struct {
+		Contents   []mediaObject `xml:"http://search.yahoo.com/mrss/ content"`
+		Thumbnails []mediaObject `xml:"http://search.yahoo.com/mrss/ thumbnail"`
+	} `xml:"http://search.yahoo.com/mrss/ group"` // media:group, например у YouTube
+
+	Published  time.Time  `xml:"-"` // Разобранная дата публикации (нулевая, если не удалось разобрать)
+	Author     string     `xml:"-"` // Автор из author, atom:author или dc:creator (fillItemFields)
+	Categories []string   `xml:"-"` // Рубрики без пустых и повторов (fillItemFields)
+	AlsoIn     []string   `xml:"-"` // Другие ленты с той же статьёй (--dedupe)
+	Image      *itemImage `xml:"-"` // Картинка статьи (fillItemFields); nil — картинки нет
+	FullText   string     `xml:"-"` // Текст статьи со страницы по ссылке (--full-text); пустой — не получен
+}
+
+// itemAuthor — автор статьи: в RSS это текст ("joe@example.com (Joe)"), в Atom — элемент name.
+type itemAuthor struct {
+	Text string `xml:",chardata"`
+	Name string `xml:"name"`
+}
+
+// itemCategory — рубрика статьи: в RSS это текст, в Atom — атрибут term (или label).
+type itemCategory struct {
+	Text  string `xml:",chardata"`
+	Term  string `xml:"term,attr"`
+	Label string `xml:"label,attr"`
+}
+
+// mediaObject — элемент media:content или media:thumbnail (Media RSS).
+type mediaObject struct {
+	URL    string `xml:"url,attr"`
+	Type   string `xml:"type,attr"`
+	Medium string `xml:"medium,attr"`
+	Width  int    `xml:"width,attr"`
+	Height int    `xml:"height,attr"`
+}
+
+// isImage сообщает, картинка ли это: по medium, типу или, если они не указаны, всегда
+// (media:thumbnail — всегда картинка, media:content без типа — чаще всего тоже).
+func (m mediaObject) isImage() bool {
+	switch {
+	case m.Medium != "":
+		return m.Medium == "image"
+	case m.Type != "":
+		return strings.HasPrefix(m.Type, "image/")
+	}
+	return true
+}
+
+// itemGUID — элемент guid. Без isPermaLink="false" программы чтения считают guid
+// ссылкой на статью, поэтому атрибут сохраняется при выводе объединённой ленты.
+type itemGUID struct {
+	IsPermaLink string `xml:"isPermaLink,attr,omitempty"`
+	Value       string `xml:",chardata"`
+}
+
+// itemSource — элемент source: лента, из которой взята статья.
+type itemSource struct {
+	URL   string `xml:"url,attr"`
+	Title string `xml:",chardata"`
+}
+
+// itemImage — картинка статьи: адрес и размеры, если лента их указала.
+type itemImage struct {
+	URL    string `json:"url"`
+	Width  int    `json:"width,omitempty"`
+	Height int    `json:"height,omitempty"`
+}
+
+var (
+	imgTagPattern  = regexp.MustCompile(`(?is)<img\b(?:[^>"']|"[^"]*"|'[^']*')*>`)
+	imgAttrPattern = regexp.MustCompile(`(?is)\b(src|width|height)\s*=\s*(?:"([^"]*)"|'([^']*)'|([^\s"'>]+))`)
+)
+
+// findImage выбирает картинку статьи: самую большую из media:content, затем самую большую
+// из media:thumbnail, затем вложение-картинку, затем первый <img> в описании (кроме
+// счётчиков 1×1). Относительный адрес разрешается от ссылки статьи или, если она
+// не абсолютная, от ссылки канала; неразрешимые и не http(s) адреса пропускаются.
+func findImage(item Item, channelLink string) *itemImage {
+	base, _ := url.Parse(strings.TrimSpace(item.Link))
+	if base == nil || !base.IsAbs() {
+		base, _ = url.Parse(channelLink)
+	}
+	resolve := func(raw string) string {
+		u, err := url.Parse(strings.TrimSpace(raw))
+		if err != nil || raw == "" {
+			return ""
+		}
+		if !u.IsAbs() {
+			if base == nil || !base.IsAbs() {
+				return ""
+			}
+			u = base.ResolveReference(u)
+		}
+		if u.Scheme != "http" && u.Scheme != "https" {
+			return ""
+		}
+		return u.String()
+	}
+	largest := func(objects ...[]mediaObject) *itemImage {
+		var best *itemImage
+		for _, list := range objects {
+			for _, m := range list {
+				if !m.isImage() {
+					continue
+				}
+				img := &itemImage{URL: resolve(m.URL), Width: m.Width, Height: m.Height}
+				if img.URL != "" && (best == nil || img.Width*img.Height > best.Width*best.Height) {
+					best = img
+				}
+			}
+		}
+		return best
+	}
+	if img := largest(item.MediaContents, item.MediaGroup.Contents); img != nil {
+		return img
+	}
+	if img := largest(item.MediaThumbnails, item.MediaGroup.Thumbnails); img != nil {
+		return img
+	}
+	for _, enc := range item.Enclosures {
+		if u := resolve(enc.URL); u != "" && strings.HasPrefix(enc.Type, "image/") {
+			return &itemImage{URL: u}
+		}
+	}
+	for _, tag := range imgTagPattern.FindAllString(cdataReplacer.Replace(item.Description), -1) {
+		img := &itemImage{}
+		for _, m := range imgAttrPattern.FindAllStringSubmatch(tag, -1) {
+			value := html.UnescapeString(m[2] + m[3] + m[4])
+			switch strings.ToLower(m[1]) {
+			case "src":
+				img.URL = resolve(value)
+			case "width":
+				img.Width, _ = strconv.Atoi(value)
+			case "height":
+				img.Height, _ = strconv.Atoi(value)
+			}
+		}
+		if img.URL != "" && !(img.Width == 1 && img.Height == 1) {
+			return img
+		}
+	}
+	return nil
+}
+
+// rssAuthorPattern выделяет имя из автора в формате RSS "почта (Имя)".
+var rssAuthorPattern = regexp.MustCompile(`^\S+@\S+\s*\((.+)\)$`)
+
+// fillItemFields заполняет Author, Categories и Image у статей ленты из сырых полей.
+// Рубрики встречаются и отдельными элементами, и одной строкой через запятую;
+// в обоих случаях получается список без пустых значений и повторов (без учёта регистра).
+func fillItemFields(rss *RSS) {
+	for i := range rss.Channel.Items {
+		item := &rss.Channel.Items[i]
+		author := strings.TrimSpace(item.RawAuthor.Name)
+		if author == "" {
+			author = strings.TrimSpace(item.RawAuthor.Text)
+			if m := rssAuthorPattern.FindStringSubmatch(author); m != nil {
+				author = strings.TrimSpace(m[1])
+			}
+		}
+		if author == "" {
+			author = strings.TrimSpace(item.Creator)
+		}
+		item.Author = oneLine(author)
+		item.Image = findImage(*item, rss.Channel.link())
+
+		seen := map[string]bool{}
+		item.Categories = nil
+		for _, c := range item.RawCategories {
+			text := c.Text
+			if strings.TrimSpace(text) == "" {
+				text = c.Term
+			}
+			if strings.TrimSpace(text) == "" {
+				text = c.Label
+			}
+			for _, name := range strings.Split(text, ",") {
+				name = oneLine(name)
+				if name == "" || seen[strings.ToLower(name)] {
+					continue
+				}
+				seen[strings.ToLower(name)] = true
+				item.Categories = append(item.Categories, name)
+			}
+		}
+	}
+}
+
+// Enclosure описывает вложение статьи (элемент enclosure).
+type Enclosure struct {
+	URL    string `xml:"url,attr" json:"url"`
+	Length int64  `xml:"length,attr" json:"length,omitempty"` // Размер в байтах; 0, если лента его не указала
+	Type   string `xml:"type,attr" json:"type,omitempty"`
+}
+
+// String возвращает вложение для вывода: адрес, тип и размер, если они известны.
+func (e Enclosure) String() string {
+	var info []string
+	if e.Type != "" {
+		info = append(info, e.Type)
+	}
+	if e.Length > 0 {
+		info = append(info, formatSize(e.Length))
+	}
+	if len(info) == 0 {
+		return e.URL
+	}
+	return fmt.Sprintf("%s (%s)", e.URL, strings.Join(info, ", "))
+}
+
+// key возвращает идентификатор статьи для учёта прочитанного: guid (или Atom id),
+// иначе ссылку, иначе хэш заголовка и даты.
+func (item Item) key() string {
+	if guid := strings.TrimSpace(item.GUID.Value); guid != "" {
+		return guid
+	}
+	if id := strings.TrimSpace(item.ID); id != "" {
+		return id
+	}
+	if link := strings.TrimSpace(item.Link); link != "" {
+		return link
+	}
+	sum := sha256.Sum256([]byte(item.Title + "\n" + item.rawDate()))
+	return "sha256:" + hex.EncodeToString(sum[:])
+}
+
+// rawDate возвращает дату статьи в том виде, в каком она указана в ленте.
+func (item Item) rawDate() string {
+	for _, s := range []string{item.PubDate, item.DCDate, item.Updated} {
+		if s = strings.TrimSpace(s); s != "" {
+			return s
+		}
+	}
+	return ""
+}
+
+// dateLayouts — форматы дат, встречающиеся в лентах. Формат "2" допускает день из одной
+// и двух цифр, поэтому отдельные варианты с "02" не нужны. День недели перед разбором
+// отбрасывается (parseDate), так как ленты пишут его как угодно, а Go его не проверяет.
+var dateLayouts = []string{
+	"2 Jan 2006 15:04:05 -0700", // RFC1123Z
+	"2 Jan 2006 15:04:05 MST",   // RFC1123
+	"2 Jan 2006 15:04 -0700",    // Без секунд
+	"2 Jan 2006 15:04 MST",
+	"2 Jan 06 15:04:05 -0700", // Год из двух цифр (RFC822)
+	"2 Jan 06 15:04:05 MST",
+	"2 Jan 06 15:04 -0700",
+	"2 Jan 06 15:04 MST",
+	"2 January 2006 15:04:05 -0700",
+	"2 January 2006 15:04:05 MST",
+	"2 Jan 2006 15:04:05",
+	"2-Jan-06 15:04:05 MST", // RFC850
+	time.RFC3339,            // Дробные секунды time.Parse тоже принимает
+	"2006-01-02T15:04Z07:00",
+	"2006-01-02T15:04:05",
+	"2006-01-02 15:04:05 -0700",
+	"2006-01-02 15:04:05",
+	"2006-01-02",
+}
+
+// rfc822Zones — американские зоны из RFC822. time.Parse не знает их смещений
+// (если это не местная зона) и считает время UTC, поэтому они заменяются на числовые.
+var rfc822Zones = map[string]string{
+	"EST": "-0500", "EDT": "-0400",
+	"CST": "-0600", "CDT": "-0500",
+	"MST": "-0700", "MDT": "-0600",
+	"PST": "-0800", "PDT": "-0700",
+}
+
+// parseDate разбирает дату статьи, перебирая известные форматы.
+func parseDate(s string) (time.Time, error) {
+	value := strings.Join(strings.Fields(s), " ")
+	// Отбрасываем день недели: "Mon, ", "Tues, ", "Monday, ".
+	if i := strings.Index(value, ","); i > 0 && strings.IndexFunc(value[:i], func(r rune) bool { return !unicode.IsLetter(r) }) < 0 {
+		value = strings.TrimSpace(value[i+1:])
+	}
+	// "UT" из RFC822 и "Z" вместо зоны в RFC1123-датах.
+	if i := strings.LastIndex(value, " "); i > 0 {
+		switch zone := value[i+1:]; {
+		case zone == "UT" || zone == "Z":
+			value = value[:i] + " UTC"
+		case rfc822Zones[zone] != "":
+			value = value[:i] + " " + rfc822Zones[zone]
+		}
+	}
+	for _, layout := range dateLayouts {
+		if t, err := time.Parse(layout, value); err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("неизвестный формат даты %q", s)
+}
+
+// parseDates заполняет Published у статей ленты. Неразобранные даты остаются нулевыми,
+// а при strict неразобранная непустая дата считается ошибкой ленты.
+func parseDates(rss *RSS, strict bool) error {
+	for i := range rss.Channel.Items {
+		item := &rss.Channel.Items[i]
+		raw := item.rawDate()
+		if raw == "" {
+			continue
+		}
+		t, err := parseDate(raw)
+		if err != nil && strict {
+			return &parseError{fmt.Errorf("статья %q: %v", item.Title, err)}
+		}
+		item.Published = t
+	}
+	return nil
+}
+
+// sortItems упорядочивает статьи по дате: "desc" — сначала новые, "asc" — сначала старые,
+// "none" — как в ленте. Статьи без разобранной даты всегда идут в конце.
+func sortItems(items []Item, order string) {
+	if order == "none" {
+		return
+	}
+	sort.SliceStable(items, func(i, j int) bool {
+		a, b := items[i].Published, items[j].Published
+		if a.IsZero() || b.IsZero() {
+			return !a.IsZero() && b.IsZero()
+		}
+		if order == "asc" {
+			return a.Before(b)
+		}
+		return a.After(b)
+	})
+}
+
+// feedResult хранит результат загрузки одной ленты.
+type feedResult struct {
+	URL  string
+	Feed *RSS
+	Err  error
+}
+
+// cacheEntry — сохранённый ответ сервера для условных запросов.
+type cacheEntry struct {
+	URL          string `json:"url"`
+	ETag         string `json:"etag,omitempty"`
+	LastModified string `json:"last_modified,omitempty"`
+	ContentType  string `json:"content_type,omitempty"` // Нужен, чтобы узнать кодировку сохранённого тела
+	Body         []byte `json:"body"`
+}
+
+// feedCache хранит ответы в директории dir, по файлу на ленту с именем из хэша адреса.
+type feedCache struct {
+	dir string
+}
+
+// defaultCacheDir возвращает директорию кэша по умолчанию (~/.cache/rssparser в Linux).
+func defaultCacheDir() string {
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(dir, "rssparser")
+}
+
+// path возвращает путь к файлу кэша ленты rssURL.
+func (c *feedCache) path(rssURL string) string {
+	sum := sha256.Sum256([]byte(rssURL))
+	return filepath.Join(c.dir, hex.EncodeToString(sum[:])+".json")
+}
+
+// load читает запись кэша; отсутствующая или повреждённая запись возвращается как nil.
+func (c *feedCache) load(rssURL string) *cacheEntry {
+	data, err := ioutil.ReadFile(c.path(rssURL))
+	if err != nil {
+		return nil
+	}
+	var entry cacheEntry
+	if err := json.Unmarshal(data, &entry); err != nil || entry.URL != rssURL {
+		return nil
+	}
+	return &entry
+}
+
+// store атомарно записывает запись кэша: сначала во временный файл, затем переименованием.
+func (c *feedCache) store(entry *cacheEntry) error {
+	if err := os.MkdirAll(c.dir, 0o755); err != nil {
+		return err
+	}
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(c.path(entry.URL), data)
+}
+
+// writeFileAtomic записывает файл через временный файл в той же директории и переименование,
+// чтобы при сбое не остался наполовину записанный файл.
+func writeFileAtomic(path string, data []byte) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".tmp-*")
+	if err != nil {
+		return err
+	}
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	return nil
+}
+
+// seenTTL — сколько хранится отметка о статье, которой уже нет в ленте.
+const seenTTL = 90 * 24 * time.Hour
+
+// seenState хранит прочитанные статьи по лентам: адрес ленты → ключ статьи → время,
+// когда статья встретилась впервые.
+type seenState struct {
+	path  string
+	Feeds map[string]map[string]time.Time `json:"feeds"`
+}
+
+// loadSeen читает файл состояния; отсутствующий файл означает пустое состояние.
+func loadSeen(path string) (*seenState, error) {
+	st := &seenState{path: path, Feeds: map[string]map[string]time.Time{}}
+	data, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return st, nil
+	} else if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(data, st); err != nil {
+		return nil, fmt.Errorf("повреждён файл состояния %s: %v", path, err)
+	}
+	if st.Feeds == nil {
+		st.Feeds = map[string]map[string]time.Time{}
+	}
+	return st, nil
+}
+
+// unseen возвращает статьи ленты, которых ещё нет в состоянии.
+func (st *seenState) unseen(feedURL string, items []Item) []Item {
+	var fresh []Item
+	for _, item := range items {
+		if _, ok := st.Feeds[feedURL][item.key()]; !ok {
+			fresh = append(fresh, item)
+		}
+	}
+	return fresh
+}
+
+// mark отмечает статьи прочитанными. Заодно удаляются старые отметки о статьях,
+// которых в ленте (current) больше нет, чтобы файл не рос бесконечно.
+func (st *seenState) mark(feedURL string, items, current []Item, now time.Time) {
+	seen := st.Feeds[feedURL]
+	if seen == nil {
+		seen = map[string]time.Time{}
+		st.Feeds[feedURL] = seen
+	}
+	inFeed := make(map[string]bool, len(current))
+	for _, item := range current {
+		inFeed[item.key()] = true
+	}
+	for key, t := range seen {
+		if !inFeed[key] && now.Sub(t) > seenTTL {
+			delete(seen, key)
+		}
+	}
+	for _, item := range items {
+		if _, ok := seen[item.key()]; !ok {
+			seen[item.key()] = now
+		}
+	}
+}
+
+// unmark снимает отметку со статей (например, не выведенных из-за --limit).
+func (st *seenState) unmark(feedURL string, items []Item) {
+	for _, item := range items {
+		delete(st.Feeds[feedURL], item.key())
+	}
+}
+
+// save атомарно записывает состояние.
+func (st *seenState) save() error {
+	if err := os.MkdirAll(filepath.Dir(st.path), 0o755); err != nil {
+		return err
+	}
+	data, err := json.MarshalIndent(st, "", "  ")
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(st.path, data)
+}
+
+// charsetAliases исправляет встречающиеся в лентах названия кодировок, которых нет
+// ни в реестре IANA, ни в списке WHATWG. ASCII читается как UTF-8, как и раньше.
+var charsetAliases = map[string]string{
+	"us-ascii": "utf-8", "ascii": "utf-8",
+	"win-1251": "windows-1251", "koi8r": "koi8-r",
+}
+
+// lookupCharset находит кодировку по названию: сначала в реестре IANA (им пользуется
+// пролог XML), затем среди меток WHATWG (cp1251, x-cp1251 и другие из HTML).
+func lookupCharset(label string) (encoding.Encoding, bool) {
+	label = strings.ToLower(strings.TrimSpace(label))
+	if alias, ok := charsetAliases[label]; ok {
+		label = alias
+	}
+	if enc, err := ianaindex.IANA.Encoding(label); err == nil && enc != nil {
+		return enc, true
+	}
+	if enc, err := htmlindex.Get(label); err == nil {
+		return enc, true
+	}
+	return nil, false
+}
+
+var xmlEncodingPattern = regexp.MustCompile(`^\s*<\?xml[^>]*\bencoding\s*=\s*["']([^"']+)["']`)
+
+// detectCharset определяет кодировку ленты: сначала по BOM и первым байтам UTF-16,
+// затем по параметру charset в Content-Type (он главнее пролога, RFC 7303), затем по
+// объявлению в прологе XML. Без указаний считается UTF-8. Возвращается исходное название.
+func detectCharset(data []byte, contentType string) string {
+	switch {
+	case bytes.HasPrefix(data, []byte{0xEF, 0xBB, 0xBF}):
+		return "utf-8"
+	case bytes.HasPrefix(data, []byte{0xFE, 0xFF}), bytes.HasPrefix(data, []byte{0x00, '<'}):
+		return "utf-16be"
+	case bytes.HasPrefix(data, []byte{0xFF, 0xFE}), bytes.HasPrefix(data, []byte{'<', 0x00}):
+		return "utf-16le"
+	}
+	if _, params, err := mime.ParseMediaType(contentType); err == nil && params["charset"] != "" {
+		return params["charset"]
+	}
+	if m := xmlEncodingPattern.FindSubmatch(data[:min(len(data), 512)]); m != nil {
+		return string(m[1])
+	}
+	return "utf-8"
+}
+
+// toUTF8 переводит тело ленты в UTF-8 по кодировке из detectCharset. Ленты нередко
+// врут о кодировке, поэтому без strict неизвестная кодировка читается как UTF-8,
+// а текст, объявленный как UTF-8, но им не являющийся, — как windows-1251 (самый
+// частый случай у русскоязычных лент), с предупреждением. С strict это ошибки.
+func toUTF8(data []byte, contentType string, strict bool) ([]byte, error) {
+	label := detectCharset(data, contentType)
+	enc, known := lookupCharset(label)
+	if !known {
+		if strict {
+			return nil, fmt.Errorf("неподдерживаемая кодировка %q", label)
+		}
+		fmt.Fprintf(os.Stderr, "Предупреждение: неподдерживаемая кодировка %q, читаем как UTF-8\n", label)
+		enc = textunicode.UTF8
+	}
+
+	if enc == textunicode.UTF8 {
+		data = bytes.TrimPrefix(data, []byte{0xEF, 0xBB, 0xBF})
+		if utf8.Valid(data) {
+			return data, nil
+		}
+		if strict {
+			return nil, fmt.Errorf("лента объявлена в кодировке %s, но содержит неверные байты UTF-8", label)
+		}
+		fmt.Fprintf(os.Stderr, "Предупреждение: лента не в UTF-8, хотя объявлена так; читаем как windows-1251\n")
+		enc = charmap.Windows1251
+	}
+	// BOM главнее названия: он задаёт порядок байтов UTF-16 и не попадает в текст.
+	decoded, _, err := transform.Bytes(textunicode.BOMOverride(enc.NewDecoder()), data)
+	if err != nil {
+		return nil, fmt.Errorf("ошибка декодирования из %s: %v", label, err)
+	}
+	// Байты, не определённые в кодировке, декодер заменяет на U+FFFD. В UTF-16 этот
+	// символ может быть и настоящим, поэтому там замены не проверяются.
+	name, _ := ianaindex.IANA.Name(enc)
+	if strict && !strings.HasPrefix(name, "UTF-16") && bytes.ContainsRune(decoded, utf8.RuneError) {
+		return nil, fmt.Errorf("лента содержит байты, не определённые в кодировке %s", label)
+	}
+	return decoded, nil
+}
+
+// maxRetryDelay ограничивает паузу перед повтором, даже если Retry-After просит больше.
+const maxRetryDelay = time.Minute
+
+// fetcher загружает ленты: общий HTTP-клиент, кэш условных запросов и число повторов.
+type fetcher struct {
+	ctx     context.Context // Отмена запросов и пауз между повторами
+	client  *http.Client
+	cache   *feedCache  // nil — без кэша
+	retries int         // Сколько раз повторять запрос после временной ошибки
+	header  http.Header // Заголовки каждого запроса (--user-agent, --header); nil — только User-Agent по умолчанию
+
+	strictEncoding bool // Ошибка вместо замены при неизвестной кодировке или неверных байтах
+}
+
+// defaultUserAgent — User-Agent запросов, если не задан --user-agent.
+const defaultUserAgent = "Mozilla/5.0 (compatible; MyRSSParser/1.0)"
+
+// newHeader возвращает копию заголовков запроса; без User-Agent подставляется defaultUserAgent.
+func (f *fetcher) newHeader() http.Header {
+	header := f.header.Clone()
+	if header == nil {
+		header = http.Header{}
+	}
+	if header.Get("User-Agent") == "" {
+		header.Set("User-Agent", defaultUserAgent)
+	}
+	return header
+}
+
+// redirectError — перенаправления зациклены или их слишком много; повтор запроса не поможет.
+type redirectError struct {
+	msg string
+}
+
+func (e *redirectError) Error() string { return e.msg }
+
+// redirectPolicy ограничивает число перенаправлений и обнаруживает циклы. Заголовки
+// исходного запроса (User-Agent, --header) http.Client переносит на каждое перенаправление
+// сам, кроме Authorization и Cookie при переходе на другой домен.
+func redirectPolicy(limit int) func(*http.Request, []*http.Request) error {
+	return func(req *http.Request, via []*http.Request) error {
+		chain := make([]string, 0, len(via)+1)
+		for _, prev := range via {
+			chain = append(chain, prev.URL.String())
+		}
+		chain = append(chain, req.URL.String())
+		for i, prev := range via {
+			if prev.URL.String() == req.URL.String() {
+				return &redirectError{"перенаправления зациклены: " + strings.Join(chain[i:], " → ")}
+			}
+		}
+		if len(via) > limit {
+			return &redirectError{fmt.Sprintf("больше %d перенаправлений (--max-redirects): %s", limit, strings.Join(chain, " → "))}
+		}
+		return nil
+	}
+}
+
+// newTransport возвращает транспорт HTTP-клиента. По умолчанию прокси берётся из
+// HTTP_PROXY/HTTPS_PROXY/NO_PROXY, proxyURL (http, https, socks5 или socks5h) его
+// заменяет, а direct отключает прокси совсем.
+func newTransport(proxyURL string, direct bool) (*http.Transport, error) {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	switch {
+	case direct:
+		transport.Proxy = nil
+	case proxyURL != "":
+		u, err := url.Parse(proxyURL)
+		if err != nil || u.Host == "" {
+			return nil, fmt.Errorf("неверный адрес прокси %q", proxyURL)
+		}
+		switch u.Scheme {
+		case "http", "https", "socks5", "socks5h":
+		default:
+			return nil, fmt.Errorf("неподдерживаемая схема прокси %q (допустимы http, https, socks5, socks5h)", u.Scheme)
+		}
+		transport.Proxy = http.ProxyURL(u)
+	default:
+		transport.Proxy = http.ProxyFromEnvironment
+	}
+	return transport, nil
+}
+
+// isProxyError сообщает, что запрос не дошёл до сервера ленты из-за прокси:
+// net/http помечает такие ошибки операцией "proxyconnect" (HTTP-прокси)
+// или "socks connect" (SOCKS5).
+func isProxyError(err error) bool {
+	var opErr *net.OpError
+	return errors.As(err, &opErr) && (opErr.Op == "proxyconnect" || strings.HasPrefix(opErr.Op, "socks"))
+}
+
+// retryable сообщает, стоит ли повторять запрос: сетевые ошибки, 429 и 5xx.
+// Остальные ответы 4xx не изменятся от повтора.
+func retryable(resp *http.Response, err error) bool {
+	if err != nil {
+		return true
+	}
+	return resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= 500
+}
+
+// retryDelay возвращает паузу перед повтором номер attempt (с нуля): экспоненциальный рост
+// от полусекунды со случайной добавкой до 50%, либо значение Retry-After (секунды или дата).
+func retryDelay(resp *http.Response, attempt int) time.Duration {
+	if resp != nil {
+		if value := resp.Header.Get("Retry-After"); value != "" {
+			if sec, err := strconv.Atoi(value); err == nil && sec >= 0 {
+				return min(time.Duration(sec)*time.Second, maxRetryDelay)
+			}
+			if t, err := http.ParseTime(value); err == nil {
+				return min(max(time.Until(t), 0), maxRetryDelay)
+			}
+		}
+	}
+	delay := 500 * time.Millisecond << attempt
+	delay += time.Duration(rand.Int63n(int64(delay/2) + 1))
+	return min(delay, maxRetryDelay)
+}
+
+// do выполняет GET-запрос с повторами. Запрос создаётся заново на каждую попытку
+// с теми же заголовками, включая условные.
+func (f *fetcher) do(rssURL string, header http.Header) (*http.Response, error) {
+	for attempt := 0; ; attempt++ {
+		// Создаем HTTP-запрос; заголовки копируем, чтобы попытки не влияли друг на друга.
+		req, err := http.NewRequestWithContext(f.ctx, "GET", rssURL, nil)
+		if err != nil {
+			return nil, fmt.Errorf("ошибка создания запроса: %v", err)
+		}
+		req.Header = header.Clone()
+
+		// Отправляем запрос.
+		resp, err := f.client.Do(req)
+		var redirErr *redirectError
+		if errors.As(err, &redirErr) {
+			return nil, redirErr
+		}
+		if !retryable(resp, err) {
+			return resp, nil
+		}
+		if attempt == f.retries || f.ctx.Err() != nil {
+			if err != nil && isProxyError(err) {
+				return nil, fmt.Errorf("ошибка прокси-сервера (попыток: %d): %v", attempt+1, err)
+			}
+			if err != nil {
+				return nil, fmt.Errorf("ошибка при выполнении запроса (попыток: %d): %v", attempt+1, err)
+			}
+			resp.Body.Close()
+			return nil, fmt.Errorf("не удалось получить данные (попыток: %d), статус: %d", attempt+1, resp.StatusCode)
+		}
+		delay := retryDelay(resp, attempt)
+		if resp != nil {
+			resp.Body.Close()
+		}
+		select {
+		case <-time.After(delay):
+		case <-f.ctx.Done():
+			return nil, f.ctx.Err()
+		}
+	}
+}
+
+// fetchFeed загружает и разбирает RSS-ленту по адресу rssURL. Если задан кэш, запрос
+// делается условным (If-None-Match/If-Modified-Since), и на ответ 304 используется
+// сохранённое тело; новый ответ после успешного разбора сохраняется в кэш.
+func (f *fetcher) fetchFeed(rssURL string) (*RSS, error) {
+	header := f.newHeader()
+
+	var cached *cacheEntry
+	if f.cache != nil {
+		if cached = f.cache.load(rssURL); cached != nil {
+			if cached.ETag != "" {
+				header.Set("If-None-Match", cached.ETag)
+			}
+			if cached.LastModified != "" {
+				header.Set("If-Modified-Since", cached.LastModified)
+			}
+		}
+	}
+
+	resp, err := f.do(rssURL, header)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	// Постоянным перенаправление считается, только если постоянны все его шаги.
+	var finalURL string
+	moved := false
+	if u := resp.Request.URL.String(); u != rssURL {
+		finalURL, moved = u, true
+		for r := resp.Request; r.Response != nil; r = r.Response.Request {
+			if code := r.Response.StatusCode; code != http.StatusMovedPermanently && code != http.StatusPermanentRedirect {
+				moved = false
+			}
+		}
+	}
+
+	// Проверяем статус ответа.
+	var data []byte
+	contentType := resp.Header.Get("Content-Type")
+	switch {
+	case resp.StatusCode == http.StatusNotModified && cached != nil:
+		// Лента не изменилась: берём тело из кэша.
+		data, contentType = cached.Body, cached.ContentType
+	case resp.StatusCode != http.StatusOK:
+		return nil, fmt.Errorf("не удалось получить данные, статус: %d", resp.StatusCode)
+	default:
+		// Читаем тело ответа.
+		data, err = ioutil.ReadAll(resp.Body)
+		if err != nil {
+			return nil, fmt.Errorf("ошибка чтения данных: %v", err)
+		}
+	}
+
+	// Переводим ленту в UTF-8 и парсим XML-данные в структуру RSS.
+	text, err := toUTF8(data, contentType, f.strictEncoding)
+	if err != nil {
+		return nil, &parseError{err}
+	}
+	var rss RSS
+	dec := xml.NewDecoder(bytes.NewReader(text))
+	// Текст уже в UTF-8, объявленная в прологе кодировка больше не важна.
+	dec.CharsetReader = func(_ string, r io.Reader) (io.Reader, error) { return r, nil }
+	if err := dec.Decode(&rss); err != nil {
+		return nil, &parseError{fmt.Errorf("ошибка парсинга XML: %v", err)}
+	}
+
+	// Если канал пустой или не содержит статей, считаем это ошибкой.
+	if rss.Channel.Title == "" && len(rss.Channel.Items) == 0 {
+		return nil, &parseError{errors.New("не удалось найти статьи в RSS-ленте. Возможно, формат ленты отличается от ожидаемого")}
+	}
+	fillItemFields(&rss)
+	rss.FinalURL, rss.Moved = finalURL, moved
+
+	if f.cache != nil && resp.StatusCode == http.StatusOK {
+		etag, modified := resp.Header.Get("ETag"), resp.Header.Get("Last-Modified")
+		// Без валидаторов условный запрос невозможен, хранить ответ незачем.
+		if etag != "" || modified != "" {
+			entry := &cacheEntry{URL: rssURL, ETag: etag, LastModified: modified, ContentType: contentType, Body: data}
+			if err := f.cache.store(entry); err != nil {
+				fmt.Fprintf(os.Stderr, "Предупреждение: не удалось сохранить кэш ленты %s: %v\n", rssURL, err)
+			}
+		}
+	}
+	return &rss, nil
+}
+
+// fetchAll загружает ленты параллельно, не более чем в workers потоков.
+// Результаты возвращаются в порядке адресов в urls.
+func fetchAll(urls []string, workers int, f *fetcher) []feedResult {
+	if workers < 1 {
+		workers = 1
+	}
+	if workers > len(urls) {
+		workers = len(urls)
+	}
+	results := make([]feedResult, len(urls))
+	jobs := make(chan int)
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range jobs {
+				feed, err := f.fetchFeed(urls[i])
+				results[i] = feedResult{URL: urls[i], Feed: feed, Err: err}
+			}
+		}()
+	}
+	for i := range urls {
+		jobs <- i
+	}
+	close(jobs)
+	wg.Wait()
+	return results
+}
+
+// readFeedsFile читает адреса лент из файла: по одному на строку,
+// пустые строки и строки, начинающиеся с "#", пропускаются.
+func readFeedsFile(path string) ([]string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	var urls []string
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		urls = append(urls, line)
+	}
+	return urls, scanner.Err()
+}
+
+// opmlDoc описывает OPML-файл со списком подписок.
+type opmlDoc struct {
+	Outlines []opmlOutline `xml:"body>outline"`
+}
+
+// opmlOutline описывает элемент outline: подписку (с xmlUrl) или папку с вложенными элементами.
+type opmlOutline struct {
+	Text     string        `xml:"text,attr"`
+	Title    string        `xml:"title,attr"`
+	XMLURL   string        `xml:"xmlUrl,attr"`
+	Outlines []opmlOutline `xml:"outline"`
+}
+
+// opmlFeed описывает подписку, извлечённую из OPML.
+type opmlFeed struct {
+	URL    string
+	Title  string
+	Folder []string // Путь папок от корня, пустой для подписок верхнего уровня
+}
+
+// name возвращает название элемента outline: title, а если его нет — text.
+func (o opmlOutline) name() string {
+	if o.Title != "" {
+		return o.Title
+	}
+	return o.Text
+}
+
+// readOPML читает подписки из OPML-файла, обходя вложенные папки.
+// Элементы без адреса ленты или с некорректным адресом пропускаются с предупреждением.
+func readOPML(path string) ([]opmlFeed, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var doc opmlDoc
+	if err := xml.Unmarshal(data, &doc); err != nil {
+		return nil, fmt.Errorf("ошибка парсинга OPML: %v", err)
+	}
+	var feeds []opmlFeed
+	var walk func(outlines []opmlOutline, folder []string)
+	walk = func(outlines []opmlOutline, folder []string) {
+		for _, o := range outlines {
+			name := strings.TrimSpace(o.name())
+			switch {
+			case o.XMLURL != "":
+				u, err := url.Parse(strings.TrimSpace(o.XMLURL))
+				if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+					fmt.Fprintf(os.Stderr, "Предупреждение: некорректный адрес ленты %q в OPML, пропускаем\n", o.XMLURL)
+					continue
+				}
+				feeds = append(feeds, opmlFeed{URL: u.String(), Title: name, Folder: folder})
+			case len(o.Outlines) > 0:
+				// Копируем путь, чтобы соседние папки не делили один массив.
+				sub := append(append([]string(nil), folder...), name)
+				walk(o.Outlines, sub)
+			default:
+				fmt.Fprintf(os.Stderr, "Предупреждение: элемент OPML %q без xmlUrl и вложенных элементов, пропускаем\n", name)
+			}
+		}
+	}
+	walk(doc.Outlines, nil)
+	return feeds, nil
+}
+
+// inFolder сообщает, лежит ли подписка в папке folder (на любом уровне вложенности).
+// Имена папок сравниваются без учёта регистра.
+func (f opmlFeed) inFolder(folder string) bool {
+	for _, name := range f.Folder {
+		if strings.EqualFold(name, folder) {
+			return true
+		}
+	}
+	return false
+}
+
+// parseArgs разбирает флаги, которые могут стоять как до, так и после адресов лент,
+// и возвращает адреса по порядку.
+func parseArgs(fs *flag.FlagSet, args []string) []string {
+	var positional []string
+	for {
+		if err := fs.Parse(args); err == flag.ErrHelp {
+			os.Exit(exitOK)
+		} else if err != nil {
+			os.Exit(exitUsage)
+		}
+		args = fs.Args()
+		if len(args) == 0 {
+			return positional
+		}
+		positional = append(positional, args[0])
+		args = args[1:]
+	}
+}
+
+// stringList — повторяемый строковый флаг (--match=a --match=b).
+type stringList []string
+
+func (l *stringList) String() string { return strings.Join(*l, ",") }
+
+func (l *stringList) Set(value string) error {
+	*l = append(*l, value)
+	return nil
+}
+
+// itemFilter отбирает статьи по регулярным выражениям, применяемым к заголовку и описанию
+// без учёта регистра: статья проходит, если подходит под любой из match (или match не заданы)
+// и ни под один из exclude. Исключение важнее совпадения. Если заданы categories или authors,
+// статья должна также иметь одну из рубрик (точное совпадение без учёта регистра) и
+// автора, в имени которого встречается одна из строк authors.
+type itemFilter struct {
+	match   []*regexp.Regexp
+	exclude []*regexp.Regexp
+
+	categories []string // --category
+	authors    []string // --author, в нижнем регистре
+}
+
+// newItemFilter компилирует шаблоны --match и --exclude.
+func newItemFilter(match, exclude []string) (itemFilter, error) {
+	var f itemFilter
+	compile := func(patterns []string, flagName string) ([]*regexp.Regexp, error) {
+		var list []*regexp.Regexp
+		for _, p := range patterns {
+			re, err := regexp.Compile("(?i)" + p)
+			if err != nil {
+				return nil, fmt.Errorf("неверное регулярное выражение в --%s=%q: %v", flagName, p, err)
+			}
+			list = append(list, re)
+		}
+		return list, nil
+	}
+	var err error
+	if f.match, err = compile(match, "match"); err != nil {
+		return f, err
+	}
+	f.exclude, err = compile(exclude, "exclude")
+	return f, err
+}
+
+// active сообщает, задан ли хотя бы один шаблон.
+func (f itemFilter) active() bool {
+	return len(f.match) > 0 || len(f.exclude) > 0 || len(f.categories) > 0 || len(f.authors) > 0
+}
+
+// keep сообщает, проходит ли статья фильтр.
+func (f itemFilter) keep(item Item) bool {
+	if len(f.categories) > 0 && !slices.ContainsFunc(item.Categories, func(c string) bool {
+		return slices.ContainsFunc(f.categories, func(want string) bool { return strings.EqualFold(c, want) })
+	}) {
+		return false
+	}
+	if len(f.authors) > 0 && !slices.ContainsFunc(f.authors, func(want string) bool {
+		return strings.Contains(strings.ToLower(item.Author), want)
+	}) {
+		return false
+	}
+	text := item.Title + "\n" + cleanHTML(item.Description)
+	for _, re := range f.exclude {
+		if re.MatchString(text) {
+			return false
+		}
+	}
+	if len(f.match) == 0 {
+		return true
+	}
+	for _, re := range f.match {
+		if re.MatchString(text) {
+			return true
+		}
+	}
+	return false
+}
+
+// apply возвращает прошедшие фильтр статьи и число отброшенных.
+func (f itemFilter) apply(items []Item) ([]Item, int) {
+	if !f.active() {
+		return items, 0
+	}
+	var kept []Item
+	for _, item := range items {
+		if f.keep(item) {
+			kept = append(kept, item)
+		}
+	}
+	return kept, len(items) - len(kept)
+}
+
+// dateBound — граница --since или --until: абсолютное время или давность относительно
+// текущего момента (для --watch пересчитывается при каждом опросе).
+type dateBound struct {
+	at  time.Time
+	ago time.Duration
+}
+
+// boundLayouts — форматы абсолютных границ, в местном времени.
+var boundLayouts = []string{"2006-01-02", "2006-01-02 15:04", "2006-01-02T15:04", "2006-01-02T15:04:05"}
+
+// parseDateBound разбирает границу: давность (90m, 24h, 7d, 2w) или дату (2024-05-01,
+// 2024-05-01 18:00, RFC 3339). Дата без времени для --until (endOfDay) включает весь день.
+func parseDateBound(value string, endOfDay bool) (dateBound, error) {
+	value = strings.TrimSpace(value)
+	if n := len(value); n > 1 && (value[n-1] == 'd' || value[n-1] == 'w') {
+		if days, err := strconv.Atoi(value[:n-1]); err == nil && days > 0 {
+			if value[n-1] == 'w' {
+				days *= 7
+			}
+			return dateBound{ago: time.Duration(days) * 24 * time.Hour}, nil
+		}
+	}
+	if d, err := time.ParseDuration(value); err == nil && d > 0 {
+		return dateBound{ago: d}, nil
+	}
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return dateBound{at: t}, nil
+	}
+	for i, layout := range boundLayouts {
+		if t, err := time.ParseInLocation(layout, value, time.Local); err == nil {
+			if i == 0 && endOfDay {
+				t = t.AddDate(0, 0, 1)
+			}
+			return dateBound{at: t}, nil
+		}
+	}
+	return dateBound{}, fmt.Errorf("не удалось разобрать %q: ожидается давность (24h, 7d) или дата (2024-05-01)", value)
+}
+
+func (b dateBound) set() bool { return b.ago > 0 || !b.at.IsZero() }
+
+// time возвращает момент границы относительно now.
+func (b dateBound) time(now time.Time) time.Time {
+	if b.ago > 0 {
+		return now.Add(-b.ago)
+	}
+	return b.at
+}
+
+// dateRange отбирает статьи по дате публикации: since <= дата < until. Статьи без
+// разобранной даты отбрасываются, если не задан keepUndated.
+type dateRange struct {
+	since, until dateBound
+	keepUndated  bool
+}
+
+func (dr dateRange) active() bool { return dr.since.set() || dr.until.set() }
+
+// apply возвращает статьи из диапазона, число отброшенных и число статей без даты.
+func (dr dateRange) apply(items []Item, now time.Time) (kept []Item, dropped, undated int) {
+	if !dr.active() {
+		return items, 0, 0
+	}
+	since, until := dr.since.time(now), dr.until.time(now)
+	for _, item := range items {
+		switch {
+		case item.Published.IsZero():
+			undated++
+			if !dr.keepUndated {
+				continue
+			}
+		case dr.since.set() && item.Published.Before(since),
+			dr.until.set() && !item.Published.Before(until):
+			continue
+		}
+		kept = append(kept, item)
+	}
+	return kept, len(items) - len(kept), undated
+}
+
+// Теги, по которым extractArticle отбирает текст страницы.
+var (
+	// Элементы, из абзацев которых складывается текст; выбирается элемент с самым длинным текстом.
+	containerTags = map[string]bool{"body": true, "div": true, "section": true, "main": true, "article": true, "td": true}
+	// Абзацы текста.
+	paragraphTags = map[string]bool{"p": true, "pre": true, "blockquote": true, "li": true}
+	// Служебные части страницы, вырезаемые целиком.
+	boilerplatePatterns = func() []*regexp.Regexp {
+		var list []*regexp.Regexp
+		for _, name := range []string{"nav", "header", "footer", "aside", "form", "noscript", "svg"} {
+			list = append(list, regexp.MustCompile(`(?is)<`+name+`\b.*?</`+name+`\s*>`))
+		}
+		return list
+	}()
+)
+
+const (
+	minParagraph = 25  // Абзацы короче (в символах) не учитываются: подписи, кнопки, даты
+	minArticle   = 250 // Если текста меньше, выделить статью не удалось
+)
+
+// extractArticle выделяет текст статьи из HTML-страницы: после удаления script/style и служебных
+// частей (nav, header, footer и т. п.) абзацы относятся к ближайшему охватывающему элементу
+// (div, section, article, ...), и выбирается элемент с наибольшим объёмом текста; article и main
+// получают надбавку. Абзацы, больше половины текста которых — ссылки, пропускаются.
+// Возвращает абзацы через перевод строки или пустую строку, если текста слишком мало.
+func extractArticle(doc string) string {
+	doc = commentPattern.ReplaceAllString(doc, " ")
+	doc = scriptPattern.ReplaceAllString(doc, " ")
+	for _, re := range boilerplatePatterns {
+		doc = re.ReplaceAllString(doc, " ")
+	}
+
+	type textBlock struct {
+		name  string
+		paras []string
+		score int
+	}
+	root := &textBlock{name: "body"}
+	blocks, stack := []*textBlock{root}, []*textBlock{root}
+	var para strings.Builder
+	inPara, inLink, linkChars := false, false, 0
+	flush := func() {
+		if !inPara {
+			return
+		}
+		text := oneLine(html.UnescapeString(para.String()))
+		if n := utf8.RuneCountInString(text); n >= minParagraph && linkChars*2 < n {
+			top := stack[len(stack)-1]
+			top.paras = append(top.paras, text)
+			top.score += n
+		}
+		para.Reset()
+		inPara, linkChars = false, 0
+	}
+	last := 0
+	for _, m := range tagPattern.FindAllStringSubmatchIndex(doc, -1) {
+		if inPara {
+			text := doc[last:m[0]]
+			para.WriteString(text)
+			if inLink {
+				linkChars += utf8.RuneCountInString(strings.TrimSpace(text))
+			}
+		}
+		last = m[1]
+		name := strings.ToLower(doc[m[2]:m[3]])
+		closing := strings.HasPrefix(doc[m[0]:m[1]], "</")
+		switch {
+		case containerTags[name]:
+			flush()
+			if !closing {
+				b := &textBlock{name: name}
+				blocks, stack = append(blocks, b), append(stack, b)
+				break
+			}
+			// Незакрытые вложенные элементы закрываются вместе с внешним.
+			for j := len(stack) - 1; j > 0; j-- {
+				if stack[j].name == name {
+					stack = stack[:j]
+					break
+				}
+			}
+		case paragraphTags[name]:
+			flush()
+			inPara = !closing
+		case name == "a":
+			inLink = !closing
+		case name == "br":
+			para.WriteString(" ")
+		}
+	}
+	flush()
+
+	var best *textBlock
+	bestScore := 0
+	for _, b := range blocks {
+		score := b.score
+		if b.name == "article" || b.name == "main" {
+			score += score / 2
+		}
+		if score > bestScore {
+			best, bestScore = b, score
+		}
+	}
+	if best == nil || best.score < minArticle {
+		return ""
+	}
+	return strings.Join(best.paras, "\n")
+}
+
+// articleFetcher загружает страницы статей для --full-text теми же запросами, что и ленты
+// (тайм-аут, повторы, прокси), не больше workers одновременно и не больше maxBytes с каждой.
+type articleFetcher struct {
+	f        *fetcher
+	workers  int
+	maxBytes int64
+}
+
+// fill заполняет FullText у статей со ссылками. Если страницу получить или разобрать
+// не удалось, выводится предупреждение и у статьи остаётся описание из ленты.
+func (a *articleFetcher) fill(items []Item) {
+	slots := make(chan struct{}, max(a.workers, 1))
+	var wg sync.WaitGroup
+	for i := range items {
+		link := strings.TrimSpace(items[i].Link)
+		if link == "" {
+			continue
+		}
+		wg.Add(1)
+		go func(item *Item) {
+			defer wg.Done()
+			slots <- struct{}{}
+			defer func() { <-slots }()
+			text, err := a.fetch(link)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "Полный текст статьи %q не получен, выводится описание из ленты: %v\n", item.Title, err)
+				return
+			}
+			item.FullText = text
+		}(&items[i])
+	}
+	wg.Wait()
+}
+
+// fetch загружает страницу и выделяет из неё текст статьи.
+func (a *articleFetcher) fetch(link string) (string, error) {
+	resp, err := a.f.do(link, a.f.newHeader())
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("статус: %d", resp.StatusCode)
+	}
+	contentType := resp.Header.Get("Content-Type")
+	if mediaType, _, _ := mime.ParseMediaType(contentType); contentType != "" && !strings.Contains(mediaType, "html") {
+		return "", fmt.Errorf("страница не в HTML (%s)", mediaType)
+	}
+	// Страница длиннее maxBytes обрезается: начала обычно достаточно для текста статьи.
+	data, err := ioutil.ReadAll(io.LimitReader(resp.Body, a.maxBytes))
+	if err != nil {
+		return "", fmt.Errorf("ошибка чтения страницы: %v", err)
+	}
+	page, err := toUTF8(data, contentType, false)
+	if err != nil {
+		return "", err
+	}
+	text := extractArticle(string(page))
+	if text == "" {
+		return "", errors.New("не удалось выделить текст статьи")
+	}
+	return text, nil
+}
+
+// descLines — сколько строк описания выводится, остальное обрезается.
+const descLines = 3
+
+// showFields задаёт поля статьи, выводимые в текстовом режиме (флаг --show).
+type showFields struct {
+	title, link, desc, date, enclosure bool
+	author, categories, comments       bool
+}
+
+// parseShow разбирает список полей через запятую: title, link, desc, date, enclosure,
+// author, categories, comments.
+func parseShow(s string) (showFields, error) {
+	var f showFields
+	for _, name := range strings.Split(s, ",") {
+		switch strings.TrimSpace(name) {
+		case "title":
+			f.title = true
+		case "link":
+			f.link = true
+		case "desc":
+			f.desc = true
+		case "date":
+			f.date = true
+		case "enclosure":
+			f.enclosure = true
+		case "author":
+			f.author = true
+		case "categories":
+			f.categories = true
+		case "comments":
+			f.comments = true
+		default:
+			return f, fmt.Errorf("неизвестное поле %q в --show (допустимы title, link, desc, date, enclosure, author, categories, comments)", name)
+		}
+	}
+	return f, nil
+}
+
+// printOptions задаёт параметры текстового вывода лент.
+type printOptions struct {
+	show  showFields
+	limit int  // Не больше limit статей на ленту (0 — без ограничения)
+	width int  // Ширина терминала для переноса описаний
+	raw   bool // Выводить описание как есть, без очистки от HTML
+
+	relative bool // Выводить возраст статьи ("3 ч назад") вместо даты
+	first    int  // Сколько статей выведено до этой ленты (сквозная нумерация для --interactive и --open)
+
+	format string // Формат вывода: text, md, html или json
+}
+
+var (
+	commentPattern = regexp.MustCompile(`(?s)<!--.*?-->`)
+	// Содержимое script и style — не текст статьи.
+	scriptPattern = regexp.MustCompile(`(?is)<(script|style)\b.*?</(script|style)\s*>`)
+	// Тег с атрибутами; кавычки учитываются, чтобы ">" в значении не обрывал тег.
+	tagPattern = regexp.MustCompile(`</?([a-zA-Z][a-zA-Z0-9]*)(?:[^>"']|"[^"]*"|'[^']*')*>`)
+	// Тег, оборванный в конце текста (описание обрезано лентой).
+	brokenTagPattern = regexp.MustCompile(`<[a-zA-Z/][^<>]*$`)
+)
+
+// blockTags — теги, на месте которых в тексте начинается новая строка.
+var blockTags = map[string]bool{
+	"br": true, "p": true, "div": true, "hr": true, "tr": true, "table": true,
+	"ul": true, "ol": true, "blockquote": true, "pre": true, "section": true, "article": true,
+	"h1": true, "h2": true, "h3": true, "h4": true, "h5": true, "h6": true,
+}
+
+var cdataReplacer = strings.NewReplacer("<![CDATA[", "", "]]>", "")
+
+// cleanHTML превращает HTML-описание в простой текст: убирает обёртки CDATA (XML-декодер
+// снимает только внешнюю), комментарии, script/style и теги; <br> и блочные теги становятся
+// переводами строк, <li> — строкой "- ". Сущности, включая числовые, декодируются,
+// пробелы внутри строк схлопываются, пустые строки убираются.
+func cleanHTML(s string) string {
+	s = cdataReplacer.Replace(s)
+	s = commentPattern.ReplaceAllString(s, " ")
+	s = scriptPattern.ReplaceAllString(s, " ")
+	s = tagPattern.ReplaceAllStringFunc(s, func(tag string) string {
+		name := strings.ToLower(tagPattern.FindStringSubmatch(tag)[1])
+		switch {
+		case name == "li" && !strings.HasPrefix(tag, "</"):
+			return "\n- "
+		case blockTags[name] || name == "li":
+			return "\n"
+		}
+		return " "
+	})
+	s = brokenTagPattern.ReplaceAllString(s, "")
+	s = html.UnescapeString(s)
+
+	var lines []string
+	for _, line := range strings.Split(s, "\n") {
+		if line = strings.Join(strings.Fields(line), " "); line != "" && line != "-" {
+			lines = append(lines, line)
+		}
+	}
+	return strings.Join(lines, "\n")
+}
+
+// wrapText разбивает текст на строки не длиннее width символов, оставляя не больше maxLines строк
+// (0 — без ограничения); переводы строк в s сохраняются. Если текст не поместился, последняя строка заканчивается многоточием.
+func wrapText(s string, width, maxLines int) []string {
+	var lines []string
+	for _, paragraph := range strings.Split(s, "\n") {
+		line := ""
+		for _, word := range strings.Fields(paragraph) {
+			for utf8.RuneCountInString(word) > width {
+				// Слово длиннее строки режем по ширине.
+				if line != "" {
+					lines = append(lines, line)
+					line = ""
+				}
+				runes := []rune(word)
+				lines = append(lines, string(runes[:width]))
+				word = string(runes[width:])
+			}
+			switch {
+			case line == "":
+				line = word
+			case utf8.RuneCountInString(line)+1+utf8.RuneCountInString(word) <= width:
+				line += " " + word
+			default:
+				lines = append(lines, line)
+				line = word
+			}
+		}
+		if line != "" {
+			lines = append(lines, line)
+		}
+	}
+	if maxLines > 0 && len(lines) > maxLines {
+		lines = lines[:maxLines]
+		last := []rune(lines[maxLines-1])
+		if len(last) >= width {
+			last = last[:width-1]
+		}
+		lines[maxLines-1] = string(last) + "…"
+	}
+	return lines
+}
+
+// terminalWidth возвращает ширину терминала из переменной COLUMNS, по умолчанию 80.
+func terminalWidth() int {
+	if n, err := strconv.Atoi(os.Getenv("COLUMNS")); err == nil && n > 0 {
+		return n
+	}
+	return 80
+}
+
+// displayDate возвращает дату статьи для вывода: разобранную в местном времени
+// или, если разобрать не удалось, как в ленте.
+func (item Item) displayDate() string {
+	if !item.Published.IsZero() {
+		return item.Published.Local().Format("2006-01-02 15:04")
+	}
+	return item.rawDate()
+}
+
+// relativeDays — до какой давности --relative выводит возраст статьи, дальше — дату.
+const relativeDays = 7
+
+// humanizeAge возвращает возраст статьи для --relative: "5 мин назад", "3 ч назад",
+// "2 дн назад" или, для дат в будущем, "через 5 мин". Единица не округляется вверх:
+// 59 минут остаются минутами. Даты дальше relativeDays выводятся как есть.
+func humanizeAge(t, now time.Time) string {
+	d := now.Sub(t)
+	future := d < 0
+	if future {
+		d = -d
+	}
+	var age string
+	switch {
+	case d < time.Minute:
+		return "только что"
+	case d < time.Hour:
+		age = fmt.Sprintf("%d мин", int(d/time.Minute))
+	case d < 24*time.Hour:
+		age = fmt.Sprintf("%d ч", int(d/time.Hour))
+	case d < relativeDays*24*time.Hour:
+		age = fmt.Sprintf("%d дн", int(d/(24*time.Hour)))
+	default:
+		return t.Local().Format("2006-01-02 15:04")
+	}
+	if future {
+		return "через " + age
+	}
+	return age + " назад"
+}
+
+// shownDate возвращает дату статьи для вывода с учётом --relative.
+func (item Item) shownDate(opts printOptions) string {
+	if opts.relative && !item.Published.IsZero() {
+		return humanizeAge(item.Published, time.Now())
+	}
+	return item.displayDate()
+}
+
+// visibleItems возвращает статьи, которые нужно вывести с учётом --limit.
+func visibleItems(items []Item, opts printOptions) []Item {
+	if opts.limit > 0 && len(items) > opts.limit {
+		return items[:opts.limit]
+	}
+	return items
+}
+
+// description возвращает описание статьи для вывода: полный текст, если он получен (--full-text),
+// иначе описание из ленты, очищенное от HTML, если не задан --raw.
+func (item Item) description(opts printOptions) string {
+	if item.FullText != "" {
+		return item.FullText
+	}
+	if opts.raw {
+		return strings.TrimSpace(item.Description)
+	}
+	return cleanHTML(item.Description)
+}
+
+// printFeed выводит заголовок канала и статьи: номер и выбранные поля.
+func printFeed(w io.Writer, rss *RSS, opts printOptions) {
+	fmt.Fprintf(w, "Заголовки статей из RSS-ленты '%s':\n", rss.Channel.Title)
+	for i, item := range visibleItems(rss.Channel.Items, opts) {
+		prefix := fmt.Sprintf("%d. ", opts.first+i+1)
+		indent := strings.Repeat(" ", len(prefix))
+		// Первое выводимое поле идёт на строке с номером, остальные — с отступом под ним.
+		var lines []string
+		if opts.show.title {
+			lines = append(lines, item.Title)
+		}
+		if opts.show.link && item.Link != "" {
+			lines = append(lines, strings.TrimSpace(item.Link))
+		}
+		if date := item.shownDate(opts); opts.show.date && date != "" {
+			lines = append(lines, date)
+		}
+		if opts.show.author && item.Author != "" {
+			lines = append(lines, "Автор: "+item.Author)
+		}
+		if opts.show.categories && len(item.Categories) > 0 {
+			lines = append(lines, "Рубрики: "+strings.Join(item.Categories, ", "))
+		}
+		if comments := strings.TrimSpace(item.Comments); opts.show.comments && comments != "" {
+			lines = append(lines, "Комментарии: "+comments)
+		}
+		if opts.show.enclosure {
+			for _, enc := range item.Enclosures {
+				lines = append(lines, "Вложение: "+enc.String())
+			}
+		}
+		if len(item.AlsoIn) > 0 {
+			lines = append(lines, "Также в: "+strings.Join(item.AlsoIn, ", "))
+		}
+		if opts.show.desc {
+			width := opts.width - len(indent)
+			if width < 20 {
+				width = 20
+			}
+			// Полный текст статьи выводится целиком.
+			maxLines := descLines
+			if item.FullText != "" {
+				maxLines = 0
+			}
+			lines = append(lines, wrapText(item.description(opts), width, maxLines)...)
+		}
+		if len(lines) == 0 {
+			lines = []string{""}
+		}
+		for j, line := range lines {
+			if j == 0 {
+				fmt.Fprintln(w, strings.TrimRight(prefix+line, " "))
+			} else {
+				fmt.Fprintln(w, indent+line)
+			}
+		}
+	}
+}
+
+// markdownEscaper экранирует символы, которые Markdown может принять за разметку.
+var markdownEscaper = strings.NewReplacer(
+	`\`, `\\`, "`", "\\`", "*", `\*`, "_", `\_`, "[", `\[`, "]", `\]`,
+	"<", `\<`, ">", `\>`, "#", `\#`, "|", `\|`, "!", `\!`, "~", `\~`,
+)
+
+// markdownURL готовит адрес для ссылки Markdown: пробелы и скобки кодируются,
+// чтобы не оборвать (ссылку).
+var markdownURL = strings.NewReplacer(" ", "%20", "(", "%28", ")", "%29")
+
+// oneLine схлопывает переводы строк и лишние пробелы: заголовки в ссылках и
+// элементах списка должны помещаться в одну строку.
+func oneLine(s string) string {
+	return strings.Join(strings.Fields(s), " ")
+}
+
+// writeMarkdownFeed выводит ленту в Markdown: "## Канал", затем пункты
+// "- [Заголовок](ссылка) — дата" и, с --show=desc, описания цитатами.
+func writeMarkdownFeed(w io.Writer, rss *RSS, opts printOptions) {
+	fmt.Fprintf(w, "## %s\n\n", markdownEscaper.Replace(oneLine(rss.Channel.Title)))
+	for _, item := range visibleItems(rss.Channel.Items, opts) {
+		title := markdownEscaper.Replace(oneLine(item.Title))
+		if link := strings.TrimSpace(item.Link); link != "" {
+			title = fmt.Sprintf("[%s](%s)", title, markdownURL.Replace(link))
+		}
+		line := "- " + title
+		if date := item.shownDate(opts); date != "" {
+			line += " — " + markdownEscaper.Replace(date)
+		}
+		if len(item.AlsoIn) > 0 {
+			line += " (также в: " + markdownEscaper.Replace(strings.Join(item.AlsoIn, ", ")) + ")"
+		}
+		fmt.Fprintln(w, line)
+		if item.Author != "" {
+			fmt.Fprintf(w, "  - Автор: %s\n", markdownEscaper.Replace(item.Author))
+		}
+		if len(item.Categories) > 0 {
+			fmt.Fprintf(w, "  - Рубрики: %s\n", markdownEscaper.Replace(strings.Join(item.Categories, ", ")))
+		}
+		if comments := strings.TrimSpace(item.Comments); comments != "" {
+			fmt.Fprintf(w, "  - [Комментарии](%s)\n", markdownURL.Replace(comments))
+		}
+		if opts.show.enclosure {
+			for _, enc := range item.Enclosures {
+				fmt.Fprintf(w, "  - Вложение: [%s](%s)\n", markdownEscaper.Replace(path.Base(enc.URL)), markdownURL.Replace(enc.URL))
+			}
+		}
+		if opts.show.desc {
+			if desc := item.description(opts); desc != "" {
+				fmt.Fprintln(w)
+				for _, l := range strings.Split(desc, "\n") {
+					fmt.Fprintf(w, "  > %s\n", markdownEscaper.Replace(l))
+				}
+				fmt.Fprintln(w)
+			}
+		}
+	}
+}
+
+// jsonItem — статья в выводе --output=json.
+type jsonItem struct {
+	Title       string      `json:"title"`
+	Link        string      `json:"link,omitempty"`
+	Date        string      `json:"date,omitempty"` // RFC 3339, если дату удалось разобрать, иначе как в ленте
+	Author      string      `json:"author,omitempty"`
+	Categories  []string    `json:"categories,omitempty"`
+	Comments    string      `json:"comments,omitempty"`
+	Description string      `json:"description,omitempty"` // Полный текст с --full-text, иначе описание из ленты
+	Summary     string      `json:"summary,omitempty"`     // Описание из ленты, если Description — полный текст
+	Enclosures  []Enclosure `json:"enclosures,omitempty"`
+	Image       *itemImage  `json:"image,omitempty"`
+	AlsoIn      []string    `json:"also_in,omitempty"`
+}
+
+// jsonFeed — лента в выводе --output=json.
+type jsonFeed struct {
+	URL      string     `json:"url"`
+	FinalURL string     `json:"final_url,omitempty"`
+	Title    string     `json:"title"`
+	Items    []jsonItem `json:"items"`
+}
+
+// jsonError — ошибка в выводе --output=json; Kind — "usage", "network" или "parse".
+type jsonError struct {
+	URL     string `json:"url,omitempty"`
+	Kind    string `json:"kind"`
+	Message string `json:"message"`
+}
+
+// jsonReport — весь вывод --output=json: ленты, ошибки и код выхода.
+type jsonReport struct {
+	Feeds    []jsonFeed  `json:"feeds"`
+	Errors   []jsonError `json:"errors"`
+	ExitCode int         `json:"exit_code"`
+}
+
+// newJSONFeed переводит выводимые статьи ленты в jsonFeed.
+func newJSONFeed(url string, rss *RSS, opts printOptions) jsonFeed {
+	feed := jsonFeed{URL: url, FinalURL: rss.FinalURL, Title: strings.TrimSpace(rss.Channel.Title), Items: []jsonItem{}}
+	for _, item := range visibleItems(rss.Channel.Items, opts) {
+		ji := jsonItem{
+			Title:       strings.TrimSpace(item.Title),
+			Link:        strings.TrimSpace(item.Link),
+			Date:        item.rawDate(),
+			Author:      item.Author,
+			Categories:  item.Categories,
+			Comments:    strings.TrimSpace(item.Comments),
+			Description: item.description(opts),
+			Enclosures:  item.Enclosures,
+			Image:       item.Image,
+			AlsoIn:      item.AlsoIn,
+		}
+		if !item.Published.IsZero() {
+			ji.Date = item.Published.Format(time.RFC3339)
+		}
+		if item.FullText != "" {
+			ji.Summary = cleanHTML(item.Description)
+		}
+		feed.Items = append(feed.Items, ji)
+	}
+	return feed
+}
+
+// writeJSONReport выводит отчёт --output=json одним документом.
+func writeJSONReport(w io.Writer, feeds []jsonFeed, errs []jsonError, code int) {
+	report := jsonReport{Feeds: feeds, Errors: errs, ExitCode: code}
+	if report.Feeds == nil {
+		report.Feeds = []jsonFeed{}
+	}
+	if report.Errors == nil {
+		report.Errors = []jsonError{}
+	}
+	data, _ := json.MarshalIndent(report, "", "  ")
+	w.Write(append(data, '\n'))
+}
+
+// Объединённая лента --output=rss (RSS 2.0).
+type (
+	rssDocument struct {
+		XMLName xml.Name   `xml:"rss"`
+		Version string     `xml:"version,attr"`
+		Channel rssOutFeed `xml:"channel"`
+	}
+	rssOutFeed struct {
+		Title         string       `xml:"title"`
+		Link          string       `xml:"link"`
+		Description   string       `xml:"description"`
+		LastBuildDate string       `xml:"lastBuildDate"`
+		Generator     string       `xml:"generator"`
+		Items         []rssOutItem `xml:"item"`
+	}
+	rssOutItem struct {
+		Title       string      `xml:"title,omitempty"`
+		Link        string      `xml:"link,omitempty"`
+		Description string      `xml:"description,omitempty"`
+		Creator     string      `xml:"http://purl.org/dc/elements/1.1/ creator,omitempty"`
+		Categories  []string    `xml:"category"`
+		Comments    string      `xml:"comments,omitempty"`
+		Enclosures  []Enclosure `xml:"enclosure"`
+		GUID        itemGUID    `xml:"guid"`
+		PubDate     string      `xml:"pubDate"`
+		Source      *itemSource `xml:"source"`
+	}
+)
+
+// channelInfo — заголовок, ссылка и описание объединённой ленты (--channel-title и др.).
+type channelInfo struct {
+	title, link, description string
+}
+
+// combineItem запоминает статью для объединённой ленты: у статьи без даты датой становится
+// время загрузки, чтобы программы чтения не переставляли её случайно (неразобранная дата
+// остаётся как в ленте), а без source источником записывается лента, из которой она загружена.
+func combineItem(item Item, feedURL, feedTitle string, fetched time.Time) Item {
+	if item.rawDate() == "" {
+		item.Published = fetched
+	}
+	if item.Source == nil {
+		item.Source = &itemSource{URL: feedURL, Title: strings.TrimSpace(feedTitle)}
+	}
+	return item
+}
+
+// writeCombinedRSS выводит статьи одной лентой RSS 2.0. guid (вместе с isPermaLink), ссылка
+// и дата статьи сохраняются, неразобранная дата — как в ленте; статье без guid им
+// становится её ключ учёта прочитанного (isPermaLink="false").
+// Название исходной ленты добавляется рубрикой.
+func writeCombinedRSS(w io.Writer, items []Item, ch channelInfo, now time.Time) error {
+	doc := rssDocument{Version: "2.0", Channel: rssOutFeed{
+		Title:         ch.title,
+		Link:          ch.link,
+		Description:   ch.description,
+		LastBuildDate: now.Format(time.RFC1123Z),
+		Generator:     "rssparser",
+	}}
+	for _, item := range items {
+		out := rssOutItem{
+			Title:       strings.TrimSpace(item.Title),
+			Link:        strings.TrimSpace(item.Link),
+			Description: strings.TrimSpace(item.Description),
+			Creator:     item.Author,
+			Categories:  slices.Clone(item.Categories),
+			Comments:    strings.TrimSpace(item.Comments),
+			Enclosures:  item.Enclosures,
+			GUID:        itemGUID{IsPermaLink: strings.TrimSpace(item.GUID.IsPermaLink), Value: strings.TrimSpace(item.GUID.Value)},
+			PubDate:     item.rawDate(),
+			Source:      item.Source,
+		}
+		if !item.Published.IsZero() {
+			out.PubDate = item.Published.Format(time.RFC1123Z)
+		}
+		if item.FullText != "" {
+			out.Description = item.FullText
+		}
+		if out.GUID.Value == "" {
+			out.GUID = itemGUID{IsPermaLink: "false", Value: item.key()}
+		}
+		if src := item.Source; src != nil && src.Title != "" && !slices.Contains(out.Categories, src.Title) {
+			out.Categories = append(out.Categories, src.Title)
+		}
+		doc.Channel.Items = append(doc.Channel.Items, out)
+	}
+	data, err := xml.MarshalIndent(doc, "", "  ")
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(append([]byte(xml.Header), append(data, '\n')...))
+	return err
+}
+
+// htmlHeader и htmlFooter обрамляют вывод --output=html, чтобы получилась отдельная страница.
+const (
+	htmlHeader = `<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>RSS</title>
+</head>
+<body>
+`
+	htmlFooter = "</body>\n</html>\n"
+)
+
+// writeHTMLFeed выводит ленту фрагментом HTML-страницы с той же структурой, что и Markdown.
+func writeHTMLFeed(w io.Writer, rss *RSS, opts printOptions) {
+	fmt.Fprintf(w, "<h2>%s</h2>\n<ul>\n", html.EscapeString(oneLine(rss.Channel.Title)))
+	for _, item := range visibleItems(rss.Channel.Items, opts) {
+		title := html.EscapeString(oneLine(item.Title))
+		if link := strings.TrimSpace(item.Link); link != "" {
+			title = fmt.Sprintf(`<a href="%s">%s</a>`, html.EscapeString(link), title)
+		}
+		fmt.Fprintf(w, "<li>%s", title)
+		if date := item.shownDate(opts); date != "" {
+			fmt.Fprintf(w, " — %s", html.EscapeString(date))
+		}
+		if len(item.AlsoIn) > 0 {
+			fmt.Fprintf(w, " (также в: %s)", html.EscapeString(strings.Join(item.AlsoIn, ", ")))
+		}
+		if item.Author != "" {
+			fmt.Fprintf(w, "\n<br>Автор: %s", html.EscapeString(item.Author))
+		}
+		if len(item.Categories) > 0 {
+			fmt.Fprintf(w, "\n<br>Рубрики: %s", html.EscapeString(strings.Join(item.Categories, ", ")))
+		}
+		if comments := strings.TrimSpace(item.Comments); comments != "" {
+			fmt.Fprintf(w, "\n<br><a href=\"%s\">Комментарии</a>", html.EscapeString(comments))
+		}
+		if img := item.Image; img != nil {
+			size := ""
+			if img.Width > 0 && img.Height > 0 {
+				size = fmt.Sprintf(` width="%d" height="%d"`, img.Width, img.Height)
+			}
+			fmt.Fprintf(w, "\n<br><img src=\"%s\"%s alt=\"\" loading=\"lazy\">", html.EscapeString(img.URL), size)
+		}
+		if opts.show.enclosure {
+			for _, enc := range item.Enclosures {
+				fmt.Fprintf(w, "\n<br>Вложение: <a href=\"%s\">%s</a>", html.EscapeString(enc.URL), html.EscapeString(path.Base(enc.URL)))
+			}
+		}
+		if opts.show.desc {
+			if desc := item.description(opts); desc != "" {
+				lines := strings.Split(desc, "\n")
+				for i, l := range lines {
+					lines[i] = html.EscapeString(l)
+				}
+				fmt.Fprintf(w, "\n<blockquote>%s</blockquote>", strings.Join(lines, "<br>\n"))
+			}
+		}
+		fmt.Fprintln(w, "</li>")
+	}
+	fmt.Fprintln(w, "</ul>")
+}
+
+// parseSize разбирает размер с необязательным суффиксом K/M/G/T (основание 1024).
+func parseSize(s string) (int64, error) {
+	str := strings.ToUpper(strings.TrimSpace(s))
+	str = strings.TrimSuffix(str, "B")
+	multiplier := int64(1)
+	if str != "" {
+		switch str[len(str)-1] {
+		case 'K':
+			multiplier = 1 << 10
+		case 'M':
+			multiplier = 1 << 20
+		case 'G':
+			multiplier = 1 << 30
+		case 'T':
+			multiplier = 1 << 40
+		}
+		if multiplier > 1 {
+			str = str[:len(str)-1]
+		}
+	}
+	value, err := strconv.ParseFloat(str, 64)
+	if err != nil || value < 0 {
+		return 0, fmt.Errorf("неверный размер %q (примеры: 512, 10K, 1.5M, 2G)", s)
+	}
+	return int64(value * float64(multiplier)), nil
+}
+
+// formatSize возвращает размер в удобочитаемом виде (KiB, MiB, ...).
+func formatSize(bytes int64) string {
+	const unit = 1024
+	if bytes < unit {
+		return fmt.Sprintf("%d B", bytes)
+	}
+	div, exp := int64(unit), 0
+	for n := bytes / unit; n >= unit; n /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %ciB", float64(bytes)/float64(div), "KMGTPE"[exp])
+}
+
+// downloadsFile — файл в директории загрузок: адрес вложения → имя загруженного файла.
+const downloadsFile = ".rssparser-downloads.json"
+
+// enclosureJob — вложение статьи, которое нужно загрузить.
+type enclosureJob struct {
+	title string
+	enc   Enclosure
+}
+
+// downloader загружает вложения в dir, не больше workers одновременно и не больше
+// budget байт за запуск (0 — без ограничения).
+type downloader struct {
+	ctx     context.Context
+	client  *http.Client
+	dir     string
+	workers int
+	budget  int64
+	header  http.Header // Заголовки запросов, как у лент
+
+	mu       sync.Mutex
+	files    map[string]string // Загруженные ранее: адрес → имя файла
+	reserved int64             // Байт, учтённых в budget
+	received int64             // Байт получено за запуск (atomic)
+}
+
+// newDownloader создаёт директорию загрузок и читает список уже загруженных файлов.
+func newDownloader(ctx context.Context, client *http.Client, header http.Header, dir string, workers int, budget int64) (*downloader, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, err
+	}
+	d := &downloader{ctx: ctx, client: client, header: header, dir: dir, workers: max(workers, 1), budget: budget, files: map[string]string{}}
+	data, err := ioutil.ReadFile(filepath.Join(dir, downloadsFile))
+	if err == nil {
+		err = json.Unmarshal(data, &d.files)
+	} else if os.IsNotExist(err) {
+		err = nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("ошибка чтения %s: %v", downloadsFile, err)
+	}
+	return d, nil
+}
+
+var unsafeNameChars = regexp.MustCompile(`[/\\:*?"<>|\x00-\x1f]+`)
+
+// imageType угадывает тип картинки по расширению адреса, чтобы у файла без расширения
+// в адресе было осмысленное имя; по умолчанию — image/jpeg.
+func imageType(imageURL string) string {
+	if u, err := url.Parse(imageURL); err == nil {
+		if t := mime.TypeByExtension(path.Ext(u.Path)); strings.HasPrefix(t, "image/") {
+			return t
+		}
+	}
+	return "image/jpeg"
+}
+
+// enclosureName возвращает имя файла для вложения: заголовок статьи без недопустимых
+// символов (не длиннее 100 символов) и расширение из адреса, а если его нет — по типу.
+func enclosureName(title string, enc Enclosure) string {
+	name := strings.Join(strings.Fields(unsafeNameChars.ReplaceAllString(title, " ")), " ")
+	name = strings.Trim(name, ". ")
+	if runes := []rune(name); len(runes) > 100 {
+		name = strings.TrimSpace(string(runes[:100]))
+	}
+	if name == "" {
+		name = "enclosure"
+	}
+	ext := ""
+	if u, err := url.Parse(enc.URL); err == nil {
+		ext = path.Ext(u.Path)
+	}
+	if len(ext) < 2 || len(ext) > 6 || strings.IndexFunc(ext[1:], func(r rune) bool { return !unicode.IsLetter(r) && !unicode.IsDigit(r) }) >= 0 {
+		ext = ".bin"
+		if exts, _ := mime.ExtensionsByType(enc.Type); len(exts) > 0 {
+			ext = exts[0]
+			// Для image/jpeg первым в списке может оказаться .jfif.
+			if slices.Contains(exts, ".jpg") {
+				ext = ".jpg"
+			}
+		}
+	}
+	return name + ext
+}
+
+// target выбирает файл для вложения. Вложение уже загружено, если оно есть в списке
+// загруженных или файл с таким именем совпадает по размеру; иначе к имени при
+// совпадении с чужим файлом добавляется номер.
+func (d *downloader) target(job enclosureJob) (name string, done bool) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if name, ok := d.files[job.enc.URL]; ok {
+		if _, err := os.Stat(filepath.Join(d.dir, name)); err == nil {
+			return name, true
+		}
+	}
+	base := enclosureName(job.title, job.enc)
+	ext := filepath.Ext(base)
+	for i := 1; ; i++ {
+		name = base
+		if i > 1 {
+			name = fmt.Sprintf("%s (%d)%s", strings.TrimSuffix(base, ext), i, ext)
+		}
+		info, err := os.Stat(filepath.Join(d.dir, name))
+		if err != nil {
+			return name, false
+		}
+		if job.enc.Length > 0 && info.Size() == job.enc.Length {
+			d.files[job.enc.URL] = name
+			return name, true
+		}
+	}
+}
+
+// reserve учитывает размер вложения в budget; false — лимит исчерпан.
+// Вложения без размера загружаются, пока лимит не достигнут.
+func (d *downloader) reserve(size int64) bool {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.budget > 0 && d.reserved+size > d.budget {
+		return false
+	}
+	if d.budget > 0 && size == 0 && atomic.LoadInt64(&d.received) >= d.budget {
+		return false
+	}
+	d.reserved += size
+	return true
+}
+
+// countingWriter считает записанные байты в общий счётчик прогресса.
+type countingWriter struct {
+	w     io.Writer
+	total *int64
+}
+
+func (c countingWriter) Write(p []byte) (int, error) {
+	n, err := c.w.Write(p)
+	atomic.AddInt64(c.total, int64(n))
+	return n, err
+}
+
+// fetch загружает вложение в name. Данные пишутся в name.part, и если такой файл
+// остался от прерванной загрузки, запрос продолжает его с помощью Range.
+func (d *downloader) fetch(job enclosureJob, name string) error {
+	final := filepath.Join(d.dir, name)
+	part := final + ".part"
+	var offset int64
+	if info, err := os.Stat(part); err == nil {
+		offset = info.Size()
+	}
+	req, err := http.NewRequestWithContext(d.ctx, "GET", job.enc.URL, nil)
+	if err != nil {
+		return err
+	}
+	req.Header = d.header.Clone()
+	if offset > 0 {
+		req.Header.Set("Range", fmt.Sprintf("bytes=%d-", offset))
+	}
+	resp, err := d.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	flags := os.O_CREATE | os.O_WRONLY
+	switch {
+	case resp.StatusCode == http.StatusPartialContent && offset > 0:
+		flags |= os.O_APPEND
+	case resp.StatusCode == http.StatusRequestedRangeNotSatisfiable && offset > 0 && (job.enc.Length == 0 || offset == job.enc.Length):
+		// Файл уже загружен целиком, осталось переименовать.
+		return os.Rename(part, final)
+	case resp.StatusCode == http.StatusOK:
+		// Сервер не поддерживает Range: загружаем заново.
+		flags |= os.O_TRUNC
+	default:
+		return fmt.Errorf("статус: %d", resp.StatusCode)
+	}
+	f, err := os.OpenFile(part, flags, 0o644)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(countingWriter{f, &d.received}, resp.Body); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	return os.Rename(part, final)
+}
+
+// run загружает вложения и возвращает число неудачных загрузок; ошибка одной загрузки
+// не прерывает остальные. Если stderr — терминал, там обновляется строка прогресса.
+func (d *downloader) run(jobs []enclosureJob) int {
+	if len(jobs) == 0 {
+		return 0
+	}
+	var failed, finished int64
+	info, _ := os.Stderr.Stat()
+	tty := info != nil && info.Mode()&os.ModeCharDevice != 0
+	var logMu sync.Mutex
+	logf := func(format string, args ...interface{}) {
+		logMu.Lock()
+		defer logMu.Unlock()
+		if tty {
+			fmt.Fprint(os.Stderr, "\r\033[K")
+		}
+		fmt.Fprintf(os.Stderr, format+"\n", args...)
+	}
+	start := atomic.LoadInt64(&d.received)
+	stop := make(chan struct{})
+	var progress sync.WaitGroup
+	if tty {
+		progress.Add(1)
+		go func() {
+			defer progress.Done()
+			ticker := time.NewTicker(500 * time.Millisecond)
+			defer ticker.Stop()
+			for {
+				select {
+				case <-ticker.C:
+					logMu.Lock()
+					fmt.Fprintf(os.Stderr, "\r\033[KЗагрузка вложений: %d из %d, получено %s", atomic.LoadInt64(&finished), len(jobs), formatSize(atomic.LoadInt64(&d.received)-start))
+					logMu.Unlock()
+				case <-stop:
+					return
+				}
+			}
+		}()
+	}
+
+	work := make(chan enclosureJob)
+	var wg sync.WaitGroup
+	for w := 0; w < min(d.workers, len(jobs)); w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for job := range work {
+				name, done := d.target(job)
+				switch {
+				case done:
+					logf("Уже загружено: %s", name)
+				case !d.reserve(job.enc.Length):
+					logf("Пропущено (--limit-bytes): %s", name)
+				default:
+					if err := d.fetch(job, name); err != nil {
+						atomic.AddInt64(&failed, 1)
+						logf("Ошибка загрузки %s: %v", job.enc.URL, err)
+					} else {
+						d.mu.Lock()
+						d.files[job.enc.URL] = name
+						d.mu.Unlock()
+						logf("Загружено: %s", filepath.Join(d.dir, name))
+					}
+				}
+				atomic.AddInt64(&finished, 1)
+			}
+		}()
+	}
+	for _, job := range jobs {
+		if d.ctx.Err() != nil {
+			break
+		}
+		work <- job
+	}
+	close(work)
+	wg.Wait()
+	close(stop)
+	progress.Wait()
+
+	d.mu.Lock()
+	data, err := json.MarshalIndent(d.files, "", "  ")
+	d.mu.Unlock()
+	if err == nil {
+		err = writeFileAtomic(filepath.Join(d.dir, downloadsFile), data)
+	}
+	if err != nil {
+		logf("Ошибка записи %s: %v", downloadsFile, err)
+	}
+	return int(failed)
+}
+
+// normalizeLink приводит ссылку к виду для сравнения статей из разных лент: без схемы
+// (зеркала часто отличаются http/https), с хостом в нижнем регистре и без порта по умолчанию,
+// без фрагмента, завершающего "/" и параметров utm_*, с отсортированными параметрами.
+// Ссылка, которую не удалось разобрать, возвращается без изменений.
+func normalizeLink(link string) string {
+	link = strings.TrimSpace(link)
+	u, err := url.Parse(link)
+	if err != nil || u.Host == "" {
+		return link
+	}
+	host := strings.ToLower(u.Host)
+	host = strings.TrimSuffix(host, map[string]string{"http": ":80", "https": ":443"}[strings.ToLower(u.Scheme)])
+	query := u.Query()
+	for name := range query {
+		if strings.HasPrefix(strings.ToLower(name), "utm_") {
+			query.Del(name)
+		}
+	}
+	key := host + strings.TrimRight(u.EscapedPath(), "/")
+	if len(query) > 0 {
+		key += "?" + query.Encode()
+	}
+	return key
+}
+
+// dedupeItems убирает повторы статей во всех лентах results: статьи совпадают по guid
+// (или Atom id) либо по нормализованной ссылке. Остаётся вариант с самой ранней датой
+// публикации (без даты — первый встретившийся), а в его AlsoIn записываются другие ленты.
+func dedupeItems(results []feedResult) {
+	type ref struct{ feed, item int }
+	var groups [][]ref
+	byKey := map[string]int{}
+	for fi, res := range results {
+		if res.Err != nil {
+			continue
+		}
+		for ii, item := range res.Feed.Channel.Items {
+			var keys []string
+			for _, id := range []string{item.GUID.Value, item.ID} {
+				if id = strings.TrimSpace(id); id != "" {
+					keys = append(keys, "id:"+id)
+				}
+			}
+			if link := strings.TrimSpace(item.Link); link != "" {
+				keys = append(keys, "link:"+normalizeLink(link))
+			}
+			group := -1
+			for _, k := range keys {
+				if g, ok := byKey[k]; ok {
+					group = g
+					break
+				}
+			}
+			if group < 0 {
+				group = len(groups)
+				groups = append(groups, nil)
+			}
+			groups[group] = append(groups[group], ref{fi, ii})
+			for _, k := range keys {
+				byKey[k] = group
+			}
+		}
+	}
+
+	drop := map[ref]bool{}
+	for _, group := range groups {
+		if len(group) < 2 {
+			continue
+		}
+		best := group[0]
+		for _, r := range group[1:] {
+			a := results[best.feed].Feed.Channel.Items[best.item].Published
+			b := results[r.feed].Feed.Channel.Items[r.item].Published
+			if !b.IsZero() && (a.IsZero() || b.Before(a)) {
+				best = r
+			}
+		}
+		kept := &results[best.feed].Feed.Channel.Items[best.item]
+		for _, r := range group {
+			if r == best {
+				continue
+			}
+			drop[r] = true
+			title := results[r.feed].Feed.Channel.Title
+			if r.feed != best.feed && !slices.Contains(kept.AlsoIn, title) {
+				kept.AlsoIn = append(kept.AlsoIn, title)
+			}
+		}
+	}
+	for fi, res := range results {
+		if res.Err != nil {
+			continue
+		}
+		var items []Item
+		for ii, item := range res.Feed.Channel.Items {
+			if !drop[ref{fi, ii}] {
+				items = append(items, item)
+			}
+		}
+		res.Feed.Channel.Items = items
+	}
+}
+
+// namedFeed — лента в файле конфигурации.
+type namedFeed struct {
+	Name    string   `json:"name"`
+	URL     string   `json:"url"`
+	Match   []string `json:"match,omitempty"`   // Как --match, только для этой ленты
+	Exclude []string `json:"exclude,omitempty"` // Как --exclude, только для этой ленты
+	Limit   int      `json:"limit,omitempty"`   // Как --limit, только для этой ленты
+}
+
+// feedConfig — файл конфигурации со списком именованных лент.
+type feedConfig struct {
+	Feeds []namedFeed `json:"feeds"`
+}
+
+// feedOverride — настройки ленты из конфигурации, действующие вместе с общими флагами.
+type feedOverride struct {
+	filter itemFilter
+	limit  int
+}
+
+// defaultConfigPath возвращает путь к конфигурации по умолчанию (~/.config/rssparser/feeds.json в Linux).
+func defaultConfigPath() string {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(dir, "rssparser", "feeds.json")
+}
+
+// loadConfig читает конфигурацию; отсутствующий файл означает пустой список лент.
+func loadConfig(path string) (*feedConfig, error) {
+	cfg := &feedConfig{}
+	data, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return cfg, nil
+	} else if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(data, cfg); err != nil {
+		return nil, fmt.Errorf("ошибка разбора %s: %v", path, err)
+	}
+	return cfg, nil
+}
+
+// save атомарно записывает конфигурацию, создавая директорию при необходимости.
+func (cfg *feedConfig) save(path string) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return err
+	}
+	data, err := json.MarshalIndent(cfg, "", "  ")
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(path, append(data, '\n'))
+}
+
+// find возвращает ленту по имени или nil.
+func (cfg *feedConfig) find(name string) *namedFeed {
+	for i := range cfg.Feeds {
+		if cfg.Feeds[i].Name == name {
+			return &cfg.Feeds[i]
+		}
+	}
+	return nil
+}
+
+// names возвращает имена лент через запятую для сообщений об ошибках.
+func (cfg *feedConfig) names() string {
+	if len(cfg.Feeds) == 0 {
+		return "(список пуст, добавьте ленту: rssparser add-feed <имя> <URL>)"
+	}
+	names := make([]string, len(cfg.Feeds))
+	for i, feed := range cfg.Feeds {
+		names[i] = feed.Name
+	}
+	return strings.Join(names, ", ")
+}
+
+// isFeedURL отличает адрес ленты от имени из конфигурации.
+func isFeedURL(arg string) bool {
+	return strings.Contains(arg, "://")
+}
+
+// runFeedCommand выполняет подкоманды add-feed и remove-feed, изменяющие конфигурацию.
+func runFeedCommand(command string, args []string) {
+	fs := flag.NewFlagSet(command, flag.ContinueOnError)
+	configPath := fs.String("config", defaultConfigPath(), "файл конфигурации с именованными лентами")
+	args = parseArgs(fs, args)
+	if *configPath == "" {
+		fmt.Fprintln(os.Stderr, "Не удалось определить путь к конфигурации, укажите --config.")
+		os.Exit(exitUsage)
+	}
+	cfg, err := loadConfig(*configPath)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Ошибка чтения конфигурации: %v\n", err)
+		os.Exit(exitUsage)
+	}
+	switch command {
+	case "add-feed":
+		if len(args) != 2 {
+			fmt.Fprintln(os.Stderr, "Использование: rssparser add-feed <имя> <URL> [--config=FILE]")
+			os.Exit(exitUsage)
+		}
+		name, feedURL := args[0], args[1]
+		if name == "" || isFeedURL(name) || strings.ContainsAny(name, " \t") || strings.HasPrefix(name, "-") {
+			fmt.Fprintf(os.Stderr, "Недопустимое имя ленты %q: имя не должно содержать пробелов и \"://\".\n", name)
+			os.Exit(exitUsage)
+		}
+		if u, err := url.Parse(feedURL); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			fmt.Fprintf(os.Stderr, "Неверный адрес ленты %q.\n", feedURL)
+			os.Exit(exitUsage)
+		}
+		if cfg.find(name) != nil {
+			fmt.Fprintf(os.Stderr, "Лента %q уже есть в конфигурации.\n", name)
+			os.Exit(exitUsage)
+		}
+		cfg.Feeds = append(cfg.Feeds, namedFeed{Name: name, URL: feedURL})
+	case "remove-feed":
+		if len(args) != 1 {
+			fmt.Fprintln(os.Stderr, "Использование: rssparser remove-feed <имя> [--config=FILE]")
+			os.Exit(exitUsage)
+		}
+		if cfg.find(args[0]) == nil {
+			fmt.Fprintf(os.Stderr, "Лента %q не найдена. Доступные ленты: %s\n", args[0], cfg.names())
+			os.Exit(exitUsage)
+		}
+		cfg.Feeds = slices.DeleteFunc(cfg.Feeds, func(feed namedFeed) bool { return feed.Name == args[0] })
+	}
+	if err := cfg.save(*configPath); err != nil {
+		fmt.Fprintf(os.Stderr, "Ошибка записи конфигурации: %v\n", err)
+		os.Exit(exitUsage)
+	}
+	if command == "add-feed" {
+		fmt.Printf("Лента %q добавлена в %s\n", args[0], *configPath)
+	} else {
+		fmt.Printf("Лента %q удалена из %s\n", args[0], *configPath)
+	}
+}
+
+// linkOpener открывает ссылки статей внешней программой (--interactive, --open).
+type linkOpener struct {
+	command []string                                // Программа и её аргументы; ссылка добавляется последней
+	run     func(name string, args ...string) error // Запуск программы; подменяется при проверке
+}
+
+// newLinkOpener разбирает --opener или, если он пуст, ищет программу открытия ссылок
+// платформы: termux-open-url (Termux), xdg-open, open (macOS).
+func newLinkOpener(command string) (*linkOpener, error) {
+	o := &linkOpener{command: strings.Fields(command), run: func(name string, args ...string) error {
+		cmd := exec.Command(name, args...)
+		cmd.Stdout, cmd.Stderr = os.Stderr, os.Stderr
+		return cmd.Run()
+	}}
+	if len(o.command) > 0 {
+		return o, nil
+	}
+	if runtime.GOOS == "windows" {
+		o.command = []string{"rundll32", "url.dll,FileProtocolHandler"}
+		return o, nil
+	}
+	for _, name := range []string{"termux-open-url", "xdg-open", "open"} {
+		if _, err := exec.LookPath(name); err == nil {
+			o.command = []string{name}
+			return o, nil
+		}
+	}
+	return nil, errors.New("не найдена программа для открытия ссылок (termux-open-url, xdg-open, open), укажите --opener")
+}
+
+// open открывает ссылку статьи.
+func (o *linkOpener) open(item Item) error {
+	link := strings.TrimSpace(item.Link)
+	if link == "" {
+		return fmt.Errorf("у статьи %q нет ссылки", item.Title)
+	}
+	args := append(slices.Clone(o.command[1:]), link)
+	if err := o.run(o.command[0], args...); err != nil {
+		return fmt.Errorf("не удалось открыть %s: %v", link, err)
+	}
+	return nil
+}
+
+// parseSelection разбирает номера статей через пробел или запятую и диапазоны ("1 3 5-7").
+// Возвращает индексы с нуля без повторов; номера вне 1..n и статьи без ссылки — ошибка.
+func parseSelection(s string, items []Item) ([]int, error) {
+	var picked []int
+	for _, part := range strings.FieldsFunc(s, func(r rune) bool { return r == ',' || unicode.IsSpace(r) }) {
+		lo, hi, isRange := strings.Cut(part, "-")
+		from, err := strconv.Atoi(lo)
+		to := from
+		if err == nil && isRange {
+			to, err = strconv.Atoi(hi)
+		}
+		if err != nil || from < 1 || to < from || to > len(items) {
+			return nil, fmt.Errorf("неверный номер %q: допустимы номера от 1 до %d", part, len(items))
+		}
+		for n := from; n <= to; n++ {
+			if strings.TrimSpace(items[n-1].Link) == "" {
+				return nil, fmt.Errorf("у статьи %d нет ссылки", n)
+			}
+			if !slices.Contains(picked, n-1) {
+				picked = append(picked, n-1)
+			}
+		}
+	}
+	return picked, nil
+}
+
+// interactive читает номера статей из in и открывает выбранные, пока не встретит
+// конец ввода или "q". При неверном выборе запрос повторяется.
+func interactive(in io.Reader, items []Item, o *linkOpener) {
+	sc := bufio.NewScanner(in)
+	for {
+		fmt.Fprint(os.Stderr, "Открыть статьи (номера или диапазоны, например 1 3 5-7; q — выход): ")
+		if !sc.Scan() {
+			fmt.Fprintln(os.Stderr)
+			return
+		}
+		line := strings.TrimSpace(sc.Text())
+		if line == "q" {
+			return
+		}
+		picked, err := parseSelection(line, items)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			continue
+		}
+		for _, i := range picked {
+			if err := o.open(items[i]); err != nil {
+				fmt.Fprintln(os.Stderr, err)
+			}
+		}
+	}
+}
+
+// lintProblem — замечание validate к ленте.
+type lintProblem struct {
+	Severity string `json:"severity"`       // "error" или "warning"
+	Rule     string `json:"rule"`           // Код правила, например "guid-duplicate"
+	Item     int    `json:"item,omitempty"` // Номер статьи с 1; 0 — замечание к ленте целиком
+	Message  string `json:"message"`
+}
+
+// lintFeed — лента для validate: в отличие от RSS сохраняет корневой элемент и все ссылки канала.
+type lintFeed struct {
+	XMLName xml.Name
+	Channel *struct {
+		Title string   `xml:"title"`
+		Links []string `xml:"link"`
+		Items []Item   `xml:"item"`
+	} `xml:"channel"`
+}
+
+// lintRSS проверяет ленту в data и возвращает замечания: ошибки — нарушения RSS 2.0, из-за
+// которых ленту читают неверно, предупреждения — то, что мешает программам чтения
+// (нет guid, относительные ссылки, даты в будущем).
+func lintRSS(data []byte, contentType string, now time.Time) []lintProblem {
+	var problems []lintProblem
+	report := func(severity, rule string, item int, format string, args ...any) {
+		problems = append(problems, lintProblem{Severity: severity, Rule: rule, Item: item, Message: fmt.Sprintf(format, args...)})
+	}
+	text, err := toUTF8(data, contentType, true)
+	if err != nil {
+		report("error", "encoding", 0, "%v", err)
+		return problems
+	}
+	var feed lintFeed
+	dec := xml.NewDecoder(bytes.NewReader(text))
+	dec.CharsetReader = func(_ string, r io.Reader) (io.Reader, error) { return r, nil }
+	if err := dec.Decode(&feed); err != nil {
+		line, column := dec.InputPos()
+		report("error", "xml", 0, "строка %d, позиция %d: %v", line, column, err)
+		return problems
+	}
+	switch {
+	case feed.XMLName.Local == "feed":
+		report("error", "root", 0, "лента в формате Atom, проверяется только RSS")
+		return problems
+	case feed.XMLName.Local != "rss":
+		report("error", "root", 0, "корневой элемент <%s>, ожидается <rss>", feed.XMLName.Local)
+		return problems
+	case feed.Channel == nil:
+		report("error", "channel", 0, "нет элемента <channel>")
+		return problems
+	}
+	ch := feed.Channel
+	if strings.TrimSpace(ch.Title) == "" {
+		report("error", "channel-title", 0, "у канала нет заголовка (title)")
+	}
+	if !slices.ContainsFunc(ch.Links, func(l string) bool { return strings.TrimSpace(l) != "" }) {
+		report("error", "channel-link", 0, "у канала нет ссылки на сайт (link)")
+	}
+	guids := map[string]int{}
+	for i, item := range ch.Items {
+		n := i + 1
+		if strings.TrimSpace(item.Title) == "" && strings.TrimSpace(item.Description) == "" {
+			report("error", "item-content", n, "нет ни заголовка, ни описания")
+		}
+		if guid := strings.TrimSpace(item.GUID.Value); guid == "" {
+			report("warning", "item-guid", n, "нет guid: программы чтения будут различать статьи по ссылке")
+		} else if first, ok := guids[guid]; ok {
+			report("error", "guid-duplicate", n, "guid %q уже есть у статьи %d", guid, first)
+		} else {
+			guids[guid] = n
+			// По умолчанию isPermaLink="true": guid, который не адрес, нужно пометить явно.
+			if u, err := url.Parse(guid); !strings.EqualFold(strings.TrimSpace(item.GUID.IsPermaLink), "false") &&
+				(err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "") {
+				report("warning", "guid-permalink", n, "guid %q не адрес статьи, но у него нет isPermaLink=\"false\"", guid)
+			}
+		}
+		if raw := item.rawDate(); raw != "" {
+			if t, err := parseDate(raw); err != nil {
+				report("error", "pubdate-invalid", n, "%v", err)
+			} else if t.After(now) {
+				report("warning", "pubdate-future", n, "дата %q в будущем", raw)
+			}
+		}
+		if link := strings.TrimSpace(item.Link); link != "" {
+			if u, err := url.Parse(link); err != nil || !u.IsAbs() || u.Host == "" {
+				report("warning", "link-relative", n, "ссылка %q не абсолютная", link)
+			}
+		}
+	}
+	return problems
+}
+
+// runValidate выполняет подкоманду validate: проверяет ленту по адресу или из файла и выводит
+// по замечанию на строку и итог (или JSON с --output=json). Код выхода: 0 — замечаний нет,
+// 1 — только предупреждения, 2 — есть ошибки (в том числе если ленту не удалось получить).
+func runValidate(args []string) {
+	const lintClean, lintWarnings, lintErrors = 0, 1, 2
+	fs := flag.NewFlagSet("validate", flag.ContinueOnError)
+	format := fs.String("output", "text", "формат вывода: text или json")
+	timeout := fs.Duration("timeout", 15*time.Second, "тайм-аут запроса ленты")
+	args = parseArgs(fs, args)
+	if len(args) != 1 || (*format != "text" && *format != "json") {
+		fmt.Fprintln(os.Stderr, "Использование: rssparser validate <URL или файл> [--output=text|json] [--timeout=15s]")
+		os.Exit(lintErrors)
+	}
+	source := args[0]
+
+	var data []byte
+	var contentType string
+	var problems []lintProblem
+	if isFeedURL(source) {
+		transport, err := newTransport("", false)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(lintErrors)
+		}
+		client := &http.Client{Timeout: *timeout, Transport: transport, CheckRedirect: redirectPolicy(10)}
+		f := &fetcher{ctx: context.Background(), client: client}
+		resp, err := f.do(source, f.newHeader())
+		if err == nil {
+			defer resp.Body.Close()
+			contentType = resp.Header.Get("Content-Type")
+			if resp.StatusCode != http.StatusOK {
+				err = fmt.Errorf("статус: %d", resp.StatusCode)
+			} else {
+				data, err = ioutil.ReadAll(resp.Body)
+			}
+		}
+		if err != nil {
+			problems = append(problems, lintProblem{Severity: "error", Rule: "fetch", Message: fmt.Sprintf("не удалось получить ленту: %v", err)})
+		}
+	} else {
+		var err error
+		if data, err = ioutil.ReadFile(source); err != nil {
+			problems = append(problems, lintProblem{Severity: "error", Rule: "fetch", Message: fmt.Sprintf("не удалось прочитать файл: %v", err)})
+		}
+	}
+	if len(problems) == 0 {
+		problems = lintRSS(data, contentType, time.Now())
+	}
+
+	errorCount, warningCount := 0, 0
+	for _, p := range problems {
+		if p.Severity == "error" {
+			errorCount++
+		} else {
+			warningCount++
+		}
+	}
+	if *format == "json" {
+		report := struct {
+			Source   string        `json:"source"`
+			Errors   int           `json:"errors"`
+			Warnings int           `json:"warnings"`
+			Problems []lintProblem `json:"problems"`
+		}{source, errorCount, warningCount, problems}
+		if report.Problems == nil {
+			report.Problems = []lintProblem{}
+		}
+		data, _ := json.MarshalIndent(report, "", "  ")
+		fmt.Println(string(data))
+	} else {
+		severities := map[string]string{"error": "ошибка", "warning": "предупреждение"}
+		for _, p := range problems {
+			where := ""
+			if p.Item > 0 {
+				where = fmt.Sprintf("статья %d: ", p.Item)
+			}
+			fmt.Printf("%s: %s [%s] %s%s\n", source, severities[p.Severity], p.Rule, where, p.Message)
+		}
+		fmt.Printf("Ошибок: %d, предупреждений: %d\n", errorCount, warningCount)
+	}
+	switch {
+	case errorCount > 0:
+		os.Exit(lintErrors)
+	case warningCount > 0:
+		os.Exit(lintWarnings)
+	}
+	os.Exit(lintClean)
+}
+
+// runner обрабатывает загруженные ленты: разбор дат, учёт прочитанного, фильтры и вывод.
+type runner struct {
+	opts        printOptions
+	out         *bufio.Writer // Куда выводятся ленты (stdout или файл --out)
+	filter      itemFilter
+	dates       dateRange // --since, --until и --keep-undated
+	sortOrder   string
+	strictDates bool
+	seen        *seenState // nil — без учёта прочитанного
+	markRead    bool       // Только отметить статьи прочитанными
+	timestamps  bool       // Предварять вывод ленты временем (режим --watch)
+	verbose     bool       // Сообщать о перенаправлениях лент
+	shown       int        // Сколько лент уже выведено
+	items       int        // Сколько статей выведено во всех лентах
+	jsonFeeds   []jsonFeed // Ленты для --output=json, выводятся одним документом в конце
+	combined    []Item     // Статьи для --output=rss, выводятся одной лентой в конце
+	channelLink string     // Ссылка первой ленты — по умолчанию ссылка объединённой ленты
+
+	execScript  string // Скрипт sh для каждой новой статьи (--exec, см. compileExec), пустой — не запускать
+	execLeft    int    // Сколько команд ещё можно запустить (--exec-limit)
+	execSkipped int    // Сколько команд не запущено из-за --exec-limit
+
+	perFeed map[string]feedOverride // Настройки лент из конфигурации по адресу
+
+	fullText *articleFetcher // Загрузка полного текста статей (--full-text), nil — не загружать
+
+	collectListed bool   // Запоминать выведенные статьи для --interactive и --open
+	listed        []Item // Выведенные статьи в порядке сквозной нумерации
+
+	collectEnclosures bool           // Собирать вложения выведенных статей для загрузки
+	collectImages     bool           // Собирать картинки выведенных статей для загрузки (--download-images)
+	enclosures        []enclosureJob // Собранные вложения
+}
+
+// execPlaceholders — подстановки --exec в порядке позиционных параметров sh: {title} — ${1}, {link} — ${2} и т. д.
+var execPlaceholders = []string{"{title}", "{link}", "{feed}", "{date}"}
+
+// compileExec превращает шаблон --exec в скрипт для sh -c, где каждая подстановка из names
+// заменена ссылкой на позиционный параметр. Сами значения передаются отдельными аргументами
+// и оболочкой не разбираются, поэтому $(...), кавычки и переводы строк в заголовке не
+// исполняются ни вне кавычек, ни внутри двойных. Вне кавычек ссылка берётся в двойные кавычки,
+// чтобы значение осталось одним словом; внутри одинарных кавычек подставить нельзя — это ошибка.
+func compileExec(tmpl string, names []string) (string, error) {
+	var b strings.Builder
+	var quote byte // Открытая кавычка: 0, '\'' или '"'
+	for i := 0; i < len(tmpl); {
+		if tmpl[i] == '{' {
+			if n := slices.IndexFunc(names, func(name string) bool { return strings.HasPrefix(tmpl[i:], name) }); n >= 0 {
+				ref := fmt.Sprintf("${%d}", n+1)
+				switch quote {
+				case '\'':
+					return "", fmt.Errorf("подстановка %s внутри одинарных кавычек не сработает, уберите кавычки или замените их двойными", names[n])
+				case 0:
+					ref = `"` + ref + `"`
+				}
+				b.WriteString(ref)
+				i += len(names[n])
+				continue
+			}
+		}
+		switch c := tmpl[i]; {
+		case c == '\\' && quote != '\'' && i+1 < len(tmpl):
+			// Экранированный символ переносится как есть вместе с обратной косой чертой.
+			b.WriteString(tmpl[i : i+2])
+			i += 2
+			continue
+		case (c == '\'' || c == '"') && quote == 0:
+			quote = c
+		case c == quote:
+			quote = 0
+		}
+		b.WriteByte(tmpl[i])
+		i++
+	}
+	return b.String(), nil
+}
+
+// runExec запускает команду --exec для статьи через sh -c: скрипт собран compileExec,
+// а заголовок, ссылка, лента и дата передаются позиционными параметрами, а не текстом скрипта.
+// Ошибка команды только выводится: статья всё равно считается прочитанной, иначе
+// неработающая команда повторялась бы для тех же статей при каждом запуске.
+func (r *runner) runExec(feed string, item Item) {
+	if r.execLeft <= 0 {
+		r.execSkipped++
+		return
+	}
+	r.execLeft--
+	// Вывод команды не должен обгонять уже выведенные статьи.
+	r.out.Flush()
+	// Первый аргумент после скрипта становится $0, значения — ${1}…${4} по execPlaceholders.
+	run := exec.Command("sh", "-c", r.execScript, "rssparser", item.Title, strings.TrimSpace(item.Link), feed, item.displayDate())
+	run.Stdout, run.Stderr = os.Stdout, os.Stderr
+	if err := run.Run(); err != nil {
+		fmt.Fprintf(os.Stderr, "Команда для статьи %q завершилась с ошибкой: %v\n", item.Title, err)
+	}
+}
+
+// handle обрабатывает результат загрузки ленты и выводит её статьи. Возвращает ошибку
+// загрузки или разбора дат; с учётом прочитанного лента без новых статей не выводится.
+func (r *runner) handle(res feedResult, now time.Time) error {
+	if res.Err == nil {
+		res.Err = parseDates(res.Feed, r.strictDates)
+	}
+	if res.Err != nil {
+		return res.Err
+	}
+	if r.verbose && res.Feed.FinalURL != "" {
+		kind := "временно"
+		if res.Feed.Moved {
+			kind = "постоянно"
+		}
+		fmt.Fprintf(os.Stderr, "Лента %s перенаправлена (%s) на %s\n", res.URL, kind, res.Feed.FinalURL)
+	}
+	sortItems(res.Feed.Channel.Items, r.sortOrder)
+	items := res.Feed.Channel.Items
+	// Настройки ленты из конфигурации: свой --limit и дополнительные фильтры.
+	opts, override := r.opts, r.perFeed[res.URL]
+	if override.limit > 0 {
+		opts.limit = override.limit
+	}
+	if r.seen != nil {
+		fresh := r.seen.unseen(res.URL, items)
+		r.seen.mark(res.URL, fresh, items, now)
+		if r.markRead {
+			return nil
+		}
+		if items = fresh; len(items) == 0 {
+			return nil
+		}
+	}
+	var dropped, droppedByFeed int
+	items, dropped = r.filter.apply(items)
+	items, droppedByFeed = override.filter.apply(items)
+	dropped += droppedByFeed
+	var outOfRange, undated int
+	items, outOfRange, undated = r.dates.apply(items, now)
+	if r.seen != nil && opts.limit > 0 && len(items) > opts.limit {
+		// Не выведенные из-за --limit статьи останутся новыми до следующего запуска.
+		r.seen.unmark(res.URL, items[opts.limit:])
+	}
+	if r.seen != nil && len(items) == 0 {
+		return nil
+	}
+	res.Feed.Channel.Items = items
+	if r.fullText != nil {
+		r.fullText.fill(visibleItems(items, opts))
+	}
+	if r.collectListed {
+		opts.first = len(r.listed)
+		r.listed = append(r.listed, visibleItems(items, opts)...)
+	}
+	switch opts.format {
+	case "md":
+		if r.shown > 0 {
+			fmt.Fprintln(r.out)
+		}
+		writeMarkdownFeed(r.out, res.Feed, opts)
+	case "html":
+		writeHTMLFeed(r.out, res.Feed, opts)
+	case "json":
+		r.jsonFeeds = append(r.jsonFeeds, newJSONFeed(res.URL, res.Feed, opts))
+	case "rss":
+		for _, item := range visibleItems(items, opts) {
+			r.combined = append(r.combined, combineItem(item, res.URL, res.Feed.Channel.Title, now))
+		}
+		if r.channelLink == "" {
+			r.channelLink = res.Feed.Channel.link()
+		}
+	default:
+		if r.shown > 0 {
+			fmt.Fprintln(r.out)
+		}
+		if r.timestamps {
+			fmt.Fprintf(r.out, "[%s] ", now.Format("2006-01-02 15:04:05"))
+		}
+		printFeed(r.out, res.Feed, opts)
+	}
+	r.shown++
+	r.items += len(visibleItems(items, opts))
+	if r.filter.active() || override.filter.active() {
+		// В Markdown и HTML сводка не входит в документ.
+		summary := io.Writer(r.out)
+		if opts.format != "text" {
+			summary = os.Stderr
+		}
+		fmt.Fprintf(summary, "Отфильтровано статей: %d из %d\n", dropped, dropped+outOfRange+len(items))
+	}
+	if r.dates.active() && (outOfRange > 0 || undated > 0) {
+		summary := io.Writer(r.out)
+		if opts.format != "text" {
+			summary = os.Stderr
+		}
+		fmt.Fprintf(summary, "Вне диапазона дат: %d из %d\n", outOfRange, outOfRange+len(items))
+		if undated > 0 && r.dates.keepUndated {
+			fmt.Fprintf(summary, "Статей без даты: %d, оставлены (--keep-undated)\n", undated)
+		} else if undated > 0 {
+			fmt.Fprintf(summary, "Статей без даты: %d, отброшены (оставить: --keep-undated)\n", undated)
+		}
+	}
+	if r.execScript != "" {
+		for _, item := range visibleItems(items, opts) {
+			r.runExec(res.Feed.Channel.Title, item)
+		}
+	}
+	if r.collectEnclosures || r.collectImages {
+		for _, item := range visibleItems(items, opts) {
+			for _, enc := range item.Enclosures {
+				if r.collectEnclosures && strings.TrimSpace(enc.URL) != "" {
+					r.enclosures = append(r.enclosures, enclosureJob{title: item.Title, enc: enc})
+				}
+			}
+			// Картинка-вложение уже загружена вместе с вложениями.
+			if img := item.Image; r.collectImages && img != nil &&
+				!(r.collectEnclosures && slices.ContainsFunc(item.Enclosures, func(e Enclosure) bool { return e.URL == img.URL })) {
+				r.enclosures = append(r.enclosures, enclosureJob{title: item.Title, enc: Enclosure{URL: img.URL, Type: imageType(img.URL)}})
+			}
+		}
+	}
+	return nil
+}
+
+// reportSkipped сообщает, сколько команд --exec не запущено из-за --exec-limit.
+func (r *runner) reportSkipped() {
+	if r.execSkipped > 0 {
+		fmt.Fprintf(os.Stderr, "Не запущено команд из-за --exec-limit: %d\n", r.execSkipped)
+	}
+}
+
+// watch опрашивает каждую ленту раз в interval, пока ctx не отменён, и выводит новые статьи.
+// Первый опрос и паузы сдвигаются на случайную долю интервала (до 10%), чтобы ленты
+// не загружались одновременно; одновременно загружается не больше workers лент.
+// Ошибки лент выводятся, но опрос продолжается. Состояние прочитанного сохраняется
+// после каждого опроса; r и состояние защищены общим мьютексом.
+func watch(ctx context.Context, r *runner, f *fetcher, d *downloader, urls []string, interval time.Duration, workers int) {
+	execLimit := r.execLeft
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	slots := make(chan struct{}, max(workers, 1))
+	jitter := func() time.Duration { return time.Duration(rand.Int63n(int64(interval/10) + 1)) }
+	for _, u := range urls {
+		wg.Add(1)
+		go func(u string) {
+			defer wg.Done()
+			delay := jitter()
+			for {
+				select {
+				case <-time.After(delay):
+				case <-ctx.Done():
+					return
+				}
+				slots <- struct{}{}
+				feed, err := f.fetchFeed(u)
+				<-slots
+				if ctx.Err() != nil {
+					return
+				}
+				mu.Lock()
+				// В режиме наблюдения --exec-limit действует на каждый опрос ленты.
+				r.execLeft, r.execSkipped = execLimit, 0
+				now := time.Now()
+				if err := r.handle(feedResult{URL: u, Feed: feed, Err: err}, now); err != nil {
+					fmt.Fprintf(os.Stderr, "[%s] Ошибка ленты %s: %v\n", now.Format("2006-01-02 15:04:05"), u, err)
+				} else if err := r.seen.save(); err != nil {
+					fmt.Fprintf(os.Stderr, "Ошибка записи состояния: %v\n", err)
+				}
+				r.reportSkipped()
+				r.out.Flush()
+				jobs := r.enclosures
+				r.enclosures = nil
+				mu.Unlock()
+				if d != nil {
+					d.run(jobs)
+				}
+				delay = interval - interval/20 + jitter()
+			}
+		}(u)
+	}
+	wg.Wait()
+}
+
+func main() {
+	if len(os.Args) > 1 && (os.Args[1] == "add-feed" || os.Args[1] == "remove-feed") {
+		runFeedCommand(os.Args[1], os.Args[2:])
+		return
+	}
+	if len(os.Args) > 1 && os.Args[1] == "validate" {
+		runValidate(os.Args[2:])
+	}
+
+	fs := flag.NewFlagSet("rssparser", flag.ContinueOnError)
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "Использование: rssparser [<URL RSS-ленты или имя из конфигурации>...] [--config=FILE] [--feeds-file=list.txt] [--opml=subscriptions.opml [--folder=Tech] [--list-opml]] [--max-concurrent=4] [--show=title,link,desc,date] [--limit=N] [--raw] [--output=text|md|html|json|rss [--channel-title=T] [--channel-link=URL] [--channel-description=D]] [--out=FILE] [--sort=desc|asc|none] [--strict-dates] [--relative] [--since=24h|2024-05-01] [--until=...] [--keep-undated] [--match=regexp]... [--exclude=regexp]... [--category=NAME]... [--author=NAME]... [--dedupe] [--cache-dir=DIR] [--no-cache] [--new-only|--mark-read] [--reset] [--watch [--interval=10m] [--once]] [--exec=CMD [--exec-limit=10]] [--download-enclosures] [--download-images] [--dir=DIR] [--limit-bytes=500M] [--timeout=15s] [--retries=2] [--proxy=URL|--no-proxy] [--max-redirects=10] [--user-agent=UA] [--header=\"Имя: значение\"]... [--verbose [--update-config]] [--strict-encoding] [--full-text [--full-text-max=200KB]] [--interactive|--open=N [--opener=CMD]]")
+		fmt.Fprintln(fs.Output(), "       rssparser add-feed <имя> <URL> [--config=FILE]")
+		fmt.Fprintln(fs.Output(), "       rssparser remove-feed <имя> [--config=FILE]")
+		fmt.Fprintln(fs.Output(), "       rssparser validate <URL или файл> [--output=text|json] [--timeout=15s]")
+		fs.PrintDefaults()
+		fmt.Fprintln(fs.Output(), "Коды выхода (если ленты завершились по-разному — худший: 3, затем 2, затем 4):")
+		fmt.Fprintln(fs.Output(), "  0 — выведена хотя бы одна статья")
+		fmt.Fprintln(fs.Output(), "  1 — ошибка аргументов, конфигурации или файлов состояния")
+		fmt.Fprintln(fs.Output(), "  2 — сетевая ошибка или ошибочный ответ HTTP")
+		fmt.Fprintln(fs.Output(), "  3 — ленту не удалось разобрать")
+		fmt.Fprintln(fs.Output(), "  4 — ленты получены, но статей после фильтров не осталось")
+		fmt.Fprintln(fs.Output(), "validate: 0 — замечаний нет, 1 — только предупреждения, 2 — есть ошибки.")
+	}
+	configPath := fs.String("config", defaultConfigPath(), "файл конфигурации с именованными лентами (JSON)")
+	feedsFile := fs.String("feeds-file", "", "файл со списком адресов лент, по одному на строку")
+	opmlFile := fs.String("opml", "", "OPML-файл с подписками")
+	folder := fs.String("folder", "", "брать из OPML только ленты из этой папки (вместе с вложенными)")
+	listOPML := fs.Bool("list-opml", false, "вывести ленты из OPML без загрузки")
+	maxConcurrent := fs.Int("max-concurrent", 4, "сколько лент загружать одновременно")
+	show := fs.String("show", "title", "поля статьи через запятую: title, link, desc, date, enclosure, author, categories, comments")
+	limit := fs.Int("limit", 0, "выводить не больше N статей из каждой ленты (0 — все)")
+	raw := fs.Bool("raw", false, "выводить описания как есть, не убирая HTML")
+	format := fs.String("output", "text", "формат вывода: text, md (Markdown), html, json или rss (все статьи одной лентой)")
+	channelTitle := fs.String("channel-title", "Объединённая лента", "с --output=rss: заголовок ленты")
+	channelLink := fs.String("channel-link", "", "с --output=rss: ссылка ленты (по умолчанию ссылка первой из лент)")
+	channelDescription := fs.String("channel-description", "", "с --output=rss: описание ленты (по умолчанию список исходных лент)")
+	outPath := fs.String("out", "", "записать вывод в файл вместо stdout")
+	sortOrder := fs.String("sort", "desc", "порядок статей по дате: desc (сначала новые), asc или none (как в ленте)")
+	strictDates := fs.Bool("strict-dates", false, "считать ошибкой ленты дату, которую не удалось разобрать")
+	relative := fs.Bool("relative", false, "выводить возраст статей (\"3 ч назад\"), старше 7 дней — дату")
+	since := fs.String("since", "", "только статьи не старше давности (24h, 7d) или не раньше даты (2024-05-01)")
+	until := fs.String("until", "", "только статьи старше давности или раньше даты (дата без времени включается целиком)")
+	keepUndated := fs.Bool("keep-undated", false, "с --since/--until: оставлять статьи без разобранной даты")
+	cacheDir := fs.String("cache-dir", defaultCacheDir(), "директория кэша лент и файла прочитанных статей")
+	newOnly := fs.Bool("new-only", false, "выводить только статьи, которых не было при прошлых запусках, и запомнить их")
+	markRead := fs.Bool("mark-read", false, "отметить все статьи лент прочитанными, ничего не выводя")
+	reset := fs.Bool("reset", false, "забыть прочитанные статьи указанных лент")
+	watchMode := fs.Bool("watch", false, "не завершаться: опрашивать ленты раз в --interval и выводить новые статьи")
+	interval := fs.Duration("interval", 10*time.Minute, "интервал опроса лент в режиме --watch")
+	once := fs.Bool("once", false, "с --watch: один опрос, как обычный запуск с --new-only")
+	execTmpl := fs.String("exec", "", "команда для каждой новой статьи (с --new-only или --watch); подставляются {title}, {link}, {feed}, {date}")
+	execLimit := fs.Int("exec-limit", 10, "не больше N команд --exec за запуск (в --watch — за опрос ленты)")
+	dedupe := fs.Bool("dedupe", false, "убрать повторы статей из разных лент (по guid или ссылке)")
+	downloadEnclosures := fs.Bool("download-enclosures", false, "загрузить вложения выведенных (с --new-only — новых) статей")
+	downloadImages := fs.Bool("download-images", false, "загрузить картинки выведенных (с --new-only — новых) статей")
+	downloadDir := fs.String("dir", ".", "директория для загруженных вложений и картинок")
+	limitBytes := fs.String("limit-bytes", "", "не загружать больше заданного объёма за запуск: 500M, 2G")
+	noCache := fs.Bool("no-cache", false, "не использовать кэш: всегда загружать ленты целиком")
+	timeout := fs.Duration("timeout", 15*time.Second, "тайм-аут одного запроса, включая чтение ленты")
+	retries := fs.Int("retries", 2, "сколько раз повторять запрос при сетевой ошибке, 429 или 5xx")
+	proxy := fs.String("proxy", "", "прокси-сервер вместо заданного в окружении: http://host:port или socks5://host:port")
+	noProxy := fs.Bool("no-proxy", false, "подключаться напрямую, не используя прокси из окружения")
+	maxRedirects := fs.Int("max-redirects", 10, "не больше N перенаправлений на запрос")
+	userAgent := fs.String("user-agent", defaultUserAgent, "заголовок User-Agent запросов")
+	verbose := fs.Bool("verbose", false, "сообщать, на какой адрес перенаправлена лента")
+	updateConfig := fs.Bool("update-config", false, "заменить в конфигурации адреса лент, перенаправленных постоянно (301, 308)")
+	strictEncoding := fs.Bool("strict-encoding", false, "считать ошибкой неизвестную кодировку ленты и байты, которым она не соответствует")
+	fullText := fs.Bool("full-text", false, "загрузить страницы статей и выводить их текст вместо описания из ленты")
+	fullTextMax := fs.String("full-text-max", "200KB", "с --full-text: не загружать больше заданного объёма с каждой страницы")
+	interactiveMode := fs.Bool("interactive", false, "после вывода спросить номера статей и открыть их ссылки")
+	openN := fs.Int("open", 0, "открыть ссылку статьи с этим номером после вывода")
+	openerCmd := fs.String("opener", "", "программа для открытия ссылок (по умолчанию termux-open-url, xdg-open или open)")
+	var headers stringList
+	fs.Var(&headers, "header", "дополнительный заголовок запросов \"Имя: значение\" (можно повторять)")
+	var match, exclude stringList
+	fs.Var(&match, "match", "оставить статьи, заголовок или описание которых подходит под регулярное выражение (можно повторять)")
+	fs.Var(&exclude, "exclude", "отбросить статьи, подходящие под регулярное выражение (можно повторять)")
+	var categories, authors stringList
+	fs.Var(&categories, "category", "оставить статьи с этой рубрикой, без учёта регистра (можно повторять)")
+	fs.Var(&authors, "author", "оставить статьи, в имени автора которых есть эта строка (можно повторять)")
+	args := parseArgs(fs, os.Args[1:])
+
+	// Сообщения об ошибках идут в stderr, а с --output=json в stdout ещё и отчёт с ошибкой.
+	fatal := func(code int, msgFormat string, args ...any) {
+		msg := fmt.Sprintf(msgFormat, args...)
+		fmt.Fprintln(os.Stderr, msg)
+		if *format == "json" {
+			writeJSONReport(os.Stdout, nil, []jsonError{{Kind: "usage", Message: msg}}, code)
+		}
+		os.Exit(code)
+	}
+
+	opts := printOptions{limit: *limit, width: terminalWidth(), raw: *raw, relative: *relative, format: *format}
+	if !slices.Contains([]string{"text", "md", "html", "json", "rss"}, *format) {
+		fatal(exitUsage, "Значение --output должно быть text, md, html, json или rss.")
+	}
+	var err error
+	if opts.show, err = parseShow(*show); err != nil {
+		fatal(exitUsage, "%v", err)
+	}
+	if *sortOrder != "desc" && *sortOrder != "asc" && *sortOrder != "none" {
+		fatal(exitUsage, "Значение --sort должно быть desc, asc или none.")
+	}
+	// Шаблоны проверяем до сетевых запросов.
+	filter, err := newItemFilter(match, exclude)
+	if err != nil {
+		fatal(exitUsage, "%v", err)
+	}
+	for _, c := range categories {
+		if c = oneLine(c); c != "" {
+			filter.categories = append(filter.categories, c)
+		}
+	}
+	for _, a := range authors {
+		if a = strings.ToLower(oneLine(a)); a != "" {
+			filter.authors = append(filter.authors, a)
+		}
+	}
+	header := http.Header{}
+	if *userAgent != "" {
+		header.Set("User-Agent", *userAgent)
+	}
+	// Заголовок из --header заменяет одноимённый из --user-agent, повторы добавляются.
+	fromFlags := map[string]bool{}
+	for _, h := range headers {
+		name, value, ok := strings.Cut(h, ":")
+		name = strings.TrimSpace(name)
+		if !ok || name == "" || strings.ContainsAny(name, " \t") {
+			fatal(exitUsage, "Неверный заголовок %q в --header, ожидается \"Имя: значение\".", h)
+		}
+		if name = http.CanonicalHeaderKey(name); fromFlags[name] {
+			header.Add(name, strings.TrimSpace(value))
+		} else {
+			header.Set(name, strings.TrimSpace(value))
+			fromFlags[name] = true
+		}
+	}
+	dates := dateRange{keepUndated: *keepUndated}
+	if *since != "" {
+		if dates.since, err = parseDateBound(*since, false); err != nil {
+			fatal(exitUsage, "Ошибка в --since: %v", err)
+		}
+	}
+	if *until != "" {
+		if dates.until, err = parseDateBound(*until, true); err != nil {
+			fatal(exitUsage, "Ошибка в --until: %v", err)
+		}
+	}
+	if now := time.Now(); dates.since.set() && dates.until.set() && !dates.since.time(now).Before(dates.until.time(now)) {
+		fatal(exitUsage, "Значение --since должно быть раньше --until.")
+	}
+	if *keepUndated && !dates.active() {
+		fatal(exitUsage, "Флаг --keep-undated действует только вместе с --since или --until.")
+	}
+	if *limit < 0 {
+		fatal(exitUsage, "Значение --limit не может быть отрицательным.")
+	}
+
+	// Имена лент берутся из конфигурации; без аргументов загружаются все ленты из неё.
+	var urls []string
+	perFeed := map[string]feedOverride{}
+	var cfg *feedConfig
+	needConfig := (len(args) == 0 && *feedsFile == "" && *opmlFile == "") || *updateConfig
+	for _, arg := range args {
+		needConfig = needConfig || !isFeedURL(arg)
+	}
+	if needConfig && *configPath != "" {
+		if cfg, err = loadConfig(*configPath); err != nil {
+			fatal(exitUsage, "Ошибка чтения конфигурации: %v", err)
+		}
+	}
+	useFeed := func(feed namedFeed) {
+		f, err := newItemFilter(feed.Match, feed.Exclude)
+		if err != nil {
+			fatal(exitUsage, "Лента %q в конфигурации: %v", feed.Name, err)
+		}
+		urls = append(urls, feed.URL)
+		perFeed[feed.URL] = feedOverride{filter: f, limit: feed.Limit}
+	}
+	for _, arg := range args {
+		if isFeedURL(arg) {
+			urls = append(urls, arg)
+			continue
+		}
+		if cfg == nil {
+			fatal(exitUsage, "Не удалось определить путь к конфигурации, укажите --config.")
+		}
+		feed := cfg.find(arg)
+		if feed == nil {
+			fatal(exitUsage, "Лента %q не найдена в %s. Доступные ленты: %s", arg, *configPath, cfg.names())
+		}
+		useFeed(*feed)
+	}
+	if *updateConfig && (cfg == nil || (*watchMode && !*once)) {
+		fatal(exitUsage, "Флаг --update-config работает только с файлом конфигурации и без --watch.")
+	}
+	if len(args) == 0 && *feedsFile == "" && *opmlFile == "" && cfg != nil {
+		for _, feed := range cfg.Feeds {
+			useFeed(feed)
+		}
+	}
+
+	if *feedsFile != "" {
+		fileURLs, err := readFeedsFile(*feedsFile)
+		if err != nil {
+			fatal(exitUsage, "Ошибка чтения списка лент: %v", err)
+		}
+		urls = append(urls, fileURLs...)
+	}
+
+	if *opmlFile != "" {
+		feeds, err := readOPML(*opmlFile)
+		if err != nil {
+			fatal(exitUsage, "Ошибка чтения OPML: %v", err)
+		}
+		for _, feed := range feeds {
+			if *folder != "" && !feed.inFolder(*folder) {
+				continue
+			}
+			if *listOPML {
+				if len(feed.Folder) > 0 {
+					fmt.Printf("[%s] ", strings.Join(feed.Folder, "/"))
+				}
+				fmt.Printf("%s: %s\n", feed.Title, feed.URL)
+				continue
+			}
+			urls = append(urls, feed.URL)
+		}
+		if *listOPML {
+			return
+		}
+	} else if *folder != "" || *listOPML {
+		fatal(exitUsage, "Флаги --folder и --list-opml работают только вместе с --opml.")
+	}
+
+	// Проверяем, передан ли хотя бы один URL RSS-ленты.
+	if len(urls) == 0 {
+		fs.Usage()
+		os.Exit(exitUsage)
+	}
+
+	if *watchMode {
+		// Режим наблюдения выводит только новые статьи.
+		if *markRead || *reset {
+			fatal(exitUsage, "Флаги --mark-read и --reset нельзя использовать вместе с --watch.")
+		}
+		if *dedupe && !*once {
+			fatal(exitUsage, "Флаг --dedupe нельзя использовать вместе с --watch: ленты опрашиваются по отдельности.")
+		}
+		if (*format == "json" || *format == "rss") && !*once {
+			fatal(exitUsage, "Вывод --output=%s выводится одним документом и не работает с --watch без --once.", *format)
+		}
+		if *interval <= 0 {
+			fatal(exitUsage, "Значение --interval должно быть положительным.")
+		}
+		*newOnly = true
+	}
+
+	if *execTmpl != "" && !*newOnly {
+		fatal(exitUsage, "Флаг --exec работает только вместе с --new-only или --watch.")
+	}
+	execScript, err := compileExec(*execTmpl, execPlaceholders)
+	if err != nil {
+		fatal(exitUsage, "--exec: %v", err)
+	}
+
+	var seen *seenState
+	if *newOnly || *markRead || *reset {
+		if *newOnly && *markRead {
+			fatal(exitUsage, "Флаги --new-only и --mark-read нельзя использовать вместе.")
+		}
+		if *cacheDir == "" {
+			fatal(exitUsage, "Не удалось определить директорию кэша, укажите --cache-dir.")
+		}
+		var err error
+		if seen, err = loadSeen(filepath.Join(*cacheDir, "seen.json")); err != nil {
+			fatal(exitUsage, "Ошибка чтения состояния: %v", err)
+		}
+	}
+	if *reset {
+		for _, u := range urls {
+			delete(seen.Feeds, u)
+		}
+		if err := seen.save(); err != nil {
+			fatal(exitUsage, "Ошибка записи состояния: %v", err)
+		}
+		if !*newOnly && !*markRead {
+			fmt.Printf("Прочитанные статьи забыты для лент: %d\n", len(urls))
+			return
+		}
+	}
+
+	var opener *linkOpener
+	if *interactiveMode || *openN != 0 {
+		switch {
+		case *interactiveMode && *openN != 0:
+			fatal(exitUsage, "Флаги --interactive и --open нельзя использовать вместе.")
+		case *openN < 0:
+			fatal(exitUsage, "Номер в --open должен быть положительным.")
+		case *watchMode || *markRead || *format != "text":
+			fatal(exitUsage, "Флаги --interactive и --open работают только с текстовым выводом и без --watch и --mark-read.")
+		}
+		var err error
+		if opener, err = newLinkOpener(*openerCmd); err != nil {
+			fatal(exitUsage, "%v", err)
+		}
+	}
+
+	var fullTextMaxBytes int64
+	if *fullText {
+		if fullTextMaxBytes, err = parseSize(*fullTextMax); err != nil || fullTextMaxBytes == 0 {
+			fatal(exitUsage, "Неверное значение --full-text-max (примеры: 200KB, 1M).")
+		}
+		// Полный текст заменяет описание, поэтому выводится и без --show=desc.
+		opts.show.desc = true
+	}
+
+	if *proxy != "" && *noProxy {
+		fatal(exitUsage, "Флаги --proxy и --no-proxy нельзя использовать вместе.")
+	}
+	transport, err := newTransport(*proxy, *noProxy)
+	if err != nil {
+		fatal(exitUsage, "%v", err)
+	}
+	if *maxRedirects < 0 {
+		fatal(exitUsage, "Значение --max-redirects не может быть отрицательным.")
+	}
+	client := &http.Client{Timeout: *timeout, Transport: transport, CheckRedirect: redirectPolicy(*maxRedirects)}
+	f := &fetcher{ctx: context.Background(), client: client, retries: max(*retries, 0), header: header, strictEncoding: *strictEncoding}
+	if !*noCache && *cacheDir != "" {
+		f.cache = &feedCache{dir: *cacheDir}
+	}
+	out := io.Writer(os.Stdout)
+	var outFile *os.File
+	if *outPath != "" {
+		if outFile, err = os.Create(*outPath); err != nil {
+			fatal(exitUsage, "Ошибка создания файла вывода: %v", err)
+		}
+		out = outFile
+	}
+	// Вывод буферизуется и сбрасывается в finish, а в режиме наблюдения — после каждого опроса.
+	bw := bufio.NewWriter(out)
+	if *format == "html" {
+		bw.WriteString(htmlHeader)
+	}
+	finish := func() {
+		if *format == "html" {
+			bw.WriteString(htmlFooter)
+		}
+		err := bw.Flush()
+		if outFile != nil {
+			if cerr := outFile.Close(); err == nil {
+				err = cerr
+			}
+		}
+		if err != nil {
+			fatal(exitUsage, "Ошибка записи вывода: %v", err)
+		}
+	}
+
+	var d *downloader
+	if *downloadEnclosures || *downloadImages {
+		budget, err := parseSize(*limitBytes)
+		if *limitBytes == "" {
+			budget, err = 0, nil
+		}
+		if err != nil {
+			fatal(exitUsage, "%v", err)
+		}
+		// Для больших файлов общий тайм-аут клиента не подходит: загрузку прерывает только отмена.
+		if d, err = newDownloader(f.ctx, &http.Client{Transport: transport, CheckRedirect: client.CheckRedirect}, f.newHeader(), *downloadDir, *maxConcurrent, budget); err != nil {
+			fatal(exitUsage, "%v", err)
+		}
+	}
+
+	r := &runner{opts: opts, out: bw, verbose: *verbose, filter: filter, dates: dates, perFeed: perFeed, collectEnclosures: *downloadEnclosures, collectImages: *downloadImages, collectListed: opener != nil, sortOrder: *sortOrder, strictDates: *strictDates, seen: seen, markRead: *markRead,
+		execScript: execScript, execLeft: *execLimit}
+	if *fullText {
+		r.fullText = &articleFetcher{f: f, workers: *maxConcurrent, maxBytes: fullTextMaxBytes}
+	}
+
+	if *watchMode && !*once {
+		// Ctrl+C или SIGTERM прерывают опрос; состояние уже сохранено после последнего опроса.
+		ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+		defer stop()
+		f.ctx = ctx
+		if d != nil {
+			d.ctx = ctx
+		}
+		r.timestamps = true
+		watch(ctx, r, f, d, urls, *interval, *maxConcurrent)
+		finish()
+		return
+	}
+
+	// Выводим ленты в порядке аргументов; ошибка одной ленты не прерывает остальные.
+	var feedErrors []error
+	var jsonErrors []jsonError
+	results := fetchAll(urls, *maxConcurrent, f)
+	if *dedupe {
+		// Для выбора самой ранней версии статьи нужны даты всех лент.
+		for i := range results {
+			if results[i].Err == nil {
+				results[i].Err = parseDates(results[i].Feed, *strictDates)
+			}
+		}
+		dedupeItems(results)
+	}
+	for _, res := range results {
+		if err := r.handle(res, time.Now()); err != nil {
+			feedErrors = append(feedErrors, err)
+			jsonErrors = append(jsonErrors, jsonError{URL: res.URL, Kind: errorKind(err), Message: err.Error()})
+			fmt.Fprintf(os.Stderr, "Ошибка ленты %s: %v\n", res.URL, err)
+		}
+	}
+	r.reportSkipped()
+	if *format == "rss" {
+		// Статьи всех лент упорядочиваются вместе; --sort=none оставляет порядок лент.
+		sortItems(r.combined, *sortOrder)
+		ch := channelInfo{title: *channelTitle, link: *channelLink, description: *channelDescription}
+		if ch.link == "" {
+			ch.link = r.channelLink
+		}
+		if ch.link == "" && len(urls) > 0 {
+			ch.link = urls[0]
+		}
+		if ch.description == "" {
+			var titles []string
+			for _, item := range r.combined {
+				if item.Source.Title != "" && !slices.Contains(titles, item.Source.Title) {
+					titles = append(titles, item.Source.Title)
+				}
+			}
+			ch.description = "Статьи из лент: " + strings.Join(titles, ", ")
+		}
+		if err := writeCombinedRSS(bw, r.combined, ch, time.Now()); err != nil {
+			fatal(exitUsage, "Ошибка записи ленты: %v", err)
+		}
+	}
+	// Отчёт JSON выводится в конце: в нём нужен код выхода с учётом загрузки вложений.
+	if *format != "json" {
+		finish()
+	}
+	if *updateConfig {
+		updated := 0
+		for _, res := range results {
+			if res.Err != nil || !res.Feed.Moved {
+				continue
+			}
+			for i := range cfg.Feeds {
+				if cfg.Feeds[i].URL != res.URL {
+					continue
+				}
+				cfg.Feeds[i].URL = res.Feed.FinalURL
+				updated++
+				fmt.Fprintf(os.Stderr, "Адрес ленты %q в конфигурации заменён: %s → %s\n", cfg.Feeds[i].Name, res.URL, res.Feed.FinalURL)
+			}
+			// Прочитанное переносится на новый адрес, иначе все статьи станут новыми.
+			if seen != nil && seen.Feeds[res.Feed.FinalURL] == nil && seen.Feeds[res.URL] != nil {
+				seen.Feeds[res.Feed.FinalURL] = seen.Feeds[res.URL]
+				delete(seen.Feeds, res.URL)
+			}
+		}
+		if updated > 0 {
+			if err := cfg.save(*configPath); err != nil {
+				fatal(exitUsage, "Ошибка записи конфигурации: %v", err)
+			}
+		}
+	}
+	downloadsFailed := 0
+	if d != nil {
+		downloadsFailed = d.run(r.enclosures)
+		if downloadsFailed > 0 {
+			jsonErrors = append(jsonErrors, jsonError{Kind: "network", Message: fmt.Sprintf("не загружено вложений: %d", downloadsFailed)})
+		}
+	}
+
+	if seen != nil && len(feedErrors) < len(urls) {
+		if err := seen.save(); err != nil {
+			fatal(exitUsage, "Ошибка записи состояния: %v", err)
+		}
+	}
+
+	switch {
+	case opener != nil && len(r.listed) == 0:
+		fmt.Fprintln(os.Stderr, "Нет статей, которые можно открыть.")
+	case *interactiveMode:
+		interactive(os.Stdin, r.listed, opener)
+	case *openN > len(r.listed):
+		fatal(exitUsage, "Статьи с номером %d нет: выведено статей %d.", *openN, len(r.listed))
+	case *openN > 0:
+		if err := opener.open(r.listed[*openN-1]); err != nil {
+			fatal(exitUsage, "%v", err)
+		}
+	}
+
+	code := exitCode(feedErrors, downloadsFailed, r.items, *markRead)
+	if *format == "json" {
+		writeJSONReport(bw, r.jsonFeeds, jsonErrors, code)
+		finish()
+	}
+	os.Exit(code)
+}
@@ -0,0 +1,897 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+	"unicode/utf16"
+)
+
+func TestParseDate(t *testing.T) {
+	utc := func(day, hour, minute, sec int) time.Time {
+		return time.Date(2026, time.October, day, hour, minute, sec, 0, time.UTC)
+	}
+	tests := []struct {
+		in   string
+		want time.Time
+	}{
+		{"Tue, 13 Oct 2026 09:05:07 +0000", utc(13, 9, 5, 7)},                           // RFC1123Z
+		{"Tue, 13 Oct 2026 12:05:07 +0300", utc(13, 9, 5, 7)},                           // Смещение учитывается
+		{"Tue, 13 Oct 2026 09:05:07 GMT", utc(13, 9, 5, 7)},                             // RFC1123
+		{"Sat, 3 Oct 2026 09:05:07 +0000", utc(3, 9, 5, 7)},                             // День из одной цифры
+		{"Sat, 03 Oct 2026 09:05:07 +0000", utc(3, 9, 5, 7)},                            // День с нулём
+		{"Tue, 13 Oct 2026 09:05 +0000", utc(13, 9, 5, 0)},                              // Без секунд
+		{"Tue, 13 Oct 26 09:05:07 +0000", utc(13, 9, 5, 7)},                             // Год из двух цифр
+		{"Tue, 13 Oct 2026 09:05:07 UT", utc(13, 9, 5, 7)},                              // UT из RFC822
+		{"Tue, 13 Oct 2026 09:05:07 Z", utc(13, 9, 5, 7)},                               // Z вместо зоны
+		{"Tue, 13 Oct 2026 04:05:07 EST", utc(13, 9, 5, 7)},                             // Американская зона
+		{"Tue, 13 Oct 2026 05:05:07 EDT", utc(13, 9, 5, 7)},                             // Летнее время
+		{"Tuesday, 13 Oct 2026 09:05:07 +0000", utc(13, 9, 5, 7)},                       // Полный день недели
+		{"Tues, 13 Oct 2026 09:05:07 +0000", utc(13, 9, 5, 7)},                          // Нестандартное сокращение
+		{"Mon, 13 Oct 2026 09:05:07 +0000", utc(13, 9, 5, 7)},                           // Неверный день недели не мешает
+		{"13 Oct 2026 09:05:07 +0000", utc(13, 9, 5, 7)},                                // Без дня недели
+		{"  Tue,  13 Oct 2026\n 09:05:07 +0000 ", utc(13, 9, 5, 7)},                     // Лишние пробелы
+		{"13 October 2026 09:05:07 +0000", utc(13, 9, 5, 7)},                            // Полное название месяца
+		{"2026-10-13T09:05:07Z", utc(13, 9, 5, 7)},                                      // RFC3339
+		{"2026-10-13T12:05:07.123+03:00", utc(13, 9, 5, 7).Add(123 * time.Millisecond)}, // Дробные секунды
+		{"2026-10-13T09:05Z", utc(13, 9, 5, 0)},                                         // RFC3339 без секунд
+		{"2026-10-13", utc(13, 0, 0, 0)},                                                // Только дата
+		{"2026-10-13 09:05:07", utc(13, 9, 5, 7)},                                       // Без зоны
+	}
+	for _, tt := range tests {
+		got, err := parseDate(tt.in)
+		if err != nil {
+			t.Errorf("parseDate(%q): %v", tt.in, err)
+			continue
+		}
+		if !got.Equal(tt.want) {
+			t.Errorf("parseDate(%q) = %v, ожидалось %v", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestParseDateInvalid(t *testing.T) {
+	for _, in := range []string{
+		"",
+		"вчера",
+		"garbage",
+		"Tue, 13 Oct 2026 9:5 +0000", // Минуты из одной цифры
+		"Tue, 32 Oct 2026 09:05:07 +0000",
+		"Tue, 13 Foo 2026 09:05:07 +0000",
+		"2026-13-01",
+		"Tue,",
+	} {
+		if got, err := parseDate(in); err == nil {
+			t.Errorf("parseDate(%q) = %v, ожидалась ошибка", in, got)
+		}
+	}
+}
+
+// utf16Bytes кодирует s в UTF-16 с BOM или без него.
+func utf16Bytes(s string, bigEndian, bom bool) []byte {
+	units := utf16.Encode([]rune(s))
+	if bom {
+		units = append([]uint16{0xFEFF}, units...)
+	}
+	data := make([]byte, 0, 2*len(units))
+	for _, u := range units {
+		if bigEndian {
+			data = append(data, byte(u>>8), byte(u))
+		} else {
+			data = append(data, byte(u), byte(u>>8))
+		}
+	}
+	return data
+}
+
+func TestToUTF8(t *testing.T) {
+	// "Привет, мир!" в однобайтовых кодировках.
+	cp1251 := []byte{0xCF, 0xF0, 0xE8, 0xE2, 0xE5, 0xF2, ',', ' ', 0xEC, 0xE8, 0xF0, '!'}
+	koi8r := []byte{0xF0, 0xD2, 0xC9, 0xD7, 0xC5, 0xD4, ',', ' ', 0xCD, 0xC9, 0xD2, '!'}
+	prolog := func(encoding string, body []byte) []byte {
+		return append([]byte(`<?xml version="1.0" encoding="`+encoding+`"?><t>`), append(body, "</t>"...)...)
+	}
+	const want = `<t>Привет, мир!</t>`
+	tests := []struct {
+		name        string
+		data        []byte
+		contentType string
+		charset     string // Ожидаемый результат detectCharset
+		want        string
+	}{
+		{"cp1251 в прологе", prolog("windows-1251", cp1251), "", "windows-1251", want},
+		{"cp1251 в Content-Type", append([]byte("<t>"), append(cp1251, "</t>"...)...), "application/rss+xml; charset=cp1251", "cp1251", want},
+		{"koi8-r в прологе", prolog("KOI8-R", koi8r), "", "KOI8-R", want},
+		{"Content-Type главнее пролога", prolog("utf-8", koi8r), "text/xml; charset=koi8-r", "koi8-r", want},
+		{"Ёё в cp1251", prolog("windows-1251", []byte{0xA8, 0xB8}), "", "windows-1251", "<t>Ёё</t>"},
+		{"Ёё в koi8-r", prolog("koi8-r", []byte{0xB3, 0xA3}), "", "koi8-r", "<t>Ёё</t>"},
+		{"latin1 в прологе", prolog("latin1", []byte{'c', 'a', 'f', 0xE9}), "", "latin1", "<t>café</t>"},
+		{"windows-1252 в Content-Type", []byte{'<', 't', '>', 0x80, '<', '/', 't', '>'}, "text/xml; charset=windows-1252", "windows-1252", "<t>€</t>"},
+		{"UTF-16LE с BOM", utf16Bytes(want, false, true), "", "utf-16le", want},
+		{"UTF-16BE с BOM", utf16Bytes(want, true, true), "", "utf-16be", want},
+		{"UTF-16LE без BOM", utf16Bytes(want, false, false), "", "utf-16le", want},
+		{"UTF-16BE без BOM", utf16Bytes(want, true, false), "", "utf-16be", want},
+		{"UTF-8 с BOM", append([]byte{0xEF, 0xBB, 0xBF}, want...), "", "utf-8", want},
+		{"без указаний", []byte(want), "", "utf-8", want},
+	}
+	for _, tt := range tests {
+		if got := detectCharset(tt.data, tt.contentType); got != tt.charset {
+			t.Errorf("%s: detectCharset = %q, ожидалось %q", tt.name, got, tt.charset)
+		}
+		got, err := toUTF8(tt.data, tt.contentType, true)
+		if err != nil {
+			t.Errorf("%s: toUTF8: %v", tt.name, err)
+			continue
+		}
+		// Пролог остаётся в тексте, сравнивается только содержимое.
+		if !strings.HasSuffix(string(got), tt.want) {
+			t.Errorf("%s: toUTF8 = %q, ожидалось окончание %q", tt.name, got, tt.want)
+		}
+	}
+}
+
+// TestToUTF8Alphabets сверяет декодирование koi8-r и windows-1251 с байтами всего
+// алфавита, выписанными вручную, и проверяет синонимы кодировок и UTF-16 вне BMP.
+func TestToUTF8Alphabets(t *testing.T) {
+	const lower, upper = "абвгдеёжзийклмнопрстуфхцчшщъыьэюя", "АБВГДЕЁЖЗИЙКЛМНОПРСТУФХЦЧШЩЪЫЬЭЮЯ"
+	koi8Lower := []byte{0xC1, 0xC2, 0xD7, 0xC7, 0xC4, 0xC5, 0xA3, 0xD6, 0xDA, 0xC9, 0xCA, 0xCB, 0xCC, 0xCD, 0xCE, 0xCF, 0xD0,
+		0xD2, 0xD3, 0xD4, 0xD5, 0xC6, 0xC8, 0xC3, 0xDE, 0xDB, 0xDD, 0xDF, 0xD9, 0xD8, 0xDC, 0xC0, 0xD1}
+	var koi8Upper, cp1251Lower, cp1251Upper []byte
+	for i, b := range koi8Lower {
+		if b == 0xA3 {
+			koi8Upper = append(koi8Upper, 0xB3) // Ё вне основного блока
+			cp1251Lower, cp1251Upper = append(cp1251Lower, 0xB8), append(cp1251Upper, 0xA8)
+			continue
+		}
+		koi8Upper = append(koi8Upper, b+0x20)
+		n := byte(i)
+		if i > 6 {
+			n-- // В cp1251 буквы а-я идут подряд без ё
+		}
+		cp1251Lower, cp1251Upper = append(cp1251Lower, 0xE0+n), append(cp1251Upper, 0xC0+n)
+	}
+	text := func(body []byte) []byte { return append(append([]byte("<t>"), body...), "</t>"...) }
+	tests := []struct {
+		name, contentType string
+		data              []byte
+		want              string
+	}{
+		{"koi8-r строчные", "text/xml; charset=koi8-r", text(koi8Lower), lower},
+		{"koi8-r прописные", "text/xml; charset=KOI8R", text(koi8Upper), upper},
+		{"koi8-r через cskoi8r", "text/xml; charset=csKOI8R", text(koi8Lower), lower},
+		{"cp1251 строчные", "text/xml; charset=x-cp1251", text(cp1251Lower), lower},
+		{"cp1251 прописные", "text/xml; charset=win-1251", text(cp1251Upper), upper},
+		// Пробел в начале прячет "<" от угадывания, и решает только Content-Type.
+		{"utf-16 без BOM — big-endian", "text/xml; charset=utf-16", utf16Bytes(" <t>"+lower+"</t>", true, false), lower},
+		{"utf-16 с BOM LE главнее названия", "text/xml; charset=utf-16be", utf16Bytes("<t>"+upper+"</t>", false, true), upper},
+		{"utf-16 вне BMP", "", utf16Bytes("<t>лента 📰</t>", false, true), "лента 📰"},
+	}
+	for _, tt := range tests {
+		got, err := toUTF8(tt.data, tt.contentType, true)
+		if err != nil {
+			t.Errorf("%s: %v", tt.name, err)
+			continue
+		}
+		if want := "<t>" + tt.want + "</t>"; strings.TrimSpace(string(got)) != want {
+			t.Errorf("%s: %q, ожидалось %q", tt.name, got, want)
+		}
+	}
+}
+
+// TestFetchFeedCharsets проверяет, что лента в koi8-r и UTF-16 разбирается целиком
+// после загрузки, а не только в toUTF8.
+func TestFetchFeedCharsets(t *testing.T) {
+	const feed = `<?xml version="1.0" encoding="%s"?><rss version="2.0"><channel><title>Новости</title>` +
+		`<item><title>Ёлка в Москве</title><link>https://example.com/1</link></item></channel></rss>`
+	koi8 := map[rune]byte{'Н': 0xEE, 'о': 0xCF, 'в': 0xD7, 'с': 0xD3, 'т': 0xD4, 'и': 0xC9, 'Ё': 0xB3, 'л': 0xCC, 'к': 0xCB, 'а': 0xC1, 'М': 0xED, 'е': 0xC5}
+	var koi8Feed []byte
+	for _, r := range fmt.Sprintf(feed, "koi8-r") {
+		if b, ok := koi8[r]; ok {
+			koi8Feed = append(koi8Feed, b)
+		} else if r < 0x80 {
+			koi8Feed = append(koi8Feed, byte(r))
+		} else {
+			t.Fatalf("нет байта koi8-r для %q", r)
+		}
+	}
+	bodies := map[string]struct {
+		contentType string
+		data        []byte
+	}{
+		"/koi8.xml":    {"application/rss+xml", koi8Feed},
+		"/koi8ct.xml":  {"application/rss+xml; charset=koi8-r", koi8Feed},
+		"/utf16le.xml": {"application/rss+xml", utf16Bytes(fmt.Sprintf(feed, "utf-16"), false, true)},
+		"/utf16be.xml": {"application/rss+xml; charset=utf-16", utf16Bytes(fmt.Sprintf(feed, "utf-16"), true, false)},
+	}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body := bodies[r.URL.Path]
+		w.Header().Set("Content-Type", body.contentType)
+		w.Write(body.data)
+	}))
+	defer srv.Close()
+	f := &fetcher{ctx: context.Background(), client: http.DefaultClient}
+	for path := range bodies {
+		rss, err := f.fetchFeed(srv.URL + path)
+		if err != nil {
+			t.Errorf("%s: %v", path, err)
+			continue
+		}
+		if rss.Channel.Title != "Новости" || len(rss.Channel.Items) != 1 || rss.Channel.Items[0].Title != "Ёлка в Москве" {
+			t.Errorf("%s: канал %q, статьи %+v", path, rss.Channel.Title, rss.Channel.Items)
+		}
+	}
+}
+
+// TestFetchFeedNotModified проверяет условный запрос: второй запрос несёт валидаторы
+// из кэша, а на ответ 304 лента собирается из сохранённого тела.
+func TestFetchFeedNotModified(t *testing.T) {
+	const etag, modified = `"v1"`, "Tue, 13 Oct 2026 10:00:00 GMT"
+	body := []byte(`<rss version="2.0"><channel><title>Кэш</title>` +
+		`<item><title>Первая</title><link>https://example.com/1</link></item></channel></rss>`)
+	var requests []http.Header
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests = append(requests, r.Header.Clone())
+		if r.Header.Get("If-None-Match") == etag {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		w.Header().Set("Content-Type", "application/rss+xml; charset=utf-8")
+		w.Header().Set("ETag", etag)
+		w.Header().Set("Last-Modified", modified)
+		w.Write(body)
+	}))
+	defer srv.Close()
+
+	f := &fetcher{ctx: context.Background(), client: http.DefaultClient, cache: &feedCache{dir: t.TempDir()}}
+	first, err := f.fetchFeed(srv.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if entry := f.cache.load(srv.URL); entry == nil || entry.ETag != etag || !bytes.Equal(entry.Body, body) {
+		t.Fatalf("в кэше %+v", entry)
+	}
+	second, err := f.fetchFeed(srv.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(requests) != 2 {
+		t.Fatalf("запросов %d, ожидалось 2", len(requests))
+	}
+	if h := requests[0]; h.Get("If-None-Match") != "" || h.Get("If-Modified-Since") != "" {
+		t.Errorf("первый запрос условный: %v", h)
+	}
+	if h := requests[1]; h.Get("If-None-Match") != etag || h.Get("If-Modified-Since") != modified {
+		t.Errorf("второй запрос без валидаторов: %v", h)
+	}
+	if second.Channel.Title != first.Channel.Title || len(second.Channel.Items) != 1 || second.Channel.Items[0].Title != "Первая" {
+		t.Errorf("после 304 канал %q, статьи %+v", second.Channel.Title, second.Channel.Items)
+	}
+	if entry := f.cache.load(srv.URL); entry == nil || !bytes.Equal(entry.Body, body) {
+		t.Errorf("ответ 304 испортил кэш: %+v", entry)
+	}
+}
+
+func TestToUTF8Fallback(t *testing.T) {
+	// Объявлено UTF-8, а на деле cp1251: без strict текст читается как windows-1251.
+	data := []byte{'<', 't', '>', 0xCF, 0xF0, 0xE8, 0xE2, 0xE5, 0xF2, '<', '/', 't', '>'}
+	got, err := toUTF8(data, "text/xml; charset=utf-8", false)
+	if err != nil || string(got) != "<t>Привет</t>" {
+		t.Errorf("toUTF8 без strict = %q, %v; ожидалось %q", got, err, "<t>Привет</t>")
+	}
+	if _, err := toUTF8(data, "text/xml; charset=utf-8", true); err == nil {
+		t.Error("toUTF8 со strict: ожидалась ошибка неверных байтов UTF-8")
+	}
+	if _, err := toUTF8([]byte("<t/>"), "text/xml; charset=x-unknown", true); err == nil {
+		t.Error("toUTF8 со strict: ожидалась ошибка неизвестной кодировки")
+	}
+	// 0x98 не определён в cp1251.
+	if _, err := toUTF8([]byte{0x98}, "text/xml; charset=windows-1251", true); err == nil {
+		t.Error("toUTF8 со strict: ожидалась ошибка неопределённого байта")
+	}
+}
+
+func TestCleanHTML(t *testing.T) {
+	tests := []struct {
+		name, in, want string
+	}{
+		{"простой текст", "Привет, мир", "Привет, мир"},
+		{"CDATA", "<![CDATA[<p>Текст</p>]]>", "Текст"},
+		{"вложенный CDATA", "До <![CDATA[внутри]]> после", "До внутри после"},
+		{"br", "строка 1<br>строка 2<br/>строка 3<BR />", "строка 1\nстрока 2\nстрока 3"},
+		{"абзацы", "<p>Первый</p><p>Второй</p>", "Первый\nВторой"},
+		{"список", "<ul><li>один</li><li>два</li></ul>", "- один\n- два"},
+		{"пустой пункт", "<ul><li></li><li>два</li></ul>", "- два"},
+		{"строчные теги", `Это <b>жирный</b> и <a href="http://x/?a=1&b=2">ссылка</a>`, "Это жирный и ссылка"},
+		{"> в атрибуте", `<img alt="a > b" src="x.png">текст`, "текст"},
+		{"именованные сущности", "&laquo;Цитата&raquo; &amp; &lt;тег&gt;", "«Цитата» & <тег>"},
+		{"числовые сущности", "&#1055;&#1088;&#1080; &#x41;&#X42; &#8212;", "При AB —"},
+		{"nbsp", "a&nbsp;&nbsp;b", "a b"},
+		{"пробелы схлопываются", "  много \t\t пробелов\n\n\n   и строк  ", "много пробелов\nи строк"},
+		{"комментарии", "до<!-- <p>скрыто</p> -->после", "до после"},
+		{"script и style", "<style>p{color:red}</style>текст<script>alert('<b>')</script>", "текст"},
+		{"оборванный тег", `Начало <a href="http://x/`, "Начало"},
+		{"пусто", "", ""},
+	}
+	for _, tt := range tests {
+		if got := cleanHTML(tt.in); got != tt.want {
+			t.Errorf("%s: cleanHTML(%q) = %q, ожидалось %q", tt.name, tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestNormalizeLink(t *testing.T) {
+	tests := []struct {
+		in, want string
+	}{
+		{"https://example.com/post", "example.com/post"},
+		{"http://example.com/post", "example.com/post"},            // Схема не важна
+		{"https://example.com/post/", "example.com/post"},          // Завершающий "/"
+		{"https://example.com/", "example.com"},                    // Корень сайта
+		{"https://Example.COM/Post", "example.com/Post"},           // Регистр хоста, но не пути
+		{"http://example.com:80/post", "example.com/post"},         // Порт по умолчанию
+		{"https://example.com:443/post", "example.com/post"},       // Порт по умолчанию
+		{"https://example.com:8080/post", "example.com:8080/post"}, // Другой порт остаётся
+		{"https://example.com/post#comments", "example.com/post"},  // Фрагмент
+		{"https://example.com/post/#top", "example.com/post"},      // Фрагмент и "/"
+		{"https://example.com/post?utm_source=rss&utm_medium=feed", "example.com/post"},
+		{"https://example.com/post?UTM_Campaign=x", "example.com/post"},
+		{"https://example.com/post?id=5&utm_source=rss", "example.com/post?id=5"}, // Другие параметры остаются
+		{"https://example.com/post?b=2&a=1", "example.com/post?a=1&b=2"},          // Параметры сортируются
+		{"https://example.com/post/?page=2#x", "example.com/post?page=2"},
+		{"https://example.com/%D0%BF%D0%BE%D1%81%D1%82", "example.com/%D0%BF%D0%BE%D1%81%D1%82"},
+		{"  https://example.com/post  ", "example.com/post"},
+		{"/relative/path", "/relative/path"}, // Без хоста — как есть
+		{"не ссылка", "не ссылка"},
+	}
+	for _, tt := range tests {
+		if got := normalizeLink(tt.in); got != tt.want {
+			t.Errorf("normalizeLink(%q) = %q, ожидалось %q", tt.in, got, tt.want)
+		}
+	}
+	// Зеркала одной статьи совпадают.
+	if a, b := normalizeLink("http://example.com/post/?utm_source=a#x"), normalizeLink("https://EXAMPLE.com/post"); a != b {
+		t.Errorf("normalizeLink: %q != %q", a, b)
+	}
+}
+
+func TestLintRSS(t *testing.T) {
+	now := time.Date(2026, time.October, 14, 12, 0, 0, 0, time.UTC)
+	// Файл в testdata/lint → ожидаемые замечания "важность правило номер-статьи".
+	tests := []struct {
+		file string
+		want []string
+	}{
+		{"valid.xml", nil},
+		{"encoding.xml", []string{"error encoding 0"}},
+		{"xml.xml", []string{"error xml 0"}},
+		{"root-atom.xml", []string{"error root 0"}},
+		{"root.xml", []string{"error root 0"}},
+		{"channel.xml", []string{"error channel 0"}},
+		{"channel-title.xml", []string{"error channel-title 0"}},
+		{"channel-link.xml", []string{"error channel-link 0"}},
+		{"item-content.xml", []string{"error item-content 1"}},
+		{"item-guid.xml", []string{"warning item-guid 1"}},
+		{"guid-duplicate.xml", []string{"error guid-duplicate 2"}},
+		{"guid-permalink.xml", []string{"warning guid-permalink 1"}},
+		{"pubdate-invalid.xml", []string{"error pubdate-invalid 1"}},
+		{"pubdate-future.xml", []string{"warning pubdate-future 1"}},
+		{"link-relative.xml", []string{"warning link-relative 1"}},
+	}
+	for _, tt := range tests {
+		data, err := os.ReadFile(filepath.Join("testdata", "lint", tt.file))
+		if err != nil {
+			t.Fatal(err)
+		}
+		var got []string
+		for _, p := range lintRSS(data, "", now) {
+			if p.Message == "" {
+				t.Errorf("%s: у замечания %s нет текста", tt.file, p.Rule)
+			}
+			got = append(got, fmt.Sprintf("%s %s %d", p.Severity, p.Rule, p.Item))
+		}
+		if !slices.Equal(got, tt.want) {
+			t.Errorf("%s: lintRSS = %q, ожидалось %q", tt.file, got, tt.want)
+		}
+	}
+}
+
+func TestExitCode(t *testing.T) {
+	network := errors.New("статус: 503")
+	parse := &parseError{errors.New("неверный XML")}
+	wrapped := fmt.Errorf("лента example: %w", parse)
+	tests := []struct {
+		name      string
+		errs      []error
+		downloads int  // Не загружено вложений
+		items     int  // Выведено статей
+		markRead  bool // --mark-read
+		want      int
+	}{
+		{"успех", nil, 0, 3, false, exitOK},
+		{"пусто после фильтров", nil, 0, 0, false, exitEmpty},
+		{"пусто с --mark-read", nil, 0, 0, true, exitOK},
+		{"сетевая ошибка", []error{network}, 0, 0, false, exitNetwork},
+		{"ошибка разбора", []error{parse}, 0, 0, false, exitParse},
+		{"обёрнутая ошибка разбора", []error{wrapped}, 0, 0, false, exitParse},
+		{"ошибка вложений", nil, 2, 3, false, exitNetwork},
+		// Несколько лент: берётся худший исход.
+		{"сетевая и удачная лента", []error{network}, 0, 3, false, exitNetwork},
+		{"сетевая, затем разбор", []error{network, parse}, 0, 3, false, exitParse},
+		{"разбор, затем сетевая", []error{parse, network}, 0, 3, false, exitParse},
+		{"разбор и вложения", []error{parse}, 1, 3, false, exitParse},
+		{"сетевая важнее пустого вывода", []error{network}, 0, 0, false, exitNetwork},
+		{"вложения важнее пустого вывода", nil, 1, 0, false, exitNetwork},
+	}
+	for _, tt := range tests {
+		if got := exitCode(tt.errs, tt.downloads, tt.items, tt.markRead); got != tt.want {
+			t.Errorf("%s: exitCode = %d, ожидалось %d", tt.name, got, tt.want)
+		}
+	}
+	if errorKind(wrapped) != "parse" || errorKind(network) != "network" {
+		t.Errorf("errorKind: %q, %q", errorKind(wrapped), errorKind(network))
+	}
+}
+
+// serveFeed отдаёт ленты по путям и возвращает адрес сервера.
+func serveFeed(t *testing.T, feeds map[string][]byte) string {
+	t.Helper()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		data, ok := feeds[r.URL.Path]
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		w.Header().Set("Content-Type", "application/rss+xml; charset=utf-8")
+		w.Write(data)
+	}))
+	t.Cleanup(srv.Close)
+	return srv.URL
+}
+
+func TestWriteCombinedRSSRoundTrip(t *testing.T) {
+	source := []byte(`<?xml version="1.0" encoding="utf-8"?>
+<rss version="2.0"><channel><title>Исходная</title><link>https://example.com/</link><description>d</description>
+<item><title>Ссылка</title><link>https://example.com/a</link><guid>https://example.com/a</guid><pubDate>Tue, 13 Oct 2026 09:05:07 +0300</pubDate></item>
+<item><title>Метка</title><link>https://example.com/b</link><guid isPermaLink="false">tag:example.com,2026:b</guid><pubDate>Tue, 13 Oct 2026 10:00:00 GMT</pubDate></item>
+<item><title>Без guid</title><link>https://example.com/c</link><pubDate>Mon, 12 Oct 2026 08:00:00 +0000</pubDate></item>
+<item><title>Плохая дата</title><link>https://example.com/d</link><guid>https://example.com/d</guid><pubDate>Tue, 13 Oct 2026 9:5 +0000</pubDate></item>
+<item><title>Без даты</title><link>https://example.com/e</link><guid>https://example.com/e</guid></item>
+<item><title>Чужая</title><link>https://other.example/f</link><guid>https://other.example/f</guid><pubDate>Sun, 11 Oct 2026 08:00:00 +0000</pubDate><source url="https://other.example/rss">Другая</source></item>
+</channel></rss>`)
+	feeds := map[string][]byte{"/source.xml": source}
+	base := serveFeed(t, feeds)
+	f := &fetcher{ctx: context.Background(), client: http.DefaultClient}
+
+	fetched := time.Date(2026, time.October, 14, 12, 0, 0, 0, time.UTC)
+	rss, err := f.fetchFeed(base + "/source.xml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := parseDates(rss, false); err != nil {
+		t.Fatal(err)
+	}
+	var items []Item
+	for _, item := range rss.Channel.Items {
+		items = append(items, combineItem(item, base+"/source.xml", rss.Channel.Title, fetched))
+	}
+	var buf bytes.Buffer
+	if err := writeCombinedRSS(&buf, items, channelInfo{title: "Все", link: "https://example.com/", description: "Все ленты"}, fetched); err != nil {
+		t.Fatal(err)
+	}
+
+	feeds["/combined.xml"] = buf.Bytes()
+	combined, err := f.fetchFeed(base + "/combined.xml")
+	if err != nil {
+		t.Fatalf("объединённая лента не разбирается: %v\n%s", err, buf.Bytes())
+	}
+	if combined.Channel.Title != "Все" || len(combined.Channel.Items) != len(items) {
+		t.Fatalf("канал %q, статей %d; ожидалось %q и %d", combined.Channel.Title, len(combined.Channel.Items), "Все", len(items))
+	}
+	if problems := lintRSS(buf.Bytes(), "", fetched); len(problems) != 1 || problems[0].Rule != "pubdate-invalid" {
+		t.Errorf("lintRSS объединённой ленты: %+v; ожидалось только pubdate-invalid статьи 4", problems)
+	}
+
+	tests := []struct {
+		guid, permaLink, link, pubDate, category, sourceURL string
+	}{
+		{"https://example.com/a", "", "https://example.com/a", "Tue, 13 Oct 2026 09:05:07 +0300", "Исходная", base + "/source.xml"},
+		{"tag:example.com,2026:b", "false", "https://example.com/b", "Tue, 13 Oct 2026 10:00:00 +0000", "Исходная", base + "/source.xml"},
+		{items[2].key(), "false", "https://example.com/c", "Mon, 12 Oct 2026 08:00:00 +0000", "Исходная", base + "/source.xml"},
+		{"https://example.com/d", "", "https://example.com/d", "Tue, 13 Oct 2026 9:5 +0000", "Исходная", base + "/source.xml"},
+		{"https://example.com/e", "", "https://example.com/e", fetched.Format(time.RFC1123Z), "Исходная", base + "/source.xml"},
+		{"https://other.example/f", "", "https://other.example/f", "Sun, 11 Oct 2026 08:00:00 +0000", "Другая", "https://other.example/rss"},
+	}
+	for i, tt := range tests {
+		got := combined.Channel.Items[i]
+		if got.GUID.Value != tt.guid || got.GUID.IsPermaLink != tt.permaLink {
+			t.Errorf("статья %d: guid %q (isPermaLink %q), ожидалось %q (%q)", i+1, got.GUID.Value, got.GUID.IsPermaLink, tt.guid, tt.permaLink)
+		}
+		if got.Link != tt.link {
+			t.Errorf("статья %d: ссылка %q, ожидалось %q", i+1, got.Link, tt.link)
+		}
+		if got.PubDate != tt.pubDate {
+			t.Errorf("статья %d: pubDate %q, ожидалось %q", i+1, got.PubDate, tt.pubDate)
+		}
+		if !slices.Contains(got.Categories, tt.category) {
+			t.Errorf("статья %d: рубрики %q без названия исходной ленты %q", i+1, got.Categories, tt.category)
+		}
+		if got.Source == nil || got.Source.URL != tt.sourceURL {
+			t.Errorf("статья %d: source %+v, ожидался адрес %q", i+1, got.Source, tt.sourceURL)
+		}
+	}
+}
+
+// TestNewTransportProxy проверяет, что запрос идёт через прокси из --proxy, что --no-proxy
+// его отключает и что ошибка соединения с прокси распознаётся.
+func TestNewTransportProxy(t *testing.T) {
+	feed := []byte(`<rss version="2.0"><channel><title>Через прокси</title></channel></rss>`)
+	var proxied []string
+	proxy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// HTTP-прокси получает абсолютный адрес ленты.
+		proxied = append(proxied, r.URL.String())
+		w.Header().Set("Content-Type", "application/rss+xml")
+		w.Write(feed)
+	}))
+	defer proxy.Close()
+
+	// Домен .invalid не разрешается, лента доступна только через прокси.
+	const feedURL = "http://feed.invalid/rss.xml"
+	transport, err := newTransport(proxy.URL, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f := &fetcher{ctx: context.Background(), client: &http.Client{Transport: transport}}
+	rss, err := f.fetchFeed(feedURL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rss.Channel.Title != "Через прокси" || !slices.Equal(proxied, []string{feedURL}) {
+		t.Errorf("канал %q, через прокси прошли %q", rss.Channel.Title, proxied)
+	}
+
+	if transport, err := newTransport(proxy.URL, true); err != nil || transport.Proxy != nil {
+		t.Errorf("--no-proxy: прокси не отключён (ошибка %v)", err)
+	}
+	for _, bad := range []string{"ftp://proxy:21", "proxy:3128", "http://", "::"} {
+		if _, err := newTransport(bad, false); err == nil {
+			t.Errorf("newTransport(%q) без ошибки", bad)
+		}
+	}
+
+	// Прокси, который не принимает соединений: ошибка должна распознаться как ошибка прокси.
+	closed := httptest.NewServer(http.NotFoundHandler())
+	closed.Close()
+	for _, scheme := range []string{"http", "socks5"} {
+		transport, err := newTransport(scheme+"://"+closed.Listener.Addr().String(), false)
+		if err != nil {
+			t.Fatal(err)
+		}
+		f := &fetcher{ctx: context.Background(), client: &http.Client{Transport: transport}}
+		_, err = f.fetchFeed(feedURL)
+		if err == nil || !strings.Contains(err.Error(), "ошибка прокси-сервера") {
+			t.Errorf("%s: ошибка %v, ожидалась ошибка прокси-сервера", scheme, err)
+		}
+	}
+}
+
+func TestIsProxyError(t *testing.T) {
+	tests := []struct {
+		err  error
+		want bool
+	}{
+		{&net.OpError{Op: "proxyconnect", Net: "tcp", Err: errors.New("connection refused")}, true},
+		{&net.OpError{Op: "socks connect", Net: "tcp", Err: errors.New("connection refused")}, true},
+		{&url.Error{Op: "Get", URL: "http://feed.invalid/", Err: &net.OpError{Op: "proxyconnect", Net: "tcp", Err: errors.New("timeout")}}, true},
+		{&net.OpError{Op: "dial", Net: "tcp", Err: errors.New("connection refused")}, false},
+		{&url.Error{Op: "Get", URL: "http://feed.invalid/", Err: &net.DNSError{Err: "no such host", Name: "feed.invalid"}}, false},
+		{errors.New("proxyconnect tcp: refused"), false},
+		{nil, false},
+	}
+	for _, tt := range tests {
+		if got := isProxyError(tt.err); got != tt.want {
+			t.Errorf("isProxyError(%v) = %v, ожидалось %v", tt.err, got, tt.want)
+		}
+	}
+}
+
+// Флаг -update перезаписывает эталонные файлы в testdata вместо сравнения с ними
+var update = flag.Bool("update", false, "перезаписать эталоны в testdata")
+
+// checkGolden сравнивает вывод с эталоном testdata/name (с -update — записывает эталон).
+func checkGolden(t *testing.T, name string, got []byte) {
+	t.Helper()
+	path := filepath.Join("testdata", name)
+	if *update {
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, got, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	want, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, want) {
+		t.Errorf("%s не совпадает с эталоном:\n--- получено\n%s\n--- ожидалось\n%s", path, got, want)
+	}
+}
+
+// TestWriteFeedGolden сверяет --output=md и --output=html с эталонами: разметка Markdown
+// и HTML в заголовках, переводы строк, адреса с пробелами, скобками и кавычками,
+// статьи без ссылки и даты, вложения, картинки и описания.
+func TestWriteFeedGolden(t *testing.T) {
+	rss := &RSS{Channel: Channel{Title: "# Новости | *дня*", Items: []Item{
+		{
+			Title:       "*Жирный* _курсив_ [ссылка](x) <b>тег</b> `код` \\ ! ~ #1\nвторая строка",
+			Link:        " https://example.com/a b (1) ",
+			PubDate:     "Tue, 13 Oct 2026 09:05:07 +0300",
+			Author:      "Иван_Петров",
+			Categories:  []string{"Go", "C#"},
+			Comments:    "https://example.com/a#comments",
+			Description: "<p>Первый абзац с *звёздочками*.</p><p>> не цитата</p>",
+			Enclosures:  []Enclosure{{URL: "https://cdn.example.com/ep_1.mp3", Length: 1 << 20, Type: "audio/mpeg"}},
+		},
+		{
+			Title:       `Tom & Jerry <script>alert("x")</script> 'кавычки'`,
+			Link:        `https://example.com/?a=1&b="2"`,
+			Image:       &itemImage{URL: `https://example.com/img.png?w=1&h=2`, Width: 640, Height: 480},
+			Description: "Строка 1 & <строка>\nСтрока 2",
+			AlsoIn:      []string{"Другая <лента>", "Третья_лента"},
+		},
+		{Title: "Без ссылки и даты"},
+	}}}
+	opts := printOptions{show: showFields{title: true, desc: true, enclosure: true}, width: 80}
+	var md, page bytes.Buffer
+	writeMarkdownFeed(&md, rss, opts)
+	writeHTMLFeed(&page, rss, opts)
+	checkGolden(t, "output/feed.md", md.Bytes())
+	checkGolden(t, "output/feed.html", page.Bytes())
+}
+
+func TestHumanizeAge(t *testing.T) {
+	now := time.Date(2026, time.October, 14, 12, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name string
+		age  time.Duration // Насколько статья старше now; отрицательное — дата в будущем
+		want string
+	}{
+		{"та же секунда", 0, "только что"},
+		{"59 с", 59 * time.Second, "только что"},
+		{"ровно минута", time.Minute, "1 мин назад"},
+		{"59 мин 59 с", time.Hour - time.Second, "59 мин назад"},
+		{"ровно час", time.Hour, "1 ч назад"},
+		{"23 ч 59 мин", 24*time.Hour - time.Minute, "23 ч назад"},
+		{"ровно сутки", 24 * time.Hour, "1 дн назад"},
+		{"без секунды 7 дней", relativeDays*24*time.Hour - time.Second, "6 дн назад"},
+		{"ровно 7 дней", relativeDays * 24 * time.Hour, "2026-10-07 12:00"},
+		{"месяц", 30 * 24 * time.Hour, "2026-09-14 12:00"},
+		{"через 30 с", -30 * time.Second, "только что"},
+		{"через 59 мин", -59 * time.Minute, "через 59 мин"},
+		{"через час", -time.Hour, "через 1 ч"},
+		{"через 3 дня", -3 * 24 * time.Hour, "через 3 дн"},
+		{"через 7 дней", -relativeDays * 24 * time.Hour, "2026-10-21 12:00"},
+	}
+	local := time.Local
+	time.Local = time.UTC // Даты дальше недели выводятся в местном времени
+	defer func() { time.Local = local }()
+	for _, tt := range tests {
+		if got := humanizeAge(now.Add(-tt.age), now); got != tt.want {
+			t.Errorf("%s: humanizeAge = %q, ожидалось %q", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestParseSelection(t *testing.T) {
+	items := []Item{{Link: "https://example.com/1"}, {Link: "https://example.com/2"}, {Link: " "}, {Link: "https://example.com/4"}}
+	tests := []struct {
+		in   string
+		want []int
+		err  string // Часть текста ошибки; пустая — ошибки нет
+	}{
+		{"1", []int{0}, ""},
+		{"2 1", []int{1, 0}, ""},
+		{"1,2", []int{0, 1}, ""},
+		{" 1 ,\t4 ", []int{0, 3}, ""},
+		{"1-2", []int{0, 1}, ""},
+		{"4-4", []int{3}, ""},
+		{"1 1-2 2", []int{0, 1}, ""},
+		{"", nil, ""},
+		{"0", nil, "от 1 до 4"},
+		{"5", nil, "от 1 до 4"},
+		{"2-1", nil, "неверный номер \"2-1\""},
+		{"1-5", nil, "от 1 до 4"},
+		{"1-", nil, "неверный номер"},
+		{"-2", nil, "неверный номер"},
+		{"один", nil, "неверный номер"},
+		{"3", nil, "у статьи 3 нет ссылки"},
+		{"2-4", nil, "у статьи 3 нет ссылки"},
+	}
+	for _, tt := range tests {
+		got, err := parseSelection(tt.in, items)
+		switch {
+		case tt.err != "" && (err == nil || !strings.Contains(err.Error(), tt.err)):
+			t.Errorf("parseSelection(%q): ошибка %v, ожидалась %q", tt.in, err, tt.err)
+		case tt.err == "" && err != nil:
+			t.Errorf("parseSelection(%q): %v", tt.in, err)
+		case !slices.Equal(got, tt.want):
+			t.Errorf("parseSelection(%q) = %v, ожидалось %v", tt.in, got, tt.want)
+		}
+	}
+}
+
+// captureStderr возвращает то, что f вывела в os.Stderr.
+func captureStderr(t *testing.T, f func()) string {
+	t.Helper()
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	stderr := os.Stderr
+	os.Stderr = w
+	out := make(chan string)
+	go func() {
+		var buf bytes.Buffer
+		buf.ReadFrom(r)
+		out <- buf.String()
+	}()
+	defer func() { os.Stderr = stderr }()
+	f()
+	w.Close()
+	return <-out
+}
+
+func TestInteractive(t *testing.T) {
+	items := []Item{
+		{Title: "Первая", Link: "https://example.com/1"},
+		{Title: "Без ссылки"},
+		{Title: "Третья", Link: " https://example.com/3 "},
+		{Title: "Сломанная", Link: "https://example.com/fail"},
+	}
+	const prompt = "Открыть статьи"
+	tests := []struct {
+		name    string
+		input   string
+		opened  []string
+		prompts int      // Сколько раз выведено приглашение
+		errors  []string // Что должно оказаться в stderr
+	}{
+		{"диапазон и номера", "1-1 3\n", []string{"https://example.com/1", "https://example.com/3"}, 2, nil},
+		{"конец ввода без перевода строки", "3", []string{"https://example.com/3"}, 2, nil},
+		{"сразу конец ввода", "", nil, 1, nil},
+		{"q завершает", "1\nq\n3\n", []string{"https://example.com/1"}, 2, nil},
+		{"неверный ввод повторяет запрос", "x\n9\n\n1\n", []string{"https://example.com/1"}, 5,
+			[]string{`неверный номер "x"`, `неверный номер "9"`}},
+		{"статья без ссылки", "2\n1-3\n3\n", []string{"https://example.com/3"}, 4, []string{"у статьи 2 нет ссылки"}},
+		{"ошибка программы не прерывает выбор", "4 1\n", []string{"https://example.com/fail", "https://example.com/1"}, 2,
+			[]string{"не удалось открыть https://example.com/fail: отказ"}},
+	}
+	for _, tt := range tests {
+		var opened []string
+		o := &linkOpener{command: []string{"browser", "--new-tab"}, run: func(name string, args ...string) error {
+			if name != "browser" || len(args) != 2 || args[0] != "--new-tab" {
+				t.Errorf("%s: запущено %s %q", tt.name, name, args)
+			}
+			link := args[len(args)-1]
+			opened = append(opened, link)
+			if strings.HasSuffix(link, "/fail") {
+				return errors.New("отказ")
+			}
+			return nil
+		}}
+		stderr := captureStderr(t, func() { interactive(strings.NewReader(tt.input), items, o) })
+		if !slices.Equal(opened, tt.opened) {
+			t.Errorf("%s: открыто %q, ожидалось %q", tt.name, opened, tt.opened)
+		}
+		if n := strings.Count(stderr, prompt); n != tt.prompts {
+			t.Errorf("%s: приглашений %d, ожидалось %d:\n%s", tt.name, n, tt.prompts, stderr)
+		}
+		for _, want := range tt.errors {
+			if !strings.Contains(stderr, want) {
+				t.Errorf("%s: в stderr нет %q:\n%s", tt.name, want, stderr)
+			}
+		}
+	}
+}
+
+// TestCompileExec проверяет, что подстановки --exec становятся ссылками на позиционные
+// параметры с учётом кавычек шаблона, а подстановка в одинарных кавычках отклоняется.
+func TestCompileExec(t *testing.T) {
+	tests := []struct {
+		tmpl    string
+		want    string
+		wantErr bool
+	}{
+		{"notify -t {title} -c {link}", `notify -t "${1}" -c "${2}"`, false},
+		{`notify -t "{title}" -c "из {feed}: {link}"`, `notify -t "${1}" -c "из ${3}: ${2}"`, false},
+		{"echo pre{date}post {unknown}", `echo pre"${4}"post {unknown}`, false},
+		{`echo \"{title}\" '"' {title}`, `echo \""${1}"\" '"' "${1}"`, false},
+		{"echo '{title}'", "", true},
+		{`echo "it's {title}"`, `echo "it's ${1}"`, false},
+	}
+	for _, tt := range tests {
+		got, err := compileExec(tt.tmpl, execPlaceholders)
+		if (err != nil) != tt.wantErr || got != tt.want {
+			t.Errorf("compileExec(%q) = %q, %v; ожидалось %q, ошибка: %v", tt.tmpl, got, err, tt.want, tt.wantErr)
+		}
+	}
+}
+
+// TestRunExec запускает --exec через sh -c: подстановки с кавычками, переводами строк
+// и подстановкой команд доходят до команды как есть (и без кавычек, и внутри двойных), ошибка команды не прерывает
+// следующие, а после --exec-limit команды не запускаются, но считаются.
+func TestRunExec(t *testing.T) {
+	if _, err := exec.LookPath("sh"); err != nil {
+		t.Skip("нет sh")
+	}
+	dir := t.TempDir()
+	log, printed := filepath.Join(dir, "log"), filepath.Join(dir, "out")
+	outFile, err := os.Create(printed)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer outFile.Close()
+	r := &runner{out: bufio.NewWriter(outFile), execLeft: 4}
+	// Поля разделены нулевым байтом: в заголовке может быть перевод строки. Последним
+	// полем идёт уже выведенное, чтобы проверить, что вывод сброшен до запуска команды.
+	// Заголовок подставляется и без кавычек, и внутри двойных, как пишут естественно:
+	// -t "{title}". В обоих случаях $(...) из заголовка не должен выполниться.
+	script, err := compileExec(`[ {title} != fail ] || exit 3; printf '%s\0' {title} {link} {feed} "дата: "{date} "в кавычках: {title}" "$(cat '`+printed+`')" >> '`+log+`'`, execPlaceholders)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r.execScript = script
+
+	items := []Item{
+		{Title: "Don't panic", Link: " https://example.com/a?x=1&y=2 ", PubDate: "Tue, 13 Oct 2026 09:05:07 +0300"},
+		{Title: "fail"},
+		{Title: "Две\nстроки; $(touch " + filepath.Join(dir, "pwned") + ") `id` $HOME \\ \"", Link: "https://example.com/b"},
+		{Title: "'", Link: "https://example.com/'c'"},
+		{Title: "Сверх лимита"},
+		{Title: "И эта"},
+	}
+	stderr := captureStderr(t, func() {
+		for i, item := range items {
+			fmt.Fprintf(r.out, "статья %d\n", i+1)
+			r.runExec("Лента 'Новости'; rm -rf /", item)
+		}
+	})
+	if want := "Команда для статьи \"fail\" завершилась с ошибкой: exit status 3\n"; stderr != want {
+		t.Errorf("stderr: %q, ожидалось %q", stderr, want)
+	}
+
+	data, err := os.ReadFile(log)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := strings.Split(strings.TrimSuffix(string(data), "\x00"), "\x00")
+	want := []string{
+		"Don't panic", "https://example.com/a?x=1&y=2", "Лента 'Новости'; rm -rf /", "дата: Tue, 13 Oct 2026 09:05:07 +0300", "в кавычках: Don't panic", "статья 1",
+		items[2].Title, "https://example.com/b", "Лента 'Новости'; rm -rf /", "дата: ", "в кавычках: " + items[2].Title, "статья 1\nстатья 2\nстатья 3",
+		"'", "https://example.com/'c'", "Лента 'Новости'; rm -rf /", "дата: ", "в кавычках: '", "статья 1\nстатья 2\nстатья 3\nстатья 4",
+	}
+	if !slices.Equal(got, want) {
+		t.Errorf("команды получили:\n%q\nожидалось:\n%q", got, want)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "pwned")); err == nil {
+		t.Error("подстановка $(...) в заголовке выполнена")
+	}
+	if r.execLeft != 0 || r.execSkipped != 2 {
+		t.Errorf("execLeft = %d, execSkipped = %d; ожидалось 0 и 2 (неудачная команда тоже считается)", r.execLeft, r.execSkipped)
+	}
+}
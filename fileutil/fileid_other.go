@@ -0,0 +1,11 @@
+//go:build !unix
+
+package fileutil
+
+import "io/fs"
+
+// fileID здесь недоступен: FileInfo не содержит устройства и inode, поэтому
+// вызывающий код сравнивает файлы через os.SameFile.
+func fileID(info fs.FileInfo) ([2]uint64, bool) {
+	return [2]uint64{}, false
+}
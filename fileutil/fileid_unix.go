@@ -0,0 +1,17 @@
+//go:build unix
+
+package fileutil
+
+import (
+	"io/fs"
+	"syscall"
+)
+
+// fileID возвращает пару (устройство, inode) файла: одинаковая пара — один и тот же файл.
+func fileID(info fs.FileInfo) ([2]uint64, bool) {
+	st, ok := info.Sys().(*syscall.Stat_t)
+	if !ok {
+		return [2]uint64{}, false
+	}
+	return [2]uint64{uint64(st.Dev), uint64(st.Ino)}, true
+}
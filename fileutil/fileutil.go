@@ -0,0 +1,3046 @@
+// Package fileutil — ядро утилиты fileutil для использования из других программ:
+// обход дерева с фильтрами, хэширование с кэшем и ограничением скорости, поиск
+// дубликатов файлов, планы переименования и нормализации имён и их выполнение с откатом.
+// Функции пакета ничего не печатают и не завершают процесс: ошибки возвращаются,
+// ход работы передаётся в необязательный обратный вызов, долгие операции отменяются
+// через context.
+package fileutil
+
+import (
+	"bufio"
+	"context"
+	"crypto/md5"
+	"crypto/sha1"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/csv"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash"
+	"hash/crc32"
+	"hash/fnv"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"time"
+	"unicode"
+)
+
+// Option настраивает функции пакета; опции, не относящиеся к функции, игнорируются.
+type Option func(*config)
+
+// config — параметры, собранные из Option.
+type config struct {
+	minSize, maxSize int64    // Диапазон размеров файлов (0 — без ограничения)
+	skipHidden       bool     // Пропускать имена, начинающиеся с точки
+	exclude          []string // Шаблоны filepath.Match для имён и путей относительно корня
+	followSymlinks   bool
+	includeExt       map[string]bool // Расширения в нижнем регистре с точкой
+	excludeExt       map[string]bool
+
+	algorithm string
+	workers   int          // Параллельно хэшируемые файлы (0 — по числу CPU)
+	bufSize   int64        // Буфер чтения (0 — DefaultReadBuffer)
+	limiter   *RateLimiter // Общее ограничение скорости чтения (nil — без ограничения)
+	counter   *int64       // Счётчик прочитанных байт, обновляется атомарно (nil — не считать)
+	cache     *HashCache
+	quick     bool
+	byName    bool // Группировать по имени и размеру
+	verify    bool // Подтверждать группы по имени и размеру хэшем
+	progress  func(Progress)
+
+	prefix      string
+	start, step int
+	width       int
+	exts        map[string]bool // Переименовывать только файлы с этими расширениями (пусто — все)
+	recursive   bool
+	global      bool   // Сквозная нумерация по всему дереву
+	sortBy      string // name, mtime или size
+	reverse     bool
+	template    string
+	dateFmt     string // Раскладка даты для имён по дате съёмки (пусто — не по дате)
+	origSuffix  bool
+	dest        string // Директория для копий под новыми именами (пусто — переименование на месте)
+	overwrite   bool
+	skipped     func(path, reason string)
+
+	move func(src, dst string) error // Перемещение файлов карантина (nil — MoveFile)
+}
+
+func newConfig(opts []Option) config {
+	c := config{algorithm: "sha256", workers: 1, prefix: "file", start: 1, step: 1, sortBy: "name"}
+	for _, opt := range opts {
+		opt(&c)
+	}
+	return c
+}
+
+// WithMinSize пропускает файлы меньше n байт.
+func WithMinSize(n int64) Option { return func(c *config) { c.minSize = n } }
+
+// WithMaxSize пропускает файлы больше n байт.
+func WithMaxSize(n int64) Option { return func(c *config) { c.maxSize = n } }
+
+// WithSkipHidden пропускает файлы и директории, имена которых начинаются с точки.
+func WithSkipHidden() Option { return func(c *config) { c.skipHidden = true } }
+
+// WithExclude пропускает пути, совпавшие с шаблонами filepath.Match по имени или по пути
+// относительно корня; исключённые директории не обходятся.
+func WithExclude(patterns ...string) Option {
+	return func(c *config) { c.exclude = append(c.exclude, patterns...) }
+}
+
+// WithFollowSymlinks переходит по символическим ссылкам; циклы и файлы, достижимые
+// по нескольким путям, обрабатываются один раз.
+func WithFollowSymlinks() Option { return func(c *config) { c.followSymlinks = true } }
+
+// WithIncludeExt оставляет при обходе только файлы с указанными расширениями
+// ("jpg", ".png" или списки через запятую, без учёта регистра).
+func WithIncludeExt(exts ...string) Option {
+	return func(c *config) { c.includeExt = addExts(c.includeExt, exts) }
+}
+
+// WithExcludeExt пропускает при обходе файлы с указанными расширениями (как WithIncludeExt).
+func WithExcludeExt(exts ...string) Option {
+	return func(c *config) { c.excludeExt = addExts(c.excludeExt, exts) }
+}
+
+// WithHash выбирает алгоритм хэширования: sha256 (по умолчанию), sha1, md5, crc32 или fnv.
+func WithHash(algorithm string) Option { return func(c *config) { c.algorithm = algorithm } }
+
+// WithWorkers задаёт, сколько файлов хэшируется параллельно (по умолчанию 1, 0 — по числу CPU).
+func WithWorkers(n int) Option { return func(c *config) { c.workers = n } }
+
+// WithReadBuffer задаёт размер буфера чтения (по умолчанию DefaultReadBuffer).
+func WithReadBuffer(n int64) Option { return func(c *config) { c.bufSize = n } }
+
+// WithThrottle ограничивает суммарную скорость чтения общим limiter (nil — без ограничения).
+func WithThrottle(limiter *RateLimiter) Option { return func(c *config) { c.limiter = limiter } }
+
+// WithReadCounter прибавляет к *n каждый прочитанный при хэшировании байт.
+func WithReadCounter(n *int64) Option { return func(c *config) { c.counter = n } }
+
+// WithCache берёт хэши неизменённых файлов из cache и сохраняет в него новые.
+func WithCache(cache *HashCache) Option { return func(c *config) { c.cache = cache } }
+
+// WithQuick останавливает FindDuplicates на хэше первых и последних PartialBlock байт:
+// большие файлы с совпавшим хэшем — лишь вероятные дубликаты.
+func WithQuick() Option { return func(c *config) { c.quick = true } }
+
+// WithNameSize группирует файлы по базовому имени (без учёта регистра) и размеру, не читая их;
+// с verify группы дополнительно разбиваются по хэшу содержимого.
+func WithNameSize(verify bool) Option {
+	return func(c *config) { c.byName, c.verify = true, verify }
+}
+
+// WithProgress задаёт обратный вызов хода поиска; вызовы не пересекаются по времени.
+func WithProgress(fn func(Progress)) Option { return func(c *config) { c.progress = fn } }
+
+// WithPrefix задаёт префикс новых имён RenamePlan (по умолчанию "file").
+func WithPrefix(prefix string) Option { return func(c *config) { c.prefix = prefix } }
+
+// WithNumbering задаёт первый номер и шаг счётчика RenamePlan.
+func WithNumbering(start, step int) Option {
+	return func(c *config) { c.start, c.step = start, step }
+}
+
+// WithWidth задаёт ширину номера с ведущими нулями (0 — по последнему номеру, не меньше 3).
+func WithWidth(width int) Option { return func(c *config) { c.width = width } }
+
+// WithExtensions ограничивает RenamePlan файлами с указанными расширениями (как WithIncludeExt).
+func WithExtensions(exts ...string) Option {
+	return func(c *config) { c.exts = addExts(c.exts, exts) }
+}
+
+// WithRecursive обрабатывает и поддиректории.
+func WithRecursive() Option { return func(c *config) { c.recursive = true } }
+
+// WithGlobalNumbering ведёт сквозной счётчик по всему дереву вместо отдельного в каждой директории.
+func WithGlobalNumbering() Option { return func(c *config) { c.global = true } }
+
+// WithSort задаёт порядок нумерации: name (по умолчанию), mtime или size; при равенстве — по имени.
+func WithSort(key string, reverse bool) Option {
+	return func(c *config) { c.sortBy, c.reverse = key, reverse }
+}
+
+// WithTemplate задаёт шаблон нового имени: {num}, {num:N}, {ext}, {name}, {date}, {prefix}.
+func WithTemplate(tmpl string) Option { return func(c *config) { c.template = tmpl } }
+
+// WithByDate строит имя из даты съёмки (EXIF) или времени изменения в раскладке layout
+// пакета time; префикс при этом необязателен, совпавшие даты получают суффикс _1, _2...
+func WithByDate(layout string) Option { return func(c *config) { c.dateFmt = layout } }
+
+// WithOriginalSuffix добавляет к новому имени исходное: trip_001__DSC_04512.jpg.
+func WithOriginalSuffix() Option { return func(c *config) { c.origSuffix = true } }
+
+// WithDest строит план копирования в dir (с теми же поддиректориями) вместо переименования;
+// без overwrite существующие файлы в dir считаются конфликтом.
+func WithDest(dir string, overwrite bool) Option {
+	return func(c *config) { c.dest, c.overwrite = dir, overwrite }
+}
+
+// WithMove задаёт, чем Quarantine, Restore и Undo перемещают файлы (по умолчанию как MoveFile).
+func WithMove(move func(src, dst string) error) Option { return func(c *config) { c.move = move } }
+
+// WithSkipped сообщает о файлах, которые RenamePlan оставил без изменений, и причине.
+func WithSkipped(fn func(path, reason string)) Option { return func(c *config) { c.skipped = fn } }
+
+// addExts добавляет расширения из values в множество set (создавая его при необходимости).
+func addExts(set map[string]bool, values []string) map[string]bool {
+	if set == nil {
+		set = make(map[string]bool)
+	}
+	for ext := range parseExtList(values) {
+		set[ext] = true
+	}
+	return set
+}
+
+// parseExtList превращает значения вида "jpg,JPEG" и ".png" в множество расширений
+// в нижнем регистре с точкой. Пустое множество означает "любые расширения".
+func parseExtList(values []string) map[string]bool {
+	set := make(map[string]bool)
+	for _, value := range values {
+		for _, ext := range strings.Split(value, ",") {
+			ext = strings.ToLower(strings.TrimSpace(ext))
+			if ext == "" {
+				continue
+			}
+			if !strings.HasPrefix(ext, ".") {
+				ext = "." + ext
+			}
+			set[ext] = true
+		}
+	}
+	return set
+}
+
+// Group — файлы с одинаковым содержимым (или, с WithNameSize, с одинаковым именем и размером).
+type Group struct {
+	Hash  string   `json:"hash"` // С WithNameSize без проверки — имя файла в нижнем регистре
+	Size  int64    `json:"size"` // Размер одного файла в байтах
+	Paths []string `json:"paths"`
+}
+
+// Wasted возвращает место, которое освободится, если оставить одну копию.
+func (g Group) Wasted() int64 {
+	return g.Size * int64(len(g.Paths)-1)
+}
+
+// sortGroups сортирует группы по убыванию освобождаемого места, при равенстве — по первому пути.
+func sortGroups(groups []Group) {
+	sort.Slice(groups, func(i, j int) bool {
+		if wi, wj := groups[i].Wasted(), groups[j].Wasted(); wi != wj {
+			return wi > wj
+		}
+		return groups[i].Paths[0] < groups[j].Paths[0]
+	})
+}
+
+// FileError — файл, пропущенный из-за ошибки обхода или чтения.
+type FileError struct {
+	Path string
+	Err  error
+}
+
+func (e *FileError) Error() string { return e.Path + ": " + e.Err.Error() }
+
+func (e *FileError) Unwrap() error { return e.Err }
+
+// Kind классифицирует ошибку: permission, vanished (файл исчез) или read.
+func (e *FileError) Kind() string {
+	switch {
+	case errors.Is(e.Err, fs.ErrPermission):
+		return "permission"
+	case errors.Is(e.Err, fs.ErrNotExist):
+		return "vanished"
+	}
+	return "read"
+}
+
+// MarshalJSON кодирует ошибку как {"path", "kind", "error"}.
+func (e *FileError) MarshalJSON() ([]byte, error) {
+	return json.Marshal(struct {
+		Path  string `json:"path"`
+		Kind  string `json:"kind"`
+		Error string `json:"error"`
+	}{e.Path, e.Kind(), e.Err.Error()})
+}
+
+// WalkStats — итоги обхода: прошедшие фильтры файлы и пропущенные записи.
+type WalkStats struct {
+	Files         int          `json:"-"`                // Файлы, прошедшие фильтры
+	SkippedBySize int          `json:"skipped_by_size"`  // Файлы, отброшенные фильтром размера
+	Symlinks      int          `json:"symlinks"`         // Символические ссылки, по которым не переходили
+	Hidden        int          `json:"hidden"`           // Скрытые файлы и директории (WithSkipHidden)
+	Excluded      int          `json:"excluded"`         // Пути, исключённые шаблонами WithExclude
+	SkippedByExt  int          `json:"skipped_by_ext"`   // Файлы, отброшенные фильтром расширений
+	Errors        []*FileError `json:"errors,omitempty"` // Файлы, пропущенные из-за ошибок обхода или чтения
+}
+
+// Add суммирует счётчики двух обходов.
+func (s *WalkStats) Add(other WalkStats) {
+	s.Files += other.Files
+	s.SkippedBySize += other.SkippedBySize
+	s.Symlinks += other.Symlinks
+	s.Hidden += other.Hidden
+	s.Excluded += other.Excluded
+	s.SkippedByExt += other.SkippedByExt
+	s.Errors = append(s.Errors, other.Errors...)
+}
+
+// Stats — итоги поиска дубликатов.
+type Stats struct {
+	WalkStats
+	Hashed        int   // Файлы с полным хэшем (вычисленным или взятым из кэша)
+	CacheHits     int   // Хэши, взятые из кэша
+	PartialHashed int   // Файлы, прошедшие предварительное хэширование начала и конца
+	PartialUnique int   // Из них отсеяны без полного хэширования
+	BytesHashed   int64 // Байт в файлах, хэшированных целиком
+}
+
+// Progress — ход поиска. Stage: walk — обход (Total неизвестен), partial — хэш начала
+// и конца больших файлов, hash — полный хэш, verify — проверка групп WithNameSize хэшем.
+type Progress struct {
+	Stage       string
+	Done, Total int
+	Bytes       int64 // Объём файлов, хэшированных целиком (этап hash)
+	Final       bool  // Этап завершён
+}
+
+// HashAlgorithms — поддерживаемые алгоритмы хэширования.
+var HashAlgorithms = []string{"sha256", "sha1", "md5", "crc32", "fnv"}
+
+// NewHasher возвращает новый hash.Hash для алгоритма с указанным именем.
+func NewHasher(name string) (hash.Hash, error) {
+	switch name {
+	case "sha256":
+		return sha256.New(), nil
+	case "sha1":
+		return sha1.New(), nil
+	case "md5":
+		return md5.New(), nil
+	case "crc32":
+		return crc32.NewIEEE(), nil
+	case "fnv":
+		return fnv.New64a(), nil
+	}
+	return nil, fmt.Errorf("неизвестный алгоритм хэширования %q (доступны: %s)", name, strings.Join(HashAlgorithms, ", "))
+}
+
+// Excluded сообщает, отброшен ли путь path внутри корня root фильтрами WithSkipHidden
+// и WithExclude. Шаблоны сравниваются и с базовым именем, и с путём относительно корня.
+func Excluded(root, path string, opts ...Option) bool {
+	c := newConfig(opts)
+	return c.excluded(root, path)
+}
+
+func (c *config) excluded(root, path string) bool {
+	rel, err := filepath.Rel(root, path)
+	if err != nil || rel == "." {
+		// Сам корень обхода никогда не исключается.
+		return false
+	}
+	name := filepath.Base(path)
+	if c.skipHidden && strings.HasPrefix(name, ".") {
+		return true
+	}
+	for _, pattern := range c.exclude {
+		if ok, _ := filepath.Match(pattern, name); ok {
+			return true
+		}
+		if ok, _ := filepath.Match(pattern, rel); ok {
+			return true
+		}
+		if ok, _ := filepath.Match(pattern, filepath.ToSlash(rel)); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// Walk рекурсивно обходит root и вызывает fn для каждого файла, прошедшего фильтры
+// (WithMinSize, WithMaxSize, WithSkipHidden, WithExclude, WithIncludeExt, WithExcludeExt).
+// Исключённые директории пропускаются целиком. Символические ссылки по умолчанию пропускаются;
+// с WithFollowSymlinks обход переходит по ним, а уже посещённые директории (циклы)
+// и файлы, достижимые по нескольким путям, обрабатываются один раз. Недоступный корень —
+// ошибка, недоступные записи внутри попадают в WalkStats.Errors.
+func Walk(ctx context.Context, root string, fn func(path string, info fs.FileInfo), opts ...Option) (WalkStats, error) {
+	c := newConfig(opts)
+	return c.walk(ctx, root, fn)
+}
+
+func (c *config) walk(ctx context.Context, root string, fn func(path string, info fs.FileInfo)) (WalkStats, error) {
+	var stats WalkStats
+	// Посещённые директории запоминаются по паре (устройство, inode); если система
+	// её не сообщает (fileID в fileid_other.go), директории сравниваются через os.SameFile.
+	visitedDirs := make(map[[2]uint64]struct{})
+	var otherDirs []fs.FileInfo
+	seenFiles := make(map[string]bool)
+
+	// visitDir запоминает директорию и сообщает, встречалась ли она раньше.
+	visitDir := func(info fs.FileInfo) bool {
+		if key, ok := fileID(info); ok {
+			if _, seen := visitedDirs[key]; seen {
+				return true
+			}
+			visitedDirs[key] = struct{}{}
+			return false
+		}
+		for _, seen := range otherDirs {
+			if os.SameFile(seen, info) {
+				return true
+			}
+		}
+		otherDirs = append(otherDirs, info)
+		return false
+	}
+
+	var walk func(start string) error
+	walk = func(start string) error {
+		return filepath.Walk(start, func(path string, info fs.FileInfo, err error) error {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			if err != nil && path == root {
+				// Недоступный корень обхода — ошибка, а не пропущенный файл.
+				return err
+			}
+			if err != nil {
+				stats.Errors = append(stats.Errors, &FileError{Path: path, Err: err})
+				return nil
+			}
+			if c.skipHidden && path != start && strings.HasPrefix(info.Name(), ".") {
+				stats.Hidden++
+				if info.IsDir() {
+					return filepath.SkipDir
+				}
+				return nil
+			}
+			if c.excluded(root, path) {
+				stats.Excluded++
+				if info.IsDir() {
+					return filepath.SkipDir
+				}
+				return nil
+			}
+			if info.Mode()&fs.ModeSymlink != 0 {
+				if !c.followSymlinks {
+					stats.Symlinks++
+					return nil
+				}
+				target, err := os.Stat(path)
+				if err != nil {
+					// Битая ссылка.
+					stats.Symlinks++
+					return nil
+				}
+				if target.IsDir() {
+					// Разделитель в конце заставляет Walk перейти по ссылке.
+					return walk(path + string(os.PathSeparator))
+				}
+				info = target
+			}
+			if info.IsDir() {
+				if c.followSymlinks && visitDir(info) {
+					return filepath.SkipDir
+				}
+				return nil
+			}
+			if c.followSymlinks {
+				real, err := filepath.EvalSymlinks(path)
+				if err != nil || seenFiles[real] {
+					return nil
+				}
+				seenFiles[real] = true
+			}
+			ext := strings.ToLower(filepath.Ext(path))
+			if (len(c.includeExt) > 0 && !c.includeExt[ext]) || c.excludeExt[ext] {
+				stats.SkippedByExt++
+				return nil
+			}
+			if (c.minSize > 0 && info.Size() < c.minSize) || (c.maxSize > 0 && info.Size() > c.maxSize) {
+				stats.SkippedBySize++
+				return nil
+			}
+			stats.Files++
+			fn(filepath.Clean(path), info)
+			return nil
+		})
+	}
+	err := walk(root)
+	return stats, err
+}
+
+// DefaultReadBuffer — размер буфера чтения по умолчанию.
+const DefaultReadBuffer = 32 << 10
+
+// PartialBlock — сколько байт с начала и с конца файла читает предварительный этап
+// FindDuplicates; ему подвергаются файлы больше 2*PartialBlock.
+const PartialBlock = 64 << 10
+
+// RateLimiter — token bucket, общий для всех горутин чтения; запас не больше секунды чтения.
+type RateLimiter struct {
+	mu     sync.Mutex
+	rate   float64 // Байт в секунду
+	tokens float64
+	last   time.Time
+}
+
+// NewRateLimiter создаёт ограничение скорости чтения в bytesPerSec байт в секунду.
+func NewRateLimiter(bytesPerSec int64) *RateLimiter {
+	return &RateLimiter{rate: float64(bytesPerSec), last: time.Now()}
+}
+
+// Rate возвращает ограничение в байтах в секунду.
+func (l *RateLimiter) Rate() int64 { return int64(l.rate) }
+
+// wait расходует n байт из запаса и ждёт, если запас ушёл в минус.
+func (l *RateLimiter) wait(n int) {
+	if l == nil {
+		return
+	}
+	l.mu.Lock()
+	now := time.Now()
+	l.tokens += now.Sub(l.last).Seconds() * l.rate
+	if l.tokens > l.rate {
+		l.tokens = l.rate
+	}
+	l.last = now
+	l.tokens -= float64(n)
+	var delay time.Duration
+	if l.tokens < 0 {
+		delay = time.Duration(-l.tokens / l.rate * float64(time.Second))
+	}
+	l.mu.Unlock()
+	time.Sleep(delay)
+}
+
+// limitedReader ограничивает скорость чтения общим RateLimiter и прекращает чтение после отмены ctx.
+type limitedReader struct {
+	ctx     context.Context
+	r       io.Reader
+	limiter *RateLimiter
+}
+
+func (t limitedReader) Read(p []byte) (int, error) {
+	if err := t.ctx.Err(); err != nil {
+		return 0, err
+	}
+	n, err := t.r.Read(p)
+	t.limiter.wait(n)
+	return n, err
+}
+
+// count учитывает n прочитанных байт; вызывается из нескольких горутин.
+func (c *config) count(n int64) {
+	if c.counter != nil {
+		atomic.AddInt64(c.counter, n)
+	}
+}
+
+// copy копирует r в w буфером c.bufSize с учётом ограничения скорости.
+func (c *config) copy(ctx context.Context, w io.Writer, r io.Reader) (int64, error) {
+	size := c.bufSize
+	if size <= 0 {
+		size = DefaultReadBuffer
+	}
+	// limitedReader скрывает WriterTo у *os.File, поэтому io.CopyBuffer действительно использует буфер.
+	n, err := io.CopyBuffer(w, limitedReader{ctx: ctx, r: r, limiter: c.limiter}, make([]byte, size))
+	c.count(n)
+	return n, err
+}
+
+// HashFile вычисляет хэш содержимого файла (WithHash) с ограничениями чтения
+// WithReadBuffer, WithThrottle и WithReadCounter. Отмена ctx прерывает чтение.
+func HashFile(ctx context.Context, path string, opts ...Option) (string, error) {
+	c := newConfig(opts)
+	return c.hashFile(ctx, path)
+}
+
+func (c *config) hashFile(ctx context.Context, path string) (string, error) {
+	hasher, err := NewHasher(c.algorithm)
+	if err != nil {
+		return "", err
+	}
+	file, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+
+	if _, err := c.copy(ctx, hasher, file); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(hasher.Sum(nil)), nil
+}
+
+// hashPartial вычисляет хэш первых и последних PartialBlock байт файла размера size.
+// Совпадение такого хэша не доказывает равенство файлов, а различие — доказывает.
+func (c *config) hashPartial(path string, size int64) (string, error) {
+	hasher, err := NewHasher(c.algorithm)
+	if err != nil {
+		return "", err
+	}
+	file, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+
+	buf := make([]byte, PartialBlock)
+	for _, offset := range []int64{0, size - PartialBlock} {
+		if _, err := file.ReadAt(buf, offset); err != nil {
+			return "", err
+		}
+		c.limiter.wait(len(buf))
+		c.count(int64(len(buf)))
+		hasher.Write(buf)
+	}
+	return hex.EncodeToString(hasher.Sum(nil)), nil
+}
+
+// HashResult — результат хэширования одного файла.
+type HashResult struct {
+	Path string
+	Hash string
+	Err  error
+}
+
+// HashFiles хэширует файлы в WithWorkers горутинах и возвращает результаты
+// в порядке paths; после отмены ctx оставшиеся файлы получают ошибку ctx.Err().
+func HashFiles(ctx context.Context, paths []string, opts ...Option) []HashResult {
+	c := newConfig(opts)
+	results := make([]HashResult, len(paths))
+	c.run(len(paths), func(i int) {
+		h, err := c.hashFile(ctx, paths[i])
+		results[i] = HashResult{Path: paths[i], Hash: h, Err: err}
+	}, nil)
+	return results
+}
+
+// run выполняет work(i) для всех i из [0, n) в c.workers горутинах
+// (0 — по числу CPU, 1 — строго по порядку). done(i), если задан, вызывается после
+// каждого задания под общим мьютексом, поэтому в нём можно обновлять счётчики и прогресс.
+func (c *config) run(n int, work func(i int), done func(i int)) {
+	workers := c.workers
+	if workers <= 0 {
+		workers = runtime.NumCPU()
+	}
+	if workers > n {
+		workers = n
+	}
+	jobs := make(chan int)
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range jobs {
+				work(i)
+				if done != nil {
+					mu.Lock()
+					done(i)
+					mu.Unlock()
+				}
+			}
+		}()
+	}
+	for i := 0; i < n; i++ {
+		jobs <- i
+	}
+	close(jobs)
+	wg.Wait()
+}
+
+// cacheEntry — запись кэша хэшей; действительна, пока не изменились размер и время изменения.
+type cacheEntry struct {
+	Size      int64     `json:"size"`
+	ModTime   time.Time `json:"mtime"`
+	Algorithm string    `json:"algorithm"`
+	Hash      string    `json:"hash"`
+}
+
+// cacheFile — содержимое файла кэша.
+type cacheFile struct {
+	Entries map[string]cacheEntry `json:"entries"` // Абсолютный путь -> запись
+}
+
+// HashCache — кэш хэшей между запусками, хранится в JSON-файле. Нулевой указатель
+// означает "кэш выключен": хэш просто вычисляется. Кэш не рассчитан на одновременное
+// использование из нескольких горутин.
+type HashCache struct {
+	// Warn, если задан, получает ошибки периодического сохранения кэша во время
+	// длительного сканирования: хэши при этом посчитаны верно, поэтому это не ошибка поиска.
+	Warn func(err error)
+
+	path     string
+	entries  map[string]cacheEntry
+	dirty    bool
+	lastSave time.Time
+}
+
+// cacheSaveInterval — как часто кэш сохраняется во время длительного сканирования.
+const cacheSaveInterval = time.Minute
+
+// LoadHashCache открывает кэш по пути path (пусто — кэш только в памяти). При read=false
+// старые записи не читаются (все файлы хэшируются заново), но кэш всё равно будет перезаписан.
+func LoadHashCache(path string, read bool) (*HashCache, error) {
+	c := &HashCache{path: path, entries: make(map[string]cacheEntry), lastSave: time.Now()}
+	if !read || path == "" {
+		return c, nil
+	}
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return c, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var file cacheFile
+	if err := json.Unmarshal(data, &file); err != nil {
+		return nil, fmt.Errorf("повреждённый кэш %s: %v", path, err)
+	}
+	if file.Entries != nil {
+		c.entries = file.Entries
+	}
+	return c, nil
+}
+
+// Path возвращает файл кэша (пусто — кэш только в памяти).
+func (c *HashCache) Path() string {
+	if c == nil {
+		return ""
+	}
+	return c.path
+}
+
+// lookup возвращает сохранённый хэш файла, если размер и время изменения не поменялись.
+func (c *HashCache) lookup(path string, info fs.FileInfo, algorithm string) (string, bool) {
+	if c == nil {
+		return "", false
+	}
+	e, ok := c.entries[cacheKey(path)]
+	if ok && e.Algorithm == algorithm && e.Size == info.Size() && e.ModTime.Equal(info.ModTime()) {
+		return e.Hash, true
+	}
+	return "", false
+}
+
+// cacheKey возвращает ключ записи кэша — абсолютный путь к файлу.
+func cacheKey(path string) string {
+	if abs, err := filepath.Abs(path); err == nil {
+		return abs
+	}
+	return path
+}
+
+// Hash возвращает хэш файла из кэша, если размер и время изменения не поменялись, иначе
+// вычисляет его с опциями opts (как HashFile) и обновляет кэш. Второе значение — признак
+// попадания в кэш.
+func (c *HashCache) Hash(ctx context.Context, path string, info fs.FileInfo, opts ...Option) (string, bool, error) {
+	cfg := newConfig(opts)
+	return c.hash(ctx, &cfg, path, info)
+}
+
+func (c *HashCache) hash(ctx context.Context, cfg *config, path string, info fs.FileInfo) (string, bool, error) {
+	if h, ok := c.lookup(path, info, cfg.algorithm); ok {
+		return h, true, nil
+	}
+	h, err := cfg.hashFile(ctx, path)
+	if err != nil {
+		return "", false, err
+	}
+	if err := c.store(path, info, cfg.algorithm, h); err != nil {
+		c.warn(err)
+	}
+	return h, false, nil
+}
+
+// Forget удаляет запись о файле, чтобы кэш не рос с удалёнными файлами.
+func (c *HashCache) Forget(path string) {
+	if c == nil {
+		return
+	}
+	if _, ok := c.entries[cacheKey(path)]; ok {
+		delete(c.entries, cacheKey(path))
+		c.dirty = true
+	}
+}
+
+// store запоминает вычисленный хэш файла и периодически сохраняет кэш; возвращает
+// ошибку такого сохранения. Кэш при этом остаётся изменённым, а следующая попытка
+// будет не раньше чем через cacheSaveInterval, чтобы не писать файл на каждый хэш.
+func (c *HashCache) store(path string, info fs.FileInfo, algorithm, h string) error {
+	if c == nil {
+		return nil
+	}
+	c.entries[cacheKey(path)] = cacheEntry{Size: info.Size(), ModTime: info.ModTime(), Algorithm: algorithm, Hash: h}
+	c.dirty = true
+	if time.Since(c.lastSave) <= cacheSaveInterval {
+		return nil
+	}
+	if err := c.Save(); err != nil {
+		c.lastSave = time.Now()
+		return err
+	}
+	return nil
+}
+
+// warn передаёт ошибку сохранения в Warn, если он задан.
+func (c *HashCache) warn(err error) {
+	if c.Warn != nil {
+		c.Warn(err)
+	}
+}
+
+// Save атомарно записывает кэш, если в нём есть изменения.
+// Кэш без пути (только в памяти) не сохраняется.
+func (c *HashCache) Save() error {
+	if c == nil || !c.dirty || c.path == "" {
+		return nil
+	}
+	data, err := json.Marshal(cacheFile{Entries: c.entries})
+	if err != nil {
+		return err
+	}
+	if err := WriteFileAtomic(c.path, data); err != nil {
+		return err
+	}
+	c.dirty = false
+	c.lastSave = time.Now()
+	return nil
+}
+
+// WriteFileAtomic записывает файл через временный файл в той же директории и переименование,
+// чтобы прерванная запись не оставила повреждённый файл.
+func WriteFileAtomic(path string, data []byte) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".tmp-*")
+	if err != nil {
+		return err
+	}
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	return nil
+}
+
+// SameDevice сообщает, лежат ли два файла на одной файловой системе. Если устройство
+// узнать нельзя (не unix), считается, что да: os.Link сам откажет между томами.
+func SameDevice(a, b fs.FileInfo) bool {
+	idA, okA := fileID(a)
+	idB, okB := fileID(b)
+	return !okA || !okB || idA[0] == idB[0]
+}
+
+// scannedFile — найденный при обходе файл.
+type scannedFile struct {
+	path string
+	info fs.FileInfo
+}
+
+// FindDuplicates обходит рекурсивно директории roots (с фильтрами Walk) и возвращает группы
+// файлов с одинаковым содержимым, отсортированные по убыванию Wasted. Файл с уникальным
+// размером не может быть дубликатом, поэтому хэшируются только файлы с совпадающими
+// размерами, а большие из них сначала сравниваются по хэшу первых и последних PartialBlock
+// байт. Файл из нескольких пересекающихся корней учитывается один раз. Недоступный корень —
+// ошибка, недоступные файлы внутри попадают в Stats.Errors. Отмена ctx прерывает обход
+// и хэширование, тогда возвращается ctx.Err(), а кэш (WithCache) не сохраняется.
+func FindDuplicates(ctx context.Context, roots []string, opts ...Option) ([]Group, Stats, error) {
+	c := newConfig(opts)
+	var stats Stats
+	if _, err := NewHasher(c.algorithm); err != nil {
+		return nil, stats, err
+	}
+	// Первый проход: карта размер -> список файлов такого размера.
+	bySize := make(map[int64][]scannedFile)
+	report := func(p Progress) {
+		if c.progress != nil {
+			c.progress(p)
+		}
+	}
+
+	seen := make(map[string]bool)
+	discovered := 0
+	for _, root := range roots {
+		walked, err := c.walk(ctx, root, func(path string, info fs.FileInfo) {
+			if abs, err := filepath.Abs(path); err == nil {
+				if seen[abs] {
+					return
+				}
+				seen[abs] = true
+			}
+			bySize[info.Size()] = append(bySize[info.Size()], scannedFile{path: path, info: info})
+			discovered++
+			report(Progress{Stage: "walk", Done: discovered})
+		})
+		stats.WalkStats.Add(walked)
+		if err != nil {
+			return nil, stats, err
+		}
+	}
+	report(Progress{Stage: "walk", Done: discovered, Final: true})
+	if c.byName {
+		groups, err := c.groupByNameSize(ctx, bySize, &stats, report)
+		return groups, stats, err
+	}
+
+	// Кандидаты на хэширование — файлы с неуникальным размером; их общее число известно заранее.
+	candidates := 0
+	for _, files := range bySize {
+		if len(files) > 1 {
+			candidates += len(files)
+		}
+	}
+
+	// Второй проход: группы файлов с одинаковым размером и хэшем.
+	byHash := make(map[string]*Group)
+	addToGroup := func(key, hashValue string, size int64, path string) {
+		group, ok := byHash[key]
+		if !ok {
+			group = &Group{Hash: hashValue, Size: size}
+			byHash[key] = group
+		}
+		group.Paths = append(group.Paths, path)
+	}
+	// Размеры обрабатываются по порядку, чтобы с одним потоком порядок чтения был детерминированным.
+	var sizes []int64
+	for size, files := range bySize {
+		if len(files) > 1 {
+			sizes = append(sizes, size)
+		}
+	}
+	sort.Slice(sizes, func(i, j int) bool { return sizes[i] < sizes[j] })
+
+	var toHash []scannedFile
+
+	// Предварительный этап для больших файлов: хэш первых и последних PartialBlock байт.
+	// Полный хэш нужен только файлам, у которых и этот хэш совпал с чьим-то ещё.
+	var partialJobs []scannedFile
+	anyCached := make(map[int64]bool)
+	for _, size := range sizes {
+		files := bySize[size]
+		if size <= 2*PartialBlock {
+			toHash = append(toHash, files...)
+			continue
+		}
+		for _, file := range files {
+			if !c.quick {
+				if hashValue, ok := c.cache.lookup(file.path, file.info, c.algorithm); ok {
+					// Хэш из кэша точный, предварительный этап для файла не нужен.
+					stats.Hashed++
+					stats.CacheHits++
+					anyCached[size] = true
+					addToGroup(fmt.Sprintf("%d:%s", size, hashValue), hashValue, size, file.path)
+					continue
+				}
+			}
+			partialJobs = append(partialJobs, file)
+		}
+	}
+	partialResults := make([]HashResult, len(partialJobs))
+	c.run(len(partialJobs), func(i int) {
+		if ctx.Err() != nil {
+			partialResults[i] = HashResult{Path: partialJobs[i].path, Err: ctx.Err()}
+			return
+		}
+		h, err := c.hashPartial(partialJobs[i].path, partialJobs[i].info.Size())
+		partialResults[i] = HashResult{Path: partialJobs[i].path, Hash: h, Err: err}
+	}, func(int) {
+		stats.PartialHashed++
+		report(Progress{Stage: "partial", Done: stats.PartialHashed, Total: len(partialJobs)})
+	})
+	if ctx.Err() != nil {
+		return nil, stats, ctx.Err()
+	}
+	partials := make(map[string][]scannedFile)
+	var partialOrder []string
+	for i, r := range partialResults {
+		if r.Err != nil {
+			stats.Errors = append(stats.Errors, &FileError{Path: r.Path, Err: r.Err})
+			continue
+		}
+		key := fmt.Sprintf("%d:%s", partialJobs[i].info.Size(), r.Hash)
+		if _, ok := partials[key]; !ok {
+			partialOrder = append(partialOrder, key)
+		}
+		partials[key] = append(partials[key], partialJobs[i])
+	}
+	for _, key := range partialOrder {
+		group := partials[key]
+		size := group[0].info.Size()
+		// Если у части файлов хэш взят из кэша, любой оставшийся может совпасть с ними.
+		if len(group) < 2 && !anyCached[size] {
+			stats.PartialUnique += len(group)
+			candidates -= len(group)
+			continue
+		}
+		if c.quick {
+			_, partial, _ := strings.Cut(key, ":")
+			for _, file := range group {
+				addToGroup(fmt.Sprintf("%d:partial:%s", size, partial), partial, size, file.path)
+			}
+			candidates -= len(group)
+			continue
+		}
+		toHash = append(toHash, group...)
+	}
+
+	// Полный хэш: сначала кэш, остальные файлы читаются параллельно.
+	var jobs []scannedFile
+	for _, file := range toHash {
+		if hashValue, ok := c.cache.lookup(file.path, file.info, c.algorithm); ok {
+			stats.Hashed++
+			stats.CacheHits++
+			addToGroup(fmt.Sprintf("%d:%s", file.info.Size(), hashValue), hashValue, file.info.Size(), file.path)
+			continue
+		}
+		jobs = append(jobs, file)
+	}
+	results := make([]HashResult, len(jobs))
+	c.run(len(jobs), func(i int) {
+		if ctx.Err() != nil {
+			results[i] = HashResult{Path: jobs[i].path, Err: ctx.Err()}
+			return
+		}
+		h, err := c.hashFile(ctx, jobs[i].path)
+		results[i] = HashResult{Path: jobs[i].path, Hash: h, Err: err}
+	}, func(i int) {
+		stats.Hashed++
+		if results[i].Err == nil {
+			stats.BytesHashed += jobs[i].info.Size()
+		}
+		report(Progress{Stage: "hash", Done: stats.Hashed, Total: candidates, Bytes: stats.BytesHashed})
+	})
+	for i, r := range results {
+		file := jobs[i]
+		if r.Err != nil {
+			// При ошибке чтения файл пропускается и попадает в итоги.
+			stats.Errors = append(stats.Errors, &FileError{Path: file.path, Err: r.Err})
+			continue
+		}
+		if err := c.cache.store(file.path, file.info, c.algorithm, r.Hash); err != nil {
+			c.cache.warn(err)
+		}
+		// Размер входит в ключ, чтобы коллизии коротких хэшей (crc32) не смешивали разные файлы.
+		addToGroup(fmt.Sprintf("%d:%s", file.info.Size(), r.Hash), r.Hash, file.info.Size(), file.path)
+	}
+	report(Progress{Stage: "hash", Done: stats.Hashed, Total: candidates, Bytes: stats.BytesHashed, Final: true})
+	if ctx.Err() != nil {
+		// Кэш не сохраняется: уже посчитанные хэши пригодятся, но прерванный прогон не должен его менять.
+		return nil, stats, ctx.Err()
+	}
+	if err := c.cache.Save(); err != nil {
+		return nil, stats, fmt.Errorf("ошибка сохранения кэша хэшей: %v", err)
+	}
+
+	// Оставляем только настоящие группы и сортируем по убыванию освобождаемого места.
+	var groups []Group
+	for _, group := range byHash {
+		if len(group.Paths) > 1 {
+			sort.Strings(group.Paths)
+			groups = append(groups, *group)
+		}
+	}
+	sortGroups(groups)
+	return groups, stats, nil
+}
+
+// groupByNameSize группирует файлы по базовому имени (без учёта регистра) и размеру, не читая их.
+// С c.verify каждая такая группа дополнительно разбивается по хэшу содержимого.
+func (c *config) groupByNameSize(ctx context.Context, bySize map[int64][]scannedFile, stats *Stats, report func(Progress)) ([]Group, error) {
+	byName := make(map[string][]scannedFile)
+	for size, files := range bySize {
+		if len(files) < 2 {
+			continue
+		}
+		for _, file := range files {
+			key := fmt.Sprintf("%d:%s", size, strings.ToLower(filepath.Base(file.path)))
+			byName[key] = append(byName[key], file)
+		}
+	}
+
+	var groups []Group
+	hashed := 0
+	for _, files := range byName {
+		if len(files) < 2 {
+			continue
+		}
+		name := strings.ToLower(filepath.Base(files[0].path))
+		size := files[0].info.Size()
+		if !c.verify {
+			group := Group{Hash: name, Size: size}
+			for _, file := range files {
+				group.Paths = append(group.Paths, file.path)
+			}
+			groups = append(groups, group)
+			continue
+		}
+		byHash := make(map[string]*Group)
+		var order []string
+		for _, file := range files {
+			if ctx.Err() != nil {
+				return nil, ctx.Err()
+			}
+			hashValue, fromCache, err := c.cache.hash(ctx, c, file.path, file.info)
+			hashed++
+			report(Progress{Stage: "verify", Done: hashed})
+			if fromCache {
+				stats.CacheHits++
+			}
+			if err != nil {
+				stats.Errors = append(stats.Errors, &FileError{Path: file.path, Err: err})
+				continue
+			}
+			stats.Hashed++
+			group, ok := byHash[hashValue]
+			if !ok {
+				group = &Group{Hash: hashValue, Size: size}
+				byHash[hashValue] = group
+				order = append(order, hashValue)
+			}
+			group.Paths = append(group.Paths, file.path)
+		}
+		for _, h := range order {
+			if len(byHash[h].Paths) > 1 {
+				groups = append(groups, *byHash[h])
+			}
+		}
+	}
+	if c.verify {
+		report(Progress{Stage: "verify", Done: hashed, Final: true})
+		if err := c.cache.Save(); err != nil {
+			return nil, fmt.Errorf("ошибка сохранения кэша хэшей: %v", err)
+		}
+	}
+	for i := range groups {
+		sort.Strings(groups[i].Paths)
+	}
+	sortGroups(groups)
+	return groups, nil
+}
+
+// Rename — одно переименование (или, с WithDest, копирование) плана: пути до и после.
+type Rename struct {
+	From, To string
+}
+
+// RenameMapName — файл, в который WriteRenameMap записывает соответствие новых и исходных
+// имён. Сам он никогда не переименовывается.
+const RenameMapName = "rename-map.csv"
+
+// originalSuffix добавляет к новому имени исходное базовое имя перед расширением:
+// trip_001.jpg + DSC 04512.JPG -> trip_001__DSC_04512.jpg. Исходное имя приводится к безопасному виду.
+func originalSuffix(newName, original string) string {
+	base := strings.TrimSuffix(original, filepath.Ext(original))
+	base = NormalizeName(base, Normalization{Separator: "_", Trim: true, Spaces: true, Strip: true, Collapse: true})
+	if base == "" {
+		return newName
+	}
+	ext := filepath.Ext(newName)
+	return strings.TrimSuffix(newName, ext) + "__" + base + ext
+}
+
+// WriteRenameMap дописывает в RenameMapName каждой целевой директории плана строки
+// "новое имя,исходное имя". Файлы, имя которых не изменилось, не записываются.
+func WriteRenameMap(plan []Rename) error {
+	byDir := make(map[string][][]string)
+	var dirs []string
+	for _, op := range plan {
+		if op.From == op.To {
+			continue
+		}
+		dir := filepath.Dir(op.To)
+		if _, ok := byDir[dir]; !ok {
+			dirs = append(dirs, dir)
+		}
+		byDir[dir] = append(byDir[dir], []string{filepath.Base(op.To), filepath.Base(op.From)})
+	}
+	for _, dir := range dirs {
+		path := filepath.Join(dir, RenameMapName)
+		_, statErr := os.Stat(path)
+		file, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0644)
+		if err != nil {
+			return err
+		}
+		w := csv.NewWriter(file)
+		if os.IsNotExist(statErr) {
+			w.Write([]string{"new", "original"})
+		}
+		w.WriteAll(byDir[dir])
+		if err := w.Error(); err != nil {
+			file.Close()
+			return err
+		}
+		if err := file.Close(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// minNumberWidth — ширина номера по умолчанию (как в прежнем формате %03d).
+const minNumberWidth = 3
+
+// numberWidth возвращает ширину номера для плана, в котором счётчик пробегает count значений.
+// Без явной ширины она подбирается по последнему номеру, чтобы в одной серии не смешивались
+// номера разной длины; явная ширина проверяется на достаточность.
+func (c *config) numberWidth(count int) (int, error) {
+	last := c.start
+	if count > 0 {
+		last += (count - 1) * c.step
+	}
+	digits := len(strconv.Itoa(last))
+	if c.width == 0 {
+		if digits < minNumberWidth {
+			return minNumberWidth, nil
+		}
+		return digits, nil
+	}
+	if digits > c.width {
+		return 0, fmt.Errorf("ширины номера %d недостаточно для последнего номера %d", c.width, last)
+	}
+	return c.width, nil
+}
+
+// captureTime возвращает дату съёмки из EXIF (для JPEG), а при её отсутствии —
+// время изменения файла. ok=false, если дату определить не удалось.
+func captureTime(path string, info fs.FileInfo) (time.Time, bool) {
+	if t, ok := exifDateTime(path); ok {
+		return t, true
+	}
+	if info.ModTime().IsZero() {
+		return time.Time{}, false
+	}
+	return info.ModTime(), true
+}
+
+// exifDateTime читает DateTimeOriginal (или DateTime) из EXIF-блока JPEG-файла.
+// Это минимальный разбор: маркеры JPEG до сегмента APP1, заголовок TIFF и два каталога IFD.
+func exifDateTime(path string) (time.Time, bool) {
+	file, err := os.Open(path)
+	if err != nil {
+		return time.Time{}, false
+	}
+	defer file.Close()
+	r := bufio.NewReader(file)
+
+	var soi [2]byte
+	if _, err := io.ReadFull(r, soi[:]); err != nil || soi[0] != 0xFF || soi[1] != 0xD8 {
+		return time.Time{}, false
+	}
+	for {
+		var marker [4]byte
+		if _, err := io.ReadFull(r, marker[:]); err != nil || marker[0] != 0xFF {
+			return time.Time{}, false
+		}
+		// SOS и EOI: дальше идут сжатые данные, EXIF уже не встретится.
+		if marker[1] == 0xDA || marker[1] == 0xD9 {
+			return time.Time{}, false
+		}
+		length := int(marker[2])<<8 | int(marker[3])
+		if length < 2 {
+			return time.Time{}, false
+		}
+		if marker[1] != 0xE1 {
+			if _, err := r.Discard(length - 2); err != nil {
+				return time.Time{}, false
+			}
+			continue
+		}
+		segment := make([]byte, length-2)
+		if _, err := io.ReadFull(r, segment); err != nil {
+			return time.Time{}, false
+		}
+		if len(segment) > 6 && string(segment[:6]) == "Exif\x00\x00" {
+			return parseExifDate(segment[6:])
+		}
+	}
+}
+
+// parseExifDate ищет дату в TIFF-структуре EXIF.
+func parseExifDate(tiff []byte) (time.Time, bool) {
+	if len(tiff) < 8 {
+		return time.Time{}, false
+	}
+	var order binary.ByteOrder
+	switch string(tiff[:2]) {
+	case "II":
+		order = binary.LittleEndian
+	case "MM":
+		order = binary.BigEndian
+	default:
+		return time.Time{}, false
+	}
+
+	// readIFD возвращает значения тегов каталога: смещение данных или сами данные (если ≤ 4 байт).
+	readIFD := func(offset uint32) map[uint16][]byte {
+		tags := make(map[uint16][]byte)
+		if int(offset)+2 > len(tiff) {
+			return tags
+		}
+		count := int(order.Uint16(tiff[offset:]))
+		for i := 0; i < count; i++ {
+			entry := int(offset) + 2 + i*12
+			if entry+12 > len(tiff) {
+				break
+			}
+			tag := order.Uint16(tiff[entry:])
+			n := int(order.Uint32(tiff[entry+4:]))
+			// Нас интересуют только строки (тип 2) и смещения (тип 4).
+			value := tiff[entry+8 : entry+12]
+			if n > 4 {
+				start := int(order.Uint32(value))
+				if start < 0 || start+n > len(tiff) {
+					continue
+				}
+				value = tiff[start : start+n]
+			}
+			tags[tag] = value
+		}
+		return tags
+	}
+
+	ifd0 := readIFD(order.Uint32(tiff[4:]))
+	candidates := [][]byte{}
+	if ptr, ok := ifd0[0x8769]; ok && len(ptr) == 4 {
+		exif := readIFD(order.Uint32(ptr))
+		candidates = append(candidates, exif[0x9003], exif[0x9004]) // DateTimeOriginal, DateTimeDigitized
+	}
+	candidates = append(candidates, ifd0[0x0132]) // DateTime
+	for _, value := range candidates {
+		text := strings.TrimRight(string(value), "\x00 ")
+		if t, err := time.ParseInLocation("2006:01:02 15:04:05", text, time.Local); err == nil {
+			return t, true
+		}
+	}
+	return time.Time{}, false
+}
+
+// templatePart — часть разобранного шаблона имени: литерал или подстановка.
+type templatePart struct {
+	literal string // Текст без изменений (если field пустое)
+	field   string // Имя подстановки: num, ext, name, date, prefix
+	width   int    // Ширина дополнения нулями для {num:N}
+}
+
+// templateValues — значения подстановок для одного файла.
+type templateValues struct {
+	prefix string
+	name   string // Исходное имя без расширения
+	ext    string // Исходное расширение с точкой
+	num    int
+	width  int       // Ширина {num} без явного :N (0 — без ведущих нулей)
+	date   time.Time // Время изменения файла
+}
+
+// parseTemplate разбирает шаблон вида "{date}_{prefix}_{num:4}{ext}".
+// Неизвестные подстановки, незакрытые скобки и разделители путей считаются ошибкой.
+func parseTemplate(tmpl string) ([]templatePart, error) {
+	if strings.ContainsAny(tmpl, `/\`) {
+		return nil, fmt.Errorf("шаблон не должен содержать разделители путей: %q", tmpl)
+	}
+	var parts []templatePart
+	rest := tmpl
+	for rest != "" {
+		open := strings.IndexByte(rest, '{')
+		if open < 0 {
+			parts = append(parts, templatePart{literal: rest})
+			break
+		}
+		if open > 0 {
+			parts = append(parts, templatePart{literal: rest[:open]})
+		}
+		end := strings.IndexByte(rest[open:], '}')
+		if end < 0 {
+			return nil, fmt.Errorf("незакрытая скобка в шаблоне %q", tmpl)
+		}
+		spec := rest[open+1 : open+end]
+		rest = rest[open+end+1:]
+
+		part := templatePart{field: spec}
+		if name, width, ok := strings.Cut(spec, ":"); ok {
+			n, err := strconv.Atoi(width)
+			if name != "num" || err != nil || n < 1 {
+				return nil, fmt.Errorf("неверная подстановка {%s}: ширина допустима только для {num:N}", spec)
+			}
+			part.field, part.width = name, n
+		}
+		switch part.field {
+		case "num", "ext", "name", "date", "prefix":
+		default:
+			return nil, fmt.Errorf("неизвестная подстановка {%s} (доступны: num, num:N, ext, name, date, prefix)", spec)
+		}
+		parts = append(parts, part)
+	}
+	return parts, nil
+}
+
+// expandTemplate подставляет значения в разобранный шаблон.
+func expandTemplate(parts []templatePart, v templateValues) string {
+	var b strings.Builder
+	for _, part := range parts {
+		switch part.field {
+		case "":
+			b.WriteString(part.literal)
+		case "num":
+			width := part.width
+			if width == 0 {
+				// {num} без ширины дополняется до WithWidth, если она задана явно.
+				width = v.width
+			}
+			fmt.Fprintf(&b, "%0*d", width, v.num)
+		case "ext":
+			b.WriteString(strings.ToLower(v.ext))
+		case "name":
+			b.WriteString(v.name)
+		case "date":
+			b.WriteString(v.date.Format("20060102"))
+		case "prefix":
+			b.WriteString(v.prefix)
+		}
+	}
+	return b.String()
+}
+
+// renameDir — директория и файлы в ней, подлежащие переименованию, в порядке обработки.
+type renameDir struct {
+	path  string
+	files []fs.FileInfo
+}
+
+// sortFiles упорядочивает файлы по ключу name, mtime или size;
+// при равенстве ключа файлы упорядочиваются по имени.
+func sortFiles(files []fs.FileInfo, key string, reverse bool) {
+	sort.SliceStable(files, func(i, j int) bool {
+		a, b := files[i], files[j]
+		cmp := 0
+		switch key {
+		case "mtime":
+			cmp = a.ModTime().Compare(b.ModTime())
+		case "size":
+			cmp = compareInt64(a.Size(), b.Size())
+		}
+		if reverse {
+			cmp = -cmp
+		}
+		if cmp == 0 {
+			cmp = strings.Compare(a.Name(), b.Name())
+			if reverse && key == "name" {
+				cmp = -cmp
+			}
+		}
+		return cmp < 0
+	})
+}
+
+// compareInt64 возвращает -1, 0 или 1 в зависимости от соотношения a и b.
+func compareInt64(a, b int64) int {
+	switch {
+	case a < b:
+		return -1
+	case a > b:
+		return 1
+	}
+	return 0
+}
+
+// skip сообщает о файле, оставленном без изменений, в WithSkipped.
+func (c *config) skip(path, reason string) {
+	if c.skipped != nil {
+		c.skipped(path, reason)
+	}
+}
+
+// collectRenameDirs собирает файлы для переименования. Без WithRecursive берётся только
+// сама директория; иначе обходится всё дерево в лексикографическом порядке.
+// Исключённые пути пропускаются, исключённые директории — вместе с содержимым.
+func (c *config) collectRenameDirs(root string) ([]renameDir, error) {
+	var dirs []renameDir
+	var visit func(dir string) error
+	visit = func(dir string) error {
+		// os.ReadDir возвращает записи, отсортированные по имени.
+		entries, err := os.ReadDir(dir)
+		if err != nil {
+			return err
+		}
+		current := renameDir{path: dir}
+		var subdirs []string
+		for _, entry := range entries {
+			path := filepath.Join(dir, entry.Name())
+			if c.excluded(root, path) {
+				continue
+			}
+			if entry.IsDir() {
+				subdirs = append(subdirs, path)
+				continue
+			}
+			if entry.Name() == RenameMapName {
+				c.skip(path, "карта переименований")
+				continue
+			}
+			if len(c.exts) > 0 && !c.exts[strings.ToLower(filepath.Ext(entry.Name()))] {
+				c.skip(path, "расширение не выбрано")
+				continue
+			}
+			info, err := entry.Info()
+			if err != nil {
+				return err
+			}
+			current.files = append(current.files, info)
+		}
+		sortFiles(current.files, c.sortBy, c.reverse)
+		dirs = append(dirs, current)
+		if !c.recursive {
+			return nil
+		}
+		for _, sub := range subdirs {
+			if err := visit(sub); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	if err := visit(root); err != nil {
+		return nil, err
+	}
+	return dirs, nil
+}
+
+// RenamePlan строит план переименования файлов директории dir (с поддиректориями при
+// WithRecursive) по алфавиту исходных имён (см. WithSort). Директории не переименовываются.
+// Новое имя формируется по шаблону WithTemplate, по дате WithByDate, а без них — по схеме
+// <префикс>_<номер><расширение>. Файловая система при этом не изменяется, поэтому план
+// одинаков для пробного и реального запуска. Файлы, уже названные как надо, в план не
+// попадают. Если два файла получают одно новое имя или оно занято файлом вне плана,
+// возвращается ошибка со списком конфликтов. Файлы, оставленные без изменений, передаются
+// в WithSkipped.
+func RenamePlan(dir string, opts ...Option) ([]Rename, error) {
+	c := newConfig(opts)
+	if strings.ContainsAny(c.prefix, `/\`) {
+		return nil, fmt.Errorf("префикс не должен содержать разделители путей: %q", c.prefix)
+	}
+	if c.start < 0 || c.step < 1 || c.width < 0 {
+		return nil, errors.New("номер должен быть неотрицательным, шаг — не меньше 1, ширина — неотрицательной")
+	}
+	if c.sortBy != "name" && c.sortBy != "mtime" && c.sortBy != "size" {
+		return nil, fmt.Errorf("порядок: ожидается name, mtime или size, получено %q", c.sortBy)
+	}
+	if c.dateFmt != "" && strings.ContainsAny(time.Now().Format(c.dateFmt), `/\`) {
+		return nil, errors.New("формат даты не должен порождать разделители путей")
+	}
+	var tmpl []templatePart
+	if c.template != "" {
+		var err error
+		if tmpl, err = parseTemplate(c.template); err != nil {
+			return nil, err
+		}
+	}
+	dirs, err := c.collectRenameDirs(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	// Сколько значений пробежит счётчик: в самой большой директории или по всему дереву.
+	count := 0
+	for _, d := range dirs {
+		if c.global {
+			count += len(d.files)
+		} else if len(d.files) > count {
+			count = len(d.files)
+		}
+	}
+	width, err := c.numberWidth(count)
+	if err != nil && c.dateFmt == "" {
+		return nil, err
+	}
+
+	var plan []Rename
+	counter := c.start
+	for _, d := range dirs {
+		if !c.global {
+			counter = c.start
+		}
+		// С WithDest копии раскладываются по тем же относительным поддиректориям.
+		targetDir := d.path
+		if c.dest != "" {
+			rel, err := filepath.Rel(dir, d.path)
+			if err != nil {
+				return nil, err
+			}
+			targetDir = filepath.Join(c.dest, rel)
+		}
+		// Сколько раз в директории уже встретилась каждая дата (для WithByDate).
+		dateCount := make(map[string]int)
+		for _, file := range d.files {
+			ext := filepath.Ext(file.Name())
+			newName := fmt.Sprintf("%s_%0*d%s", c.prefix, width, counter, ext)
+			if c.dateFmt != "" {
+				date, ok := captureTime(filepath.Join(d.path, file.Name()), file)
+				if !ok {
+					c.skip(filepath.Join(d.path, file.Name()), "дата не определена")
+					continue
+				}
+				stamp := date.Format(c.dateFmt)
+				if c.prefix != "" {
+					stamp = c.prefix + "_" + stamp
+				}
+				if n := dateCount[stamp]; n > 0 {
+					newName = fmt.Sprintf("%s_%d%s", stamp, n, ext)
+				} else {
+					newName = stamp + ext
+				}
+				dateCount[stamp]++
+			} else if tmpl != nil {
+				newName = expandTemplate(tmpl, templateValues{
+					prefix: c.prefix,
+					name:   strings.TrimSuffix(file.Name(), ext),
+					ext:    ext,
+					num:    counter,
+					width:  c.width,
+					date:   file.ModTime(),
+				})
+			}
+			if c.origSuffix {
+				newName = originalSuffix(newName, file.Name())
+			}
+			counter += c.step
+			op := Rename{From: filepath.Join(d.path, file.Name()), To: filepath.Join(targetDir, newName)}
+			if op.From == op.To {
+				continue
+			}
+			plan = append(plan, op)
+		}
+	}
+	if c.dest != "" {
+		err = checkCopyTargets(plan, c.overwrite)
+	} else {
+		err = checkPlanTargets(plan)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return plan, nil
+}
+
+// checkPlanTargets проверяет, что никакие два файла плана не получают одинаковое новое имя
+// и что новое имя не занято существующим файлом, который сам не переименовывается.
+// Цепочки, где новое имя совпадает со старым именем другого файла плана, допустимы:
+// Apply переименовывает файлы в две фазы через временные имена.
+func checkPlanTargets(plan []Rename) error {
+	sources := make(map[string]bool, len(plan))
+	for _, op := range plan {
+		sources[op.From] = true
+	}
+	targets := make(map[string]string, len(plan))
+	var conflicts []string
+	for _, op := range plan {
+		if other, ok := targets[op.To]; ok {
+			conflicts = append(conflicts, fmt.Sprintf("%s и %s -> %s", other, op.From, op.To))
+			continue
+		}
+		targets[op.To] = op.From
+		if sources[op.To] {
+			continue
+		}
+		if _, err := os.Lstat(op.To); err == nil {
+			conflicts = append(conflicts, fmt.Sprintf("%s -> %s: файл уже существует", op.From, op.To))
+		}
+	}
+	if len(conflicts) > 0 {
+		return fmt.Errorf("конфликты имён, ничего не переименовано:\n  %s", strings.Join(conflicts, "\n  "))
+	}
+	return nil
+}
+
+// checkCopyTargets проверяет план копирования: новые имена не повторяются,
+// а существующие файлы в директории назначения допустимы только с overwrite.
+func checkCopyTargets(plan []Rename, overwrite bool) error {
+	targets := make(map[string]string, len(plan))
+	var conflicts []string
+	for _, op := range plan {
+		if other, ok := targets[op.To]; ok {
+			conflicts = append(conflicts, fmt.Sprintf("%s и %s -> %s", other, op.From, op.To))
+			continue
+		}
+		targets[op.To] = op.From
+		if info, err := os.Lstat(op.To); err == nil && (!overwrite || !info.Mode().IsRegular()) {
+			conflicts = append(conflicts, fmt.Sprintf("%s -> %s: файл уже существует", op.From, op.To))
+		}
+	}
+	if len(conflicts) > 0 {
+		return fmt.Errorf("конфликты имён, ничего не скопировано:\n  %s", strings.Join(conflicts, "\n  "))
+	}
+	return nil
+}
+
+// Apply выполняет план переименования (см. ApplyRollback) и при ошибке всегда откатывает
+// выполненные шаги; если откатить удалось не всё, ошибка перечисляет такие файлы.
+func Apply(plan []Rename) error {
+	_, err := ApplyRollback(plan, func(error) bool { return true })
+	return err
+}
+
+// ApplyRollback выполняет план в две фазы: сначала все файлы получают временные
+// уникальные имена, затем — окончательные. Так цепочки (a -> b, b -> c) и циклы имён
+// не затирают ещё не переименованные файлы.
+// При первой ошибке вызывается rollback: если он возвращает true, выполненные шаги
+// откатываются, иначе уже переименованные файлы остаются под новыми именами (кроме
+// занявших исходное имя другого файла), а файлы с временными именами возвращаются
+// к исходным. Возвращаются операции, которые после ошибки остались выполненными
+// (пусто, если откат удался полностью).
+func ApplyRollback(plan []Rename, rollback func(err error) bool) ([]Rename, error) {
+	temps := make([]string, len(plan))
+	// moved[i] описывает, где сейчас файл i: 0 — исходное имя, 1 — временное, 2 — новое.
+	moved := make([]int, len(plan))
+
+	fail := func(err error) ([]Rename, error) {
+		full := rollback(err)
+		problems := rollbackRename(plan, temps, moved, full)
+		var done []Rename
+		for i, state := range moved {
+			if state == 2 {
+				done = append(done, plan[i])
+			}
+		}
+		switch {
+		case len(problems) > 0:
+			return done, fmt.Errorf("%w; не удалось откатить:\n  %s", err, strings.Join(problems, "\n  "))
+		case full:
+			return nil, fmt.Errorf("%w; изменения откачены", err)
+		default:
+			return done, fmt.Errorf("%w; переименовано до ошибки: %d из %d", err, len(done), len(plan))
+		}
+	}
+
+	for i, op := range plan {
+		tmp, err := tempName(op.From, i)
+		if err != nil {
+			return fail(err)
+		}
+		if err := os.Rename(op.From, tmp); err != nil {
+			return fail(fmt.Errorf("ошибка переименования файла %s: %v", op.From, err))
+		}
+		temps[i], moved[i] = tmp, 1
+	}
+	for i, op := range plan {
+		// Повторная проверка: файл мог появиться после построения плана.
+		if _, err := os.Lstat(op.To); err == nil {
+			return fail(fmt.Errorf("файл %s уже существует", op.To))
+		}
+		if err := os.Rename(temps[i], op.To); err != nil {
+			return fail(fmt.Errorf("ошибка переименования файла %s: %v", op.From, err))
+		}
+		moved[i] = 2
+	}
+	return nil, nil
+}
+
+// rollbackRename возвращает файлы к исходным именам и возвращает список неудачных откатов.
+// Без full файлы, уже получившие новые имена, не трогаются, если только новое имя не занимает
+// исходное имя возвращаемого файла (цепочки a->b, b->c и циклы): тогда откатывается и такой
+// файл, и дальше по цепочке. Занятое исходное имя не перезаписывается: файл остаётся
+// под временным именем, и это попадает в список.
+func rollbackRename(plan []Rename, temps []string, moved []int, full bool) []string {
+	var problems []string
+	// release возвращает файл с нового имени на временное.
+	release := func(i int) bool {
+		if err := os.Rename(plan[i].To, temps[i]); err != nil {
+			problems = append(problems, fmt.Sprintf("%s: %v", plan[i].To, err))
+			return false
+		}
+		moved[i] = 1
+		return true
+	}
+	// Сначала освобождаем новые имена, затем возвращаем исходные.
+	for i := len(plan) - 1; i >= 0 && full; i-- {
+		if moved[i] == 2 {
+			release(i)
+		}
+	}
+	byTarget := make(map[string]int)
+	for i, state := range moved {
+		if state == 2 {
+			byTarget[plan[i].To] = i
+		}
+	}
+	tried := make([]bool, len(plan))
+	for i := len(plan) - 1; i >= 0; i-- {
+		// Возвращаем файл i, а если его исходное имя занято файлом j с новым именем, —
+		// сначала освобождаем это имя, а затем так же возвращаем j.
+		for cur := i; cur >= 0 && moved[cur] == 1 && !tried[cur]; {
+			tried[cur] = true
+			from, next := plan[cur].From, -1
+			if j, ok := byTarget[from]; ok && moved[j] == 2 && release(j) {
+				next = j
+			}
+			if _, err := os.Lstat(from); err == nil {
+				problems = append(problems, fmt.Sprintf("%s: имя %s занято, файл оставлен под временным именем", temps[cur], from))
+			} else if err := os.Rename(temps[cur], from); err != nil {
+				problems = append(problems, fmt.Sprintf("%s: %v", temps[cur], err))
+			} else {
+				moved[cur] = 0
+			}
+			cur = next
+		}
+	}
+	return problems
+}
+
+// tempName подбирает свободное временное имя рядом с файлом.
+func tempName(path string, i int) (string, error) {
+	dir := filepath.Dir(path)
+	for attempt := 0; attempt < 100; attempt++ {
+		tmp := filepath.Join(dir, fmt.Sprintf(".fileutil-rename-%d-%d-%d", os.Getpid(), i, attempt))
+		if _, err := os.Lstat(tmp); os.IsNotExist(err) {
+			return tmp, nil
+		}
+	}
+	return "", fmt.Errorf("не удалось подобрать временное имя для %s", path)
+}
+
+// Normalization задаёт, какие преобразования имён выполняют NormalizeName и NormalizePlan.
+type Normalization struct {
+	Separator string // Замена пробелов
+	LowerExt  bool   // Расширение в нижний регистр
+	Trim      bool   // Убрать пробелы по краям имени
+	Spaces    bool   // Заменить пробелы разделителем
+	Strip     bool   // Удалить символы вне безопасного набора
+	ASCII     bool   // Транслитерировать кириллицу в латиницу (иначе кириллица сохраняется)
+	Collapse  bool   // Схлопнуть повторяющиеся разделители
+}
+
+// cyrillicToLatin — таблица транслитерации русских букв (строчных; заглавные обрабатываются отдельно).
+var cyrillicToLatin = map[rune]string{
+	'а': "a", 'б': "b", 'в': "v", 'г': "g", 'д': "d", 'е': "e", 'ё': "e", 'ж': "zh",
+	'з': "z", 'и': "i", 'й': "y", 'к': "k", 'л': "l", 'м': "m", 'н': "n", 'о': "o",
+	'п': "p", 'р': "r", 'с': "s", 'т': "t", 'у': "u", 'ф': "f", 'х': "kh", 'ц': "ts",
+	'ч': "ch", 'ш': "sh", 'щ': "shch", 'ъ': "", 'ы': "y", 'ь': "", 'э': "e", 'ю': "yu",
+	'я': "ya",
+}
+
+// transliterate заменяет кириллические буквы латинскими, сохраняя регистр первой буквы.
+func transliterate(s string) string {
+	var b strings.Builder
+	for _, r := range s {
+		lower := unicode.ToLower(r)
+		latin, ok := cyrillicToLatin[lower]
+		if !ok {
+			b.WriteRune(r)
+			continue
+		}
+		if lower != r && latin != "" {
+			latin = strings.ToUpper(latin[:1]) + latin[1:]
+		}
+		b.WriteString(latin)
+	}
+	return b.String()
+}
+
+// safeRune сообщает, входит ли символ в безопасный для shell набор.
+func safeRune(r rune, allowCyrillic bool) bool {
+	switch {
+	case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9':
+		return true
+	case r == '.', r == '-', r == '_':
+		return true
+	case allowCyrillic && unicode.Is(unicode.Cyrillic, r):
+		return true
+	}
+	return false
+}
+
+// NormalizeName применяет к имени файла включённые в n преобразования.
+// Расширение обрабатывается отдельно от основы имени.
+func NormalizeName(name string, n Normalization) string {
+	ext := filepath.Ext(name)
+	base := strings.TrimSuffix(name, ext)
+	if base == "" || strings.TrimSpace(base) == "" {
+		// Имена вида ".bashrc": вся строка считается основой.
+		base, ext = name, ""
+	}
+
+	if n.Trim {
+		base = strings.TrimSpace(base)
+		ext = strings.TrimSpace(ext)
+	}
+	if n.LowerExt {
+		ext = strings.ToLower(ext)
+	}
+	if n.Spaces {
+		base = strings.Join(strings.Fields(base), " ")
+		base = strings.ReplaceAll(base, " ", n.Separator)
+	}
+	if n.ASCII {
+		base = transliterate(base)
+	}
+	if n.Strip {
+		base = strings.Map(func(r rune) rune {
+			if safeRune(r, !n.ASCII) || strings.ContainsRune(n.Separator, r) {
+				return r
+			}
+			return -1
+		}, base)
+		ext = strings.Map(func(r rune) rune {
+			if safeRune(r, !n.ASCII) {
+				return r
+			}
+			return -1
+		}, ext)
+	}
+	if n.Collapse && n.Separator != "" {
+		double := n.Separator + n.Separator
+		for strings.Contains(base, double) {
+			base = strings.ReplaceAll(base, double, n.Separator)
+		}
+		if base != n.Separator {
+			base = strings.TrimSuffix(base, n.Separator)
+		}
+	}
+	if base == "" {
+		base = "file"
+	}
+	return base + ext
+}
+
+// NormalizePlan строит план переименования файлов dir (с поддиректориями при WithRecursive,
+// без путей WithExclude и WithSkipHidden) в имена NormalizeName. Если новое имя уже занято
+// (другим файлом, директорией или другим результатом нормализации), к нему добавляется
+// числовой суффикс: name_2.ext, name_3.ext...
+func NormalizePlan(dir string, n Normalization, opts ...Option) ([]Rename, error) {
+	if strings.ContainsAny(n.Separator, `/\`) {
+		return nil, fmt.Errorf("разделитель не может содержать разделители путей: %q", n.Separator)
+	}
+	c := newConfig(opts)
+	c.exts, c.sortBy, c.reverse = nil, "name", false
+	dirs, err := c.collectRenameDirs(dir)
+	if err != nil {
+		return nil, err
+	}
+	var plan []Rename
+	for _, d := range dirs {
+		entries, err := os.ReadDir(d.path)
+		if err != nil {
+			return nil, err
+		}
+		// Занятые имена: всё в директории, кроме файлов, которые будут переименованы.
+		taken := make(map[string]bool, len(entries))
+		for _, entry := range entries {
+			taken[entry.Name()] = true
+		}
+		newNames := make([]string, len(d.files))
+		for i, file := range d.files {
+			newNames[i] = NormalizeName(file.Name(), n)
+			if newNames[i] != file.Name() {
+				delete(taken, file.Name())
+			}
+		}
+		for i, file := range d.files {
+			if newNames[i] == file.Name() {
+				continue
+			}
+			name := newNames[i]
+			ext := filepath.Ext(name)
+			for k := 2; taken[name]; k++ {
+				name = fmt.Sprintf("%s%s%d%s", strings.TrimSuffix(newNames[i], ext), n.Separator, k, ext)
+			}
+			taken[name] = true
+			plan = append(plan, Rename{From: filepath.Join(d.path, file.Name()), To: filepath.Join(d.path, name)})
+		}
+	}
+	if err := checkPlanTargets(plan); err != nil {
+		return nil, err
+	}
+	return plan, nil
+}
+
+// RootIndex возвращает номер корня (с 0), к которому относится путь; при вложенных
+// корнях выбирается самый глубокий, а для пути вне всех корней возвращается 0.
+func RootIndex(path string, roots []string) int {
+	best, bestLen := 0, -1
+	for i, root := range roots {
+		root = filepath.Clean(root)
+		if rel, err := filepath.Rel(root, path); err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+			if len(root) > bestLen {
+				best, bestLen = i, len(root)
+			}
+		}
+	}
+	return best
+}
+
+// MoveFile перемещает src в dst, создавая недостающие директории и не перезаписывая dst.
+// Если переименование невозможно (другая файловая система), файл копируется, копия
+// сверяется по хэшу sha256 (с ограничениями чтения из opts) и только после этого
+// исходный файл удаляется.
+func MoveFile(src, dst string, opts ...Option) error {
+	c := newConfig(opts)
+	return c.moveVerified(src, dst)
+}
+
+func (c *config) moveVerified(src, dst string) error {
+	if _, err := os.Lstat(dst); err == nil {
+		return fmt.Errorf("%s уже существует", dst)
+	}
+	if err := os.MkdirAll(filepath.Dir(dst), 0755); err != nil {
+		return err
+	}
+	err := os.Rename(src, dst)
+	if err == nil || !errors.Is(err, syscall.EXDEV) {
+		return err
+	}
+	if err := CopyFile(src, dst, false); err != nil {
+		os.Remove(dst)
+		return err
+	}
+	hc := *c
+	hc.algorithm = "sha256"
+	srcHash, err := hc.hashFile(context.Background(), src)
+	if err != nil {
+		os.Remove(dst)
+		return err
+	}
+	dstHash, err := hc.hashFile(context.Background(), dst)
+	if err != nil || dstHash != srcHash {
+		os.Remove(dst)
+		return fmt.Errorf("копия %s не совпадает с исходным файлом", dst)
+	}
+	return os.Remove(src)
+}
+
+// move перемещает файл функцией WithMove, а без неё — как MoveFile.
+func (c *config) moveFile(src, dst string) error {
+	if c.move != nil {
+		return c.move(src, dst)
+	}
+	return c.moveVerified(src, dst)
+}
+
+// CopyFile копирует содержимое, права и время изменения src в файл dst.
+// Без overwrite существующий dst считается ошибкой.
+func CopyFile(src, dst string, overwrite bool) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	info, err := in.Stat()
+	if err != nil {
+		return err
+	}
+	flags := os.O_WRONLY | os.O_CREATE | os.O_EXCL
+	if overwrite {
+		flags = os.O_WRONLY | os.O_CREATE | os.O_TRUNC
+	}
+	out, err := os.OpenFile(dst, flags, info.Mode().Perm())
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		return err
+	}
+	if err := out.Close(); err != nil {
+		return err
+	}
+	return os.Chtimes(dst, info.ModTime(), info.ModTime())
+}
+
+// LinkOver заменяет файл dst жёсткой ссылкой на src: ссылка создаётся рядом с dst
+// под временным именем и переименовывается поверх него, так что при любой ошибке
+// dst остаётся на месте нетронутым.
+func LinkOver(src, dst string) error {
+	dir := filepath.Dir(dst)
+	for attempt := 0; attempt < 100; attempt++ {
+		tmp := filepath.Join(dir, fmt.Sprintf(".fileutil-link-%d-%d", os.Getpid(), attempt))
+		err := os.Link(src, tmp)
+		if errors.Is(err, os.ErrExist) {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		if err := os.Rename(tmp, dst); err != nil {
+			os.Remove(tmp)
+			return err
+		}
+		return nil
+	}
+	return fmt.Errorf("не удалось подобрать временное имя для %s", dst)
+}
+
+// QuarantineManifestName — имя манифеста, который Quarantine ведёт в директории карантина.
+// Манифест в формате JSON Lines: каждое перемещение дописывает в него одну строку.
+const QuarantineManifestName = "fileutil-quarantine.jsonl"
+
+// QuarantineEntry — строка манифеста: файл, перемещённый в карантин, или, с Removed,
+// отметка о том, что файл Path возвращён (Restore, Undo) и из манифеста вычеркнут.
+type QuarantineEntry struct {
+	Path     string `json:"path"`               // Новое расположение в карантине
+	Original string `json:"original,omitempty"` // Исходное расположение
+	Size     int64  `json:"size,omitempty"`
+	Removed  bool   `json:"removed,omitempty"`
+}
+
+// legacyQuarantine — манифест прежних версий: один JSON-объект со всеми записями.
+type legacyQuarantine struct {
+	Entries []QuarantineEntry `json:"entries"`
+}
+
+// ReadQuarantine возвращает файлы, которые по манифесту ещё в карантине; отсутствующий
+// манифест пуст. Оборванная последняя строка (запуск прервался посреди записи) пропускается,
+// манифест прежнего формата (один JSON-объект) тоже читается.
+func ReadQuarantine(manifest string) ([]QuarantineEntry, error) {
+	entries, _, err := readQuarantine(manifest)
+	return entries, err
+}
+
+// readQuarantine — ReadQuarantine, который сообщает также, что манифест в прежнем формате.
+func readQuarantine(path string) (entries []QuarantineEntry, legacy bool, err error) {
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil, false, nil
+	}
+	if err != nil {
+		return nil, false, err
+	}
+	if strings.HasPrefix(strings.TrimSpace(string(data)), "{\n") {
+		var m legacyQuarantine
+		if err := json.Unmarshal(data, &m); err != nil {
+			return nil, false, fmt.Errorf("повреждённый манифест %s: %v", path, err)
+		}
+		return m.Entries, true, nil
+	}
+	lines := strings.Split(string(data), "\n")
+	index := make(map[string]int) // Путь в карантине -> позиция в entries
+	for i, line := range lines {
+		if strings.TrimSpace(line) == "" {
+			continue
+		}
+		var e QuarantineEntry
+		if err := json.Unmarshal([]byte(line), &e); err != nil {
+			if i == len(lines)-1 {
+				break
+			}
+			return nil, false, fmt.Errorf("повреждённый манифест %s, строка %d: %v", path, i+1, err)
+		}
+		if j, ok := index[e.Path]; ok {
+			entries[j].Removed = true
+			delete(index, e.Path)
+		}
+		if !e.Removed {
+			index[e.Path] = len(entries)
+			entries = append(entries, e)
+		}
+	}
+	remaining := entries[:0]
+	for _, e := range entries {
+		if !e.Removed {
+			remaining = append(remaining, e)
+		}
+	}
+	return remaining, false, nil
+}
+
+// openQuarantine читает манифест перед тем, как дописывать в него отметки;
+// манифест прежнего формата сначала переписывается в JSON Lines.
+func openQuarantine(path string) ([]QuarantineEntry, error) {
+	entries, legacy, err := readQuarantine(path)
+	if err == nil && legacy {
+		err = writeQuarantine(path, entries)
+	}
+	return entries, err
+}
+
+// appendQuarantine дописывает строки в манифест и сбрасывает их на диск:
+// после возврата записи переживут падение процесса, а манифест не переписывается целиком.
+func appendQuarantine(path string, entries ...QuarantineEntry) error {
+	data, err := marshalQuarantine(entries)
+	if err != nil {
+		return err
+	}
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0644)
+	if err != nil {
+		return err
+	}
+	if _, err := file.Write(data); err != nil {
+		file.Close()
+		return err
+	}
+	if err := file.Sync(); err != nil {
+		file.Close()
+		return err
+	}
+	return file.Close()
+}
+
+// writeQuarantine атомарно переписывает манифест, оставляя только файлы entries
+// без отметок о вычеркнутых; пустой манифест удаляется.
+func writeQuarantine(path string, entries []QuarantineEntry) error {
+	if len(entries) == 0 {
+		if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		return nil
+	}
+	data, err := marshalQuarantine(entries)
+	if err != nil {
+		return err
+	}
+	return WriteFileAtomic(path, data)
+}
+
+// marshalQuarantine кодирует строки манифеста, по одной JSON-строке на запись.
+func marshalQuarantine(entries []QuarantineEntry) ([]byte, error) {
+	var b strings.Builder
+	for _, e := range entries {
+		data, err := json.Marshal(e)
+		if err != nil {
+			return nil, err
+		}
+		b.Write(data)
+		b.WriteByte('\n')
+	}
+	return []byte(b.String()), nil
+}
+
+// dropQuarantine переписывает манифест path, прочитанный как entries, без файлов dropped.
+func dropQuarantine(path string, entries []QuarantineEntry, dropped map[string]bool) error {
+	var remaining []QuarantineEntry
+	for _, e := range entries {
+		if !dropped[e.Path] {
+			remaining = append(remaining, e)
+		}
+	}
+	return writeQuarantine(path, remaining)
+}
+
+// Quarantine — директория карантина: файлы перемещаются в неё с сохранением пути
+// относительно корня сканирования, а манифест записывает, откуда каждый пришёл.
+type Quarantine struct {
+	Dir      string // Абсолютный путь директории карантина
+	Manifest string // Манифест QuarantineManifestName в Dir
+	roots    []string
+	c        config
+}
+
+// OpenQuarantine готовит карантин в dir для файлов из корней roots и проверяет, что
+// манифест, если он уже есть, читается. Файлы перемещаются функцией WithMove (по
+// умолчанию как MoveFile, с ограничениями чтения из opts).
+func OpenQuarantine(dir string, roots []string, opts ...Option) (*Quarantine, error) {
+	if abs, err := filepath.Abs(dir); err == nil {
+		dir = abs
+	}
+	q := &Quarantine{Dir: dir, Manifest: filepath.Join(dir, QuarantineManifestName), roots: roots, c: newConfig(opts)}
+	if _, _, err := readQuarantine(q.Manifest); err != nil {
+		return nil, err
+	}
+	return q, nil
+}
+
+// Path возвращает путь в карантине для файла path: путь относительно его корня
+// сохраняется, а при нескольких корнях перед ним добавляется номер корня (с 1).
+func (q *Quarantine) Path(path string) string {
+	i := RootIndex(path, q.roots)
+	rel, err := filepath.Rel(filepath.Clean(q.roots[i]), path)
+	if err != nil {
+		rel = filepath.Base(path)
+	}
+	if len(q.roots) > 1 {
+		return filepath.Join(q.Dir, strconv.Itoa(i+1), rel)
+	}
+	return filepath.Join(q.Dir, rel)
+}
+
+// Move перемещает файл path размера size в карантин и дописывает о нём строку в манифест,
+// сразу сбрасывая её на диск: если запуск прервётся, уже перемещённые файлы можно вернуть.
+// Ошибка перемещения возвращается как *FileError, файл тогда остаётся на месте. Если файл
+// перемещён, но манифест записать не удалось, возвращаются и запись, и ошибка записи.
+func (q *Quarantine) Move(path string, size int64) (QuarantineEntry, error) {
+	dst := q.Path(path)
+	if err := q.c.moveFile(path, dst); err != nil {
+		return QuarantineEntry{}, &FileError{Path: path, Err: err}
+	}
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		abs = path
+	}
+	e := QuarantineEntry{Path: dst, Original: abs, Size: size}
+	if err := appendQuarantine(q.Manifest, e); err != nil {
+		return e, err
+	}
+	return e, nil
+}
+
+// RestoreResult — итог Restore.
+type RestoreResult struct {
+	Restored []QuarantineEntry // Возвращённые на место файлы
+	Total    int               // Файлов в манифесте
+	Errors   []*FileError      // Файлы, которые вернуть не удалось: они остались в манифесте
+}
+
+// Restore возвращает файлы из карантина на исходные места по манифесту (функцией WithMove).
+// Каждый возвращённый файл сразу вычёркивается строкой в манифесте, так что прерванный
+// Restore можно повторить; в конце манифест переписывается без них, опустевший удаляется.
+// Ошибка возвращается, только если не удалось прочитать или записать сам манифест.
+func Restore(manifest string, opts ...Option) (RestoreResult, error) {
+	c := newConfig(opts)
+	var result RestoreResult
+	entries, err := openQuarantine(manifest)
+	if err != nil {
+		return result, err
+	}
+	result.Total = len(entries)
+	var remaining []QuarantineEntry
+	for _, e := range entries {
+		if err := c.moveFile(e.Path, e.Original); err != nil {
+			result.Errors = append(result.Errors, &FileError{Path: e.Path, Err: err})
+			remaining = append(remaining, e)
+			continue
+		}
+		result.Restored = append(result.Restored, e)
+		if err := appendQuarantine(manifest, QuarantineEntry{Path: e.Path, Removed: true}); err != nil {
+			return result, err
+		}
+	}
+	if len(entries) == 0 {
+		return result, nil
+	}
+	if err := writeQuarantine(manifest, remaining); err != nil {
+		return result, err
+	}
+	return result, nil
+}
+
+// UndoOp — одна выполненная операция журнала отмены: файл перемещён из From в To.
+type UndoOp struct {
+	Kind     string `json:"kind"`               // rename — переименование, move — перемещение в карантин
+	From     string `json:"from"`               // Абсолютный путь до операции
+	To       string `json:"to"`                 // Абсолютный путь после операции
+	Manifest string `json:"manifest,omitempty"` // Для move: манифест карантина с записью о файле
+}
+
+// UndoRecord — запись журнала отмены: операции одного запуска или отмена другого запуска.
+type UndoRecord struct {
+	ID      int       `json:"id"` // Номер записи в журнале, по возрастанию
+	Time    time.Time `json:"time"`
+	Command string    `json:"command"`          // rename, normalize, duplicates или undo
+	Undoes  int       `json:"undoes,omitempty"` // Для undo: номер отменённого запуска
+	Ops     []UndoOp  `json:"ops"`              // Выполненные операции по порядку
+}
+
+// ReadUndoLog читает журнал отмены; отсутствующий файл означает пустой журнал.
+// Строки одного запуска, дописанные по мере выполнения, собираются в одну запись.
+func ReadUndoLog(path string) ([]UndoRecord, error) {
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var records []UndoRecord
+	index := make(map[int]int) // Номер запуска -> позиция в records
+	for i, line := range strings.Split(string(data), "\n") {
+		if strings.TrimSpace(line) == "" {
+			continue
+		}
+		var rec UndoRecord
+		if err := json.Unmarshal([]byte(line), &rec); err != nil {
+			return nil, fmt.Errorf("повреждённый журнал отмены %s, строка %d: %v", path, i+1, err)
+		}
+		if j, ok := index[rec.ID]; ok {
+			records[j].Ops = append(records[j].Ops, rec.Ops...)
+			continue
+		}
+		index[rec.ID] = len(records)
+		records = append(records, rec)
+	}
+	return records, nil
+}
+
+// AppendUndo дописывает в журнал отмены path запись об операциях команды command
+// (для undo — с номером отменённого запуска undoes) и возвращает номер запуска.
+// id — номер, полученный при прошлом вызове того же запуска (0 — новый запуск):
+// так операции дописываются по одной, и прерванный запуск всё равно можно отменить.
+// Пути приводятся к абсолютным. Журнал только дополняется: прежние записи не переписываются.
+// Пустой path или ops ничего не записывают.
+func AppendUndo(path, command string, undoes, id int, ops []UndoOp) (int, error) {
+	if path == "" || len(ops) == 0 {
+		return id, nil
+	}
+	rec := UndoRecord{ID: id, Time: time.Now(), Command: command, Undoes: undoes}
+	if id == 0 {
+		records, err := ReadUndoLog(path)
+		if err != nil {
+			return 0, err
+		}
+		rec.ID = 1
+		if len(records) > 0 {
+			rec.ID = records[len(records)-1].ID + 1
+		}
+	}
+	for _, op := range ops {
+		if abs, err := filepath.Abs(op.From); err == nil {
+			op.From = abs
+		}
+		if abs, err := filepath.Abs(op.To); err == nil {
+			op.To = abs
+		}
+		rec.Ops = append(rec.Ops, op)
+	}
+	data, err := json.Marshal(rec)
+	if err != nil {
+		return 0, err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return 0, err
+	}
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0644)
+	if err != nil {
+		return 0, err
+	}
+	if _, err := file.Write(append(data, '\n')); err != nil {
+		file.Close()
+		return 0, err
+	}
+	return rec.ID, file.Close()
+}
+
+// RenameUndoOps переводит выполненные переименования в операции журнала отмены.
+func RenameUndoOps(plan []Rename) []UndoOp {
+	ops := make([]UndoOp, len(plan))
+	for i, op := range plan {
+		ops[i] = UndoOp{Kind: "rename", From: op.From, To: op.To}
+	}
+	return ops
+}
+
+// pendingUndo возвращает операции запуска rec, ещё не отменённые записями undo из records.
+func pendingUndo(rec UndoRecord, records []UndoRecord) []UndoOp {
+	undone := make(map[[2]string]bool)
+	for _, r := range records {
+		if r.Command == "undo" && r.Undoes == rec.ID {
+			for _, op := range r.Ops {
+				undone[[2]string{op.To, op.From}] = true
+			}
+		}
+	}
+	var pending []UndoOp
+	for _, op := range rec.Ops {
+		if !undone[[2]string{op.From, op.To}] {
+			pending = append(pending, op)
+		}
+	}
+	return pending
+}
+
+// ErrUndoNotFound — запуска с запрошенным номером нет в журнале отмены.
+var ErrUndoNotFound = errors.New("запуск не найден в журнале отмены")
+
+// FindUndo находит в журнале отмены запуск id (0 — последний, у которого остались
+// неотменённые операции) и возвращает его вместе с ещё не отменёнными операциями.
+// Если отменять нечего, запуск nil; для уже отменённого запуска id операций нет.
+func FindUndo(path string, id int) (*UndoRecord, []UndoOp, error) {
+	records, err := ReadUndoLog(path)
+	if err != nil {
+		return nil, nil, err
+	}
+	for i := len(records) - 1; i >= 0; i-- {
+		rec := records[i]
+		if rec.Command == "undo" || (id != 0 && rec.ID != id) {
+			continue
+		}
+		if pending := pendingUndo(rec, records); len(pending) > 0 || id != 0 {
+			return &records[i], pending, nil
+		}
+	}
+	if id != 0 {
+		return nil, nil, fmt.Errorf("%w: %d", ErrUndoNotFound, id)
+	}
+	return nil, nil, nil
+}
+
+// UndoResult — итог Undo.
+type UndoResult struct {
+	Done      []UndoOp     // Отменённые операции в порядке выполнения (файлы вернулись из To в From)
+	RenameErr error        // Ошибка отмены переименований: они откатываются целиком или не откатываются
+	LogErrors []error      // Ошибки записи журнала: отмена выполнена, но повторный Undo её не увидит
+	Errors    []*FileError // Файлы, которые не удалось вернуть, и манифесты, которые не удалось обновить
+}
+
+// Undo отменяет операции pending запуска run (см. FindUndo) и дописывает отмену в журнал
+// path. Переименования откатываются одним набором через Apply, поэтому цепочки и циклы
+// имён возвращаются целиком или не возвращаются вовсе; перемещённые в карантин файлы
+// возвращаются по одному в обратном порядке (функцией WithMove) и вычёркиваются из
+// манифеста: дописанной строкой сразу и переписанным манифестом в конце.
+func Undo(path string, run *UndoRecord, pending []UndoOp, opts ...Option) UndoResult {
+	c := newConfig(opts)
+	var result UndoResult
+	undoID := 0
+	record := func(ops []UndoOp) {
+		var err error
+		if undoID, err = AppendUndo(path, "undo", run.ID, undoID, ops); err != nil {
+			result.LogErrors = append(result.LogErrors, err)
+		}
+	}
+
+	var renames []Rename
+	var moves []UndoOp
+	for i := len(pending) - 1; i >= 0; i-- {
+		if op := pending[i]; op.Kind == "move" {
+			moves = append(moves, op)
+		} else {
+			renames = append(renames, Rename{From: op.To, To: op.From})
+		}
+	}
+	if len(renames) > 0 {
+		if err := Apply(renames); err != nil {
+			result.RenameErr = err
+		} else {
+			ops := RenameUndoOps(renames)
+			record(ops)
+			for _, op := range ops {
+				result.Done = append(result.Done, UndoOp{Kind: op.Kind, From: op.To, To: op.From})
+			}
+		}
+	}
+
+	// Манифесты карантина читаются один раз; повреждённый манифест не трогается:
+	// файлы возвращаются, но в нём не вычёркиваются.
+	manifests := make(map[string][]QuarantineEntry)
+	seen := make(map[string]bool)
+	for _, op := range moves {
+		if seen[op.Manifest] || op.Manifest == "" {
+			continue
+		}
+		seen[op.Manifest] = true
+		entries, err := openQuarantine(op.Manifest)
+		if err != nil {
+			result.Errors = append(result.Errors, &FileError{Path: op.Manifest, Err: err})
+			continue
+		}
+		manifests[op.Manifest] = entries
+	}
+	dropped := make(map[string]bool) // Вычеркнутые из манифестов пути в карантине
+	for _, op := range moves {
+		if err := c.moveFile(op.To, op.From); err != nil {
+			result.Errors = append(result.Errors, &FileError{Path: op.To, Err: err})
+			continue
+		}
+		record([]UndoOp{{Kind: "move", From: op.To, To: op.From, Manifest: op.Manifest}})
+		result.Done = append(result.Done, op)
+		if _, ok := manifests[op.Manifest]; !ok {
+			continue
+		}
+		if err := appendQuarantine(op.Manifest, QuarantineEntry{Path: op.To, Removed: true}); err != nil {
+			result.Errors = append(result.Errors, &FileError{Path: op.Manifest, Err: err})
+			continue
+		}
+		dropped[op.To] = true
+	}
+	for manifest, entries := range manifests {
+		if err := dropQuarantine(manifest, entries, dropped); err != nil {
+			result.Errors = append(result.Errors, &FileError{Path: manifest, Err: err})
+		}
+	}
+	return result
+}
+
+// FileDiff описывает файл, присутствующий в обеих директориях, но с разным содержимым.
+type FileDiff struct {
+	Path   string `json:"path"`            // Относительный путь
+	Reason string `json:"reason"`          // size, content или error
+	SizeA  int64  `json:"size_a"`          // Размер в первой директории
+	SizeB  int64  `json:"size_b"`          // Размер во второй директории
+	Error  string `json:"error,omitempty"` // Ошибка чтения (для reason=error)
+}
+
+// CompareResult — результат сравнения двух директорий.
+type CompareResult struct {
+	OnlyInA   []string   `json:"only_in_a"`
+	OnlyInB   []string   `json:"only_in_b"`
+	Different []FileDiff `json:"different"`
+	Identical int        `json:"identical"`
+	Skipped   WalkStats  `json:"skipped"` // Пропущенное при обходе обеих директорий
+}
+
+// collectRelative обходит root и возвращает карту: относительный путь (через "/") -> информация о файле.
+func (c *config) collectRelative(ctx context.Context, root string) (map[string]fs.FileInfo, WalkStats, error) {
+	files := make(map[string]fs.FileInfo)
+	stats, err := c.walk(ctx, root, func(path string, info fs.FileInfo) {
+		if rel, err := filepath.Rel(root, path); err == nil {
+			files[filepath.ToSlash(rel)] = info
+		}
+	})
+	return files, stats, err
+}
+
+// CompareDirs сравнивает два дерева (с фильтрами Walk): сначала по размеру, а при совпадении
+// размеров — по хэшу (WithHash), пары хэшируются в WithWorkers горутинах. Файлы, которые
+// не удалось прочитать, считаются различающимися (reason=error) и попадают в Skipped.Errors.
+func CompareDirs(ctx context.Context, dirA, dirB string, opts ...Option) (CompareResult, error) {
+	c := newConfig(opts)
+	result := CompareResult{OnlyInA: []string{}, OnlyInB: []string{}, Different: []FileDiff{}}
+	filesA, statsA, err := c.collectRelative(ctx, dirA)
+	if err != nil {
+		return result, err
+	}
+	filesB, statsB, err := c.collectRelative(ctx, dirB)
+	if err != nil {
+		return result, err
+	}
+	result.Skipped = statsA
+	result.Skipped.Add(statsB)
+
+	paths := make([]string, 0, len(filesA))
+	for rel := range filesA {
+		paths = append(paths, rel)
+	}
+	sort.Strings(paths)
+	var same []string
+	for _, rel := range paths {
+		infoA := filesA[rel]
+		infoB, ok := filesB[rel]
+		if !ok {
+			result.OnlyInA = append(result.OnlyInA, rel)
+			continue
+		}
+		if infoA.Size() != infoB.Size() {
+			result.Different = append(result.Different, FileDiff{Path: rel, Reason: "size", SizeA: infoA.Size(), SizeB: infoB.Size()})
+			continue
+		}
+		same = append(same, rel)
+	}
+	// Сначала идут файлы из A, затем их пары из B: пара i — это записи i и len(same)+i.
+	pairs := make([]string, 0, 2*len(same))
+	for _, rel := range same {
+		pairs = append(pairs, filepath.Join(dirA, filepath.FromSlash(rel)))
+	}
+	for _, rel := range same {
+		pairs = append(pairs, filepath.Join(dirB, filepath.FromSlash(rel)))
+	}
+	hashes := HashFiles(ctx, pairs, opts...)
+	for i, rel := range same {
+		diff := FileDiff{Path: rel, SizeA: filesA[rel].Size(), SizeB: filesB[rel].Size()}
+		a, b := hashes[i], hashes[len(same)+i]
+		switch {
+		case a.Err != nil || b.Err != nil:
+			diff.Reason = "error"
+			if a.Err != nil {
+				diff.Error = a.Err.Error()
+				result.Skipped.Errors = append(result.Skipped.Errors, &FileError{Path: a.Path, Err: a.Err})
+			}
+			if b.Err != nil {
+				if a.Err == nil {
+					diff.Error = b.Err.Error()
+				}
+				result.Skipped.Errors = append(result.Skipped.Errors, &FileError{Path: b.Path, Err: b.Err})
+			}
+			result.Different = append(result.Different, diff)
+		case a.Hash != b.Hash:
+			diff.Reason = "content"
+			result.Different = append(result.Different, diff)
+		default:
+			result.Identical++
+		}
+	}
+	sort.Slice(result.Different, func(i, j int) bool { return result.Different[i].Path < result.Different[j].Path })
+	for rel := range filesB {
+		if _, ok := filesA[rel]; !ok {
+			result.OnlyInB = append(result.OnlyInB, rel)
+		}
+	}
+	sort.Strings(result.OnlyInB)
+	return result, nil
+}
+
+// ChecksumStatus — состояние файла при проверке по манифесту: OK, FAILED (хэш не совпал
+// или файл не прочитан, тогда Err не nil), MISSING (файла нет) или NEW (нет в манифесте).
+type ChecksumStatus struct {
+	Path   string // Относительный путь через "/", как в манифесте
+	Status string
+	Err    error
+}
+
+// checksumFiles собирает относительные пути (через "/") файлов директории в отсортированном
+// порядке. Сам файл манифеста, если он лежит внутри директории, не учитывается.
+func (c *config) checksumFiles(ctx context.Context, dir, manifest string) ([]string, WalkStats, error) {
+	manifestAbs, _ := filepath.Abs(manifest)
+	var rels []string
+	stats, err := c.walk(ctx, dir, func(path string, info fs.FileInfo) {
+		if abs, err := filepath.Abs(path); err == nil && abs == manifestAbs {
+			return
+		}
+		if rel, err := filepath.Rel(dir, path); err == nil {
+			rels = append(rels, filepath.ToSlash(rel))
+		}
+	})
+	sort.Strings(rels)
+	return rels, stats, err
+}
+
+// relPaths превращает относительные пути манифеста в пути внутри dir.
+func relPaths(dir string, rels []string) []string {
+	paths := make([]string, len(rels))
+	for i, rel := range rels {
+		paths[i] = filepath.Join(dir, filepath.FromSlash(rel))
+	}
+	return paths
+}
+
+// CreateChecksums атомарно записывает в manifest хэши sha256 файлов dir (с фильтрами Walk)
+// в формате sha256sum: "хэш  относительный/путь". Возвращает число записанных файлов;
+// файлы, которые не удалось прочитать, в манифест не попадают и добавляются в Errors.
+func CreateChecksums(ctx context.Context, dir, manifest string, opts ...Option) (int, WalkStats, error) {
+	c := newConfig(opts)
+	rels, stats, err := c.checksumFiles(ctx, dir, manifest)
+	if err != nil {
+		return 0, stats, err
+	}
+	var b strings.Builder
+	written := 0
+	for i, r := range HashFiles(ctx, relPaths(dir, rels), append(opts, WithHash("sha256"))...) {
+		if r.Err != nil {
+			stats.Errors = append(stats.Errors, &FileError{Path: r.Path, Err: r.Err})
+			continue
+		}
+		fmt.Fprintf(&b, "%s  %s\n", r.Hash, rels[i])
+		written++
+	}
+	if err := WriteFileAtomic(manifest, []byte(b.String())); err != nil {
+		return 0, stats, err
+	}
+	return written, stats, nil
+}
+
+// readChecksums читает манифест формата sha256sum и возвращает карту путь -> хэш
+// вместе с путями в порядке следования.
+func readChecksums(path string) (map[string]string, []string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer file.Close()
+
+	sums := make(map[string]string)
+	var order []string
+	scanner := bufio.NewScanner(file)
+	line := 0
+	for scanner.Scan() {
+		line++
+		text := strings.TrimRight(scanner.Text(), "\r")
+		if strings.TrimSpace(text) == "" {
+			continue
+		}
+		// "хэш  путь" (текстовый режим) или "хэш *путь" (двоичный режим).
+		sum, rel, ok := strings.Cut(text, " ")
+		if !ok || len(rel) < 2 || (rel[0] != ' ' && rel[0] != '*') {
+			return nil, nil, fmt.Errorf("%s:%d: неверная строка манифеста", path, line)
+		}
+		rel = filepath.ToSlash(rel[1:])
+		if _, dup := sums[rel]; !dup {
+			order = append(order, rel)
+		}
+		sums[rel] = strings.ToLower(sum)
+	}
+	return sums, order, scanner.Err()
+}
+
+// VerifyChecksums пересчитывает хэши файлов dir и сравнивает их с манифестом: сначала
+// идут файлы манифеста в его порядке, затем NEW в порядке путей. Файлы, которые не
+// удалось прочитать, получают FAILED и добавляются в Errors.
+func VerifyChecksums(ctx context.Context, dir, manifest string, opts ...Option) ([]ChecksumStatus, WalkStats, error) {
+	c := newConfig(opts)
+	sums, order, err := readChecksums(manifest)
+	if err != nil {
+		return nil, WalkStats{}, err
+	}
+	rels, stats, err := c.checksumFiles(ctx, dir, manifest)
+	if err != nil {
+		return nil, stats, err
+	}
+	present := make(map[string]bool, len(rels))
+	for _, rel := range rels {
+		present[rel] = true
+	}
+	var toHash []string
+	for _, rel := range order {
+		if present[rel] {
+			toHash = append(toHash, rel)
+		}
+	}
+	actual := make(map[string]HashResult, len(toHash))
+	for i, r := range HashFiles(ctx, relPaths(dir, toHash), append(opts, WithHash("sha256"))...) {
+		actual[toHash[i]] = r
+	}
+
+	var statuses []ChecksumStatus
+	for _, rel := range order {
+		r, found := actual[rel]
+		switch {
+		case !found:
+			statuses = append(statuses, ChecksumStatus{Path: rel, Status: "MISSING"})
+		case r.Err != nil:
+			statuses = append(statuses, ChecksumStatus{Path: rel, Status: "FAILED", Err: r.Err})
+			stats.Errors = append(stats.Errors, &FileError{Path: r.Path, Err: r.Err})
+		case r.Hash != sums[rel]:
+			statuses = append(statuses, ChecksumStatus{Path: rel, Status: "FAILED"})
+		default:
+			statuses = append(statuses, ChecksumStatus{Path: rel, Status: "OK"})
+		}
+	}
+	for _, rel := range rels {
+		if _, listed := sums[rel]; !listed {
+			statuses = append(statuses, ChecksumStatus{Path: rel, Status: "NEW"})
+		}
+	}
+	return statuses, stats, nil
+}
+
+// Cleanup задаёт, что удаляет Clean.
+type Cleanup struct {
+	EmptyFiles bool // Файлы нулевого размера
+	EmptyDirs  bool // Пустые директории, в том числе ставшие пустыми
+	DryRun     bool // Ничего не удалять, только вернуть то, что было бы удалено
+}
+
+// Removed — запись, удалённая Clean.
+type Removed struct {
+	Path string
+	Dir  bool
+}
+
+// CleanResult — итог Clean.
+type CleanResult struct {
+	Removed []Removed    // Удалённые (с DryRun — подлежащие удалению) записи по порядку
+	Scanned int          // Просмотренные записи
+	Errors  []*FileError // Записи, которые не удалось прочитать или удалить
+}
+
+// Clean удаляет пустые файлы и директории под root, обходя дерево в глубину: директория,
+// ставшая пустой после удаления её содержимого, тоже удаляется. Пути WithExclude и
+// WithSkipHidden не удаляются, а их директории не считаются пустыми. Символические ссылки
+// не удаляются и не обходятся, а сам root никогда не удаляется.
+func Clean(root string, what Cleanup, opts ...Option) CleanResult {
+	c := newConfig(opts)
+	var result CleanResult
+	remove := func(path string, dir bool) bool {
+		if !what.DryRun {
+			if err := os.Remove(path); err != nil {
+				result.Errors = append(result.Errors, &FileError{Path: path, Err: err})
+				return false
+			}
+		}
+		result.Removed = append(result.Removed, Removed{Path: path, Dir: dir})
+		return true
+	}
+
+	// clean обрабатывает содержимое dir и сообщает, осталось ли в ней что-нибудь.
+	var clean func(dir string) bool
+	clean = func(dir string) bool {
+		entries, err := os.ReadDir(dir)
+		if err != nil {
+			result.Errors = append(result.Errors, &FileError{Path: dir, Err: err})
+			return true
+		}
+		left := false
+		for _, entry := range entries {
+			result.Scanned++
+			path := filepath.Join(dir, entry.Name())
+			if c.excluded(root, path) {
+				left = true
+				continue
+			}
+			switch {
+			case entry.Type()&fs.ModeSymlink != 0:
+				left = true
+			case entry.IsDir():
+				if clean(path) || !what.EmptyDirs || !remove(path, true) {
+					left = true
+				}
+			default:
+				info, err := entry.Info()
+				if err != nil || !info.Mode().IsRegular() || info.Size() > 0 || !what.EmptyFiles || !remove(path, false) {
+					left = true
+				}
+			}
+		}
+		return left
+	}
+	clean(root)
+	return result
+}
+
+// NewDuplicate — новый файл, у которого Watcher нашёл копии.
+type NewDuplicate struct {
+	Path   string
+	Copies []string // Прежние файлы с тем же содержимым, по порядку путей
+	Size   int64
+	Hash   string
+}
+
+// Watcher следит за директориями периодическими повторными обходами и сообщает
+// о новых дубликатах. Хэши берутся из кэша (WithCache, без него — кэш в памяти),
+// поэтому неизменённые файлы не перечитываются.
+type Watcher struct {
+	roots  []string
+	c      config
+	stable map[string]fs.FileInfo // Файлы, не менявшиеся между двумя проверками
+	// Новые или изменившиеся файлы: они хэшируются, только если к следующей
+	// проверке размер и время изменения не поменялись (файл дописан).
+	pending map[string]fs.FileInfo
+	bySize  map[int64]map[string]bool // Размер -> стабильные файлы такого размера
+}
+
+// NewWatcher запоминает текущие файлы roots (с фильтрами Walk): о них Check не сообщает.
+func NewWatcher(ctx context.Context, roots []string, opts ...Option) *Watcher {
+	w := &Watcher{
+		roots:   roots,
+		c:       newConfig(opts),
+		stable:  make(map[string]fs.FileInfo),
+		pending: make(map[string]fs.FileInfo),
+		bySize:  make(map[int64]map[string]bool),
+	}
+	if w.c.cache == nil {
+		w.c.cache, _ = LoadHashCache("", false)
+	}
+	for path, info := range w.snapshot(ctx) {
+		w.addStable(path, info)
+	}
+	return w
+}
+
+// sameState сообщает, что размер и время изменения файла не поменялись.
+func sameState(a, b fs.FileInfo) bool {
+	return a.Size() == b.Size() && a.ModTime().Equal(b.ModTime())
+}
+
+// snapshot обходит все корни и возвращает текущие файлы.
+func (w *Watcher) snapshot(ctx context.Context) map[string]fs.FileInfo {
+	files := make(map[string]fs.FileInfo)
+	for _, root := range w.roots {
+		w.c.walk(ctx, root, func(path string, info fs.FileInfo) {
+			files[path] = info
+		})
+	}
+	return files
+}
+
+// addStable добавляет файл в индекс стабильных файлов.
+func (w *Watcher) addStable(path string, info fs.FileInfo) {
+	w.stable[path] = info
+	if w.bySize[info.Size()] == nil {
+		w.bySize[info.Size()] = make(map[string]bool)
+	}
+	w.bySize[info.Size()][path] = true
+}
+
+// remove забывает файл вместе с его записью в кэше, чтобы память не росла с удалёнными файлами.
+func (w *Watcher) remove(path string) {
+	info, ok := w.stable[path]
+	if !ok {
+		return
+	}
+	delete(w.stable, path)
+	if set := w.bySize[info.Size()]; set != nil {
+		delete(set, path)
+		if len(set) == 0 {
+			delete(w.bySize, info.Size())
+		}
+	}
+	w.c.cache.Forget(path)
+}
+
+// Check повторно обходит директории и возвращает новые файлы, у которых нашлись копии,
+// по порядку путей. Файл считается новым, когда он дописан: его размер и время изменения
+// не поменялись со следующей проверки после появления. Файлы, которые не удалось
+// прочитать при хэшировании, возвращаются отдельно. Кэш сохраняет вызывающий.
+func (w *Watcher) Check(ctx context.Context) ([]NewDuplicate, []*FileError) {
+	current := w.snapshot(ctx)
+	for path, info := range w.stable {
+		if now, ok := current[path]; !ok || !sameState(now, info) {
+			w.remove(path)
+		}
+	}
+	var ready []string
+	for path, info := range current {
+		if _, ok := w.stable[path]; ok {
+			continue
+		}
+		prev, seen := w.pending[path]
+		if !seen || !sameState(prev, info) {
+			// Файл появился или ещё пишется: ждём следующей проверки.
+			w.pending[path] = info
+			continue
+		}
+		delete(w.pending, path)
+		w.addStable(path, info)
+		ready = append(ready, path)
+	}
+	for path := range w.pending {
+		if _, ok := current[path]; !ok {
+			delete(w.pending, path)
+		}
+	}
+	sort.Strings(ready)
+	var found []NewDuplicate
+	var errs []*FileError
+	for _, path := range ready {
+		d, err := w.copies(ctx, path)
+		if err != nil {
+			errs = append(errs, &FileError{Path: path, Err: err})
+			continue
+		}
+		if len(d.Copies) > 0 {
+			found = append(found, d)
+		}
+	}
+	return found, errs
+}
+
+// copies ищет среди стабильных файлов копии нового файла path.
+func (w *Watcher) copies(ctx context.Context, path string) (NewDuplicate, error) {
+	info := w.stable[path]
+	d := NewDuplicate{Path: path, Size: info.Size()}
+	others := w.bySize[info.Size()]
+	if len(others) < 2 {
+		return d, nil
+	}
+	var err error
+	if d.Hash, _, err = w.c.cache.hash(ctx, &w.c, path, info); err != nil {
+		return d, err
+	}
+	for other := range others {
+		if other == path {
+			continue
+		}
+		h, _, err := w.c.cache.hash(ctx, &w.c, other, w.stable[other])
+		if err == nil && h == d.Hash {
+			d.Copies = append(d.Copies, other)
+		}
+	}
+	sort.Strings(d.Copies)
+	return d, nil
+}
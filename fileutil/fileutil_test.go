@@ -0,0 +1,1032 @@
+package fileutil
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+// writeTree создаёт файлы из files (путь через "/" -> содержимое) в dir.
+func writeTree(t *testing.T, dir string, files map[string]string) {
+	t.Helper()
+	for name, content := range files {
+		path := filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+// relGroups возвращает пути групп относительно dir через "/".
+func relGroups(t *testing.T, dir string, groups []Group) [][]string {
+	t.Helper()
+	var out [][]string
+	for _, g := range groups {
+		var paths []string
+		for _, p := range g.Paths {
+			rel, err := filepath.Rel(dir, p)
+			if err != nil {
+				t.Fatal(err)
+			}
+			paths = append(paths, filepath.ToSlash(rel))
+		}
+		out = append(out, paths)
+	}
+	return out
+}
+
+func TestFindDuplicates(t *testing.T) {
+	dir := t.TempDir()
+	big := strings.Repeat("0123456789", 20000) // Больше 2*partialBlock: проходит предварительный этап
+	writeTree(t, dir, map[string]string{
+		"a/one.txt":    "одинаковое",
+		"b/one.txt":    "одинаковое",
+		"b/copy.txt":   "одинаковое",
+		"a/other.txt":  "другое, тот же размер",
+		"big1.bin":     big,
+		"x/big2.bin":   big,
+		"x/big3.bin":   big[:len(big)-1] + "!",
+		".hidden/copy": "одинаковое",
+		"skip/one.txt": "одинаковое",
+		"empty1":       "",
+		"empty2":       "",
+	})
+	tests := []struct {
+		name string
+		opts []Option
+		want [][]string
+	}{
+		{"все", nil, [][]string{
+			{"big1.bin", "x/big2.bin"},
+			{".hidden/copy", "a/one.txt", "b/copy.txt", "b/one.txt", "skip/one.txt"},
+			{"empty1", "empty2"},
+		}},
+		{"фильтры", []Option{WithSkipHidden(), WithExclude("skip"), WithMinSize(1), WithWorkers(3)}, [][]string{
+			{"big1.bin", "x/big2.bin"},
+			{"a/one.txt", "b/copy.txt", "b/one.txt"},
+		}},
+		{"максимальный размер", []Option{WithMaxSize(100), WithHash("crc32"), WithExclude("empty*", ".hidden")}, [][]string{
+			{"a/one.txt", "b/copy.txt", "b/one.txt", "skip/one.txt"},
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			groups, stats, err := FindDuplicates(context.Background(), []string{dir}, tt.opts...)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := relGroups(t, dir, groups); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("группы %q, ожидалось %q", got, tt.want)
+			}
+			if len(stats.Errors) > 0 {
+				t.Errorf("ошибки: %v", stats.Errors)
+			}
+		})
+	}
+
+	// Пересекающиеся корни: файл учитывается один раз.
+	groups, _, err := FindDuplicates(context.Background(), []string{dir, filepath.Join(dir, "b")}, WithSkipHidden(), WithExclude("skip", "empty*"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := relGroups(t, dir, groups); len(got) != 2 || len(got[1]) != 3 {
+		t.Errorf("пересекающиеся корни: %q", got)
+	}
+
+	if _, _, err := FindDuplicates(context.Background(), []string{filepath.Join(dir, "missing")}); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("недоступный корень: %v", err)
+	}
+	if _, _, err := FindDuplicates(context.Background(), []string{dir}, WithHash("sha3")); err == nil {
+		t.Error("неизвестный алгоритм не отвергнут")
+	}
+}
+
+func TestFindDuplicatesModes(t *testing.T) {
+	dir := t.TempDir()
+	big := strings.Repeat("0123456789", 20000)
+	writeTree(t, dir, map[string]string{
+		"a/one.txt":   "одинаковое",
+		"b/one.txt":   "одинаковое",
+		"b/copy.txt":  "одинаковое",
+		"a/other.txt": "другое с тем же размером?",
+		"b/one.log":   "не совпадает",
+		"big1.bin":    big,
+		"x/big2.bin":  big,
+		"x/big3.bin":  big[:len(big)-1] + "!", // Тот же размер и начало, другой конец
+		"x/one.txt":   "ОДИНАКОВОЕ",           // Имя и размер совпадают, содержимое другое
+		"empty":       "",
+	})
+
+	var read int64
+	tests := []struct {
+		name string
+		opts []Option
+		want [][]string
+	}{
+		{"по содержимому", nil, [][]string{
+			{"big1.bin", "x/big2.bin"},
+			{"a/one.txt", "b/copy.txt", "b/one.txt"},
+		}},
+		{"по имени и размеру", []Option{WithNameSize(false)}, [][]string{
+			{"a/one.txt", "b/one.txt", "x/one.txt"},
+		}},
+		{"по имени и размеру с проверкой", []Option{WithNameSize(true)}, [][]string{
+			{"a/one.txt", "b/one.txt"},
+		}},
+		{"только начало и конец", []Option{WithQuick()}, [][]string{
+			{"big1.bin", "x/big2.bin"},
+			{"a/one.txt", "b/copy.txt", "b/one.txt"},
+		}},
+		{"минимальный размер", []Option{WithMinSize(1000)}, [][]string{
+			{"big1.bin", "x/big2.bin"},
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			opts := append([]Option{WithWorkers(2), WithReadCounter(&read)}, tt.opts...)
+			groups, stats, err := FindDuplicates(context.Background(), []string{dir}, opts...)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := relGroups(t, dir, groups); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("группы %q, ожидалось %q", got, tt.want)
+			}
+			if len(stats.Errors) > 0 {
+				t.Errorf("ошибки: %v", stats.Errors)
+			}
+		})
+	}
+	if read == 0 {
+		t.Error("прочитанные байты не учтены в WithReadCounter")
+	}
+}
+
+func TestFindDuplicatesCache(t *testing.T) {
+	dir := t.TempDir()
+	writeTree(t, dir, map[string]string{"a": "x", "b": "x", "c": "y"})
+	path := filepath.Join(t.TempDir(), "cache.json")
+	for i, wantHits := range []int{0, 3} {
+		cache, err := LoadHashCache(path, true)
+		if err != nil {
+			t.Fatal(err)
+		}
+		groups, stats, err := FindDuplicates(context.Background(), []string{dir}, WithCache(cache))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(groups) != 1 || stats.CacheHits != wantHits || stats.Hashed != 3 {
+			t.Errorf("прогон %d: групп %d, из кэша %d, хэшей %d; ожидалось 1, %d, 3", i+1, len(groups), stats.CacheHits, stats.Hashed, wantHits)
+		}
+	}
+}
+
+func TestFindDuplicatesProgress(t *testing.T) {
+	dir := t.TempDir()
+	writeTree(t, dir, map[string]string{"a": "a", "b": "b", "c": "a"})
+	var events []Progress
+	if _, _, err := FindDuplicates(context.Background(), []string{dir}, WithProgress(func(p Progress) { events = append(events, p) })); err != nil {
+		t.Fatal(err)
+	}
+	want := []Progress{
+		{Stage: "walk", Done: 1}, {Stage: "walk", Done: 2}, {Stage: "walk", Done: 3},
+		{Stage: "walk", Done: 3, Final: true},
+		{Stage: "hash", Done: 1, Total: 3, Bytes: 1}, {Stage: "hash", Done: 2, Total: 3, Bytes: 2}, {Stage: "hash", Done: 3, Total: 3, Bytes: 3},
+		{Stage: "hash", Done: 3, Total: 3, Bytes: 3, Final: true},
+	}
+	if !reflect.DeepEqual(events, want) {
+		t.Errorf("события прогресса:\n%+v\nожидалось:\n%+v", events, want)
+	}
+}
+
+func TestFindDuplicatesCancel(t *testing.T) {
+	dir := t.TempDir()
+	files := make(map[string]string)
+	for i := 0; i < 50; i++ {
+		files[filepath.Join("d", string(rune('a'+i%26)), strings.Repeat("f", i+1))] = "x"
+	}
+	writeTree(t, dir, files)
+
+	for _, stage := range []string{"walk", "hash"} {
+		ctx, cancel := context.WithCancel(context.Background())
+		var last Progress
+		progress := func(p Progress) {
+			last = p
+			if p.Stage == stage {
+				cancel()
+			}
+		}
+		groups, _, err := FindDuplicates(ctx, []string{dir}, WithProgress(progress))
+		cancel()
+		if !errors.Is(err, context.Canceled) || groups != nil {
+			t.Errorf("отмена на этапе %s: группы %d, ошибка %v", stage, len(groups), err)
+		}
+		if last.Stage != stage || (stage == "walk" && last.Done != 1) {
+			t.Errorf("отмена на этапе %s: поиск продолжился до %+v", stage, last)
+		}
+	}
+}
+
+func TestRenamePlan(t *testing.T) {
+	tests := []struct {
+		name    string
+		files   []string
+		opts    []Option
+		want    [][2]string
+		wantErr string
+	}{
+		{"по алфавиту", []string{"b.JPG", "a.txt", "c"}, []Option{WithPrefix("trip")},
+			[][2]string{{"a.txt", "trip_001.txt"}, {"b.JPG", "trip_002.JPG"}, {"c", "trip_003"}}, ""},
+		{"нумерация и ширина", []string{"a", "b"}, []Option{WithNumbering(10, 5), WithWidth(4)},
+			[][2]string{{"a", "file_0010"}, {"b", "file_0015"}}, ""},
+		{"уже названные не трогаются", []string{"file_001.txt", "z.txt"}, nil,
+			[][2]string{{"z.txt", "file_002.txt"}}, ""},
+		{"цепочка имён внутри плана", []string{"file_002", "file_003"}, nil,
+			[][2]string{{"file_002", "file_001"}, {"file_003", "file_002"}}, ""},
+		{"имя занято директорией", []string{"a.jpg", "b.png", "file_001.jpg/x"}, []Option{WithExtensions("JPG")}, nil, "уже существует"},
+		{"расширения без конфликта", []string{"a.jpg", "b.png"}, []Option{WithExtensions(".jpg")},
+			[][2]string{{"a.jpg", "file_001.jpg"}}, ""},
+		{"рекурсивно со сквозной нумерацией", []string{"c.txt", "a.jpg", "sub/d.png"}, []Option{WithPrefix("img"), WithRecursive(), WithGlobalNumbering()},
+			[][2]string{{"a.jpg", "img_001.jpg"}, {"c.txt", "img_002.txt"}, {"sub/d.png", "sub/img_003.png"}}, ""},
+		{"шаблон", []string{"DSC 1.JPG", "b.txt"}, []Option{WithPrefix("trip"), WithTemplate("{prefix}-{num:2}-{name}{ext}")},
+			[][2]string{{"DSC 1.JPG", "trip-01-DSC 1.jpg"}, {"b.txt", "trip-02-b.txt"}}, ""},
+		{"исходное имя в суффиксе", []string{"DSC 1.JPG"}, []Option{WithPrefix("trip"), WithOriginalSuffix()},
+			[][2]string{{"DSC 1.JPG", "trip_001__DSC_1.JPG"}}, ""},
+		{"по размеру в обратном порядке", []string{"a", "bb", "ccc"}, []Option{WithSort("size", true)},
+			[][2]string{{"ccc", "file_001"}, {"bb", "file_002"}, {"a", "file_003"}}, ""},
+		{"недостаточная ширина", []string{"a", "b"}, []Option{WithNumbering(99, 1), WithWidth(2)}, nil, "ширины номера 2 недостаточно"},
+		{"разделитель в префиксе", []string{"a"}, []Option{WithPrefix("x/y")}, nil, "разделители путей"},
+		{"неверный шаг", []string{"a"}, []Option{WithNumbering(1, 0)}, nil, "шаг"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			if err := os.Mkdir(filepath.Join(dir, "sub"), 0755); err != nil {
+				t.Fatal(err)
+			}
+			for _, name := range tt.files {
+				writeTree(t, dir, map[string]string{name: name})
+			}
+			plan, err := RenamePlan(dir, tt.opts...)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("ошибка %v, ожидалась %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			var got [][2]string
+			for _, op := range plan {
+				from, _ := filepath.Rel(dir, op.From)
+				to, _ := filepath.Rel(dir, op.To)
+				got = append(got, [2]string{filepath.ToSlash(from), filepath.ToSlash(to)})
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Fatalf("план %q, ожидалось %q", got, tt.want)
+			}
+			if err := Apply(plan); err != nil {
+				t.Fatal(err)
+			}
+			for _, op := range tt.want {
+				data, err := os.ReadFile(filepath.Join(dir, filepath.FromSlash(op[1])))
+				if err != nil || string(data) != op[0] {
+					t.Errorf("%s: %q, %v; ожидалось содержимое %q", op[1], data, err, op[0])
+				}
+			}
+		})
+	}
+}
+
+func TestNormalizePlan(t *testing.T) {
+	dir := t.TempDir()
+	writeTree(t, dir, map[string]string{"Мой  файл.TXT": "1", "мой_файл.txt": "2", "ok.txt": "3", "sub/a b": "4"})
+	n := Normalization{Separator: "_", LowerExt: true, Trim: true, Spaces: true, Strip: true, Collapse: true}
+	plan, err := NormalizePlan(dir, n, WithRecursive())
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got [][2]string
+	for _, op := range plan {
+		from, _ := filepath.Rel(dir, op.From)
+		to, _ := filepath.Rel(dir, op.To)
+		got = append(got, [2]string{filepath.ToSlash(from), filepath.ToSlash(to)})
+	}
+	want := [][2]string{{"Мой  файл.TXT", "Мой_файл.txt"}, {"sub/a b", "sub/a_b"}}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("план %q, ожидалось %q", got, want)
+	}
+	if name := NormalizeName("Мой файл.TXT", Normalization{Separator: "-", Spaces: true, ASCII: true, Strip: true}); name != "Moy-fayl.TXT" {
+		t.Errorf("NormalizeName с транслитерацией = %q", name)
+	}
+	if _, err := NormalizePlan(dir, Normalization{Separator: "/"}); err == nil {
+		t.Error("разделитель с \"/\" не отвергнут")
+	}
+}
+
+func TestApplyRollback(t *testing.T) {
+	dir := t.TempDir()
+	writeTree(t, dir, map[string]string{"a": "a", "b": "b"})
+	plan := []Rename{
+		{From: filepath.Join(dir, "a"), To: filepath.Join(dir, "b")},
+		{From: filepath.Join(dir, "b"), To: filepath.Join(dir, "missing", "c")},
+	}
+	if err := Apply(plan); err == nil || !strings.Contains(err.Error(), "откачены") {
+		t.Fatalf("ошибка %v, ожидался откат", err)
+	}
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, e := range entries {
+		names = append(names, e.Name())
+	}
+	if !reflect.DeepEqual(names, []string{"a", "b"}) {
+		t.Fatalf("после отката в директории %q", names)
+	}
+	for _, name := range names {
+		if data, _ := os.ReadFile(filepath.Join(dir, name)); string(data) != name {
+			t.Errorf("%s после отката содержит %q", name, data)
+		}
+	}
+}
+
+func TestApplyRollbackPartial(t *testing.T) {
+	tests := []struct {
+		name  string
+		files []string
+		plan  [][2]string // Последний шаг каждого плана проваливается: директории missing нет
+		full  bool        // Что ответил rollback
+		want  map[string]string
+		done  int // Сколько операций осталось выполненными
+	}{
+		{
+			name:  "цепочка без полного отката",
+			files: []string{"a.txt", "p1.txt"},
+			plan:  [][2]string{{"a.txt", "p1.txt"}, {"p1.txt", "missing/x"}},
+			want:  map[string]string{"a.txt": "a.txt", "p1.txt": "p1.txt"},
+		},
+		{
+			name:  "цепочка с полным откатом",
+			files: []string{"a.txt", "p1.txt"},
+			plan:  [][2]string{{"a.txt", "p1.txt"}, {"p1.txt", "missing/x"}},
+			full:  true,
+			want:  map[string]string{"a.txt": "a.txt", "p1.txt": "p1.txt"},
+		},
+		{
+			name:  "длинная цепочка без полного отката",
+			files: []string{"1", "2", "3"},
+			plan:  [][2]string{{"1", "2"}, {"2", "3"}, {"3", "missing/x"}},
+			want:  map[string]string{"1": "1", "2": "2", "3": "3"},
+		},
+		{
+			name:  "цикл без полного отката",
+			files: []string{"a", "b", "x"},
+			plan:  [][2]string{{"a", "b"}, {"x", "missing/y"}, {"b", "a"}},
+			want:  map[string]string{"a": "a", "b": "b", "x": "x"},
+		},
+		{
+			name:  "цикл с полным откатом",
+			files: []string{"a", "b", "x"},
+			plan:  [][2]string{{"a", "b"}, {"b", "a"}, {"x", "missing/y"}},
+			full:  true,
+			want:  map[string]string{"a": "a", "b": "b", "x": "x"},
+		},
+		{
+			name:  "выполненный цикл остаётся",
+			files: []string{"a", "b", "x"},
+			plan:  [][2]string{{"a", "b"}, {"b", "a"}, {"x", "missing/y"}},
+			want:  map[string]string{"a": "b", "b": "a", "x": "x"},
+			done:  2,
+		},
+		{
+			name:  "независимые переименования остаются",
+			files: []string{"a", "b"},
+			plan:  [][2]string{{"a", "c"}, {"b", "missing/x"}},
+			want:  map[string]string{"c": "a", "b": "b"},
+			done:  1,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			for _, name := range tt.files {
+				writeTree(t, dir, map[string]string{name: name})
+			}
+			var plan []Rename
+			for _, op := range tt.plan {
+				plan = append(plan, Rename{From: filepath.Join(dir, op[0]), To: filepath.Join(dir, op[1])})
+			}
+			done, err := ApplyRollback(plan, func(error) bool { return tt.full })
+			if err == nil {
+				t.Fatal("ожидалась ошибка последнего шага")
+			}
+			if strings.Contains(err.Error(), "не удалось откатить") {
+				t.Errorf("откат с ошибками: %v", err)
+			}
+			if len(done) != tt.done {
+				t.Errorf("выполнено операций %d (%v), ожидалось %d", len(done), done, tt.done)
+			}
+			got := fileContents(t, dir)
+			if len(got) != len(tt.want) {
+				t.Errorf("файлы %v, ожидалось %v", got, tt.want)
+			}
+			for name, content := range tt.want {
+				if got[name] != content {
+					t.Errorf("%s содержит %q, ожидалось %q (все файлы: %v)", name, got[name], content, got)
+				}
+			}
+		})
+	}
+}
+
+// fileContents возвращает содержимое файлов dir по именам; временные имена тоже попадают в результат.
+func fileContents(t *testing.T, dir string) map[string]string {
+	t.Helper()
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	files := map[string]string{}
+	for _, e := range entries {
+		if e.IsDir() {
+			continue
+		}
+		data, err := os.ReadFile(filepath.Join(dir, e.Name()))
+		if err != nil {
+			t.Fatal(err)
+		}
+		files[e.Name()] = string(data)
+	}
+	return files
+}
+
+func TestRollbackRenameKeepsOccupiedName(t *testing.T) {
+	// Пока файл был под временным именем, его исходное имя занял посторонний файл.
+	dir := t.TempDir()
+	writeTree(t, dir, map[string]string{"a": "a", "tmp": "tmp"})
+	plan := []Rename{{From: filepath.Join(dir, "a"), To: filepath.Join(dir, "b")}}
+	problems := rollbackRename(plan, []string{filepath.Join(dir, "tmp")}, []int{1}, true)
+	if len(problems) != 1 || !strings.Contains(problems[0], filepath.Join(dir, "tmp")) {
+		t.Errorf("rollbackRename = %q, ожидалось замечание о временном файле", problems)
+	}
+	if got := fileContents(t, dir); got["a"] != "a" || got["tmp"] != "tmp" {
+		t.Errorf("файлы %v: посторонний файл или временный потеряны", got)
+	}
+}
+
+func TestWalkSymlinkCycle(t *testing.T) {
+	dir := t.TempDir()
+	writeTree(t, dir, map[string]string{"a.txt": "a", "sub/b.txt": "b", "sub/deep/c.txt": "c"})
+	// Цикл на корень и вторая ссылка на ту же директорию.
+	for link, target := range map[string]string{"sub/deep/loop": dir, "alias": filepath.Join(dir, "sub")} {
+		if err := os.Symlink(target, filepath.Join(dir, link)); err != nil {
+			t.Skip(err)
+		}
+	}
+	seen := map[string]int{}
+	if _, err := Walk(context.Background(), dir, func(path string, info fs.FileInfo) {
+		seen[info.Name()]++
+	}, WithFollowSymlinks()); err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"a.txt", "b.txt", "c.txt"} {
+		if seen[name] != 1 {
+			t.Errorf("%s обработан %d раз, ожидался один (все: %v)", name, seen[name], seen)
+		}
+	}
+}
+
+// TestFileID проверяет ключ (устройство, inode) из fileid_unix.go и fileid_other.go:
+// жёсткая ссылка даёт тот же ключ, другой файл — другой; без ключа SameDevice считает тома общими.
+func TestFileID(t *testing.T) {
+	dir := t.TempDir()
+	writeTree(t, dir, map[string]string{"a": "a", "c": "c"})
+	if err := os.Link(filepath.Join(dir, "a"), filepath.Join(dir, "b")); err != nil {
+		t.Skip(err)
+	}
+	infos := map[string]fs.FileInfo{}
+	for _, name := range []string{"a", "b", "c"} {
+		info, err := os.Stat(filepath.Join(dir, name))
+		if err != nil {
+			t.Fatal(err)
+		}
+		infos[name] = info
+	}
+	idA, ok := fileID(infos["a"])
+	if !ok {
+		if !SameDevice(infos["a"], infos["c"]) {
+			t.Error("без ключа файлы должны считаться лежащими на одном томе")
+		}
+		return
+	}
+	if idB, _ := fileID(infos["b"]); idB != idA {
+		t.Errorf("жёсткая ссылка: ключ %v, ожидался %v", idB, idA)
+	}
+	if idC, _ := fileID(infos["c"]); idC == idA {
+		t.Errorf("разные файлы с одним ключом %v", idA)
+	}
+	if !SameDevice(infos["a"], infos["c"]) {
+		t.Error("файлы одной директории на разных устройствах")
+	}
+}
+
+// TestHashCacheStoreError проверяет, что ошибка периодического сохранения кэша
+// возвращается из store, а не теряется, и что повтор откладывается на интервал.
+func TestHashCacheStoreError(t *testing.T) {
+	dir := t.TempDir()
+	writeTree(t, dir, map[string]string{"a": "a", "b": "b"})
+	cache, err := LoadHashCache(filepath.Join(dir, "missing", "cache.json"), true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	info, err := os.Stat(filepath.Join(dir, "a"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	cache.lastSave = time.Now().Add(-2 * cacheSaveInterval)
+	if err := cache.store(filepath.Join(dir, "a"), info, "sha256", "h1"); err == nil {
+		t.Fatal("store не вернул ошибку сохранения в несуществующую директорию")
+	}
+	if !cache.dirty {
+		t.Error("после неудачного сохранения кэш помечен сохранённым")
+	}
+	if err := cache.store(filepath.Join(dir, "b"), info, "sha256", "h2"); err != nil {
+		t.Errorf("повторная попытка сохранения раньше интервала: %v", err)
+	}
+	if err := cache.Save(); err == nil {
+		t.Error("Save не вернул ошибку")
+	}
+	if h, ok := cache.lookup(filepath.Join(dir, "a"), info, "sha256"); !ok || h != "h1" {
+		t.Errorf("запись потеряна после ошибки сохранения: %q, %v", h, ok)
+	}
+}
+
+func TestParseTemplate(t *testing.T) {
+	tests := []struct {
+		tmpl    string
+		want    []templatePart
+		wantErr string
+	}{
+		{"{prefix}_{num:3}{ext}", []templatePart{{field: "prefix"}, {literal: "_"}, {field: "num", width: 3}, {field: "ext"}}, ""},
+		{"{date}-{name}", []templatePart{{field: "date"}, {literal: "-"}, {field: "name"}}, ""},
+		{"фото {num}", []templatePart{{literal: "фото "}, {field: "num"}}, ""},
+		{"без подстановок", []templatePart{{literal: "без подстановок"}}, ""},
+		{"", nil, ""},
+		{"{num}}", []templatePart{{field: "num"}, {literal: "}"}}, ""},
+		{"a/{num}", nil, "разделители путей"},
+		{`a\{num}`, nil, "разделители путей"},
+		{"{num", nil, "незакрытая скобка"},
+		{"{size}", nil, "неизвестная подстановка {size}"},
+		{"{}", nil, "неизвестная подстановка {}"},
+		{"{name:3}", nil, "ширина допустима только для {num:N}"},
+		{"{num:0}", nil, "ширина допустима только для {num:N}"},
+		{"{num:x}", nil, "ширина допустима только для {num:N}"},
+	}
+	for _, tt := range tests {
+		got, err := parseTemplate(tt.tmpl)
+		switch {
+		case tt.wantErr != "" && (err == nil || !strings.Contains(err.Error(), tt.wantErr)):
+			t.Errorf("parseTemplate(%q): ошибка %v, ожидалась %q", tt.tmpl, err, tt.wantErr)
+		case tt.wantErr == "" && err != nil:
+			t.Errorf("parseTemplate(%q): %v", tt.tmpl, err)
+		case tt.wantErr == "" && !reflect.DeepEqual(got, tt.want):
+			t.Errorf("parseTemplate(%q) = %+v, ожидалось %+v", tt.tmpl, got, tt.want)
+		}
+	}
+}
+
+func TestExpandTemplate(t *testing.T) {
+	v := templateValues{prefix: "trip", name: "DSC 0451", ext: ".JPG", num: 7, date: time.Date(2026, 5, 1, 23, 59, 0, 0, time.UTC)}
+	tests := []struct {
+		tmpl  string
+		width int // templateValues.width (WithWidth)
+		want  string
+	}{
+		{"{prefix}_{num:3}{ext}", 0, "trip_007.jpg"},
+		{"{prefix}_{num}{ext}", 0, "trip_7.jpg"},
+		{"{prefix}_{num}{ext}", 4, "trip_0007.jpg"},
+		{"{num:2}", 4, "07"}, // Явная ширина важнее WithWidth
+		{"{date}_{name}{ext}", 0, "20260501_DSC 0451.jpg"},
+		{"{num:1}", 0, "7"},
+		{"копия {name}", 0, "копия DSC 0451"},
+	}
+	for _, tt := range tests {
+		parts, err := parseTemplate(tt.tmpl)
+		if err != nil {
+			t.Fatalf("parseTemplate(%q): %v", tt.tmpl, err)
+		}
+		values := v
+		values.width = tt.width
+		if got := expandTemplate(parts, values); got != tt.want {
+			t.Errorf("expandTemplate(%q, width %d) = %q, ожидалось %q", tt.tmpl, tt.width, got, tt.want)
+		}
+	}
+	// Номер длиннее ширины не обрезается.
+	parts, _ := parseTemplate("{num:2}")
+	if got := expandTemplate(parts, templateValues{num: 1234}); got != "1234" {
+		t.Errorf("expandTemplate({num:2}, 1234) = %q", got)
+	}
+}
+
+// TestQuarantineInterrupted проверяет, что перемещение, прерванное после первого файла,
+// оставляет в манифесте этот файл, и Restore возвращает его на место.
+func TestQuarantineInterrupted(t *testing.T) {
+	dir, target := t.TempDir(), t.TempDir()
+	writeTree(t, dir, map[string]string{"a": "a", "b": "a", "c": "a"})
+	moves := 0
+	move := func(src, dst string) error {
+		if moves++; moves > 1 {
+			panic("прервано")
+		}
+		return MoveFile(src, dst)
+	}
+	q, err := OpenQuarantine(target, []string{dir}, WithMove(move))
+	if err != nil {
+		t.Fatal(err)
+	}
+	func() {
+		defer func() {
+			if r := recover(); r != "прервано" {
+				t.Fatalf("перемещение не прервано: %v", r)
+			}
+		}()
+		for _, name := range []string{"b", "c"} {
+			if _, err := q.Move(filepath.Join(dir, name), 1); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}()
+
+	entries, err := ReadQuarantine(q.Manifest)
+	if err != nil || len(entries) != 1 || entries[0].Original != filepath.Join(dir, "b") || entries[0].Path != filepath.Join(target, "b") {
+		t.Fatalf("манифест после прерывания: %+v, %v", entries, err)
+	}
+	result, err := Restore(q.Manifest)
+	if err != nil || len(result.Restored) != 1 || len(result.Errors) != 0 {
+		t.Fatalf("Restore: %+v, %v", result, err)
+	}
+	if got := fileContents(t, dir); len(got) != 3 || got["b"] != "a" {
+		t.Errorf("после Restore: %v", got)
+	}
+	if _, err := os.Stat(q.Manifest); !os.IsNotExist(err) {
+		t.Errorf("опустевший манифест не удалён: %v", err)
+	}
+}
+
+// TestReadQuarantine проверяет чтение манифеста карантина: отметки о возвращённых
+// файлах, оборванную последнюю строку прерванной записи и прежний формат (один JSON-объект).
+func TestReadQuarantine(t *testing.T) {
+	tests := []struct {
+		name    string
+		data    string
+		want    []string // Пути оставшихся в карантине файлов
+		legacy  bool
+		wantErr bool
+	}{
+		{"пустой", "", nil, false, false},
+		{"записи", `{"path":"/q/a","original":"/d/a","size":1}` + "\n" + `{"path":"/q/b","original":"/d/b","size":1}` + "\n", []string{"/q/a", "/q/b"}, false, false},
+		{"возвращённый файл", `{"path":"/q/a","original":"/d/a"}` + "\n" + `{"path":"/q/b","original":"/d/b"}` + "\n" + `{"path":"/q/a","removed":true}` + "\n", []string{"/q/b"}, false, false},
+		{"снова в карантине", `{"path":"/q/a","original":"/d/a"}` + "\n" + `{"path":"/q/a","removed":true}` + "\n" + `{"path":"/q/a","original":"/d/a"}` + "\n", []string{"/q/a"}, false, false},
+		{"оборванная строка", `{"path":"/q/a","original":"/d/a"}` + "\n" + `{"path":"/q/b","orig`, []string{"/q/a"}, false, false},
+		{"повреждённая строка", `{"path":"/q/a"` + "\n" + `{"path":"/q/b","original":"/d/b"}` + "\n", nil, false, true},
+		{"прежний формат", "{\n  \"entries\": [\n    {\"path\": \"/q/a\", \"original\": \"/d/a\", \"size\": 1}\n  ]\n}", []string{"/q/a"}, true, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), QuarantineManifestName)
+			if err := os.WriteFile(path, []byte(tt.data), 0644); err != nil {
+				t.Fatal(err)
+			}
+			entries, legacy, err := readQuarantine(path)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ошибка %v, ожидалась ошибка: %v", err, tt.wantErr)
+			}
+			var got []string
+			for _, e := range entries {
+				got = append(got, e.Path)
+			}
+			if !reflect.DeepEqual(got, tt.want) || legacy != tt.legacy {
+				t.Errorf("получено %v (прежний формат: %v), ожидалось %v (%v)", got, legacy, tt.want, tt.legacy)
+			}
+		})
+	}
+}
+
+// TestUndo проверяет отмену по журналу: переименование и перемещение в карантин
+// откатываются, файл вычёркивается из манифеста, а отмена дописывается в журнал.
+func TestUndo(t *testing.T) {
+	dir, target := t.TempDir(), t.TempDir()
+	undoLog := filepath.Join(t.TempDir(), "undo.jsonl")
+	writeTree(t, dir, map[string]string{"a": "1", "b": "1", "c": "2"})
+	want := fileContents(t, dir)
+
+	plan := []Rename{{From: filepath.Join(dir, "c"), To: filepath.Join(dir, "d")}}
+	if err := Apply(plan); err != nil {
+		t.Fatal(err)
+	}
+	id, err := AppendUndo(undoLog, "rename", 0, 0, RenameUndoOps(plan))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var moved []string
+	q, err := OpenQuarantine(target, []string{dir}, WithMove(func(src, dst string) error {
+		moved = append(moved, src)
+		return MoveFile(src, dst)
+	}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	e, err := q.Move(filepath.Join(dir, "b"), 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := AppendUndo(undoLog, "duplicates", 0, 0, []UndoOp{{Kind: "move", From: e.Original, To: e.Path, Manifest: q.Manifest}}); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, runID := range []int{0, id} {
+		run, pending, err := FindUndo(undoLog, runID)
+		if err != nil || run == nil || len(pending) != 1 {
+			t.Fatalf("FindUndo(%d): %+v, %v, %v", runID, run, pending, err)
+		}
+		result := Undo(undoLog, run, pending, WithMove(func(src, dst string) error {
+			moved = append(moved, src)
+			return MoveFile(src, dst)
+		}))
+		if len(result.Done) != 1 || result.RenameErr != nil || len(result.LogErrors) != 0 || len(result.Errors) != 0 {
+			t.Fatalf("Undo(%d): %+v", run.ID, result)
+		}
+	}
+	if got := fileContents(t, dir); !reflect.DeepEqual(got, want) {
+		t.Errorf("после Undo: %v, ожидалось %v", got, want)
+	}
+	if wantMoved := []string{filepath.Join(dir, "b"), filepath.Join(target, "b")}; !reflect.DeepEqual(moved, wantMoved) {
+		t.Errorf("WithMove вызвана для %v, ожидалось %v", moved, wantMoved)
+	}
+	if _, err := os.Stat(q.Manifest); !os.IsNotExist(err) {
+		t.Errorf("опустевший манифест не удалён: %v", err)
+	}
+	if run, _, err := FindUndo(undoLog, 0); run != nil || err != nil {
+		t.Errorf("после отмены всех запусков FindUndo(0) = %+v, %v", run, err)
+	}
+	if run, pending, err := FindUndo(undoLog, id); run == nil || len(pending) != 0 || err != nil {
+		t.Errorf("отменённый запуск: %+v, %v, %v", run, pending, err)
+	}
+	if _, _, err := FindUndo(undoLog, 100); !errors.Is(err, ErrUndoNotFound) {
+		t.Errorf("FindUndo(100): %v, ожидалась ErrUndoNotFound", err)
+	}
+	records, err := ReadUndoLog(undoLog)
+	if err != nil || len(records) != 4 || records[3].Command != "undo" || records[3].Undoes != id {
+		t.Errorf("журнал отмены: %+v, %v", records, err)
+	}
+}
+
+func TestCompareDirs(t *testing.T) {
+	dirA, dirB := t.TempDir(), t.TempDir()
+	writeTree(t, dirA, map[string]string{"same": "x", "sub/content": "aa", "size": "a", "only-a": "", ".hidden": "a"})
+	writeTree(t, dirB, map[string]string{"same": "x", "sub/content": "bb", "size": "aa", "only-b": "", ".hidden": "b"})
+	result, err := CompareDirs(context.Background(), dirA, dirB, WithSkipHidden(), WithWorkers(2))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := CompareResult{
+		OnlyInA:   []string{"only-a"},
+		OnlyInB:   []string{"only-b"},
+		Different: []FileDiff{{Path: "size", Reason: "size", SizeA: 1, SizeB: 2}, {Path: "sub/content", Reason: "content", SizeA: 2, SizeB: 2}},
+		Identical: 1,
+	}
+	result.Skipped = WalkStats{}
+	if !reflect.DeepEqual(result, want) {
+		t.Errorf("CompareDirs = %+v, ожидалось %+v", result, want)
+	}
+}
+
+// TestChecksums проверяет манифест sha256sum: файл манифеста внутри директории не
+// учитывается, а изменённые, удалённые и новые файлы получают свои состояния.
+func TestChecksums(t *testing.T) {
+	dir := t.TempDir()
+	manifest := filepath.Join(dir, "SHA256SUMS")
+	writeTree(t, dir, map[string]string{"a": "1", "sub/b": "2", "c": "3"})
+	written, _, err := CreateChecksums(context.Background(), dir, manifest)
+	if err != nil || written != 3 {
+		t.Fatalf("CreateChecksums: %d, %v", written, err)
+	}
+	writeTree(t, dir, map[string]string{"a": "изменён", "d": "4"})
+	if err := os.Remove(filepath.Join(dir, "c")); err != nil {
+		t.Fatal(err)
+	}
+	statuses, _, err := VerifyChecksums(context.Background(), dir, manifest)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for _, s := range statuses {
+		got = append(got, s.Path+": "+s.Status)
+	}
+	if want := []string{"a: FAILED", "c: MISSING", "sub/b: OK", "d: NEW"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("VerifyChecksums = %v, ожидалось %v", got, want)
+	}
+	if err := os.WriteFile(manifest, []byte("не манифест\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := VerifyChecksums(context.Background(), dir, manifest); err == nil {
+		t.Error("повреждённый манифест прочитан без ошибки")
+	}
+}
+
+func TestClean(t *testing.T) {
+	tests := []struct {
+		name string
+		what Cleanup
+		opts []Option
+		want []string // Оставшиеся записи относительно корня
+	}{
+		{"файлы", Cleanup{EmptyFiles: true}, nil, []string{"empty", "full", "full/f", "keep"}},
+		{"директории", Cleanup{EmptyDirs: true}, nil, []string{"empty", "empty/e", "full", "full/e", "full/f", "keep", "keep/.e"}},
+		{"всё", Cleanup{EmptyFiles: true, EmptyDirs: true}, nil, []string{"full", "full/f"}},
+		{"без скрытых", Cleanup{EmptyFiles: true, EmptyDirs: true}, []Option{WithSkipHidden()}, []string{"full", "full/f", "keep", "keep/.e"}},
+		{"исключение", Cleanup{EmptyFiles: true, EmptyDirs: true}, []Option{WithExclude("empty")}, []string{"empty", "empty/e", "full", "full/f"}},
+		{"пробный запуск", Cleanup{EmptyFiles: true, EmptyDirs: true, DryRun: true}, nil, []string{"empty", "empty/e", "full", "full/e", "full/f", "keep", "keep/.e"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			writeTree(t, dir, map[string]string{"empty/e": "", "full/e": "", "full/f": "f", "keep/.e": ""})
+			result := Clean(dir, tt.what, tt.opts...)
+			if len(result.Errors) != 0 {
+				t.Fatalf("ошибки: %v", result.Errors)
+			}
+			var got []string
+			filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+				if rel, _ := filepath.Rel(dir, path); rel != "." {
+					got = append(got, filepath.ToSlash(rel))
+				}
+				return err
+			})
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("осталось %v, ожидалось %v (удалено %+v)", got, tt.want, result.Removed)
+			}
+		})
+	}
+}
+
+// TestWatcher проверяет, что Watcher сообщает о новом файле только после того, как он
+// перестал меняться, и только если у него есть копии.
+func TestWatcher(t *testing.T) {
+	dir := t.TempDir()
+	writeTree(t, dir, map[string]string{"a": "копия", "b": "другое"})
+	w := NewWatcher(context.Background(), []string{dir})
+	writeTree(t, dir, map[string]string{"new": "копия", "unique": "новое"})
+	if found, errs := w.Check(context.Background()); len(found) != 0 || len(errs) != 0 {
+		t.Fatalf("новые файлы учтены до второй проверки: %+v, %v", found, errs)
+	}
+	found, errs := w.Check(context.Background())
+	if len(errs) != 0 {
+		t.Fatal(errs)
+	}
+	if len(found) != 1 || found[0].Path != filepath.Join(dir, "new") || !reflect.DeepEqual(found[0].Copies, []string{filepath.Join(dir, "a")}) {
+		t.Errorf("Check = %+v", found)
+	}
+	if found, _ := w.Check(context.Background()); len(found) != 0 {
+		t.Errorf("повторная проверка без изменений: %+v", found)
+	}
+}
+
+// benchTree создаёт в dir дерево из dirs директорий по files файлов: размеры повторяются,
+// и каждый третий файл — копия файла из соседней директории, так что работают все этапы поиска.
+func benchTree(b *testing.B, dir string, dirs, files int) {
+	b.Helper()
+	for d := 0; d < dirs; d++ {
+		sub := filepath.Join(dir, fmt.Sprintf("d%02d", d))
+		if err := os.Mkdir(sub, 0755); err != nil {
+			b.Fatal(err)
+		}
+		for f := 0; f < files; f++ {
+			owner := d
+			if f%3 == 0 {
+				owner = d / 2 * 2 // Копия файла из чётной директории пары
+			}
+			content := strings.Repeat(fmt.Sprintf("%02d-%03d;", owner, f), 64+f%16*32)
+			if err := os.WriteFile(filepath.Join(sub, fmt.Sprintf("f%03d.dat", f)), []byte(content), 0644); err != nil {
+				b.Fatal(err)
+			}
+		}
+	}
+}
+
+func BenchmarkFindDuplicates(b *testing.B) {
+	dir := b.TempDir()
+	benchTree(b, dir, 20, 50)
+	for _, workers := range []int{1, 4} {
+		b.Run(fmt.Sprintf("workers=%d", workers), func(b *testing.B) {
+			var read int64
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				groups, _, err := FindDuplicates(context.Background(), []string{dir}, WithWorkers(workers), WithReadCounter(&read))
+				if err != nil {
+					b.Fatal(err)
+				}
+				if len(groups) == 0 {
+					b.Fatal("дубликаты не найдены")
+				}
+			}
+			b.ReportMetric(float64(read)/float64(b.N), "read-B/op")
+		})
+	}
+}
+
+// BenchmarkFindDuplicatesPartial сравнивает поиск среди больших файлов одного размера
+// с предварительным хэшем начала и конца и без него: read-B/op показывает, сколько
+// байт прочитано за прогон.
+func BenchmarkFindDuplicatesPartial(b *testing.B) {
+	const size, count = 4 << 20, 8
+	cases := []struct {
+		name string
+		tail func(i int) byte // Последний байт i-го файла
+	}{
+		{"различаются концом", func(i int) byte { return byte('a' + i) }},
+		{"одинаковые", func(int) byte { return 'a' }},
+	}
+	for _, c := range cases {
+		dir := b.TempDir()
+		data := bytes.Repeat([]byte("0123456789abcdef"), size/16)
+		for i := 0; i < count; i++ {
+			data[len(data)-1] = c.tail(i)
+			if err := os.WriteFile(filepath.Join(dir, fmt.Sprintf("big%d.bin", i)), data, 0644); err != nil {
+				b.Fatal(err)
+			}
+		}
+		for _, quick := range []bool{false, true} {
+			b.Run(fmt.Sprintf("%s/quick=%v", c.name, quick), func(b *testing.B) {
+				var read int64
+				opts := []Option{WithReadCounter(&read)}
+				if quick {
+					opts = append(opts, WithQuick())
+				}
+				b.ResetTimer()
+				for i := 0; i < b.N; i++ {
+					if _, _, err := FindDuplicates(context.Background(), []string{dir}, opts...); err != nil {
+						b.Fatal(err)
+					}
+				}
+				b.ReportMetric(float64(read)/float64(b.N), "read-B/op")
+			})
+		}
+	}
+}
+
+// BenchmarkHashAlgorithms сравнивает алгоритмы WithHash на одном файле: с b.SetBytes
+// вывод показывает пропускную способность каждого алгоритма в MB/s.
+func BenchmarkHashAlgorithms(b *testing.B) {
+	const size = 8 << 20
+	path := filepath.Join(b.TempDir(), "data.bin")
+	if err := os.WriteFile(path, bytes.Repeat([]byte("0123456789abcdef"), size/16), 0644); err != nil {
+		b.Fatal(err)
+	}
+	for _, alg := range HashAlgorithms {
+		b.Run("hash="+alg, func(b *testing.B) {
+			b.SetBytes(size)
+			for i := 0; i < b.N; i++ {
+				if _, err := HashFile(context.Background(), path, WithHash(alg)); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
+
+func BenchmarkHashPartial(b *testing.B) {
+	path := filepath.Join(b.TempDir(), "big.bin")
+	if err := os.WriteFile(path, bytes.Repeat([]byte{'x'}, 64<<20), 0644); err != nil {
+		b.Fatal(err)
+	}
+	c := newConfig(nil)
+	for _, mode := range []string{"partial", "full"} {
+		b.Run(mode, func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				var err error
+				if mode == "partial" {
+					_, err = c.hashPartial(path, 64<<20)
+				} else {
+					_, err = c.hashFile(context.Background(), path)
+				}
+				if err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
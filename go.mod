@@ -0,0 +1,9 @@
+module github.com/KiraLYG/Portfolio
+
+go 1.23.0
+
+require (
+	github.com/gorilla/websocket v1.5.3
+	golang.org/x/crypto v0.40.0
+	golang.org/x/text v0.28.0
+)